@@ -0,0 +1,135 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"strings"
+)
+
+// Groupings supported by aggregate queries.
+const (
+	GroupByCountry = "country"
+	GroupByCity    = "city"
+	GroupByRegion  = "region"
+	GroupByService = "service"
+	GroupByVersion = "version"
+	// GroupByWeek groups heartbeats by the week they were sent in, see BucketStart.
+	GroupByWeek = "week"
+)
+
+// Metrics supported by aggregate queries.
+const (
+	// MetricDeployments counts distinct deployments.
+	MetricDeployments = "deployments"
+	// MetricHeartbeats counts heartbeats.
+	MetricHeartbeats = "heartbeats"
+)
+
+const (
+	// maxGroupBy is the maximum number of groupings of an aggregate query.
+	maxGroupBy = 2
+	// MaxAggregateTop is the maximum number of rows of an aggregate query.
+	MaxAggregateTop = 1000
+)
+
+var (
+	groupings = map[string]bool{
+		GroupByCountry: true,
+		GroupByCity:    true,
+		GroupByRegion:  true,
+		GroupByService: true,
+		GroupByVersion: true,
+		GroupByWeek:    true,
+	}
+	metrics = map[string]bool{
+		MetricDeployments: true,
+		MetricHeartbeats:  true,
+	}
+)
+
+// ErrInvalidAggregateQuery indicates an unsupported grouping, metric or order.
+var ErrInvalidAggregateQuery = errors.New("invalid aggregate query")
+
+// AggregateQuery specifies how heartbeats are grouped and measured.
+type AggregateQuery struct {
+	// GroupBy are one or two distinct groupings.
+	GroupBy []string
+	// Metrics are distinct metrics, the first one if empty.
+	Metrics []string
+	// Order is a grouping or a metric of the query, prefixed with a minus
+	// for descending order. Rows are ordered by the first metric, descending,
+	// if it is empty, and then by their groups.
+	Order string
+	// Top is the maximum number of rows, MaxAggregateTop if zero.
+	Top int
+}
+
+// Validate checks the query only uses supported groupings and metrics.
+func (q AggregateQuery) Validate() error {
+	if len(q.GroupBy) == 0 || len(q.GroupBy) > maxGroupBy || q.Top < 0 || q.Top > MaxAggregateTop {
+		return ErrInvalidAggregateQuery
+	}
+	if !distinctIn(q.GroupBy, groupings) || !distinctIn(q.Metrics, metrics) {
+		return ErrInvalidAggregateQuery
+	}
+	if q.Order == "" {
+		return nil
+	}
+	order, _ := q.OrderBy()
+	for _, fields := range [][]string{q.WithDefaults().Metrics, q.GroupBy} {
+		for _, f := range fields {
+			if f == order {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidAggregateQuery
+}
+
+// WithDefaults sets the default metrics, order and number of rows.
+func (q AggregateQuery) WithDefaults() AggregateQuery {
+	if len(q.Metrics) == 0 {
+		q.Metrics = []string{MetricDeployments}
+	}
+	if q.Order == "" {
+		q.Order = "-" + q.Metrics[0]
+	}
+	if q.Top == 0 {
+		q.Top = MaxAggregateTop
+	}
+	return q
+}
+
+// OrderBy returns the grouping or metric rows are ordered by, and whether
+// the order is descending, for a query with defaults set.
+func (q AggregateQuery) OrderBy() (string, bool) {
+	return strings.TrimPrefix(q.Order, "-"), strings.HasPrefix(q.Order, "-")
+}
+
+// AggregateRow is a single group of heartbeats.
+type AggregateRow struct {
+	// Groups are the values of the groupings in the order of the query. Weeks
+	// are formatted as RFC 3339 times.
+	Groups []string
+	// Metrics are the values of the metrics in the order of the query.
+	Metrics []int
+}
+
+// Aggregate is the result of an aggregate query.
+type Aggregate struct {
+	AggregateQuery
+	Rows []AggregateRow
+}
+
+func distinctIn(values []string, allowed map[string]bool) bool {
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !allowed[v] || seen[v] {
+			return false
+		}
+		seen[v] = true
+	}
+	return true
+}
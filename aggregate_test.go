@@ -0,0 +1,36 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateQueryValidate(t *testing.T) {
+	cases := []struct {
+		desc string
+		q    callhome.AggregateQuery
+		err  error
+	}{
+		{desc: "single grouping", q: callhome.AggregateQuery{GroupBy: []string{"country"}}},
+		{desc: "two groupings and metrics", q: callhome.AggregateQuery{GroupBy: []string{"region", "week"}, Metrics: []string{"heartbeats", "deployments"}, Order: "-heartbeats", Top: 10}},
+		{desc: "order by grouping", q: callhome.AggregateQuery{GroupBy: []string{"week"}, Order: "week"}},
+		{desc: "order by default metric", q: callhome.AggregateQuery{GroupBy: []string{"version"}, Order: "deployments"}},
+		{desc: "no grouping", q: callhome.AggregateQuery{}, err: callhome.ErrInvalidAggregateQuery},
+		{desc: "three groupings", q: callhome.AggregateQuery{GroupBy: []string{"country", "city", "week"}}, err: callhome.ErrInvalidAggregateQuery},
+		{desc: "repeated grouping", q: callhome.AggregateQuery{GroupBy: []string{"city", "city"}}, err: callhome.ErrInvalidAggregateQuery},
+		{desc: "unknown grouping", q: callhome.AggregateQuery{GroupBy: []string{"ip_address"}}, err: callhome.ErrInvalidAggregateQuery},
+		{desc: "unknown metric", q: callhome.AggregateQuery{GroupBy: []string{"city"}, Metrics: []string{"COUNT(*)"}}, err: callhome.ErrInvalidAggregateQuery},
+		{desc: "order by other metric", q: callhome.AggregateQuery{GroupBy: []string{"city"}, Order: "-heartbeats"}, err: callhome.ErrInvalidAggregateQuery},
+		{desc: "too many rows", q: callhome.AggregateQuery{GroupBy: []string{"city"}, Top: callhome.MaxAggregateTop + 1}, err: callhome.ErrInvalidAggregateQuery},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.q.Validate())
+		})
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Alert kinds.
+const (
+	// AlertRateDrop indicates far fewer heartbeats than the baseline.
+	AlertRateDrop = "rate_drop"
+	// AlertRateSpike indicates far more heartbeats than the baseline.
+	AlertRateSpike = "rate_spike"
+	// AlertFastClient indicates a deployment reporting far more often than
+	// the heartbeat interval.
+	AlertFastClient = "fast_client"
+)
+
+// DimensionDeployment is the dimension of alerts about a single deployment.
+const DimensionDeployment = "deployment"
+
+// monitoredDimensions are the groupings the heartbeat rate is monitored by.
+var monitoredDimensions = []string{GroupByVersion, GroupByService, GroupByCountry}
+
+// ErrInvalidAnomalyConfig indicates a malformed anomaly monitor configuration.
+var ErrInvalidAnomalyConfig = errors.New("invalid anomaly monitor configuration")
+
+// AnomalyConfig configures the anomaly monitor.
+type AnomalyConfig struct {
+	// Interval is how often heartbeats are checked.
+	Interval time.Duration `env:"ANOMALY_INTERVAL"         envDefault:"15m"`
+	// Window is the period the current heartbeat rate is measured over.
+	Window time.Duration `env:"ANOMALY_WINDOW"           envDefault:"1h"`
+	// Baseline is the period preceding the window the baseline rate is
+	// measured over.
+	Baseline time.Duration `env:"ANOMALY_BASELINE"         envDefault:"168h"`
+	// DropRatio is the fraction of the baseline rate below which a drop is
+	// reported.
+	DropRatio float64 `env:"ANOMALY_DROP_RATIO"       envDefault:"0.5"`
+	// SpikeRatio is the multiple of the baseline rate above which a spike is
+	// reported.
+	SpikeRatio float64 `env:"ANOMALY_SPIKE_RATIO"      envDefault:"3"`
+	// MinHeartbeats is the number of heartbeats expected in the window below
+	// which deviations are ignored as noise.
+	MinHeartbeats float64 `env:"ANOMALY_MIN_HEARTBEATS"   envDefault:"20"`
+	// FastCadence is the mean heartbeat interval below which a deployment is
+	// considered misconfigured.
+	FastCadence time.Duration `env:"ANOMALY_FAST_CADENCE"     envDefault:"10m"`
+}
+
+// Validate checks the periods are positive and the ratios bound the baseline.
+func (cfg AnomalyConfig) Validate() error {
+	if cfg.Interval <= 0 || cfg.Window <= 0 || cfg.Baseline < cfg.Window || cfg.FastCadence <= 0 {
+		return ErrInvalidAnomalyConfig
+	}
+	if cfg.DropRatio <= 0 || cfg.DropRatio >= 1 || cfg.SpikeRatio <= 1 || cfg.MinHeartbeats < 0 {
+		return ErrInvalidAnomalyConfig
+	}
+	return nil
+}
+
+// Alert is a detected anomaly. Rates are in heartbeats per hour.
+type Alert struct {
+	Kind string `json:"kind"`
+	// Dimension is a grouping the rate is monitored by, or
+	// DimensionDeployment for fast clients.
+	Dimension string `json:"dimension"`
+	// Value is the group, or the deployment ID for fast clients.
+	Value    string  `json:"value"`
+	Rate     float64 `json:"rate"`
+	Baseline float64 `json:"baseline"`
+	// Time is the end of the window the anomaly was detected in.
+	Time time.Time `json:"time"`
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s of %s %q: %.1f heartbeats per hour, baseline %.1f", a.Kind, a.Dimension, a.Value, a.Rate, a.Baseline)
+}
+
+func (a Alert) key() string {
+	return a.Kind + "/" + a.Dimension + "/" + a.Value
+}
+
+// Notifier delivers alerts, for example to a chat or an on-call system.
+type Notifier interface {
+	// Notify delivers the alerts. Alerts that failed to be delivered are
+	// raised again on the next check.
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// NotifierFunc is an adapter to use a function as a Notifier.
+type NotifierFunc func(ctx context.Context, alerts []Alert) error
+
+// Notify calls f.
+func (f NotifierFunc) Notify(ctx context.Context, alerts []Alert) error {
+	return f(ctx, alerts)
+}
+
+// AnomalyMonitor compares the heartbeat rate per version, service and
+// country with its baseline, and looks for deployments reporting too often.
+type AnomalyMonitor struct {
+	repo     TelemetryRepo
+	notifier Notifier
+	cfg      AnomalyConfig
+
+	mu sync.Mutex
+	// active are the anomalies already raised, which are not raised again
+	// until they are resolved.
+	active map[string]bool
+}
+
+// NewAnomalyMonitor creates a monitor of the repository heartbeats.
+func NewAnomalyMonitor(repo TelemetryRepo, notifier Notifier, cfg AnomalyConfig) (*AnomalyMonitor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &AnomalyMonitor{
+		repo:     repo,
+		notifier: notifier,
+		cfg:      cfg,
+		active:   make(map[string]bool),
+	}, nil
+}
+
+// Interval is how often the monitor should be checked.
+func (m *AnomalyMonitor) Interval() time.Duration {
+	return m.cfg.Interval
+}
+
+// Check detects the anomalies in the window ending now and notifies the
+// ones that were not raised by previous checks.
+func (m *AnomalyMonitor) Check(ctx context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts, err := m.Detect(ctx, now)
+	if err != nil {
+		return err
+	}
+	active := make(map[string]bool, len(alerts))
+	var raised []Alert
+	for _, a := range alerts {
+		active[a.key()] = true
+		if !m.active[a.key()] {
+			raised = append(raised, a)
+		}
+	}
+	if len(raised) > 0 {
+		if err := m.notifier.Notify(ctx, raised); err != nil {
+			for _, a := range raised {
+				delete(active, a.key())
+			}
+			m.active = active
+			return err
+		}
+	}
+	m.active = active
+	return nil
+}
+
+// Detect gets all anomalies in the window ending now, ordered by kind,
+// dimension and value.
+func (m *AnomalyMonitor) Detect(ctx context.Context, now time.Time) ([]Alert, error) {
+	var alerts []Alert
+	for _, dim := range monitoredDimensions {
+		as, err := m.detectDeviations(ctx, dim, now)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, as...)
+	}
+	as, err := m.detectFastClients(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	alerts = append(alerts, as...)
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Kind != alerts[j].Kind {
+			return alerts[i].Kind < alerts[j].Kind
+		}
+		if alerts[i].Dimension != alerts[j].Dimension {
+			return alerts[i].Dimension < alerts[j].Dimension
+		}
+		return alerts[i].Value < alerts[j].Value
+	})
+	return alerts, nil
+}
+
+// detectDeviations compares the heartbeats of each group in the window with
+// the baseline rate. Groups without a baseline, such as new versions, are
+// not anomalies.
+func (m *AnomalyMonitor) detectDeviations(ctx context.Context, dim string, now time.Time) ([]Alert, error) {
+	start := now.Add(-m.cfg.Window)
+	current, err := m.heartbeats(ctx, dim, TelemetryFilters{From: start, To: now})
+	if err != nil {
+		return nil, err
+	}
+	// The baseline ends just before the window so no heartbeat is counted twice.
+	baseline, err := m.heartbeats(ctx, dim, TelemetryFilters{From: start.Add(-m.cfg.Baseline), To: start.Add(-time.Nanosecond)})
+	if err != nil {
+		return nil, err
+	}
+
+	windowHours := m.cfg.Window.Hours()
+	var alerts []Alert
+	for value, n := range baseline {
+		// The number of heartbeats expected in the window at the baseline rate.
+		expected := float64(n) * float64(m.cfg.Window) / float64(m.cfg.Baseline)
+		if expected < m.cfg.MinHeartbeats {
+			continue
+		}
+		got := float64(current[value])
+		a := Alert{Dimension: dim, Value: value, Rate: got / windowHours, Baseline: expected / windowHours, Time: now}
+		switch {
+		case got < expected*m.cfg.DropRatio:
+			a.Kind = AlertRateDrop
+		case got > expected*m.cfg.SpikeRatio:
+			a.Kind = AlertRateSpike
+		default:
+			continue
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, nil
+}
+
+func (m *AnomalyMonitor) heartbeats(ctx context.Context, dim string, filters TelemetryFilters) (map[string]int, error) {
+	q := AggregateQuery{GroupBy: []string{dim}, Metrics: []string{MetricHeartbeats}}
+	rows, err := m.repo.RetrieveAggregate(ctx, q, filters)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]int, len(rows))
+	for _, r := range rows {
+		ret[r.Groups[0]] = r.Metrics[0]
+	}
+	return ret, nil
+}
+
+// detectFastClients finds the deployments with a client whose mean heartbeat
+// interval in the window is below the fast cadence. Each service reports on
+// its own, so cadences are not comparable across the services of a
+// deployment. At least three heartbeats are needed to tell a fast client from
+// a restart. A deployment is reported once, at the rate of its fastest client.
+func (m *AnomalyMonitor) detectFastClients(ctx context.Context, now time.Time) ([]Alert, error) {
+	seen, err := m.repo.RetrieveClientsSeen(ctx, TelemetryFilters{From: now.Add(-m.cfg.Window), To: now})
+	if err != nil {
+		return nil, err
+	}
+	windowHours := m.cfg.Window.Hours()
+	var alerts []Alert
+	fastest := make(map[string]int)
+	for _, c := range seen {
+		if c.Heartbeats < 3 || c.Cadence() >= m.cfg.FastCadence {
+			continue
+		}
+		rate := float64(c.Heartbeats) / windowHours
+		if i, ok := fastest[c.DeploymentID]; ok {
+			alerts[i].Rate = max(alerts[i].Rate, rate)
+			continue
+		}
+		fastest[c.DeploymentID] = len(alerts)
+		alerts = append(alerts, Alert{
+			Kind:      AlertFastClient,
+			Dimension: DimensionDeployment,
+			Value:     c.DeploymentID,
+			Rate:      rate,
+			Baseline:  float64(time.Hour) / float64(HeartbeatInterval),
+			Time:      now,
+		})
+	}
+	return alerts, nil
+}
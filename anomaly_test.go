@@ -0,0 +1,191 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+var anomalyCfg = callhome.AnomalyConfig{
+	Interval:      time.Minute,
+	Window:        time.Hour,
+	Baseline:      24 * time.Hour,
+	DropRatio:     0.5,
+	SpikeRatio:    3,
+	MinHeartbeats: 4,
+	FastCadence:   10 * time.Minute,
+}
+
+func TestAnomalyConfigValidate(t *testing.T) {
+	cases := []struct {
+		desc   string
+		modify func(cfg *callhome.AnomalyConfig)
+		err    error
+	}{
+		{"valid", func(cfg *callhome.AnomalyConfig) {}, nil},
+		{"zero interval", func(cfg *callhome.AnomalyConfig) { cfg.Interval = 0 }, callhome.ErrInvalidAnomalyConfig},
+		{"baseline shorter than window", func(cfg *callhome.AnomalyConfig) { cfg.Baseline = time.Minute }, callhome.ErrInvalidAnomalyConfig},
+		{"drop ratio above one", func(cfg *callhome.AnomalyConfig) { cfg.DropRatio = 1.5 }, callhome.ErrInvalidAnomalyConfig},
+		{"spike ratio below one", func(cfg *callhome.AnomalyConfig) { cfg.SpikeRatio = 0.5 }, callhome.ErrInvalidAnomalyConfig},
+		{"zero fast cadence", func(cfg *callhome.AnomalyConfig) { cfg.FastCadence = 0 }, callhome.ErrInvalidAnomalyConfig},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			cfg := anomalyCfg
+			c.modify(&cfg)
+			assert.Equal(t, c.err, cfg.Validate())
+		})
+	}
+}
+
+func TestAnomalyMonitor(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	repo := memory.New()
+	beats := func(ip, svc, version, country string, last time.Time, every time.Duration, n int) {
+		for k := 0; k < n; k++ {
+			at := last.Add(-time.Duration(k) * every)
+			assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: svc, Version: version, Country: country, ServiceTime: at}))
+		}
+	}
+	for i := 0; i < 8; i++ {
+		// Reporting half-hourly, until three hours from now.
+		beats(fmt.Sprintf("10.0.0.%d", i), "users", "0.14.0", "Serbia", now.Add(3*time.Hour-5*time.Minute), callhome.HeartbeatInterval, 58)
+		// Stopped reporting three hours ago.
+		beats(fmt.Sprintf("10.0.1.%d", i), "things", "0.13.0", "France", now.Add(-3*time.Hour), callhome.HeartbeatInterval, 48)
+	}
+	// Reporting every minute since it was deployed.
+	beats("10.0.2.1", "bootstrap", "0.15.0", "Germany", now, time.Minute, 50)
+
+	_, err := callhome.NewAnomalyMonitor(repo, nil, callhome.AnomalyConfig{})
+	assert.ErrorIs(t, err, callhome.ErrInvalidAnomalyConfig)
+
+	baseline := 8 * 45 / 24.0
+	want := []callhome.Alert{
+		{Kind: callhome.AlertFastClient, Dimension: callhome.DimensionDeployment, Value: deploymentIDs(t, repo)["10.0.2.1"], Rate: 50, Baseline: 2, Time: now},
+		{Kind: callhome.AlertRateDrop, Dimension: callhome.GroupByCountry, Value: "France", Baseline: baseline, Time: now},
+		{Kind: callhome.AlertRateDrop, Dimension: callhome.GroupByService, Value: "things", Baseline: baseline, Time: now},
+		{Kind: callhome.AlertRateDrop, Dimension: callhome.GroupByVersion, Value: "0.13.0", Baseline: baseline, Time: now},
+	}
+
+	t.Run("detect", func(t *testing.T) {
+		m, err := callhome.NewAnomalyMonitor(repo, nil, anomalyCfg)
+		assert.Nil(t, err)
+		alerts, err := m.Detect(ctx, now)
+		assert.Nil(t, err)
+		assert.InDeltaSlice(t, rates(want), rates(alerts), 1e-9)
+		assert.Equal(t, withoutRates(want), withoutRates(alerts))
+	})
+
+	t.Run("spike", func(t *testing.T) {
+		spikeRepo := memory.New()
+		for k := 0; k < 24; k++ {
+			assert.Nil(t, spikeRepo.Save(ctx, callhome.Telemetry{IpAddress: fmt.Sprintf("10.0.3.%d", k), Service: "users", Version: "0.14.0", Country: "Serbia", ServiceTime: now.Add(-time.Duration(k+2) * time.Hour)}))
+		}
+		for k := 0; k < 20; k++ {
+			assert.Nil(t, spikeRepo.Save(ctx, callhome.Telemetry{IpAddress: fmt.Sprintf("10.0.4.%d", k), Service: "users", Version: "0.14.0", Country: "Serbia", ServiceTime: now.Add(-time.Duration(k) * time.Minute)}))
+		}
+		m, err := callhome.NewAnomalyMonitor(spikeRepo, nil, callhome.AnomalyConfig{
+			Interval: time.Minute, Window: time.Hour, Baseline: 24 * time.Hour, DropRatio: 0.5, SpikeRatio: 3, MinHeartbeats: 0.5, FastCadence: 10 * time.Minute,
+		})
+		assert.Nil(t, err)
+		alerts, err := m.Detect(ctx, now)
+		assert.Nil(t, err)
+		if assert.Len(t, alerts, 3) {
+			assert.Equal(t, callhome.AlertRateSpike, alerts[0].Kind)
+			assert.Equal(t, float64(20), alerts[0].Rate)
+			assert.Equal(t, float64(1), alerts[0].Baseline)
+		}
+	})
+
+	t.Run("services of a deployment", func(t *testing.T) {
+		servicesRepo := memory.New()
+		save := func(ip, svc string, last time.Time, every time.Duration, n int) {
+			for k := 0; k < n; k++ {
+				assert.Nil(t, servicesRepo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: svc, Version: "0.14.0", Country: "Serbia", ServiceTime: last.Add(-time.Duration(k) * every)}))
+			}
+		}
+		// Five services reporting half-hourly, six minutes apart, together
+		// report every six minutes.
+		for i, svc := range []string{"users", "things", "bootstrap", "certs", "provision"} {
+			save("10.0.5.1", svc, now.Add(-time.Duration(i)*6*time.Minute), callhome.HeartbeatInterval, 6)
+		}
+		// A service reporting every two minutes, next to a half-hourly one.
+		save("10.0.5.2", "users", now, callhome.HeartbeatInterval, 6)
+		save("10.0.5.2", "things", now, 2*time.Minute, 30)
+
+		m, err := callhome.NewAnomalyMonitor(servicesRepo, nil, anomalyCfg)
+		assert.Nil(t, err)
+		alerts, err := m.Detect(ctx, now)
+		assert.Nil(t, err)
+		var fast []callhome.Alert
+		for _, a := range alerts {
+			if a.Kind == callhome.AlertFastClient {
+				fast = append(fast, a)
+			}
+		}
+		assert.Equal(t, []callhome.Alert{
+			{Kind: callhome.AlertFastClient, Dimension: callhome.DimensionDeployment, Value: deploymentIDs(t, servicesRepo)["10.0.5.2"], Rate: 30, Baseline: 2, Time: now},
+		}, fast)
+	})
+
+	t.Run("check", func(t *testing.T) {
+		var notified [][]callhome.Alert
+		fail := true
+		notifier := callhome.NotifierFunc(func(_ context.Context, alerts []callhome.Alert) error {
+			notified = append(notified, alerts)
+			if fail {
+				return fmt.Errorf("unavailable")
+			}
+			return nil
+		})
+		m, err := callhome.NewAnomalyMonitor(repo, notifier, anomalyCfg)
+		assert.Nil(t, err)
+
+		assert.NotNil(t, m.Check(ctx, now))
+		fail = false
+		// Alerts that failed to be delivered are raised again.
+		assert.Nil(t, m.Check(ctx, now))
+		// Active alerts are not raised again.
+		assert.Nil(t, m.Check(ctx, now))
+		if assert.Len(t, notified, 2) {
+			assert.Len(t, notified[0], len(want))
+			assert.Len(t, notified[1], len(want))
+		}
+
+		// The fast client is silent an hour later, while the drop persists.
+		assert.Nil(t, m.Check(ctx, now.Add(2*time.Hour)))
+		assert.Len(t, notified, 2)
+		// The fast client is raised again once it starts flooding again.
+		beats("10.0.2.1", "bootstrap", "0.15.0", "Germany", now.Add(3*time.Hour), time.Minute, 30)
+		assert.Nil(t, m.Check(ctx, now.Add(3*time.Hour)))
+		if assert.Len(t, notified, 3) && assert.Len(t, notified[2], 1) {
+			assert.Equal(t, callhome.AlertFastClient, notified[2][0].Kind)
+		}
+	})
+}
+
+func rates(alerts []callhome.Alert) []float64 {
+	var ret []float64
+	for _, a := range alerts {
+		ret = append(ret, a.Rate, a.Baseline)
+	}
+	return ret
+}
+
+func withoutRates(alerts []callhome.Alert) []callhome.Alert {
+	ret := make([]callhome.Alert, len(alerts))
+	for i, a := range alerts {
+		a.Rate, a.Baseline = 0, 0
+		ret[i] = a
+	}
+	return ret
+}
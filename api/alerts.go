@@ -0,0 +1,60 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+// MonitorAnomalies checks the monitor at its interval until the context is done.
+func MonitorAnomalies(ctx context.Context, m *callhome.AnomalyMonitor, logger *slog.Logger) error {
+	ticker := time.NewTicker(m.Interval())
+	defer ticker.Stop()
+	for {
+		if err := m.Check(ctx, time.Now()); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to check for anomalies: %s.", err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// LoggingNotifier is a notifier that logs alerts as warnings.
+func LoggingNotifier(logger *slog.Logger) callhome.Notifier {
+	return callhome.NotifierFunc(func(_ context.Context, alerts []callhome.Alert) error {
+		for _, a := range alerts {
+			logger.Warn(fmt.Sprintf("Anomaly detected: %s.", a),
+				slog.String("kind", a.Kind),
+				slog.String("dimension", a.Dimension),
+				slog.String("value", a.Value),
+			)
+		}
+		return nil
+	})
+}
+
+// PublishMilestones checks for fleet milestones at the webhooks milestone
+// interval until the context is done.
+func PublishMilestones(ctx context.Context, hooks *callhome.Webhooks, logger *slog.Logger) error {
+	ticker := time.NewTicker(hooks.MilestoneInterval())
+	defer ticker.Stop()
+	for {
+		if err := hooks.CheckMilestones(ctx); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to check for milestones: %s.", err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
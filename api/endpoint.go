@@ -5,6 +5,10 @@ package api
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/absmach/callhome"
 	"github.com/go-kit/kit/endpoint"
@@ -19,6 +23,7 @@ func saveEndpoint(svc callhome.Service) endpoint.Endpoint {
 		tel := callhome.Telemetry{
 			Service:     req.Service,
 			IpAddress:   req.IpAddress,
+			MacAddress:  req.MacAddress,
 			Version:     req.Version,
 			ServiceTime: req.LastSeen,
 		}
@@ -39,17 +44,12 @@ func retrieveEndpoint(svc callhome.Service) endpoint.Endpoint {
 			return nil, err
 		}
 		pm := callhome.PageMetadata{
-			Offset: req.offset,
-			Limit:  req.limit,
-		}
-		filter := callhome.TelemetryFilters{
-			From:    req.from,
-			To:      req.to,
-			Country: req.country,
-			City:    req.city,
-			Version: req.version,
-			Service: req.service,
+			Offset:        req.offset,
+			Limit:         req.limit,
+			Cursor:        req.cursor,
+			EstimateTotal: req.total == totalEstimate,
 		}
+		filter := req.filters()
 		tm, err := svc.Retrieve(ctx, pm, filter)
 		if err != nil {
 			return nil, err
@@ -61,6 +61,8 @@ func retrieveEndpoint(svc callhome.Service) endpoint.Endpoint {
 				Limit:  tm.Limit,
 			},
 			Telemetry: tm.Telemetry,
+			Next:      tm.Next,
+			Prev:      tm.Prev,
 		}
 		return res, nil
 	}
@@ -68,19 +70,12 @@ func retrieveEndpoint(svc callhome.Service) endpoint.Endpoint {
 
 func retrieveSummaryEndpoint(svc callhome.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		req := request.(listTelemetryReq)
+		req := request.(summaryReq)
 		if err := req.validate(); err != nil {
 			return nil, err
 		}
-		filter := callhome.TelemetryFilters{
-			From:    req.from,
-			To:      req.to,
-			Country: req.country,
-			City:    req.city,
-			Version: req.version,
-			Service: req.service,
-		}
-		summary, err := svc.RetrieveSummary(ctx, filter)
+		filter := req.filters()
+		summary, err := svc.RetrieveSummary(ctx, req.query(), filter)
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +84,12 @@ func retrieveSummaryEndpoint(svc callhome.Service) endpoint.Endpoint {
 			Cities:           summary.Cities,
 			Services:         summary.Services,
 			Versions:         summary.Versions,
+			CityCounts:       summary.CityCounts,
+			ServiceCounts:    summary.ServiceCounts,
+			VersionCounts:    summary.VersionCounts,
+			Distinct:         summary.Distinct,
 			TotalDeployments: summary.TotalDeployments,
+			Comparison:       summary.Comparison,
 		}, nil
 	}
 }
@@ -100,17 +100,329 @@ func serveUI(svc callhome.Service) endpoint.Endpoint {
 		if err := req.validate(); err != nil {
 			return nil, err
 		}
-		filter := callhome.TelemetryFilters{
-			From:    req.from,
-			To:      req.to,
-			Country: req.country,
-			City:    req.city,
-			Version: req.version,
-			Service: req.service,
-		}
+		filter := req.filters()
 		res, err := svc.ServeUI(ctx, filter)
 		return uiRes{
 			html: res,
 		}, err
 	}
 }
+
+func retrievePoliciesEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (response interface{}, err error) {
+		policies, err := svc.RetrievePolicies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newPoliciesRes(policies), nil
+	}
+}
+
+func retrieveTimeSeriesEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(timeSeriesReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		q := callhome.TimeSeriesQuery{
+			Interval: req.interval,
+			SplitBy:  req.splitBy,
+		}
+		filter := req.filters()
+		ts, err := svc.RetrieveTimeSeries(ctx, q, filter)
+		if err != nil {
+			return nil, err
+		}
+		return timeSeriesRes{
+			Interval: ts.Interval,
+			SplitBy:  ts.SplitBy,
+			Buckets:  ts.Buckets,
+		}, nil
+	}
+}
+
+func retrieveVersionAnalyticsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := req.filters()
+		va, err := svc.RetrieveVersionAnalytics(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		return newVersionAnalyticsRes(va), nil
+	}
+}
+
+func retrieveAggregateEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(aggregateReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := req.filters()
+		a, err := svc.RetrieveAggregate(ctx, req.query(), filter)
+		if err != nil {
+			return nil, err
+		}
+		return newAggregateRes(a), nil
+	}
+}
+
+func retrieveServiceCompositionEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listTelemetryReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := req.filters()
+		sc, err := svc.RetrieveServiceComposition(ctx, int(req.limit), filter)
+		if err != nil {
+			return nil, err
+		}
+		return newServiceCompositionRes(sc), nil
+	}
+}
+
+func retrieveVersionTransitionsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(transitionsReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := req.filters()
+		vt, err := svc.RetrieveVersionTransitions(ctx, req.interval, filter)
+		if err != nil {
+			return nil, err
+		}
+		return newTransitionsRes(vt), nil
+	}
+}
+
+func retrieveRetentionEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(retentionReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		q := callhome.RetentionQuery{
+			Interval:         req.interval,
+			InactivityWindow: req.window,
+		}
+		filter := req.filters()
+		r, err := svc.RetrieveRetention(ctx, q, filter)
+		if err != nil {
+			return nil, err
+		}
+		return newRetentionRes(r), nil
+	}
+}
+
+func retrieveSilentDeploymentsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(silentReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := req.filters()
+		// The lookback of the query replaces the time range.
+		filter.From, filter.To = time.Time{}, time.Time{}
+		sd, err := svc.RetrieveSilentDeployments(ctx, req.query(), filter)
+		if err != nil {
+			return nil, err
+		}
+		return newSilentDeploymentsRes(sd, req.offset, req.limit), nil
+	}
+}
+
+func exportTelemetryEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(exportReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		q := req.query()
+		filter := req.filters()
+		// The telemetry is exported while the response is encoded, so it is
+		// streamed to the client instead of being held in memory.
+		res := exportRes{
+			query:    q,
+			filename: fmt.Sprintf("callhome-%s-%s.%s", q.Rows, time.Now().UTC().Format("20060102T150405Z"), q.Format),
+			export: func(ctx context.Context, w io.Writer) error {
+				return svc.ExportTelemetry(ctx, q, filter, w)
+			},
+		}
+		return res, nil
+	}
+}
+
+func retrieveMapPointsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(mapPointsReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := req.filters()
+		mp, err := svc.RetrieveMapPoints(ctx, req.query(), filter)
+		if err != nil {
+			return nil, err
+		}
+		return newMapPointsRes(mp), nil
+	}
+}
+
+func retrieveDeploymentEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deploymentReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		filter := callhome.TelemetryFilters{
+			From: req.from,
+			To:   req.to,
+		}
+		d, err := svc.RetrieveDeployment(ctx, req.id, filter)
+		if err != nil {
+			return nil, err
+		}
+		return newDeploymentRes(d), nil
+	}
+}
+
+func createWebhookEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(createWebhookReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		w, err := svc.CreateWebhook(ctx, callhome.Webhook{
+			URL:    req.URL,
+			Secret: req.Secret,
+			Events: req.Events,
+		})
+		if err != nil {
+			return nil, err
+		}
+		res := newWebhookRes(w)
+		res.Secret = w.Secret
+		res.created = true
+		return res, nil
+	}
+}
+
+func retrieveWebhooksEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (response interface{}, err error) {
+		hooks, err := svc.RetrieveWebhooks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res := webhooksRes{Webhooks: []webhookRes{}}
+		for _, w := range hooks {
+			res.Webhooks = append(res.Webhooks, newWebhookRes(w))
+		}
+		return res, nil
+	}
+}
+
+func removeWebhookEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		if err := svc.RemoveWebhook(ctx, req.id); err != nil {
+			return nil, err
+		}
+		return removeWebhookRes{}, nil
+	}
+}
+
+func retrieveWebhookDeliveriesEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookDeliveriesReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		ds, err := svc.RetrieveWebhookDeliveries(ctx, req.id, int(req.limit))
+		if err != nil {
+			return nil, err
+		}
+		res := deliveriesRes{Deliveries: []deliveryRes{}}
+		for _, d := range ds {
+			res.Deliveries = append(res.Deliveries, deliveryRes{Delivery: d, Succeeded: d.Succeeded()})
+		}
+		return res, nil
+	}
+}
+
+func grafanaSearchEndpoint() endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(grafanaSearchReq)
+		res := grafanaSearchRes{}
+		for _, t := range grafanaTargets {
+			if strings.Contains(t, req.Target) {
+				res = append(res, t)
+			}
+		}
+		return res, nil
+	}
+}
+
+func grafanaQueryEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(grafanaQueryReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		res := grafanaQueryRes{}
+		for _, t := range req.Targets {
+			if t.Hide {
+				continue
+			}
+			table, split, _ := t.split()
+			if table {
+				s, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{}, t.filters(req.Range))
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, newGrafanaTable(t, split, s))
+				continue
+			}
+			q := callhome.TimeSeriesQuery{Interval: req.interval(), SplitBy: split}
+			ts, err := svc.RetrieveTimeSeries(ctx, q, t.filters(req.Range))
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range newGrafanaSeries(t, ts) {
+				res = append(res, s)
+			}
+		}
+		return res, nil
+	}
+}
+
+func grafanaAnnotationsEndpoint(svc callhome.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(grafanaAnnotationsReq)
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		versions, err := svc.RetrieveNewVersions(ctx, callhome.TelemetryFilters{From: req.Range.From, To: req.Range.To})
+		if err != nil {
+			return nil, err
+		}
+		res := grafanaAnnotationsRes{}
+		for _, v := range versions {
+			res = append(res, grafanaAnnotationRes{
+				Annotation: req.Annotation,
+				Time:       v.FirstSeen.UnixMilli(),
+				Title:      "Version " + v.Version,
+				Text:       fmt.Sprintf("First heartbeat reporting version %s, now running on %d deployments.", v.Version, v.Deployments),
+				Tags:       []string{grafanaVersions, v.Version},
+			})
+		}
+		return res, nil
+	}
+}
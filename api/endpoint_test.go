@@ -4,12 +4,15 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/absmach/callhome"
 	"github.com/absmach/callhome/mocks"
@@ -19,10 +22,12 @@ import (
 	"go.opentelemetry.io/otel/trace/noop"
 )
 
+const adminToken = "admin-token"
+
 func TestEndpointsRetrieve(t *testing.T) {
 	svc := mocks.NewService(t)
 	svc.On("Retrieve", mock.Anything, callhome.PageMetadata{Limit: 10}).Return(callhome.TelemetryPage{}, nil)
-	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default())
+	h := MakeHandler(svc, trace.NewNoopTracerProvider(), slog.Default(), adminToken)
 	server := httptest.NewServer(h)
 	client := server.Client()
 	testCases := []struct {
@@ -56,7 +61,7 @@ func TestEndpointSave(t *testing.T) {
 		}`
 	svc := mocks.NewService(t)
 	svc.On("Save", mock.Anything, mock.AnythingOfType("callhome.Telemetry")).Return(nil)
-	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default())
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
 	server := httptest.NewServer(h)
 	client := server.Client()
 	testCases := []struct {
@@ -98,3 +103,845 @@ func TestEndpointSave(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpointRetrievePolicies(t *testing.T) {
+	svc := mocks.NewService(t)
+	svc.On("RetrievePolicies", mock.Anything).Return(callhome.StoragePolicies{RetentionPeriod: time.Hour}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		token       string
+		statusCode  int
+	}{
+		{"successful req", adminToken, http.StatusOK},
+		{"missing token", "", http.StatusUnauthorized},
+		{"invalid token", "invalid", http.StatusUnauthorized},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/admin/policies", server.URL), nil)
+			assert.Nil(t, err)
+			if testCase.token != "" {
+				req.Header.Set("Authorization", "Bearer "+testCase.token)
+			}
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointsRetrieveCursor(t *testing.T) {
+	svc := mocks.NewService(t)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	cursor := callhome.PageCursor{Time: time.Now(), DeploymentID: "0f3b8e4c2a9d4c6e8b1a7d5f3e2c1b0a"}.String()
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"invalid cursor", "cursor=invalid", http.StatusBadRequest},
+		{"cursor with offset", fmt.Sprintf("cursor=%s&offset=10", cursor), http.StatusBadRequest},
+		{"invalid total mode", "total=approximate", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveTimeSeries(t *testing.T) {
+	svc := mocks.NewService(t)
+	ts := callhome.TimeSeries{
+		TimeSeriesQuery: callhome.TimeSeriesQuery{Interval: callhome.IntervalWeek, SplitBy: callhome.SplitByCountry},
+		Buckets:         []callhome.TimeSeriesBucket{{Time: time.Now(), Group: "Serbia", ActiveDeployments: 3}},
+	}
+	svc.On("RetrieveTimeSeries", mock.Anything, ts.TimeSeriesQuery, mock.Anything).Return(ts, nil)
+	svc.On("RetrieveTimeSeries", mock.Anything, callhome.TimeSeriesQuery{Interval: callhome.IntervalDay}, mock.Anything).Return(callhome.TimeSeries{}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "interval=week&split_by=country", http.StatusOK},
+		{"default interval", "", http.StatusOK},
+		{"invalid interval", "interval=fortnight", http.StatusBadRequest},
+		{"invalid split", "interval=day&split_by=city", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/timeseries?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveVersionAnalytics(t *testing.T) {
+	svc := mocks.NewService(t)
+	ttm := 36 * time.Hour
+	va := callhome.VersionAnalytics{
+		Versions: []callhome.VersionStats{
+			{VersionUsage: callhome.VersionUsage{Version: "0.14.0", Deployments: 3, FirstSeen: time.Now()}, Share: 0.75, TimeToMajority: &ttm},
+			{VersionUsage: callhome.VersionUsage{Version: "0.13.0", Deployments: 1, FirstSeen: time.Now()}, Share: 0.25},
+		},
+		TotalDeployments:     4,
+		Latest:               "0.14.0",
+		LatestShare:          0.75,
+		MedianTimeToMajority: ttm,
+	}
+	svc.On("RetrieveVersionAnalytics", mock.Anything, mock.Anything).Return(va, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "country=Serbia", http.StatusOK},
+		{"invalid limit", "limit=0", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/versions?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if testCase.statusCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Latest               string `json:"latest"`
+				MedianTimeToMajority string `json:"median_time_to_majority"`
+				Versions             []struct {
+					Version        string `json:"version"`
+					TimeToMajority string `json:"time_to_majority"`
+				} `json:"versions"`
+			}
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, "0.14.0", body.Latest)
+			assert.Equal(t, "36h0m0s", body.MedianTimeToMajority)
+			assert.Len(t, body.Versions, 2)
+			assert.Equal(t, "", body.Versions[1].TimeToMajority)
+		})
+	}
+}
+
+func TestEndpointRetrieveVersionTransitions(t *testing.T) {
+	svc := mocks.NewService(t)
+	vt := callhome.VersionTransitions{
+		Interval: callhome.IntervalWeek,
+		Matrix:   []callhome.TransitionCount{{From: "0.13.0", To: "0.15.0", Deployments: 2}},
+		Periods:  []callhome.UpgradeBucket{{Time: time.Now(), Upgrades: 2}},
+	}
+	svc.On("RetrieveVersionTransitions", mock.Anything, callhome.IntervalWeek, mock.Anything).Return(vt, nil)
+	svc.On("RetrieveVersionTransitions", mock.Anything, callhome.IntervalDay, mock.Anything).Return(callhome.VersionTransitions{Interval: callhome.IntervalDay}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "interval=week&country=Serbia&service=users", http.StatusOK},
+		{"default interval", "", http.StatusOK},
+		{"invalid interval", "interval=fortnight", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/transitions?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveRetention(t *testing.T) {
+	svc := mocks.NewService(t)
+	r := callhome.Retention{
+		RetentionQuery: callhome.RetentionQuery{Interval: callhome.IntervalMonth, InactivityWindow: 90 * 24 * time.Hour},
+		Periods:        []callhome.ActivityPeriod{{Time: time.Now(), New: 2, Active: 5, Returning: 1, Churned: 1}},
+		Cohorts:        []callhome.Cohort{{Start: time.Now(), Size: 2, Retained: []int{2, 1}}},
+	}
+	svc.On("RetrieveRetention", mock.Anything, r.RetentionQuery, mock.Anything).Return(r, nil)
+	svc.On("RetrieveRetention", mock.Anything, callhome.RetentionQuery{Interval: callhome.IntervalWeek}, mock.Anything).Return(callhome.Retention{}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "interval=month&inactivity_window=2160h", http.StatusOK},
+		{"default interval and window", "", http.StatusOK},
+		{"invalid interval", "interval=day", http.StatusBadRequest},
+		{"invalid window", "inactivity_window=two-weeks", http.StatusBadRequest},
+		{"window shorter than a period", "interval=month&inactivity_window=168h", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/retention?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointRetrieveDeployment(t *testing.T) {
+	svc := mocks.NewService(t)
+	id := "0f3b8e4c2a9d4c6e8b1a7d5f3e2c1b0a"
+	now := time.Now().UTC()
+	d := callhome.DeploymentDetail{
+		Deployment: callhome.Deployment{
+			ID:        id,
+			Latest:    callhome.Telemetry{Version: "0.14.0", Country: "Serbia", ServiceTime: now},
+			FirstSeen: now.Add(-24 * time.Hour),
+		},
+		From:       now.Add(-24 * time.Hour),
+		To:         now,
+		Heartbeats: 40,
+		Gaps:       []callhome.HeartbeatGap{{Start: now.Add(-6 * time.Hour), End: now.Add(-2 * time.Hour)}},
+		Uptime:     0.85,
+	}
+	svc.On("RetrieveDeployment", mock.Anything, id, mock.Anything).Return(d, nil)
+	svc.On("RetrieveDeployment", mock.Anything, "unknown", mock.Anything).Return(callhome.DeploymentDetail{}, callhome.ErrDeploymentNotFound)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		id          string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", id, "", http.StatusOK},
+		{"not found", "unknown", "", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/deployments/%s?%s", server.URL, testCase.id, testCase.query), nil)
+			assert.Nil(t, err)
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				ID       string        `json:"id"`
+				Version  string        `json:"magistrala_version"`
+				Versions []interface{} `json:"versions"`
+				Gaps     []struct {
+					Duration string `json:"duration"`
+				} `json:"gaps"`
+				Uptime float64 `json:"uptime"`
+			}
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, id, body.ID)
+			assert.Equal(t, "0.14.0", body.Version)
+			assert.NotNil(t, body.Versions)
+			if assert.Len(t, body.Gaps, 1) {
+				assert.Equal(t, "4h0m0s", body.Gaps[0].Duration)
+			}
+			assert.Equal(t, 0.85, body.Uptime)
+		})
+	}
+}
+
+func TestEndpointRetrieveServiceComposition(t *testing.T) {
+	svc := mocks.NewService(t)
+	sc := callhome.ServiceComposition{
+		TotalDeployments: 4,
+		Services:         []callhome.ServiceUsage{{Service: "users", Deployments: 4}, {Service: "things", Deployments: 3}},
+		CoOccurrence:     [][]int{{4, 3}, {3, 3}},
+		Profiles:         []callhome.ServiceSet{{Services: []string{"things", "users"}, Deployments: 3}},
+	}
+	svc.On("RetrieveServiceComposition", mock.Anything, 5, callhome.TelemetryFilters{
+		Country: "Serbia",
+		From:    time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC),
+	}).Return(sc, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	t.Run("successful req", func(t *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/telemetry/services?limit=5&country=Serbia&from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z", server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		var body struct {
+			CoOccurrence [][]int `json:"co_occurrence"`
+			Profiles     []struct {
+				Services []string `json:"services"`
+				Share    float64  `json:"share"`
+			} `json:"profiles"`
+		}
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, sc.CoOccurrence, body.CoOccurrence)
+		if assert.Len(t, body.Profiles, 1) {
+			assert.Equal(t, []string{"things", "users"}, body.Profiles[0].Services)
+			assert.Equal(t, 0.75, body.Profiles[0].Share)
+		}
+	})
+	t.Run("invalid limit", func(t *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/telemetry/services?limit=0", server.URL))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestEndpointRetrieveAggregate(t *testing.T) {
+	svc := mocks.NewService(t)
+	q := callhome.AggregateQuery{
+		GroupBy: []string{"country", "week"},
+		Metrics: []string{"deployments", "heartbeats"},
+		Order:   "-heartbeats",
+		Top:     20,
+	}
+	a := callhome.Aggregate{
+		AggregateQuery: q,
+		Rows:           []callhome.AggregateRow{{Groups: []string{"Serbia", "2024-02-26T00:00:00Z"}, Metrics: []int{3, 40}}},
+	}
+	svc.On("RetrieveAggregate", mock.Anything, q, mock.Anything).Return(a, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "group_by=country,week&metrics=deployments,heartbeats&order=-heartbeats&top=20", http.StatusOK},
+		{"missing group by", "metrics=deployments", http.StatusBadRequest},
+		{"unknown group by", "group_by=ip_address", http.StatusBadRequest},
+		{"unknown metric", "group_by=country&metrics=sum", http.StatusBadRequest},
+		{"invalid order", "group_by=country&order=city", http.StatusBadRequest},
+		{"invalid top", "group_by=country&top=0", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			res, err := client.Get(fmt.Sprintf("%s/telemetry/aggregate?%s", server.URL, testCase.query))
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Rows []map[string]interface{} `json:"rows"`
+			}
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, []map[string]interface{}{{
+				"country":     "Serbia",
+				"week":        "2024-02-26T00:00:00Z",
+				"deployments": float64(3),
+				"heartbeats":  float64(40),
+			}}, body.Rows)
+		})
+	}
+}
+
+func TestEndpointRetrieveSummary(t *testing.T) {
+	svc := mocks.NewService(t)
+	summary := callhome.TelemetrySummary{
+		Countries:        []callhome.CountrySummary{{Country: "Serbia", NoDeployments: 3}},
+		Cities:           []string{"Belgrade"},
+		CityCounts:       []callhome.ValueSummary{{Value: "Belgrade", NoDeployments: 3}},
+		Distinct:         callhome.DistinctValues{Countries: 4, Cities: 7},
+		TotalDeployments: 9,
+	}
+	svc.On("RetrieveSummary", mock.Anything, callhome.SummaryQuery{Top: 1}, mock.Anything).Return(summary, nil)
+	baseFrom := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	custom := callhome.SummaryQuery{Top: 1, Compare: callhome.CompareCustom, BaselineFrom: baseFrom, BaselineTo: baseFrom.AddDate(0, 1, 0)}
+	compared := summary
+	compared.Comparison = &callhome.SummaryComparison{
+		From:             baseFrom,
+		To:               baseFrom.AddDate(0, 1, 0),
+		TotalDeployments: callhome.Change{Baseline: 9, Delta: 0},
+	}
+	svc.On("RetrieveSummary", mock.Anything, custom, mock.Anything).Return(compared, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "top=1", http.StatusOK},
+		{"invalid top", "top=1001", http.StatusBadRequest},
+		{"malformed top", "top=many", http.StatusBadRequest},
+		{"custom baseline", "top=1&compare=custom&baseline_from=2024-01-01T00:00:00Z&baseline_to=2024-02-01T00:00:00Z", http.StatusOK},
+		{"missing custom baseline", "compare=custom", http.StatusBadRequest},
+		{"invalid baseline", "compare=last_year", http.StatusBadRequest},
+		{"malformed baseline", "compare=custom&baseline_from=yesterday&baseline_to=2024-02-01T00:00:00Z", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			res, err := client.Get(fmt.Sprintf("%s/telemetry/summary?%s", server.URL, testCase.query))
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+			var body map[string]interface{}
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, []interface{}{"Belgrade"}, body["cities"])
+			assert.Equal(t, []interface{}{map[string]interface{}{"value": "Belgrade", "number_of_deployments": float64(3)}}, body["city_counts"])
+			assert.Equal(t, float64(7), body["distinct"].(map[string]interface{})["cities"])
+			if strings.Contains(testCase.query, "compare") {
+				assert.Equal(t, map[string]interface{}{"baseline": float64(9), "delta": float64(0), "percent": nil},
+					body["comparison"].(map[string]interface{})["total_deployments"])
+			} else {
+				assert.NotContains(t, body, "comparison")
+			}
+		})
+	}
+}
+
+func TestEndpointRetrieveSilentDeployments(t *testing.T) {
+	svc := mocks.NewService(t)
+	lastSeen := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	sd := callhome.SilentDeployments{
+		SilentQuery: callhome.SilentQuery{Threshold: 6 * time.Hour, Lookback: 72 * time.Hour},
+		Deployments: []callhome.SilentDeployment{
+			{ID: "a", Country: "Serbia", Version: "0.14.0", LastSeen: lastSeen, Cadence: 30 * time.Minute, Silence: 7 * time.Hour},
+			{ID: "b", Country: "Serbia", Version: "0.14.0", LastSeen: lastSeen.Add(-time.Hour), Cadence: 30 * time.Minute, Silence: 8 * time.Hour},
+		},
+		Groups: []callhome.SilentGroup{{Version: "0.14.0", Country: "Serbia", Deployments: 2}},
+	}
+	svc.On("RetrieveSilentDeployments", mock.Anything, callhome.SilentQuery{Threshold: 6 * time.Hour, Lookback: 72 * time.Hour}, callhome.TelemetryFilters{Country: "Serbia"}).Return(sd, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"successful req", "threshold=6h&lookback=72h&country=Serbia&offset=1&limit=5", http.StatusOK},
+		{"malformed threshold", "threshold=six", http.StatusBadRequest},
+		{"threshold beyond lookback", "threshold=96h&lookback=72h", http.StatusBadRequest},
+		{"lookback too long", "lookback=10000h", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			res, err := client.Get(fmt.Sprintf("%s/deployments/silent?%s", server.URL, testCase.query))
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+			var body silentDeploymentsRes
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, silentDeploymentsRes{
+				Threshold: "6h0m0s",
+				Lookback:  "72h0m0s",
+				Total:     2,
+				Offset:    1,
+				Limit:     5,
+				Deployments: []silentDeploymentRes{
+					{ID: "b", Country: "Serbia", Version: "0.14.0", LastSeen: lastSeen.Add(-time.Hour), Cadence: "30m0s", Silence: "8h0m0s"},
+				},
+				Groups: sd.Groups,
+			}, body)
+		})
+	}
+}
+
+func TestEndpointWebhooks(t *testing.T) {
+	svc := mocks.NewService(t)
+	createdAt := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	hook := callhome.Webhook{ID: "a", URL: "https://example.com/hooks", Secret: "secret", Events: []string{callhome.EventNewCountry}, CreatedAt: createdAt}
+	svc.On("CreateWebhook", mock.Anything, callhome.Webhook{URL: hook.URL, Events: hook.Events}).Return(hook, nil)
+	svc.On("CreateWebhook", mock.Anything, callhome.Webhook{URL: "ftp://example.com", Events: hook.Events}).Return(callhome.Webhook{}, callhome.ErrInvalidWebhook)
+	svc.On("RetrieveWebhooks", mock.Anything).Return([]callhome.Webhook{hook}, nil)
+	svc.On("RemoveWebhook", mock.Anything, "a").Return(nil)
+	svc.On("RemoveWebhook", mock.Anything, "b").Return(callhome.ErrWebhookNotFound)
+	svc.On("RetrieveWebhookDeliveries", mock.Anything, "a", 100).Return([]callhome.Delivery{
+		{WebhookID: "a", EventID: "e1", EventType: callhome.EventNewCountry, Attempt: 1, Time: createdAt, StatusCode: http.StatusOK},
+	}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+
+	testCases := []struct {
+		description string
+		method      string
+		path        string
+		body        string
+		token       string
+		statusCode  int
+		response    string
+	}{
+		{
+			description: "create webhook",
+			method:      http.MethodPost,
+			path:        "/admin/webhooks",
+			body:        `{"url":"https://example.com/hooks","events":["new_country"]}`,
+			token:       adminToken,
+			statusCode:  http.StatusCreated,
+			response:    `{"id":"a","url":"https://example.com/hooks","events":["new_country"],"secret":"secret","created_at":"2024-03-01T12:00:00Z"}`,
+		},
+		{"create invalid webhook", http.MethodPost, "/admin/webhooks", `{"url":"ftp://example.com","events":["new_country"]}`, adminToken, http.StatusBadRequest, ""},
+		{"create webhook without events", http.MethodPost, "/admin/webhooks", `{"url":"https://example.com/hooks"}`, adminToken, http.StatusBadRequest, ""},
+		{"create malformed webhook", http.MethodPost, "/admin/webhooks", `{"url":`, adminToken, http.StatusBadRequest, ""},
+		{"create webhook without token", http.MethodPost, "/admin/webhooks", `{"url":"https://example.com/hooks","events":["new_country"]}`, "", http.StatusUnauthorized, ""},
+		{
+			description: "list webhooks without secrets",
+			method:      http.MethodGet,
+			path:        "/admin/webhooks",
+			token:       adminToken,
+			statusCode:  http.StatusOK,
+			response:    `{"webhooks":[{"id":"a","url":"https://example.com/hooks","events":["new_country"],"created_at":"2024-03-01T12:00:00Z"}]}`,
+		},
+		{"remove webhook", http.MethodDelete, "/admin/webhooks/a", "", adminToken, http.StatusNoContent, ""},
+		{"remove missing webhook", http.MethodDelete, "/admin/webhooks/b", "", adminToken, http.StatusNotFound, ""},
+		{
+			description: "list deliveries",
+			method:      http.MethodGet,
+			path:        "/admin/webhooks/a/deliveries",
+			token:       adminToken,
+			statusCode:  http.StatusOK,
+			response:    `{"deliveries":[{"webhook_id":"a","event_id":"e1","event_type":"new_country","attempt":1,"time":"2024-03-01T12:00:00Z","status_code":200,"succeeded":true}]}`,
+		},
+		{"list too many deliveries", http.MethodGet, "/admin/webhooks/a/deliveries?limit=5000", "", adminToken, http.StatusBadRequest, ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(testCase.method, server.URL+testCase.path, strings.NewReader(testCase.body))
+			assert.Nil(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if testCase.token != "" {
+				req.Header.Set("Authorization", "Bearer "+testCase.token)
+			}
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if testCase.response != "" {
+				body, err := io.ReadAll(res.Body)
+				assert.Nil(t, err)
+				assert.JSONEq(t, testCase.response, string(body))
+			}
+		})
+	}
+}
+
+func TestEndpointGrafana(t *testing.T) {
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(48 * time.Hour)
+	svc := mocks.NewService(t)
+	svc.On("RetrieveTimeSeries", mock.Anything, callhome.TimeSeriesQuery{Interval: callhome.IntervalHour}, callhome.TelemetryFilters{From: from, To: to, Country: "Serbia"}).Return(callhome.TimeSeries{
+		Buckets: []callhome.TimeSeriesBucket{{Time: from, ActiveDeployments: 2}, {Time: from.Add(time.Hour), ActiveDeployments: 3}},
+	}, nil)
+	svc.On("RetrieveTimeSeries", mock.Anything, callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: callhome.SplitByVersion}, callhome.TelemetryFilters{From: from, To: to}).Return(callhome.TimeSeries{
+		TimeSeriesQuery: callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: callhome.SplitByVersion},
+		Buckets: []callhome.TimeSeriesBucket{
+			{Time: from, Group: "0.14.0", ActiveDeployments: 2},
+			{Time: from, Group: "0.13.0", ActiveDeployments: 1},
+			{Time: from.Add(24 * time.Hour), Group: "0.14.0", ActiveDeployments: 3},
+		},
+	}, nil)
+	svc.On("RetrieveSummary", mock.Anything, callhome.SummaryQuery{}, callhome.TelemetryFilters{From: from, To: to, Service: "users"}).Return(callhome.TelemetrySummary{
+		VersionCounts: []callhome.ValueSummary{{Value: "0.14.0", NoDeployments: 3}, {Value: "0.13.0", NoDeployments: 1}},
+	}, nil)
+	svc.On("RetrieveNewVersions", mock.Anything, callhome.TelemetryFilters{From: from, To: to}).Return([]callhome.VersionUsage{
+		{Version: "0.14.0", Deployments: 3, FirstSeen: from.Add(time.Hour)},
+	}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	rng := `"range":{"from":"2024-03-01T00:00:00Z","to":"2024-03-03T00:00:00Z"}`
+
+	testCases := []struct {
+		description string
+		method      string
+		path        string
+		body        string
+		statusCode  int
+		response    string
+	}{
+		{"test connection", http.MethodGet, "/grafana", "", http.StatusOK, ""},
+		{"search", http.MethodPost, "/grafana/search", `{"target":"by_c"}`, http.StatusOK, `["active_deployments_by_country","deployments_by_country","deployments_by_city"]`},
+		{"search without body", http.MethodPost, "/grafana/search", "", http.StatusOK, ""},
+		{
+			description: "query time series",
+			method:      http.MethodPost,
+			path:        "/grafana/query",
+			body:        `{` + rng + `,"intervalMs":3600000,"targets":[{"target":"active_deployments","refId":"A","data":{"country":"Serbia"}},{"target":"unknown","hide":true}]}`,
+			statusCode:  http.StatusOK,
+			response:    `[{"target":"active_deployments","refId":"A","datapoints":[[2,1709251200000],[3,1709254800000]]}]`,
+		},
+		{
+			description: "query split time series",
+			method:      http.MethodPost,
+			path:        "/grafana/query",
+			body:        `{` + rng + `,"targets":[{"target":"active_deployments_by_version"}]}`,
+			statusCode:  http.StatusOK,
+			response:    `[{"target":"0.13.0","datapoints":[[1,1709251200000]]},{"target":"0.14.0","datapoints":[[2,1709251200000],[3,1709337600000]]}]`,
+		},
+		{
+			description: "query table",
+			method:      http.MethodPost,
+			path:        "/grafana/query",
+			body:        `{` + rng + `,"targets":[{"target":"deployments_by_version","refId":"B","payload":{"service":"users"}}]}`,
+			statusCode:  http.StatusOK,
+			response:    `[{"type":"table","refId":"B","columns":[{"text":"version","type":"string"},{"text":"deployments","type":"number"}],"rows":[["0.14.0",3],["0.13.0",1]]}]`,
+		},
+		{"query unknown target", http.MethodPost, "/grafana/query", `{` + rng + `,"targets":[{"target":"active_deployments_by_city"}]}`, http.StatusBadRequest, ""},
+		{"query without range", http.MethodPost, "/grafana/query", `{"targets":[{"target":"active_deployments"}]}`, http.StatusBadRequest, ""},
+		{"query malformed", http.MethodPost, "/grafana/query", `{"targets":`, http.StatusBadRequest, ""},
+		{
+			description: "annotations",
+			method:      http.MethodPost,
+			path:        "/grafana/annotations",
+			body:        `{` + rng + `,"annotation":{"name":"releases","enable":true,"query":"versions"}}`,
+			statusCode:  http.StatusOK,
+			response:    `[{"annotation":{"name":"releases","enable":true,"iconColor":"","query":"versions"},"time":1709254800000,"title":"Version 0.14.0","text":"First heartbeat reporting version 0.14.0, now running on 3 deployments.","tags":["versions","0.14.0"]}]`,
+		},
+		{"unknown annotations", http.MethodPost, "/grafana/annotations", `{` + rng + `,"annotation":{"query":"countries"}}`, http.StatusBadRequest, ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(testCase.method, server.URL+testCase.path, strings.NewReader(testCase.body))
+			assert.Nil(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if testCase.response != "" {
+				body, err := io.ReadAll(res.Body)
+				assert.Nil(t, err)
+				assert.JSONEq(t, testCase.response, string(body))
+			}
+		})
+	}
+}
+
+func TestEndpointExportTelemetry(t *testing.T) {
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	filters := callhome.TelemetryFilters{From: from, To: to, Country: "Serbia"}
+	svc := mocks.NewService(t)
+	svc.On("ExportTelemetry", mock.Anything, callhome.ExportQuery{Format: callhome.FormatCSV, Rows: callhome.ExportHeartbeats}, filters, mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, err := io.WriteString(args.Get(3).(io.Writer), "deployment_id\na\n")
+			assert.Nil(t, err)
+		}).Return(nil)
+	svc.On("ExportTelemetry", mock.Anything, callhome.ExportQuery{Format: callhome.FormatNDJSON, Rows: callhome.ExportDeployments}, filters, mock.Anything).
+		Return(fmt.Errorf("any error"))
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	filter := "from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z&country=Serbia"
+
+	testCases := []struct {
+		description string
+		query       string
+		token       string
+		statusCode  int
+		contentType string
+		body        string
+	}{
+		{"export csv heartbeats", filter, adminToken, http.StatusOK, "text/csv", "deployment_id\na\n"},
+		{"export without token", filter, "", http.StatusUnauthorized, "", ""},
+		{"export with invalid token", filter, "invalid", http.StatusUnauthorized, "", ""},
+		{"export unknown format", filter + "&format=xlsx", adminToken, http.StatusBadRequest, "", ""},
+		{"export unknown rows", filter + "&rows=countries", adminToken, http.StatusBadRequest, "", ""},
+		{"export failure", filter + "&format=ndjson&rows=deployments", adminToken, http.StatusInternalServerError, "", ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/telemetry/export?%s", server.URL, testCase.query), nil)
+			assert.Nil(t, err)
+			if testCase.token != "" {
+				req.Header.Set("Authorization", "Bearer "+testCase.token)
+			}
+			res, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				assert.Empty(t, res.Header.Get("Content-Disposition"))
+				return
+			}
+			assert.Equal(t, testCase.contentType, res.Header.Get("Content-Type"))
+			assert.Regexp(t, `^attachment; filename=callhome-heartbeats-\d{8}T\d{6}Z\.csv$`, res.Header.Get("Content-Disposition"))
+			body, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.body, string(body))
+		})
+	}
+}
+
+func TestEndpointMapPoints(t *testing.T) {
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	filters := callhome.TelemetryFilters{From: from, To: to}
+	bbox := &callhome.BoundingBox{West: 10, South: 40, East: 30, North: 50}
+	seen := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	deployment := &callhome.Telemetry{DeploymentID: "abc", Services: []string{"users"}, Country: "Serbia", Latitude: 44.8, Longitude: 20.4, ServiceTime: seen, LastSeen: seen}
+	svc := mocks.NewService(t)
+	svc.On("RetrieveMapPoints", mock.Anything, callhome.MapQuery{BBox: bbox, Zoom: 4}, filters).Return(callhome.MapPoints{
+		MapQuery: callhome.MapQuery{BBox: bbox, Zoom: 4},
+		Points: []callhome.MapPoint{
+			{Longitude: 20.1, Latitude: 45, Count: 2},
+			{Longitude: 20.4, Latitude: 44.8, Count: 1, Deployment: deployment},
+		},
+		Total: 3,
+	}, nil)
+	svc.On("RetrieveMapPoints", mock.Anything, callhome.MapQuery{Zoom: 12}, filters).Return(callhome.MapPoints{}, fmt.Errorf("any error"))
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	filter := "from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z"
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+		body        string
+	}{
+		{
+			"map points",
+			filter + "&bbox=10,40,30,50&zoom=4",
+			http.StatusOK,
+			`{"type":"FeatureCollection","bbox":[10,40,30,50],"features":[` +
+				`{"type":"Feature","geometry":{"type":"Point","coordinates":[20.1,45]},"properties":{"cluster":true,"count":2}},` +
+				`{"type":"Feature","geometry":{"type":"Point","coordinates":[20.4,44.8]},"properties":{"cluster":false,"count":1,` +
+				`"deployment_id":"abc","services":["users"],"longitude":20.4,"latitude":44.8,"last_seen":"2024-03-01T12:00:00Z","country":"Serbia","timestamp":"2024-03-01T12:00:00Z"}}` +
+				`],"zoom":4,"clustered":true,"total":3}`,
+		},
+		{"map points with malformed bbox", filter + "&bbox=10,40,30", http.StatusBadRequest, ""},
+		{"map points with invalid bbox", filter + "&bbox=10,50,30,40", http.StatusBadRequest, ""},
+		{"map points with invalid zoom", filter + "&zoom=23", http.StatusBadRequest, ""},
+		{"map points failure", filter + "&zoom=12", http.StatusInternalServerError, ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			res, err := client.Get(fmt.Sprintf("%s/map/points?%s", server.URL, testCase.query))
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/geo+json", res.Header.Get("Content-Type"))
+			body, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+			assert.JSONEq(t, testCase.body, string(body))
+		})
+	}
+}
+
+func TestEndpointGeoFilters(t *testing.T) {
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	svc := mocks.NewService(t)
+	svc.On("RetrieveVersionAnalytics", mock.Anything, callhome.TelemetryFilters{
+		From:      from,
+		To:        to,
+		BBox:      &callhome.BoundingBox{West: -10, South: 35, East: 30, North: 60},
+		Near:      &callhome.GeoCircle{Latitude: 44.8, Longitude: 20.46, Radius: 100},
+		Continent: callhome.ContinentEurope,
+		SubRegion: "Southern Europe",
+	}).Return(callhome.VersionAnalytics{}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	filter := "from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z"
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"geographic filters", filter + "&bbox=-10,35,30,60&near=44.8,20.46&radius=100&continent=Europe&sub_region=Southern+Europe", http.StatusOK},
+		{"invalid bounding box", filter + "&bbox=-10,60,30,35", http.StatusBadRequest},
+		{"near without radius", filter + "&near=44.8,20.46", http.StatusBadRequest},
+		{"radius without near", filter + "&radius=100", http.StatusBadRequest},
+		{"negative radius", filter + "&near=44.8,20.46&radius=-1", http.StatusBadRequest},
+		{"unknown continent", filter + "&continent=Atlantis", http.StatusBadRequest},
+		{"unknown sub-region", filter + "&sub_region=Balkans", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			res, err := client.Get(fmt.Sprintf("%s/telemetry/versions?%s", server.URL, testCase.query))
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestEndpointFilterExpressions(t *testing.T) {
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	svc := mocks.NewService(t)
+	svc.On("RetrieveVersionAnalytics", mock.Anything, callhome.TelemetryFilters{
+		From:    from,
+		To:      to,
+		Country: "Serbia,France",
+		Service: "!bootstrap",
+		Version: ">=0.14.0 <0.16",
+	}).Return(callhome.VersionAnalytics{}, nil)
+	svc.On("RetrieveVersionAnalytics", mock.Anything, callhome.TelemetryFilters{
+		From:    from,
+		To:      to,
+		City:    "Belgrade,Paris",
+		Version: "0.13.0,>=0.14.0 <0.16",
+	}).Return(callhome.VersionAnalytics{}, nil)
+	h := MakeHandler(svc, noop.NewTracerProvider(), slog.Default(), adminToken)
+	server := httptest.NewServer(h)
+	client := server.Client()
+	filter := "from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z"
+
+	testCases := []struct {
+		description string
+		query       string
+		statusCode  int
+	}{
+		{"comma-separated values, negation and version range", filter + "&country=Serbia,France&service=!bootstrap&version=%3E%3D0.14.0+%3C0.16", http.StatusOK},
+		{"repeated values", filter + "&city=Belgrade&city=Paris&version=0.13.0&version=%3E%3D0.14.0+%3C0.16", http.StatusOK},
+		{"empty value", filter + "&country=Serbia,,France", http.StatusBadRequest},
+		{"empty negation", filter + "&service=!", http.StatusBadRequest},
+		{"negated version range", filter + "&version=!%3E0.14", http.StatusBadRequest},
+		{"invalid version bound", filter + "&version=%3E%3D0.x", http.StatusBadRequest},
+		{"invalid version operator", filter + "&version=%3D%3E0.14.0", http.StatusBadRequest},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			res, err := client.Get(fmt.Sprintf("%s/telemetry/versions?%s", server.URL, testCase.query))
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.statusCode, res.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RecordSilentDeployments sets the gauge to the number of silent deployments
+// by version and country at the given interval, until the context is done.
+func RecordSilentDeployments(ctx context.Context, svc callhome.Service, gauge *prometheus.GaugeVec, interval time.Duration, logger *slog.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := recordSilentDeployments(ctx, svc, gauge); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to record silent deployments: %s.", err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewSilentGauge makes the gauge of silent deployments by version and
+// country. It is registered if reg is not nil.
+func NewSilentGauge(namespace, subsystem string, reg prometheus.Registerer) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "silent_deployments",
+		Help:      fmt.Sprintf("Number of deployments that recently stopped reporting, with versions that are not semantic and unknown countries summed up as %q.", callhome.FleetOther),
+	}, []string{"version", "country"})
+	if reg != nil {
+		reg.MustRegister(gauge)
+	}
+	return gauge
+}
+
+func recordSilentDeployments(ctx context.Context, svc callhome.Service, gauge *prometheus.GaugeVec) error {
+	sd, err := svc.RetrieveSilentDeployments(ctx, callhome.SilentQuery{}, callhome.TelemetryFilters{})
+	if err != nil {
+		return err
+	}
+	// Reset drops the groups that are no longer silent.
+	gauge.Reset()
+	for _, g := range sd.Groups {
+		gauge.WithLabelValues(silentLabels(g)...).Add(float64(g.Deployments))
+	}
+	return nil
+}
+
+// silentLabels are the version and country labels of the group. Labels are
+// reported by clients, so only semantic versions and known countries are
+// kept to bound the cardinality of the gauge.
+func silentLabels(g callhome.SilentGroup) []string {
+	labels := []string{g.Version, g.Country}
+	if _, ok := callhome.VersionKey(g.Version); !ok {
+		labels[0] = callhome.FleetOther
+	}
+	if !callhome.IsCountry(g.Country) {
+		labels[1] = callhome.FleetOther
+	}
+	for i, l := range []string{g.Version, g.Country} {
+		if l == "" {
+			labels[i] = callhome.FleetUnknown
+		}
+	}
+	return labels
+}
+
+// FleetGauges are the gauges of fleet metrics, see callhome.FleetMetrics.
+type FleetGauges struct {
+	VersionDeployments  *prometheus.GaugeVec
+	CountryDeployments  *prometheus.GaugeVec
+	ServiceDeployments  *prometheus.GaugeVec
+	Heartbeats          prometheus.Gauge
+	GeolocationFailures prometheus.Gauge
+	CacheHitRatio       prometheus.Gauge
+}
+
+// NewFleetGauges makes the fleet gauges. They are registered if reg is not nil.
+func NewFleetGauges(namespace, subsystem string, reg prometheus.Registerer) FleetGauges {
+	deployments := func(label string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "active_deployments_by_" + label,
+			Help:      fmt.Sprintf("Number of deployments active in the fleet window by %s, with the smallest groups summed up as %q.", label, callhome.FleetOther),
+		}, []string{label})
+	}
+	gauge := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		})
+	}
+	g := FleetGauges{
+		VersionDeployments:  deployments("version"),
+		CountryDeployments:  deployments("country"),
+		ServiceDeployments:  deployments("service"),
+		Heartbeats:          gauge("heartbeats_ingested", "Number of heartbeats ingested in the fleet window."),
+		GeolocationFailures: gauge("geolocation_failures", "Number of heartbeats rejected since the service started because they could not be geolocated."),
+		CacheHitRatio:       gauge("cache_hit_ratio", "Ratio of cache hits since the service started."),
+	}
+	if reg != nil {
+		reg.MustRegister(g.VersionDeployments, g.CountryDeployments, g.ServiceDeployments, g.Heartbeats, g.GeolocationFailures, g.CacheHitRatio)
+	}
+	return g
+}
+
+// RecordFleetMetrics sets the fleet gauges at the given interval, until the
+// context is done.
+func RecordFleetMetrics(ctx context.Context, svc callhome.Service, gauges FleetGauges, q callhome.FleetQuery, interval time.Duration, logger *slog.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := recordFleetMetrics(ctx, svc, gauges, q); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to record fleet metrics: %s.", err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func recordFleetMetrics(ctx context.Context, svc callhome.Service, gauges FleetGauges, q callhome.FleetQuery) error {
+	fm, err := svc.RetrieveFleetMetrics(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, vec := range []struct {
+		gauge  *prometheus.GaugeVec
+		values []callhome.ValueSummary
+	}{
+		{gauges.VersionDeployments, fm.Versions},
+		{gauges.CountryDeployments, fm.Countries},
+		{gauges.ServiceDeployments, fm.Services},
+	} {
+		// Reset drops the values that fell out of the top ones.
+		vec.gauge.Reset()
+		for _, v := range vec.values {
+			vec.gauge.WithLabelValues(v.Value).Set(float64(v.NoDeployments))
+		}
+	}
+	gauges.Heartbeats.Set(float64(fm.Heartbeats))
+	gauges.GeolocationFailures.Set(float64(fm.GeolocationFailures))
+	gauges.CacheHitRatio.Set(fm.CacheHitRatio)
+	return nil
+}
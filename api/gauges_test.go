@@ -0,0 +1,91 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRecordSilentDeployments(t *testing.T) {
+	ctx := context.TODO()
+	gauge := NewSilentGauge("test", "fleet", nil)
+
+	svc := mocks.NewService(t)
+	svc.On("RetrieveSilentDeployments", mock.Anything, callhome.SilentQuery{}, callhome.TelemetryFilters{}).Return(callhome.SilentDeployments{
+		Groups: []callhome.SilentGroup{
+			{Version: "0.14.0", Country: "Serbia", Deployments: 3},
+			{Version: "0.13.0", Country: "France", Deployments: 1},
+		},
+	}, nil).Once()
+	assert.Nil(t, recordSilentDeployments(ctx, svc, gauge))
+	assert.Equal(t, 2, testutil.CollectAndCount(gauge))
+	assert.Equal(t, float64(3), testutil.ToFloat64(gauge.WithLabelValues("0.14.0", "Serbia")))
+
+	svc.On("RetrieveSilentDeployments", mock.Anything, callhome.SilentQuery{}, callhome.TelemetryFilters{}).Return(callhome.SilentDeployments{
+		Groups: []callhome.SilentGroup{{Version: "0.13.0", Country: "France", Deployments: 2}},
+	}, nil).Once()
+	assert.Nil(t, recordSilentDeployments(ctx, svc, gauge))
+	assert.Equal(t, 1, testutil.CollectAndCount(gauge))
+	assert.Equal(t, float64(2), testutil.ToFloat64(gauge.WithLabelValues("0.13.0", "France")))
+
+	// Versions that are not semantic and unknown countries are summed up.
+	svc.On("RetrieveSilentDeployments", mock.Anything, callhome.SilentQuery{}, callhome.TelemetryFilters{}).Return(callhome.SilentDeployments{
+		Groups: []callhome.SilentGroup{
+			{Version: "dev-1", Country: "Serbia", Deployments: 1},
+			{Version: "dev-2", Country: "Serbia", Deployments: 2},
+			{Version: "0.14.0", Country: "Atlantis", Deployments: 1},
+			{Version: "", Country: "", Deployments: 1},
+		},
+	}, nil).Once()
+	assert.Nil(t, recordSilentDeployments(ctx, svc, gauge))
+	assert.Equal(t, 3, testutil.CollectAndCount(gauge))
+	assert.Equal(t, float64(3), testutil.ToFloat64(gauge.WithLabelValues(callhome.FleetOther, "Serbia")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(gauge.WithLabelValues("0.14.0", callhome.FleetOther)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(gauge.WithLabelValues(callhome.FleetUnknown, callhome.FleetUnknown)))
+
+	svc.On("RetrieveSilentDeployments", mock.Anything, callhome.SilentQuery{}, callhome.TelemetryFilters{}).Return(callhome.SilentDeployments{}, fmt.Errorf("any error")).Once()
+	assert.NotNil(t, recordSilentDeployments(ctx, svc, gauge))
+	assert.Equal(t, 3, testutil.CollectAndCount(gauge))
+}
+
+func TestRecordFleetMetrics(t *testing.T) {
+	ctx := context.TODO()
+	gauges := NewFleetGauges("test", "fleet", nil)
+
+	svc := mocks.NewService(t)
+	svc.On("RetrieveFleetMetrics", mock.Anything, callhome.FleetQuery{}).Return(callhome.FleetMetrics{
+		Versions:            []callhome.ValueSummary{{Value: "0.14.0", NoDeployments: 3}, {Value: callhome.FleetOther, NoDeployments: 1}},
+		Countries:           []callhome.ValueSummary{{Value: "Serbia", NoDeployments: 4}},
+		Services:            []callhome.ValueSummary{{Value: "users", NoDeployments: 4}},
+		Heartbeats:          40,
+		GeolocationFailures: 2,
+		CacheHitRatio:       0.75,
+	}, nil).Once()
+	assert.Nil(t, recordFleetMetrics(ctx, svc, gauges, callhome.FleetQuery{}))
+	assert.Equal(t, 2, testutil.CollectAndCount(gauges.VersionDeployments))
+	assert.Equal(t, float64(1), testutil.ToFloat64(gauges.VersionDeployments.WithLabelValues(callhome.FleetOther)))
+	assert.Equal(t, float64(4), testutil.ToFloat64(gauges.CountryDeployments.WithLabelValues("Serbia")))
+	assert.Equal(t, float64(40), testutil.ToFloat64(gauges.Heartbeats))
+	assert.Equal(t, float64(2), testutil.ToFloat64(gauges.GeolocationFailures))
+	assert.Equal(t, 0.75, testutil.ToFloat64(gauges.CacheHitRatio))
+
+	svc.On("RetrieveFleetMetrics", mock.Anything, callhome.FleetQuery{}).Return(callhome.FleetMetrics{
+		Versions: []callhome.ValueSummary{{Value: "0.15.0", NoDeployments: 4}},
+	}, nil).Once()
+	assert.Nil(t, recordFleetMetrics(ctx, svc, gauges, callhome.FleetQuery{}))
+	assert.Equal(t, 1, testutil.CollectAndCount(gauges.VersionDeployments))
+	assert.Equal(t, 0, testutil.CollectAndCount(gauges.CountryDeployments))
+
+	svc.On("RetrieveFleetMetrics", mock.Anything, callhome.FleetQuery{}).Return(callhome.FleetMetrics{}, fmt.Errorf("any error")).Once()
+	assert.NotNil(t, recordFleetMetrics(ctx, svc, gauges, callhome.FleetQuery{}))
+	assert.Equal(t, 1, testutil.CollectAndCount(gauges.VersionDeployments))
+}
@@ -6,7 +6,9 @@ package api
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/absmach/callhome"
@@ -52,7 +54,7 @@ func (lm *loggingMiddleware) Save(ctx context.Context, t callhome.Telemetry) (er
 	return lm.svc.Save(ctx, t)
 }
 
-func (lm *loggingMiddleware) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (summary callhome.TelemetrySummary, err error) {
+func (lm *loggingMiddleware) RetrieveSummary(ctx context.Context, q callhome.SummaryQuery, filters callhome.TelemetryFilters) (summary callhome.TelemetrySummary, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method retrieve summary event took %s to complete", time.Since(begin))
 		if err != nil {
@@ -62,7 +64,7 @@ func (lm *loggingMiddleware) RetrieveSummary(ctx context.Context, filters callho
 		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
 	}(time.Now())
 
-	return lm.svc.RetrieveSummary(ctx, filters)
+	return lm.svc.RetrieveSummary(ctx, q, filters)
 }
 
 // ServeUI implements callhome.Service.
@@ -78,3 +80,224 @@ func (lm *loggingMiddleware) ServeUI(ctx context.Context, filters callhome.Telem
 
 	return lm.svc.ServeUI(ctx, filters)
 }
+
+// RetrievePolicies adds logging middleware to retrieve policies service.
+func (lm *loggingMiddleware) RetrievePolicies(ctx context.Context) (policies callhome.StoragePolicies, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve policies took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrievePolicies(ctx)
+}
+
+// RetrieveTimeSeries adds logging middleware to retrieve time series service.
+func (lm *loggingMiddleware) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) (ts callhome.TimeSeries, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve time series by %s took %s to complete", q.Interval, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveTimeSeries(ctx, q, filters)
+}
+
+// RetrieveVersionAnalytics adds logging middleware to retrieve version analytics service.
+func (lm *loggingMiddleware) RetrieveVersionAnalytics(ctx context.Context, filters callhome.TelemetryFilters) (va callhome.VersionAnalytics, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve version analytics took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveVersionAnalytics(ctx, filters)
+}
+
+// RetrieveNewVersions adds logging middleware to retrieve new versions service.
+func (lm *loggingMiddleware) RetrieveNewVersions(ctx context.Context, filters callhome.TelemetryFilters) (versions []callhome.VersionUsage, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve new versions took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveNewVersions(ctx, filters)
+}
+
+// RetrieveVersionTransitions adds logging middleware to retrieve version transitions service.
+func (lm *loggingMiddleware) RetrieveVersionTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) (vt callhome.VersionTransitions, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve version transitions by %s took %s to complete", interval, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveVersionTransitions(ctx, interval, filters)
+}
+
+// RetrieveRetention adds logging middleware to retrieve retention service.
+func (lm *loggingMiddleware) RetrieveRetention(ctx context.Context, q callhome.RetentionQuery, filters callhome.TelemetryFilters) (r callhome.Retention, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve retention by %s took %s to complete", q.Interval, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveRetention(ctx, q, filters)
+}
+
+// RetrieveAggregate adds logging middleware to retrieve aggregate service.
+func (lm *loggingMiddleware) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) (a callhome.Aggregate, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve aggregate by %s took %s to complete", strings.Join(q.GroupBy, ","), time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveAggregate(ctx, q, filters)
+}
+
+// RetrieveServiceComposition adds logging middleware to retrieve service composition service.
+func (lm *loggingMiddleware) RetrieveServiceComposition(ctx context.Context, profiles int, filters callhome.TelemetryFilters) (sc callhome.ServiceComposition, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve service composition took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveServiceComposition(ctx, profiles, filters)
+}
+
+// RetrieveDeployment adds logging middleware to retrieve deployment service.
+func (lm *loggingMiddleware) RetrieveDeployment(ctx context.Context, id string, filters callhome.TelemetryFilters) (d callhome.DeploymentDetail, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve deployment %s took %s to complete", id, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveDeployment(ctx, id, filters)
+}
+
+// RetrieveSilentDeployments adds logging middleware to retrieve silent deployments service.
+func (lm *loggingMiddleware) RetrieveSilentDeployments(ctx context.Context, q callhome.SilentQuery, filters callhome.TelemetryFilters) (sd callhome.SilentDeployments, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve silent deployments took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveSilentDeployments(ctx, q, filters)
+}
+
+// CreateWebhook adds logging middleware to create webhook service.
+func (lm *loggingMiddleware) CreateWebhook(ctx context.Context, w callhome.Webhook) (wh callhome.Webhook, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method create webhook for %s took %s to complete", strings.Join(w.Events, ","), time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.CreateWebhook(ctx, w)
+}
+
+// RetrieveWebhooks adds logging middleware to retrieve webhooks service.
+func (lm *loggingMiddleware) RetrieveWebhooks(ctx context.Context) (hooks []callhome.Webhook, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve webhooks took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveWebhooks(ctx)
+}
+
+// RemoveWebhook adds logging middleware to remove webhook service.
+func (lm *loggingMiddleware) RemoveWebhook(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method remove webhook %s took %s to complete", id, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RemoveWebhook(ctx, id)
+}
+
+// RetrieveWebhookDeliveries adds logging middleware to retrieve webhook deliveries service.
+func (lm *loggingMiddleware) RetrieveWebhookDeliveries(ctx context.Context, id string, limit int) (ds []callhome.Delivery, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve webhook %s deliveries took %s to complete", id, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveWebhookDeliveries(ctx, id, limit)
+}
+
+// RetrieveFleetMetrics adds logging middleware to retrieve fleet metrics service.
+func (lm *loggingMiddleware) RetrieveFleetMetrics(ctx context.Context, q callhome.FleetQuery) (fm callhome.FleetMetrics, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve fleet metrics took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveFleetMetrics(ctx, q)
+}
+
+// ExportTelemetry adds logging middleware to export telemetry service.
+func (lm *loggingMiddleware) ExportTelemetry(ctx context.Context, q callhome.ExportQuery, filters callhome.TelemetryFilters, w io.Writer) (err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method export telemetry as %s %s took %s to complete", q.Format, q.Rows, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.ExportTelemetry(ctx, q, filters, w)
+}
+
+// RetrieveMapPoints adds logging middleware to retrieve map points service.
+func (lm *loggingMiddleware) RetrieveMapPoints(ctx context.Context, q callhome.MapQuery, filters callhome.TelemetryFilters) (mp callhome.MapPoints, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method retrieve map points at zoom %d took %s to complete", q.Zoom, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+	return lm.svc.RetrieveMapPoints(ctx, q, filters)
+}
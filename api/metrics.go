@@ -5,6 +5,7 @@ package api
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/absmach/callhome"
@@ -49,12 +50,12 @@ func (mm *metricsMiddleware) Save(ctx context.Context, t callhome.Telemetry) err
 }
 
 // RetrieveSummary adds metrics middleware to retrieve summary service.
-func (mm *metricsMiddleware) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+func (mm *metricsMiddleware) RetrieveSummary(ctx context.Context, q callhome.SummaryQuery, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
 	defer func(begin time.Time) {
 		mm.counter.With("method", "retrieve-summary").Add(1)
 		mm.latency.With("method", "retrieve-summary").Observe(time.Since(begin).Seconds())
 	}(time.Now())
-	return mm.svc.RetrieveSummary(ctx, filters)
+	return mm.svc.RetrieveSummary(ctx, q, filters)
 }
 
 // ServeUI implements callhome.Service.
@@ -65,3 +66,156 @@ func (mm *metricsMiddleware) ServeUI(ctx context.Context, filters callhome.Telem
 	}(time.Now())
 	return mm.svc.ServeUI(ctx, filters)
 }
+
+// RetrievePolicies adds metrics middleware to retrieve policies service.
+func (mm *metricsMiddleware) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-policies").Add(1)
+		mm.latency.With("method", "retrieve-policies").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrievePolicies(ctx)
+}
+
+// RetrieveTimeSeries adds metrics middleware to retrieve time series service.
+func (mm *metricsMiddleware) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) (callhome.TimeSeries, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-time-series").Add(1)
+		mm.latency.With("method", "retrieve-time-series").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveTimeSeries(ctx, q, filters)
+}
+
+// RetrieveVersionAnalytics adds metrics middleware to retrieve version analytics service.
+func (mm *metricsMiddleware) RetrieveVersionAnalytics(ctx context.Context, filters callhome.TelemetryFilters) (callhome.VersionAnalytics, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-version-analytics").Add(1)
+		mm.latency.With("method", "retrieve-version-analytics").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveVersionAnalytics(ctx, filters)
+}
+
+// RetrieveNewVersions adds metrics middleware to retrieve new versions service.
+func (mm *metricsMiddleware) RetrieveNewVersions(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-new-versions").Add(1)
+		mm.latency.With("method", "retrieve-new-versions").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveNewVersions(ctx, filters)
+}
+
+// RetrieveVersionTransitions adds metrics middleware to retrieve version transitions service.
+func (mm *metricsMiddleware) RetrieveVersionTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) (callhome.VersionTransitions, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-version-transitions").Add(1)
+		mm.latency.With("method", "retrieve-version-transitions").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveVersionTransitions(ctx, interval, filters)
+}
+
+// RetrieveRetention adds metrics middleware to retrieve retention service.
+func (mm *metricsMiddleware) RetrieveRetention(ctx context.Context, q callhome.RetentionQuery, filters callhome.TelemetryFilters) (callhome.Retention, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-retention").Add(1)
+		mm.latency.With("method", "retrieve-retention").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveRetention(ctx, q, filters)
+}
+
+// RetrieveAggregate adds metrics middleware to retrieve aggregate service.
+func (mm *metricsMiddleware) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) (callhome.Aggregate, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-aggregate").Add(1)
+		mm.latency.With("method", "retrieve-aggregate").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveAggregate(ctx, q, filters)
+}
+
+// RetrieveServiceComposition adds metrics middleware to retrieve service composition service.
+func (mm *metricsMiddleware) RetrieveServiceComposition(ctx context.Context, profiles int, filters callhome.TelemetryFilters) (callhome.ServiceComposition, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-service-composition").Add(1)
+		mm.latency.With("method", "retrieve-service-composition").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveServiceComposition(ctx, profiles, filters)
+}
+
+// RetrieveDeployment adds metrics middleware to retrieve deployment service.
+func (mm *metricsMiddleware) RetrieveDeployment(ctx context.Context, id string, filters callhome.TelemetryFilters) (callhome.DeploymentDetail, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-deployment").Add(1)
+		mm.latency.With("method", "retrieve-deployment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveDeployment(ctx, id, filters)
+}
+
+// RetrieveSilentDeployments adds metrics middleware to retrieve silent deployments service.
+func (mm *metricsMiddleware) RetrieveSilentDeployments(ctx context.Context, q callhome.SilentQuery, filters callhome.TelemetryFilters) (callhome.SilentDeployments, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-silent-deployments").Add(1)
+		mm.latency.With("method", "retrieve-silent-deployments").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveSilentDeployments(ctx, q, filters)
+}
+
+// CreateWebhook adds metrics middleware to create webhook service.
+func (mm *metricsMiddleware) CreateWebhook(ctx context.Context, w callhome.Webhook) (callhome.Webhook, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "create-webhook").Add(1)
+		mm.latency.With("method", "create-webhook").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.CreateWebhook(ctx, w)
+}
+
+// RetrieveWebhooks adds metrics middleware to retrieve webhooks service.
+func (mm *metricsMiddleware) RetrieveWebhooks(ctx context.Context) ([]callhome.Webhook, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-webhooks").Add(1)
+		mm.latency.With("method", "retrieve-webhooks").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveWebhooks(ctx)
+}
+
+// RemoveWebhook adds metrics middleware to remove webhook service.
+func (mm *metricsMiddleware) RemoveWebhook(ctx context.Context, id string) error {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "remove-webhook").Add(1)
+		mm.latency.With("method", "remove-webhook").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RemoveWebhook(ctx, id)
+}
+
+// RetrieveWebhookDeliveries adds metrics middleware to retrieve webhook deliveries service.
+func (mm *metricsMiddleware) RetrieveWebhookDeliveries(ctx context.Context, id string, limit int) ([]callhome.Delivery, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-webhook-deliveries").Add(1)
+		mm.latency.With("method", "retrieve-webhook-deliveries").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveWebhookDeliveries(ctx, id, limit)
+}
+
+// RetrieveFleetMetrics adds metrics middleware to retrieve fleet metrics service.
+func (mm *metricsMiddleware) RetrieveFleetMetrics(ctx context.Context, q callhome.FleetQuery) (callhome.FleetMetrics, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-fleet-metrics").Add(1)
+		mm.latency.With("method", "retrieve-fleet-metrics").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveFleetMetrics(ctx, q)
+}
+
+// ExportTelemetry adds metrics middleware to export telemetry service.
+func (mm *metricsMiddleware) ExportTelemetry(ctx context.Context, q callhome.ExportQuery, filters callhome.TelemetryFilters, w io.Writer) error {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "export-telemetry").Add(1)
+		mm.latency.With("method", "export-telemetry").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.ExportTelemetry(ctx, q, filters, w)
+}
+
+// RetrieveMapPoints adds metrics middleware to retrieve map points service.
+func (mm *metricsMiddleware) RetrieveMapPoints(ctx context.Context, q callhome.MapQuery, filters callhome.TelemetryFilters) (callhome.MapPoints, error) {
+	defer func(begin time.Time) {
+		mm.counter.With("method", "retrieve-map-points").Add(1)
+		mm.latency.With("method", "retrieve-map-points").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mm.svc.RetrieveMapPoints(ctx, q, filters)
+}
@@ -5,7 +5,10 @@ package api
 
 import (
 	"errors"
+	"strings"
 	"time"
+
+	"github.com/absmach/callhome"
 )
 
 var (
@@ -21,13 +24,19 @@ var (
 	ErrUnsupportedContentType = errors.New("unsupported content type")
 )
 
-const maxLimitSize = 100
+const (
+	maxLimitSize  = 100
+	maxSummaryTop = 1000
+	totalExact    = "exact"
+	totalEstimate = "estimate"
+)
 
 type saveTelemetryReq struct {
-	Service   string    `json:"service"`
-	IpAddress string    `json:"ip_address"`
-	Version   string    `json:"magistrala_version"`
-	LastSeen  time.Time `json:"last_seen"`
+	Service    string    `json:"service"`
+	IpAddress  string    `json:"ip_address"`
+	MacAddress string    `json:"mac_address"`
+	Version    string    `json:"magistrala_version"`
+	LastSeen   time.Time `json:"last_seen"`
 }
 
 func (req saveTelemetryReq) validate() error {
@@ -48,12 +57,34 @@ func (req saveTelemetryReq) validate() error {
 type listTelemetryReq struct {
 	offset  uint64
 	limit   uint64
+	cursor  string
+	total   string
 	from    time.Time
 	to      time.Time
 	country string
 	city    string
 	version string
 	service string
+	// Geographic filters.
+	bbox      *callhome.BoundingBox
+	near      *callhome.GeoCircle
+	continent string
+	subRegion string
+}
+
+func (req listTelemetryReq) filters() callhome.TelemetryFilters {
+	return callhome.TelemetryFilters{
+		From:      req.from,
+		To:        req.to,
+		Country:   req.country,
+		City:      req.city,
+		Version:   req.version,
+		Service:   req.service,
+		BBox:      req.bbox,
+		Near:      req.near,
+		Continent: req.continent,
+		SubRegion: req.subRegion,
+	}
 }
 
 func (req listTelemetryReq) validate() error {
@@ -65,5 +96,381 @@ func (req listTelemetryReq) validate() error {
 		return ErrInvalidDateRange
 	}
 
+	if req.cursor != "" {
+		if req.offset != 0 {
+			return ErrInvalidQueryParams
+		}
+		if _, err := callhome.ParsePageCursor(req.cursor); err != nil {
+			return err
+		}
+	}
+
+	switch req.total {
+	case "", totalExact, totalEstimate:
+	default:
+		return ErrInvalidQueryParams
+	}
+
+	return req.filters().Validate()
+}
+
+type timeSeriesReq struct {
+	listTelemetryReq
+	interval string
+	splitBy  string
+}
+
+func (req timeSeriesReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	q := callhome.TimeSeriesQuery{Interval: req.interval, SplitBy: req.splitBy}
+	return q.Validate()
+}
+
+type transitionsReq struct {
+	listTelemetryReq
+	interval string
+}
+
+func (req transitionsReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	q := callhome.TimeSeriesQuery{Interval: req.interval}
+	return q.Validate()
+}
+
+type summaryReq struct {
+	listTelemetryReq
+	// top is the number of values of each dimension, all of them if zero.
+	top          uint64
+	compare      string
+	baselineFrom time.Time
+	baselineTo   time.Time
+}
+
+func (req summaryReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	if req.top > maxSummaryTop {
+		return ErrLimitSize
+	}
+	return req.query().Validate()
+}
+
+func (req summaryReq) query() callhome.SummaryQuery {
+	return callhome.SummaryQuery{
+		Top:          int(req.top),
+		Compare:      req.compare,
+		BaselineFrom: req.baselineFrom,
+		BaselineTo:   req.baselineTo,
+	}
+}
+
+type retentionReq struct {
+	listTelemetryReq
+	interval string
+	window   time.Duration
+}
+
+func (req retentionReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	q := callhome.RetentionQuery{Interval: req.interval, InactivityWindow: req.window}
+	return q.Validate()
+}
+
+type aggregateReq struct {
+	listTelemetryReq
+	groupBy []string
+	metrics []string
+	order   string
+	top     uint64
+}
+
+func (req aggregateReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	if req.top < 1 || req.top > callhome.MaxAggregateTop {
+		return ErrLimitSize
+	}
+	return req.query().Validate()
+}
+
+func (req aggregateReq) query() callhome.AggregateQuery {
+	return callhome.AggregateQuery{
+		GroupBy: req.groupBy,
+		Metrics: req.metrics,
+		Order:   req.order,
+		Top:     int(req.top),
+	}
+}
+
+type silentReq struct {
+	listTelemetryReq
+	threshold time.Duration
+	lookback  time.Duration
+}
+
+func (req silentReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	return req.query().Validate()
+}
+
+func (req silentReq) query() callhome.SilentQuery {
+	return callhome.SilentQuery{Threshold: req.threshold, Lookback: req.lookback}
+}
+
+type exportReq struct {
+	listTelemetryReq
+	format string
+	rows   string
+}
+
+func (req exportReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	return req.query().Validate()
+}
+
+func (req exportReq) query() callhome.ExportQuery {
+	return callhome.ExportQuery{Format: req.format, Rows: req.rows}
+}
+
+type mapPointsReq struct {
+	listTelemetryReq
+	bbox *callhome.BoundingBox
+	zoom uint64
+}
+
+func (req mapPointsReq) validate() error {
+	if err := req.listTelemetryReq.validate(); err != nil {
+		return err
+	}
+	if req.zoom > callhome.MaxMapZoom {
+		return callhome.ErrInvalidMapQuery
+	}
+	return req.query().Validate()
+}
+
+func (req mapPointsReq) query() callhome.MapQuery {
+	return callhome.MapQuery{BBox: req.bbox, Zoom: int(req.zoom)}
+}
+
+type deploymentReq struct {
+	listTelemetryReq
+	id string
+}
+
+func (req deploymentReq) validate() error {
+	if req.id == "" {
+		return ErrMalformedEntity
+	}
+	return req.listTelemetryReq.validate()
+}
+
+type createWebhookReq struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (req createWebhookReq) validate() error {
+	if req.URL == "" || len(req.Events) == 0 {
+		return ErrMalformedEntity
+	}
+	return nil
+}
+
+type webhookReq struct {
+	id string
+}
+
+func (req webhookReq) validate() error {
+	if req.id == "" {
+		return ErrMalformedEntity
+	}
 	return nil
 }
+
+type webhookDeliveriesReq struct {
+	webhookReq
+	limit uint64
+}
+
+func (req webhookDeliveriesReq) validate() error {
+	if req.limit == 0 || req.limit > callhome.MaxDeliveries {
+		return ErrLimitSize
+	}
+	return req.webhookReq.validate()
+}
+
+// Grafana JSON datasource targets. Time series targets may be split by
+// appending grafanaBy and a time series split, table targets are grafanaTable
+// followed by grafanaBy and a dimension.
+const (
+	grafanaActive = "active_deployments"
+	grafanaTable  = "deployments"
+	grafanaBy     = "_by_"
+
+	grafanaTypeTable = "table"
+	// grafanaVersions is the default annotation query, marking the first
+	// heartbeat of each version.
+	grafanaVersions = "versions"
+)
+
+// grafanaTargets lists the targets returned by the Grafana search.
+var grafanaTargets = []string{
+	grafanaActive,
+	grafanaActive + grafanaBy + callhome.SplitByCountry,
+	grafanaActive + grafanaBy + callhome.SplitByService,
+	grafanaActive + grafanaBy + callhome.SplitByVersion,
+	grafanaTable + grafanaBy + countryKey,
+	grafanaTable + grafanaBy + cityKey,
+	grafanaTable + grafanaBy + serviceKey,
+	grafanaTable + grafanaBy + versionKey,
+}
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func (r grafanaRange) validate() error {
+	if r.From.IsZero() || r.To.IsZero() || r.To.Before(r.From) {
+		return ErrInvalidDateRange
+	}
+	return nil
+}
+
+// grafanaFilters are the telemetry filters of a target, given as the target
+// data, or the payload in newer versions of the datasource.
+type grafanaFilters struct {
+	Country string `json:"country"`
+	City    string `json:"city"`
+	Version string `json:"version"`
+	Service string `json:"service"`
+}
+
+type grafanaTarget struct {
+	Target  string          `json:"target"`
+	RefID   string          `json:"refId"`
+	Type    string          `json:"type"`
+	Hide    bool            `json:"hide"`
+	Data    *grafanaFilters `json:"data"`
+	Payload *grafanaFilters `json:"payload"`
+}
+
+// split returns the time series split of a time series target, or the
+// dimension of a table target.
+func (t grafanaTarget) split() (table bool, split string, err error) {
+	switch {
+	case t.Target == grafanaActive:
+		return false, "", nil
+	case strings.HasPrefix(t.Target, grafanaActive+grafanaBy):
+		switch split := strings.TrimPrefix(t.Target, grafanaActive+grafanaBy); split {
+		case callhome.SplitByCountry, callhome.SplitByService, callhome.SplitByVersion:
+			return false, split, nil
+		}
+	case strings.HasPrefix(t.Target, grafanaTable+grafanaBy):
+		switch dim := strings.TrimPrefix(t.Target, grafanaTable+grafanaBy); dim {
+		case countryKey, cityKey, serviceKey, versionKey:
+			return true, dim, nil
+		}
+	}
+	return false, "", ErrMalformedEntity
+}
+
+func (t grafanaTarget) filters(r grafanaRange) callhome.TelemetryFilters {
+	filters := callhome.TelemetryFilters{From: r.From, To: r.To}
+	for _, f := range []*grafanaFilters{t.Data, t.Payload} {
+		if f == nil {
+			continue
+		}
+		filters.Country = f.Country
+		filters.City = f.City
+		filters.Version = f.Version
+		filters.Service = f.Service
+	}
+	return filters
+}
+
+type grafanaSearchReq struct {
+	Target string `json:"target"`
+}
+
+type grafanaQueryReq struct {
+	Range      grafanaRange    `json:"range"`
+	IntervalMs int64           `json:"intervalMs"`
+	Targets    []grafanaTarget `json:"targets"`
+}
+
+func (req grafanaQueryReq) validate() error {
+	if err := req.Range.validate(); err != nil {
+		return err
+	}
+	if req.IntervalMs < 0 {
+		return ErrInvalidQueryParams
+	}
+	for _, t := range req.Targets {
+		if t.Hide {
+			continue
+		}
+		if _, _, err := t.split(); err != nil {
+			return err
+		}
+		if err := t.filters(req.Range).Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interval is the smallest time series interval that is not shorter than the
+// interval Grafana asks for, daily if it asks for none.
+func (req grafanaQueryReq) interval() string {
+	d := time.Duration(req.IntervalMs) * time.Millisecond
+	switch {
+	case d == 0:
+		return callhome.IntervalDay
+	case d <= time.Hour:
+		return callhome.IntervalHour
+	case d <= 24*time.Hour:
+		return callhome.IntervalDay
+	case d <= 7*24*time.Hour:
+		return callhome.IntervalWeek
+	default:
+		return callhome.IntervalMonth
+	}
+}
+
+type grafanaAnnotation struct {
+	Name      string `json:"name"`
+	Enable    bool   `json:"enable"`
+	IconColor string `json:"iconColor"`
+	Query     string `json:"query"`
+}
+
+type grafanaAnnotationsReq struct {
+	Range      grafanaRange      `json:"range"`
+	Annotation grafanaAnnotation `json:"annotation"`
+}
+
+func (req grafanaAnnotationsReq) validate() error {
+	if err := req.Range.validate(); err != nil {
+		return err
+	}
+	switch req.Annotation.Query {
+	case "", grafanaVersions:
+		return nil
+	default:
+		return ErrMalformedEntity
+	}
+}
@@ -4,7 +4,12 @@
 package api
 
 import (
+	"context"
+	"io"
+	"mime"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/absmach/callhome"
 )
@@ -26,6 +31,24 @@ var (
 	_ Response = (*saveTelemetryRes)(nil)
 	_ Response = (*telemetryPageRes)(nil)
 	_ Response = (*telemetrySummaryRes)(nil)
+	_ Response = (*policiesRes)(nil)
+	_ Response = (*timeSeriesRes)(nil)
+	_ Response = (*versionAnalyticsRes)(nil)
+	_ Response = (*transitionsRes)(nil)
+	_ Response = (*retentionRes)(nil)
+	_ Response = (*deploymentRes)(nil)
+	_ Response = (*serviceCompositionRes)(nil)
+	_ Response = (*aggregateRes)(nil)
+	_ Response = (*silentDeploymentsRes)(nil)
+	_ Response = (*webhookRes)(nil)
+	_ Response = (*webhooksRes)(nil)
+	_ Response = (*removeWebhookRes)(nil)
+	_ Response = (*deliveriesRes)(nil)
+	_ Response = (*exportRes)(nil)
+	_ Response = (*mapPointsRes)(nil)
+	_ Response = (*grafanaSearchRes)(nil)
+	_ Response = (*grafanaQueryRes)(nil)
+	_ Response = (*grafanaAnnotationsRes)(nil)
 )
 
 type saveTelemetryRes struct {
@@ -61,6 +84,8 @@ type pageRes struct {
 type telemetryPageRes struct {
 	pageRes
 	Telemetry []callhome.Telemetry `json:"telemetry"`
+	Next      string               `json:"next,omitempty"`
+	Prev      string               `json:"prev,omitempty"`
 }
 
 func (res telemetryPageRes) Code() int {
@@ -104,11 +129,16 @@ func (res uiRes) Headers() map[string]string {
 }
 
 type telemetrySummaryRes struct {
-	Countries        []callhome.CountrySummary `json:"countries,omitempty"`
-	Cities           []string                  `json:"cities,omitempty"`
-	Services         []string                  `json:"services,omitempty"`
-	Versions         []string                  `json:"versions,omitempty"`
-	TotalDeployments int                       `json:"total_deployments,omitempty"`
+	Countries        []callhome.CountrySummary   `json:"countries,omitempty"`
+	Cities           []string                    `json:"cities,omitempty"`
+	Services         []string                    `json:"services,omitempty"`
+	Versions         []string                    `json:"versions,omitempty"`
+	CityCounts       []callhome.ValueSummary     `json:"city_counts,omitempty"`
+	ServiceCounts    []callhome.ValueSummary     `json:"service_counts,omitempty"`
+	VersionCounts    []callhome.ValueSummary     `json:"version_counts,omitempty"`
+	Distinct         callhome.DistinctValues     `json:"distinct"`
+	TotalDeployments int                         `json:"total_deployments,omitempty"`
+	Comparison       *callhome.SummaryComparison `json:"comparison,omitempty"`
 }
 
 // Code implements magistrala.Response.
@@ -125,3 +155,746 @@ func (*telemetrySummaryRes) Empty() bool {
 func (res *telemetrySummaryRes) Headers() map[string]string {
 	return map[string]string{}
 }
+
+type policiesRes struct {
+	ChunkInterval      string `json:"chunk_interval,omitempty"`
+	RetentionPeriod    string `json:"retention_period,omitempty"`
+	CompressionEnabled bool   `json:"compression_enabled"`
+	CompressAfter      string `json:"compress_after,omitempty"`
+	CompressSegmentBy  string `json:"compress_segment_by,omitempty"`
+}
+
+func newPoliciesRes(p callhome.StoragePolicies) policiesRes {
+	return policiesRes{
+		ChunkInterval:      formatDuration(p.ChunkInterval),
+		RetentionPeriod:    formatDuration(p.RetentionPeriod),
+		CompressionEnabled: p.CompressionEnabled,
+		CompressAfter:      formatDuration(p.CompressAfter),
+		CompressSegmentBy:  p.CompressSegmentBy,
+	}
+}
+
+// Code implements magistrala.Response.
+func (res policiesRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res policiesRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res policiesRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type timeSeriesRes struct {
+	Interval string                      `json:"interval"`
+	SplitBy  string                      `json:"split_by,omitempty"`
+	Buckets  []callhome.TimeSeriesBucket `json:"buckets"`
+}
+
+// Code implements magistrala.Response.
+func (res timeSeriesRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res timeSeriesRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res timeSeriesRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type versionStatsRes struct {
+	Version        string    `json:"version"`
+	Deployments    int       `json:"deployments"`
+	Share          float64   `json:"share"`
+	FirstSeen      time.Time `json:"first_seen"`
+	TimeToMajority string    `json:"time_to_majority,omitempty"`
+}
+
+type versionAnalyticsRes struct {
+	Versions             []versionStatsRes `json:"versions"`
+	TotalDeployments     int               `json:"total_deployments"`
+	Latest               string            `json:"latest,omitempty"`
+	LatestShare          float64           `json:"latest_share"`
+	MedianTimeToMajority string            `json:"median_time_to_majority,omitempty"`
+}
+
+func newVersionAnalyticsRes(va callhome.VersionAnalytics) versionAnalyticsRes {
+	res := versionAnalyticsRes{
+		Versions:             []versionStatsRes{},
+		TotalDeployments:     va.TotalDeployments,
+		Latest:               va.Latest,
+		LatestShare:          va.LatestShare,
+		MedianTimeToMajority: formatDuration(va.MedianTimeToMajority),
+	}
+	for _, vs := range va.Versions {
+		v := versionStatsRes{
+			Version:     vs.Version,
+			Deployments: vs.Deployments,
+			Share:       vs.Share,
+			FirstSeen:   vs.FirstSeen,
+		}
+		if vs.TimeToMajority != nil {
+			v.TimeToMajority = vs.TimeToMajority.String()
+		}
+		res.Versions = append(res.Versions, v)
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res versionAnalyticsRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res versionAnalyticsRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res versionAnalyticsRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type transitionsRes struct {
+	Interval    string                     `json:"interval"`
+	Transitions []callhome.TransitionCount `json:"transitions"`
+	Periods     []callhome.UpgradeBucket   `json:"periods"`
+}
+
+func newTransitionsRes(vt callhome.VersionTransitions) transitionsRes {
+	res := transitionsRes{
+		Interval:    vt.Interval,
+		Transitions: vt.Matrix,
+		Periods:     vt.Periods,
+	}
+	if res.Transitions == nil {
+		res.Transitions = []callhome.TransitionCount{}
+	}
+	if res.Periods == nil {
+		res.Periods = []callhome.UpgradeBucket{}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res transitionsRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res transitionsRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res transitionsRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type retentionRes struct {
+	Interval         string                    `json:"interval"`
+	InactivityWindow string                    `json:"inactivity_window"`
+	Periods          []callhome.ActivityPeriod `json:"periods"`
+	Cohorts          []callhome.Cohort         `json:"cohorts"`
+}
+
+func newRetentionRes(r callhome.Retention) retentionRes {
+	res := retentionRes{
+		Interval:         r.Interval,
+		InactivityWindow: formatDuration(r.InactivityWindow),
+		Periods:          r.Periods,
+		Cohorts:          r.Cohorts,
+	}
+	if res.Periods == nil {
+		res.Periods = []callhome.ActivityPeriod{}
+	}
+	if res.Cohorts == nil {
+		res.Cohorts = []callhome.Cohort{}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res retentionRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res retentionRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res retentionRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type aggregateRes struct {
+	GroupBy []string                 `json:"group_by"`
+	Metrics []string                 `json:"metrics"`
+	Order   string                   `json:"order"`
+	Top     int                      `json:"top"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// newAggregateRes keys the groups and metrics of each row by their names.
+func newAggregateRes(a callhome.Aggregate) aggregateRes {
+	res := aggregateRes{
+		GroupBy: a.GroupBy,
+		Metrics: a.Metrics,
+		Order:   a.Order,
+		Top:     a.Top,
+		Rows:    make([]map[string]interface{}, len(a.Rows)),
+	}
+	for i, row := range a.Rows {
+		res.Rows[i] = make(map[string]interface{}, len(row.Groups)+len(row.Metrics))
+		for j, g := range a.GroupBy {
+			res.Rows[i][g] = row.Groups[j]
+		}
+		for j, m := range a.Metrics {
+			res.Rows[i][m] = row.Metrics[j]
+		}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res aggregateRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res aggregateRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res aggregateRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type serviceProfileRes struct {
+	Services    []string `json:"services"`
+	Deployments int      `json:"deployments"`
+	Share       float64  `json:"share"`
+}
+
+type serviceCompositionRes struct {
+	TotalDeployments int                     `json:"total_deployments"`
+	Services         []callhome.ServiceUsage `json:"services"`
+	CoOccurrence     [][]int                 `json:"co_occurrence"`
+	Profiles         []serviceProfileRes     `json:"profiles"`
+}
+
+func newServiceCompositionRes(sc callhome.ServiceComposition) serviceCompositionRes {
+	res := serviceCompositionRes{
+		TotalDeployments: sc.TotalDeployments,
+		Services:         sc.Services,
+		CoOccurrence:     sc.CoOccurrence,
+		Profiles:         make([]serviceProfileRes, len(sc.Profiles)),
+	}
+	for i, p := range sc.Profiles {
+		res.Profiles[i] = serviceProfileRes{Services: p.Services, Deployments: p.Deployments}
+		if sc.TotalDeployments > 0 {
+			res.Profiles[i].Share = float64(p.Deployments) / float64(sc.TotalDeployments)
+		}
+	}
+	if res.Services == nil {
+		res.Services = []callhome.ServiceUsage{}
+	}
+	if res.CoOccurrence == nil {
+		res.CoOccurrence = [][]int{}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res serviceCompositionRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res serviceCompositionRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res serviceCompositionRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type heartbeatGapRes struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+type deploymentRes struct {
+	ID         string                   `json:"id"`
+	Country    string                   `json:"country,omitempty"`
+	City       string                   `json:"city,omitempty"`
+	Latitude   float64                  `json:"latitude,omitempty"`
+	Longitude  float64                  `json:"longitude,omitempty"`
+	Version    string                   `json:"magistrala_version,omitempty"`
+	Services   []string                 `json:"services"`
+	FirstSeen  time.Time                `json:"first_seen"`
+	LastSeen   time.Time                `json:"last_seen"`
+	Versions   []callhome.VersionPeriod `json:"versions"`
+	From       time.Time                `json:"from"`
+	To         time.Time                `json:"to"`
+	Heartbeats int                      `json:"heartbeats"`
+	Gaps       []heartbeatGapRes        `json:"gaps"`
+	Uptime     float64                  `json:"uptime"`
+}
+
+func newDeploymentRes(d callhome.DeploymentDetail) deploymentRes {
+	res := deploymentRes{
+		ID:         d.ID,
+		Country:    d.Latest.Country,
+		City:       d.Latest.City,
+		Latitude:   d.Latest.Latitude,
+		Longitude:  d.Latest.Longitude,
+		Version:    d.Latest.Version,
+		Services:   d.Latest.Services,
+		FirstSeen:  d.FirstSeen,
+		LastSeen:   d.Latest.ServiceTime,
+		Versions:   d.Versions,
+		From:       d.From,
+		To:         d.To,
+		Heartbeats: d.Heartbeats,
+		Gaps:       make([]heartbeatGapRes, len(d.Gaps)),
+		Uptime:     d.Uptime,
+	}
+	for i, g := range d.Gaps {
+		res.Gaps[i] = heartbeatGapRes{Start: g.Start, End: g.End, Duration: g.End.Sub(g.Start).String()}
+	}
+	if res.Services == nil {
+		res.Services = []string{}
+	}
+	if res.Versions == nil {
+		res.Versions = []callhome.VersionPeriod{}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res deploymentRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res deploymentRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res deploymentRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type silentDeploymentRes struct {
+	ID       string    `json:"id"`
+	Country  string    `json:"country,omitempty"`
+	City     string    `json:"city,omitempty"`
+	Version  string    `json:"magistrala_version,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+	Cadence  string    `json:"cadence"`
+	Silence  string    `json:"silence"`
+}
+
+type silentDeploymentsRes struct {
+	Threshold   string                 `json:"threshold"`
+	Lookback    string                 `json:"lookback"`
+	Total       int                    `json:"total"`
+	Offset      uint64                 `json:"offset"`
+	Limit       uint64                 `json:"limit"`
+	Deployments []silentDeploymentRes  `json:"deployments"`
+	Groups      []callhome.SilentGroup `json:"groups"`
+}
+
+// newSilentDeploymentsRes lists a page of the silent deployments, and all of their groups.
+func newSilentDeploymentsRes(sd callhome.SilentDeployments, offset, limit uint64) silentDeploymentsRes {
+	res := silentDeploymentsRes{
+		Threshold:   sd.Threshold.String(),
+		Lookback:    sd.Lookback.String(),
+		Total:       len(sd.Deployments),
+		Offset:      offset,
+		Limit:       limit,
+		Deployments: []silentDeploymentRes{},
+		Groups:      sd.Groups,
+	}
+	for i := offset; i < offset+limit && i < uint64(len(sd.Deployments)); i++ {
+		d := sd.Deployments[i]
+		res.Deployments = append(res.Deployments, silentDeploymentRes{
+			ID:       d.ID,
+			Country:  d.Country,
+			City:     d.City,
+			Version:  d.Version,
+			LastSeen: d.LastSeen,
+			Cadence:  d.Cadence.String(),
+			Silence:  d.Silence.Round(time.Second).String(),
+		})
+	}
+	if res.Groups == nil {
+		res.Groups = []callhome.SilentGroup{}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res silentDeploymentsRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res silentDeploymentsRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res silentDeploymentsRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+type webhookRes struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only returned when the webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	created   bool
+}
+
+func newWebhookRes(w callhome.Webhook) webhookRes {
+	return webhookRes{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+// Code implements magistrala.Response.
+func (res webhookRes) Code() int {
+	if res.created {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res webhookRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res webhookRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type webhooksRes struct {
+	Webhooks []webhookRes `json:"webhooks"`
+}
+
+// Code implements magistrala.Response.
+func (res webhooksRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res webhooksRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res webhooksRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type removeWebhookRes struct{}
+
+// Code implements magistrala.Response.
+func (res removeWebhookRes) Code() int {
+	return http.StatusNoContent
+}
+
+// Empty implements magistrala.Response.
+func (res removeWebhookRes) Empty() bool {
+	return true
+}
+
+// Headers implements magistrala.Response.
+func (res removeWebhookRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type deliveryRes struct {
+	callhome.Delivery
+	Succeeded bool `json:"succeeded"`
+}
+
+type deliveriesRes struct {
+	Deliveries []deliveryRes `json:"deliveries"`
+}
+
+// Code implements magistrala.Response.
+func (res deliveriesRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res deliveriesRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res deliveriesRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type exportRes struct {
+	query    callhome.ExportQuery
+	filename string
+	export   func(ctx context.Context, w io.Writer) error
+}
+
+// Code implements magistrala.Response.
+func (res exportRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res exportRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res exportRes) Headers() map[string]string {
+	return map[string]string{
+		"Content-Type":        res.query.ContentType(),
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": res.filename}),
+	}
+}
+
+// mapPointsRes is a GeoJSON feature collection of map points.
+type mapPointsRes struct {
+	Type      string       `json:"type"`
+	BBox      []float64    `json:"bbox,omitempty"`
+	Features  []mapFeature `json:"features"`
+	Zoom      int          `json:"zoom"`
+	Clustered bool         `json:"clustered"`
+	Total     int          `json:"total"`
+}
+
+type mapFeature struct {
+	Type       string        `json:"type"`
+	Geometry   mapGeometry   `json:"geometry"`
+	Properties mapProperties `json:"properties"`
+}
+
+type mapGeometry struct {
+	Type string `json:"type"`
+	// Coordinates are the longitude and the latitude.
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// mapProperties are the deployment of single points, or the number of
+// deployments in clusters.
+type mapProperties struct {
+	Cluster bool `json:"cluster"`
+	Count   int  `json:"count"`
+	*callhome.Telemetry
+}
+
+func newMapPointsRes(mp callhome.MapPoints) mapPointsRes {
+	res := mapPointsRes{
+		Type:      "FeatureCollection",
+		Features:  make([]mapFeature, len(mp.Points)),
+		Zoom:      mp.Zoom,
+		Clustered: mp.Zoom < callhome.ClusterMaxZoom,
+		Total:     mp.Total,
+	}
+	if b := mp.BBox; b != nil {
+		res.BBox = []float64{b.West, b.South, b.East, b.North}
+	}
+	for i, p := range mp.Points {
+		res.Features[i] = mapFeature{
+			Type:     "Feature",
+			Geometry: mapGeometry{Type: "Point", Coordinates: [2]float64{p.Longitude, p.Latitude}},
+			Properties: mapProperties{
+				Cluster:   p.Deployment == nil,
+				Count:     p.Count,
+				Telemetry: p.Deployment,
+			},
+		}
+	}
+	return res
+}
+
+// Code implements magistrala.Response.
+func (res mapPointsRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res mapPointsRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res mapPointsRes) Headers() map[string]string {
+	return map[string]string{"Content-Type": "application/geo+json"}
+}
+
+type grafanaSearchRes []string
+
+// Code implements magistrala.Response.
+func (res grafanaSearchRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res grafanaSearchRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res grafanaSearchRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+// grafanaSeries is a time series of a Grafana query, with data points of the
+// value and the time in milliseconds.
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// newGrafanaSeries makes a time series of each group of the buckets, ordered
+// by group. Buckets without a group belong to the target series.
+func newGrafanaSeries(t grafanaTarget, ts callhome.TimeSeries) []grafanaSeries {
+	var series []grafanaSeries
+	groups := make(map[string]int)
+	for _, b := range ts.Buckets {
+		name := t.Target
+		if ts.SplitBy != "" {
+			name = b.Group
+			if name == "" {
+				name = callhome.FleetUnknown
+			}
+		}
+		i, ok := groups[name]
+		if !ok {
+			i = len(series)
+			groups[name] = i
+			series = append(series, grafanaSeries{Target: name, RefID: t.RefID, Datapoints: [][2]float64{}})
+		}
+		series[i].Datapoints = append(series[i].Datapoints, [2]float64{float64(b.ActiveDeployments), float64(b.Time.UnixMilli())})
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Target < series[j].Target
+	})
+	return series
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTableRes struct {
+	Type    string          `json:"type"`
+	RefID   string          `json:"refId,omitempty"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// newGrafanaTable makes a table of the deployments by the summary dimension,
+// most deployments first.
+func newGrafanaTable(t grafanaTarget, dim string, s callhome.TelemetrySummary) grafanaTableRes {
+	var counts []callhome.ValueSummary
+	switch dim {
+	case countryKey:
+		for _, c := range s.Countries {
+			counts = append(counts, callhome.ValueSummary{Value: c.Country, NoDeployments: c.NoDeployments})
+		}
+	case cityKey:
+		counts = s.CityCounts
+	case serviceKey:
+		counts = s.ServiceCounts
+	case versionKey:
+		counts = s.VersionCounts
+	}
+	res := grafanaTableRes{
+		Type:    grafanaTypeTable,
+		RefID:   t.RefID,
+		Columns: []grafanaColumn{{Text: dim, Type: "string"}, {Text: "deployments", Type: "number"}},
+		Rows:    [][]interface{}{},
+	}
+	for _, c := range counts {
+		res.Rows = append(res.Rows, []interface{}{c.Value, c.NoDeployments})
+	}
+	return res
+}
+
+// grafanaQueryRes holds the grafanaSeries and grafanaTableRes of the targets.
+type grafanaQueryRes []interface{}
+
+// Code implements magistrala.Response.
+func (res grafanaQueryRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res grafanaQueryRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res grafanaQueryRes) Headers() map[string]string {
+	return map[string]string{}
+}
+
+type grafanaAnnotationRes struct {
+	Annotation grafanaAnnotation `json:"annotation"`
+	// Time is in milliseconds.
+	Time  int64    `json:"time"`
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags"`
+}
+
+type grafanaAnnotationsRes []grafanaAnnotationRes
+
+// Code implements magistrala.Response.
+func (res grafanaAnnotationsRes) Code() int {
+	return http.StatusOK
+}
+
+// Empty implements magistrala.Response.
+func (res grafanaAnnotationsRes) Empty() bool {
+	return false
+}
+
+// Headers implements magistrala.Response.
+func (res grafanaAnnotationsRes) Headers() map[string]string {
+	return map[string]string{}
+}
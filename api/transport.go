@@ -5,10 +5,13 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,22 +25,55 @@ import (
 )
 
 const (
-	contentType = "application/json"
-	offsetKey   = "offset"
-	limitKey    = "limit"
-	fromKey     = "from"
-	toKey       = "to"
-	countryKey  = "country"
-	cityKey     = "city"
-	versionKey  = "version"
-	serviceKey  = "service"
-	defOffset   = 0
-	defLimit    = 10
-	staticDir   = "./web/static"
+	contentType  = "application/json"
+	offsetKey    = "offset"
+	limitKey     = "limit"
+	fromKey      = "from"
+	toKey        = "to"
+	countryKey   = "country"
+	cityKey      = "city"
+	versionKey   = "version"
+	serviceKey   = "service"
+	cursorKey    = "cursor"
+	totalKey     = "total"
+	intervalKey  = "interval"
+	splitByKey   = "split_by"
+	windowKey    = "inactivity_window"
+	idKey        = "id"
+	groupByKey   = "group_by"
+	metricsKey   = "metrics"
+	orderKey     = "order"
+	topKey       = "top"
+	compareKey   = "compare"
+	baseFromKey  = "baseline_from"
+	baseToKey    = "baseline_to"
+	thresholdKey = "threshold"
+	lookbackKey  = "lookback"
+	formatKey    = "format"
+	rowsKey      = "rows"
+	bboxKey      = "bbox"
+	zoomKey      = "zoom"
+	nearKey      = "near"
+	radiusKey    = "radius"
+	continentKey = "continent"
+	subRegionKey = "sub_region"
+	defInterval  = callhome.IntervalDay
+	defCohort    = callhome.IntervalWeek
+	defOffset    = 0
+	defLimit     = 10
+	defTop       = 100
+	staticDir    = "./web/static"
+
+	// defDeliveriesLimit is the default number of webhook deliveries listed.
+	defDeliveriesLimit = 100
+
+	authzHeader  = "Authorization"
+	bearerPrefix = "Bearer "
 )
 
 // MakeHandler returns a HTTP handler for API endpoints.
-func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Logger) http.Handler {
+// Admin endpoints require the given admin token and are disabled if it is empty.
+func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Logger, adminToken string) http.Handler {
 	opts := []kithttp.ServerOption{
 		kithttp.ServerErrorEncoder(LoggingErrorEncoder(logger, encodeError)),
 	}
@@ -63,11 +99,91 @@ func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Log
 	mux.Get("/telemetry/summary",
 		otelhttp.NewHandler(kithttp.NewServer(
 			retrieveSummaryEndpoint(svc),
-			decodeRetrieve,
+			decodeRetrieveSummary,
 			encodeResponse,
 			opts...,
 		), "retrieve-summary").ServeHTTP)
 
+	mux.Get("/telemetry/timeseries",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveTimeSeriesEndpoint(svc),
+			decodeRetrieveTimeSeries,
+			encodeResponse,
+			opts...,
+		), "retrieve-time-series").ServeHTTP)
+
+	mux.With(adminAuth(adminToken)).Get("/telemetry/export",
+		otelhttp.NewHandler(kithttp.NewServer(
+			exportTelemetryEndpoint(svc),
+			decodeExportTelemetry,
+			encodeExportResponse,
+			opts...,
+		), "export-telemetry").ServeHTTP)
+
+	mux.Get("/map/points",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveMapPointsEndpoint(svc),
+			decodeRetrieveMapPoints,
+			encodeResponse,
+			opts...,
+		), "retrieve-map-points").ServeHTTP)
+
+	mux.Get("/telemetry/versions",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveVersionAnalyticsEndpoint(svc),
+			decodeRetrieve,
+			encodeResponse,
+			opts...,
+		), "retrieve-version-analytics").ServeHTTP)
+
+	mux.Get("/telemetry/aggregate",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveAggregateEndpoint(svc),
+			decodeRetrieveAggregate,
+			encodeResponse,
+			opts...,
+		), "retrieve-aggregate").ServeHTTP)
+
+	mux.Get("/telemetry/services",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveServiceCompositionEndpoint(svc),
+			decodeRetrieve,
+			encodeResponse,
+			opts...,
+		), "retrieve-service-composition").ServeHTTP)
+
+	mux.Get("/telemetry/transitions",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveVersionTransitionsEndpoint(svc),
+			decodeRetrieveTransitions,
+			encodeResponse,
+			opts...,
+		), "retrieve-version-transitions").ServeHTTP)
+
+	mux.Get("/telemetry/retention",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveRetentionEndpoint(svc),
+			decodeRetrieveRetention,
+			encodeResponse,
+			opts...,
+		), "retrieve-retention").ServeHTTP)
+
+	mux.Get("/deployments/silent",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveSilentDeploymentsEndpoint(svc),
+			decodeRetrieveSilent,
+			encodeResponse,
+			opts...,
+		), "retrieve-silent-deployments").ServeHTTP)
+
+	mux.Get("/deployments/{id}",
+		otelhttp.NewHandler(kithttp.NewServer(
+			retrieveDeploymentEndpoint(svc),
+			decodeRetrieveDeployment,
+			encodeResponse,
+			opts...,
+		), "retrieve-deployment").ServeHTTP)
+
 	mux.Get("/",
 		otelhttp.NewHandler(kithttp.NewServer(
 			serveUI(svc),
@@ -76,6 +192,71 @@ func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Log
 			opts...,
 		), "serve-ui").ServeHTTP)
 
+	mux.Route("/admin", func(r chi.Router) {
+		r.Use(adminAuth(adminToken))
+		r.Get("/policies",
+			otelhttp.NewHandler(kithttp.NewServer(
+				retrievePoliciesEndpoint(svc),
+				kithttp.NopRequestDecoder,
+				encodeResponse,
+				opts...,
+			), "retrieve-policies").ServeHTTP)
+		r.Post("/webhooks",
+			otelhttp.NewHandler(kithttp.NewServer(
+				createWebhookEndpoint(svc),
+				decodeCreateWebhook,
+				encodeResponse,
+				opts...,
+			), "create-webhook").ServeHTTP)
+		r.Get("/webhooks",
+			otelhttp.NewHandler(kithttp.NewServer(
+				retrieveWebhooksEndpoint(svc),
+				kithttp.NopRequestDecoder,
+				encodeResponse,
+				opts...,
+			), "retrieve-webhooks").ServeHTTP)
+		r.Delete("/webhooks/{id}",
+			otelhttp.NewHandler(kithttp.NewServer(
+				removeWebhookEndpoint(svc),
+				decodeWebhook,
+				encodeResponse,
+				opts...,
+			), "remove-webhook").ServeHTTP)
+		r.Get("/webhooks/{id}/deliveries",
+			otelhttp.NewHandler(kithttp.NewServer(
+				retrieveWebhookDeliveriesEndpoint(svc),
+				decodeWebhookDeliveries,
+				encodeResponse,
+				opts...,
+			), "retrieve-webhook-deliveries").ServeHTTP)
+	})
+	mux.Route("/grafana", func(r chi.Router) {
+		// Grafana tests the datasource connection with a request to its URL.
+		r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		r.Post("/search",
+			otelhttp.NewHandler(kithttp.NewServer(
+				grafanaSearchEndpoint(),
+				decodeGrafanaSearch,
+				encodeResponse,
+				opts...,
+			), "grafana-search").ServeHTTP)
+		r.Post("/query",
+			otelhttp.NewHandler(kithttp.NewServer(
+				grafanaQueryEndpoint(svc),
+				decodeGrafanaQuery,
+				encodeResponse,
+				opts...,
+			), "grafana-query").ServeHTTP)
+		r.Post("/annotations",
+			otelhttp.NewHandler(kithttp.NewServer(
+				grafanaAnnotationsEndpoint(svc),
+				decodeGrafanaAnnotations,
+				encodeResponse,
+				opts...,
+			), "grafana-annotations").ServeHTTP)
+	})
 	mux.Get("/health", callhome.Health("home", "telemetry"))
 	mux.Handle("/metrics", promhttp.Handler())
 
@@ -86,6 +267,20 @@ func MakeHandler(svc callhome.Service, tp trace.TracerProvider, logger *slog.Log
 	return mux
 }
 
+// adminAuth only lets through requests bearing the admin token.
+func adminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := strings.TrimPrefix(r.Header.Get(authzHeader), bearerPrefix)
+			if token == "" || subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func encodeStaticResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "text/html")
 	ar, ok := response.(uiRes)
@@ -109,12 +304,43 @@ func encodeStaticResponse(_ context.Context, w http.ResponseWriter, response int
 	return nil
 }
 
+// encodeExportResponse streams the export. Errors are reported with the
+// status code until the first byte is written, and abort the response after.
+func encodeExportResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(exportRes)
+	for k, v := range res.Headers() {
+		w.Header().Set(k, v)
+	}
+	ew := &exportWriter{w: w}
+	if err := res.export(ctx, ew); err != nil {
+		if ew.written {
+			panic(http.ErrAbortHandler)
+		}
+		for k := range res.Headers() {
+			w.Header().Del(k)
+		}
+		return err
+	}
+	return nil
+}
+
+// exportWriter tells whether anything was written to the response.
+type exportWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	ew.written = true
+	return ew.w.Write(p)
+}
+
 func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	if ar, ok := response.(Response); ok {
+		w.Header().Set("Content-Type", contentType)
 		for k, v := range ar.Headers() {
 			w.Header().Set(k, v)
 		}
-		w.Header().Set("Content-Type", contentType)
 		w.WriteHeader(ar.Code())
 
 		if ar.Empty() {
@@ -130,9 +356,25 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	case
 		errors.Is(err, ErrInvalidQueryParams),
 		errors.Is(err, ErrMalformedEntity),
+		errors.Is(err, ErrInvalidDateRange),
+		errors.Is(err, callhome.ErrInvalidCursor),
+		errors.Is(err, callhome.ErrInvalidTimeSeries),
+		errors.Is(err, callhome.ErrInvalidRetentionQuery),
+		errors.Is(err, callhome.ErrInvalidAggregateQuery),
+		errors.Is(err, callhome.ErrInvalidComparison),
+		errors.Is(err, callhome.ErrInvalidSilentQuery),
+		errors.Is(err, callhome.ErrInvalidWebhook),
+		errors.Is(err, callhome.ErrInvalidExport),
+		errors.Is(err, callhome.ErrInvalidMapQuery),
+		errors.Is(err, callhome.ErrInvalidGeoFilter),
+		errors.Is(err, callhome.ErrInvalidFilter),
 		err == ErrLimitSize,
 		err == ErrOffsetSize:
 		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, callhome.ErrDeploymentNotFound),
+		errors.Is(err, callhome.ErrWebhookNotFound),
+		errors.Is(err, callhome.ErrWebhooksDisabled):
+		w.WriteHeader(http.StatusNotFound)
 	case err == ErrUnsupportedContentType:
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 	case errors.Is(err, timescale.ErrInvalidEvent):
@@ -156,6 +398,14 @@ func decodeRetrieve(_ context.Context, r *http.Request) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	cu, err := ReadStringQuery(r, cursorKey, "")
+	if err != nil {
+		return nil, err
+	}
+	tm, err := ReadStringQuery(r, totalKey, "")
+	if err != nil {
+		return nil, err
+	}
 
 	fromString, err := ReadStringQuery(r, fromKey, "")
 	if err != nil {
@@ -184,35 +434,355 @@ func decodeRetrieve(_ context.Context, r *http.Request) (interface{}, error) {
 	} else {
 		to = t.Round(callhome.RoundPeriod)
 	}
-	co, err := ReadStringQuery(r, countryKey, "")
+	co := ReadFilterQuery(r, countryKey)
+	ci := ReadFilterQuery(r, cityKey)
+	ve := ReadFilterQuery(r, versionKey)
+	se := ReadFilterQuery(r, serviceKey)
+
+	bb, err := readBBoxQuery(r)
 	if err != nil {
 		return nil, err
 	}
 
-	ci, err := ReadStringQuery(r, cityKey, "")
+	ne, err := readNearQuery(r)
 	if err != nil {
 		return nil, err
 	}
 
-	ve, err := ReadStringQuery(r, versionKey, "")
+	cn, err := ReadStringQuery(r, continentKey, "")
 	if err != nil {
 		return nil, err
 	}
 
-	se, err := ReadStringQuery(r, serviceKey, "")
+	sr, err := ReadStringQuery(r, subRegionKey, "")
 	if err != nil {
 		return nil, err
 	}
 
 	req := listTelemetryReq{
-		offset:  o,
-		limit:   l,
-		from:    from,
-		to:      to,
-		country: co,
-		city:    ci,
-		version: ve,
-		service: se,
+		offset:    o,
+		limit:     l,
+		cursor:    cu,
+		total:     tm,
+		from:      from,
+		to:        to,
+		country:   co,
+		city:      ci,
+		version:   ve,
+		service:   se,
+		bbox:      bb,
+		near:      ne,
+		continent: cn,
+		subRegion: sr,
+	}
+	return req, nil
+}
+
+func decodeRetrieveTimeSeries(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	in, err := ReadStringQuery(r, intervalKey, defInterval)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := ReadStringQuery(r, splitByKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return timeSeriesReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		interval:         in,
+		splitBy:          sb,
+	}, nil
+}
+
+func decodeRetrieveTransitions(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	in, err := ReadStringQuery(r, intervalKey, defInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return transitionsReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		interval:         in,
+	}, nil
+}
+
+func decodeRetrieveRetention(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	in, err := ReadStringQuery(r, intervalKey, defCohort)
+	if err != nil {
+		return nil, err
+	}
+	w, err := ReadDurationQuery(r, windowKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return retentionReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		interval:         in,
+		window:           w,
+	}, nil
+}
+
+func decodeRetrieveSummary(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	top, err := ReadUintQuery(r, topKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	co, err := ReadStringQuery(r, compareKey, "")
+	if err != nil {
+		return nil, err
+	}
+	bf, err := ReadTimeQuery(r, baseFromKey)
+	if err != nil {
+		return nil, err
+	}
+	bt, err := ReadTimeQuery(r, baseToKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return summaryReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		top:              top,
+		compare:          co,
+		baselineFrom:     bf,
+		baselineTo:       bt,
+	}, nil
+}
+
+func decodeRetrieveAggregate(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	gb, err := ReadStringsQuery(r, groupByKey)
+	if err != nil {
+		return nil, err
+	}
+	me, err := ReadStringsQuery(r, metricsKey)
+	if err != nil {
+		return nil, err
+	}
+	or, err := ReadStringQuery(r, orderKey, "")
+	if err != nil {
+		return nil, err
+	}
+	top, err := ReadUintQuery(r, topKey, defTop)
+	if err != nil {
+		return nil, err
+	}
+
+	return aggregateReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		groupBy:          gb,
+		metrics:          me,
+		order:            or,
+		top:              top,
+	}, nil
+}
+
+func decodeRetrieveSilent(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	th, err := ReadDurationQuery(r, thresholdKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	lb, err := ReadDurationQuery(r, lookbackKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return silentReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		threshold:        th,
+		lookback:         lb,
+	}, nil
+}
+
+func decodeRetrieveMapPoints(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	zo, err := ReadUintQuery(r, zoomKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	// The bounding box is the visible area of the map rather than a filter,
+	// so the deployments matching the filters are cached for any area.
+	lr := req.(listTelemetryReq)
+	bb := lr.bbox
+	lr.bbox = nil
+
+	return mapPointsReq{
+		listTelemetryReq: lr,
+		bbox:             bb,
+		zoom:             zo,
+	}, nil
+}
+
+// readBBoxQuery reads the bounding box as west,south,east,north degrees, nil
+// if it is missing.
+func readBBoxQuery(r *http.Request) (*callhome.BoundingBox, error) {
+	vals, err := ReadStringsQuery(r, bboxKey)
+	if err != nil || len(vals) == 0 {
+		return nil, err
+	}
+	if len(vals) != 4 {
+		return nil, ErrInvalidQueryParams
+	}
+	var bounds [4]float64
+	for i, p := range vals {
+		if bounds[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+			return nil, ErrInvalidQueryParams
+		}
+	}
+	return &callhome.BoundingBox{West: bounds[0], South: bounds[1], East: bounds[2], North: bounds[3]}, nil
+}
+
+// readNearQuery reads the circle of the latitude,longitude center and the
+// radius in kilometres, nil if both are missing.
+func readNearQuery(r *http.Request) (*callhome.GeoCircle, error) {
+	vals, err := ReadStringsQuery(r, nearKey)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := ReadStringQuery(r, radiusKey, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 && rs == "" {
+		return nil, nil
+	}
+	if len(vals) != 2 || rs == "" {
+		return nil, ErrInvalidQueryParams
+	}
+	var c callhome.GeoCircle
+	if c.Latitude, err = strconv.ParseFloat(strings.TrimSpace(vals[0]), 64); err != nil {
+		return nil, ErrInvalidQueryParams
+	}
+	if c.Longitude, err = strconv.ParseFloat(strings.TrimSpace(vals[1]), 64); err != nil {
+		return nil, ErrInvalidQueryParams
+	}
+	if c.Radius, err = strconv.ParseFloat(rs, 64); err != nil {
+		return nil, ErrInvalidQueryParams
+	}
+	return &c, nil
+}
+
+func decodeExportTelemetry(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	fo, err := ReadStringQuery(r, formatKey, callhome.FormatCSV)
+	if err != nil {
+		return nil, err
+	}
+	ro, err := ReadStringQuery(r, rowsKey, callhome.ExportHeartbeats)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		format:           fo,
+		rows:             ro,
+	}, nil
+}
+
+func decodeRetrieveDeployment(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeRetrieve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return deploymentReq{
+		listTelemetryReq: req.(listTelemetryReq),
+		id:               chi.URLParam(r, idKey),
+	}, nil
+}
+
+func decodeCreateWebhook(_ context.Context, r *http.Request) (interface{}, error) {
+	if !strings.Contains(r.Header.Get("Content-Type"), contentType) {
+		return nil, ErrUnsupportedContentType
+	}
+
+	var req createWebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.Join(ErrMalformedEntity, err)
+	}
+	return req, nil
+}
+
+func decodeWebhook(_ context.Context, r *http.Request) (interface{}, error) {
+	return webhookReq{id: chi.URLParam(r, idKey)}, nil
+}
+
+func decodeWebhookDeliveries(_ context.Context, r *http.Request) (interface{}, error) {
+	l, err := ReadUintQuery(r, limitKey, defDeliveriesLimit)
+	if err != nil {
+		return nil, err
+	}
+	return webhookDeliveriesReq{
+		webhookReq: webhookReq{id: chi.URLParam(r, idKey)},
+		limit:      l,
+	}, nil
+}
+
+func decodeGrafanaSearch(_ context.Context, r *http.Request) (interface{}, error) {
+	if !strings.Contains(r.Header.Get("Content-Type"), contentType) {
+		return nil, ErrUnsupportedContentType
+	}
+
+	// Older versions of Grafana search without a body.
+	var req grafanaSearchReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return nil, errors.Join(ErrMalformedEntity, err)
+	}
+	return req, nil
+}
+
+func decodeGrafanaQuery(_ context.Context, r *http.Request) (interface{}, error) {
+	if !strings.Contains(r.Header.Get("Content-Type"), contentType) {
+		return nil, ErrUnsupportedContentType
+	}
+
+	var req grafanaQueryReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.Join(ErrMalformedEntity, err)
+	}
+	return req, nil
+}
+
+func decodeGrafanaAnnotations(_ context.Context, r *http.Request) (interface{}, error) {
+	if !strings.Contains(r.Header.Get("Content-Type"), contentType) {
+		return nil, ErrUnsupportedContentType
+	}
+
+	var req grafanaAnnotationsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.Join(ErrMalformedEntity, err)
 	}
 	return req, nil
 }
@@ -9,6 +9,8 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/go-zoo/bone"
@@ -60,3 +62,50 @@ func ReadStringQuery(r *http.Request, key string, def string) (string, error) {
 	}
 	return vals[0], nil
 }
+
+// ReadDurationQuery reads the value of duration http query parameters for a given key.
+func ReadDurationQuery(r *http.Request, key string, def time.Duration) (time.Duration, error) {
+	vals := bone.GetQuery(r, key)
+	if len(vals) > 1 {
+		return 0, ErrInvalidQueryParams
+	}
+	if len(vals) == 0 {
+		return def, nil
+	}
+	val, err := time.ParseDuration(vals[0])
+	if err != nil {
+		return 0, ErrInvalidQueryParams
+	}
+	return val, nil
+}
+
+// ReadStringsQuery reads the comma-separated or repeated values of string http query parameters for a given key.
+func ReadStringsQuery(r *http.Request, key string) ([]string, error) {
+	var vals []string
+	for _, v := range bone.GetQuery(r, key) {
+		if v == "" {
+			return nil, ErrInvalidQueryParams
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// ReadFilterQuery reads the filter expression of http query parameters for a
+// given key. Repeated parameters are joined as comma-separated values.
+func ReadFilterQuery(r *http.Request, key string) string {
+	return strings.Join(bone.GetQuery(r, key), ",")
+}
+
+// ReadTimeQuery reads the RFC 3339 time of http query parameters for a given key, zero if it is missing.
+func ReadTimeQuery(r *http.Request, key string) (time.Time, error) {
+	val, err := ReadStringQuery(r, key, "")
+	if err != nil || val == "" {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, ErrInvalidQueryParams
+	}
+	return t, nil
+}
@@ -5,10 +5,12 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"time"
 
@@ -17,13 +19,15 @@ import (
 	"github.com/absmach/callhome/internal"
 	jaegerClient "github.com/absmach/callhome/internal/clients/jaeger"
 	"github.com/absmach/callhome/internal/clients/postgres"
+	sqliteClient "github.com/absmach/callhome/internal/clients/sqlite"
 	"github.com/absmach/callhome/internal/env"
 	"github.com/absmach/callhome/internal/server"
 	httpserver "github.com/absmach/callhome/internal/server/http"
+	"github.com/absmach/callhome/sqlite"
 	"github.com/absmach/callhome/timescale"
 	"github.com/absmach/callhome/timescale/tracing"
 	stracing "github.com/absmach/callhome/tracing"
-	"github.com/jmoiron/sqlx"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
@@ -33,30 +37,56 @@ const (
 	envPrefix      = "MG_CALLHOME_"
 	envPrefixHttp  = "MG_CALLHOME_"
 	defSvcHttpPort = "8855"
+
+	dbTypeTimescale = "timescale"
+	dbTypeSQLite    = "sqlite"
+
+	// silentInterval is how often the silent deployments gauge is updated.
+	silentInterval = 5 * time.Minute
+	// fleetInterval is how often the fleet gauges are updated.
+	fleetInterval = time.Minute
 )
 
 type config struct {
 	LogLevel       string `env:"MG_CALLHOME_LOG_LEVEL"       envDefault:"info"`
 	JaegerURL      string `env:"MG_JAEGER_URL"               envDefault:"http://jaeger:14268/api/traces"`
 	IPDatabaseFile string `env:"MG_CALLHOME_IP_DB"           envDefault:"./IP2LOCATION-LITE-DB5.BIN"`
+	AdminToken     string `env:"MG_CALLHOME_ADMIN_TOKEN"     envDefault:""`
+	DBType         string `env:"MG_CALLHOME_DB_TYPE"         envDefault:"timescale"`
 }
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	g, ctx := errgroup.WithContext(ctx)
-
 	cfg := config{}
 	if err := env.Parse(&cfg); err != nil {
 		log.Fatalf("failed to load %s configuration : %s", svcName, err)
 	}
 
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(context.Background(), cfg.DBType, args[1:], os.Stdout); err != nil {
+			log.Fatalf("failed to migrate %s database : %s", cfg.DBType, err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet(svcName, flag.ExitOnError)
+	noMigrate := fs.Bool("no-migrate", false, "serve without applying pending database migrations")
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("failed to parse %s flags : %s", svcName, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g, ctx := errgroup.WithContext(ctx)
+
 	logger, err := newLogger(os.Stdout, cfg.LogLevel)
 	if err != nil {
 		log.Fatalf("failed to init logger: %s", err.Error())
 	}
-	timescaleDB, err := postgres.Setup(envPrefix, timescale.Migration())
+	repo, webhookRepo, err := newRepo(ctx, cfg.DBType, !*noMigrate)
 	if err != nil {
-		log.Fatalf("failed to setup timescale db : %s", err)
+		log.Fatalf("failed to setup %s repository : %s", cfg.DBType, err)
 	}
 
 	tp, err := jaegerClient.NewProvider(svcName, cfg.JaegerURL)
@@ -65,7 +95,13 @@ func main() {
 	}
 	tracer := tp.Tracer(svcName)
 
-	svc, err := newService(ctx, logger, cfg.IPDatabaseFile, timescaleDB, tracer)
+	webhookCfg := callhome.WebhookConfig{}
+	if err := env.Parse(&webhookCfg, env.Options{Prefix: envPrefix}); err != nil {
+		log.Fatalf("failed to load %s webhook configuration : %s", svcName, err)
+	}
+	hooks := callhome.NewWebhooks(webhookRepo, tracing.New(tracer, repo), &http.Client{}, webhookCfg)
+
+	svc, err := newService(ctx, logger, cfg.IPDatabaseFile, repo, hooks, tracer)
 	if err != nil {
 		log.Fatalf("failed to initialize service: %s", err)
 	}
@@ -80,7 +116,18 @@ func main() {
 		logger.Error(fmt.Sprintf("failed to load %s HTTP server configuration : %s", svcName, err.Error()))
 		return
 	}
-	hs := httpserver.New(ctx, cancel, svcName, httpServerConfig, api.MakeHandler(svc, tp, logger), logger)
+	anomalyCfg := callhome.AnomalyConfig{}
+	if err := env.Parse(&anomalyCfg, env.Options{Prefix: envPrefix}); err != nil {
+		logger.Error(fmt.Sprintf("failed to load %s anomaly monitor configuration : %s", svcName, err.Error()))
+		return
+	}
+	monitor, err := callhome.NewAnomalyMonitor(tracing.New(tracer, repo), api.LoggingNotifier(logger), anomalyCfg)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to create %s anomaly monitor : %s", svcName, err.Error()))
+		return
+	}
+
+	hs := httpserver.New(ctx, cancel, svcName, httpServerConfig, api.MakeHandler(svc, tp, logger, cfg.AdminToken), logger)
 
 	g.Go(func() error {
 		return hs.Start()
@@ -90,20 +137,96 @@ func main() {
 		return server.StopSignalHandler(ctx, cancel, logger, svcName, hs)
 	})
 
+	g.Go(func() error {
+		gauge := api.NewSilentGauge(svcName, "fleet", stdprometheus.DefaultRegisterer)
+		return api.RecordSilentDeployments(ctx, svc, gauge, silentInterval, logger)
+	})
+
+	g.Go(func() error {
+		gauges := api.NewFleetGauges(svcName, "fleet", stdprometheus.DefaultRegisterer)
+		return api.RecordFleetMetrics(ctx, svc, gauges, callhome.FleetQuery{}, fleetInterval, logger)
+	})
+
+	g.Go(func() error {
+		return api.MonitorAnomalies(ctx, monitor, logger)
+	})
+
+	g.Go(func() error {
+		return api.PublishMilestones(ctx, hooks, logger)
+	})
+
 	if err := g.Wait(); err != nil {
 		logger.Error(fmt.Sprintf("%s service terminated: %s", svcName, err))
 	}
+	// Pending deliveries are finished rather than lost on shutdown, unless
+	// they outlast the shutdown timeout.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), webhookCfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := hooks.Shutdown(shutdownCtx); err != nil {
+		logger.Warn(fmt.Sprintf("pending webhook deliveries canceled on shutdown: %s", err))
+	}
+}
+
+// newRepo sets up the telemetry and webhook repositories of the given
+// database type, applying pending migrations if migrate is set.
+func newRepo(ctx context.Context, dbType string, migrate bool) (callhome.TelemetryRepo, callhome.WebhookRepo, error) {
+	switch dbType {
+	case dbTypeSQLite:
+		dbCfg := sqliteClient.Config{}
+		if err := dbCfg.LoadEnv(envPrefix); err != nil {
+			return nil, nil, err
+		}
+		db, err := sqliteClient.Connect(dbCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if migrate {
+			if err := sqliteClient.MigrateDB(db, sqlite.Migration()); err != nil {
+				return nil, nil, err
+			}
+		}
+		return sqlite.New(db), sqlite.NewWebhookRepo(db), nil
+	case dbTypeTimescale:
+		dbCfg := postgres.Config{}
+		if err := dbCfg.LoadEnv(envPrefix); err != nil {
+			return nil, nil, err
+		}
+		db, err := postgres.Connect(dbCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if migrate {
+			policyCfg := timescale.PolicyConfig{}
+			if err := env.Parse(&policyCfg, env.Options{Prefix: envPrefix}); err != nil {
+				return nil, nil, fmt.Errorf("failed to load storage policy configuration : %w", err)
+			}
+			// Policies are reconciled under the migration lock, so instances
+			// starting together do not each add the same policy.
+			reconcile := func() error {
+				return timescale.ReconcilePolicies(ctx, db, policyCfg)
+			}
+			if err := postgres.MigrateDB(db, dbCfg, timescale.Migration(), reconcile); err != nil {
+				return nil, nil, err
+			}
+		}
+		replicaDB, err := postgres.ConnectReplica(dbCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return timescale.NewWithReplica(db, replicaDB), timescale.NewWebhookRepo(db), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported database type %q", dbType)
+	}
 }
 
-func newService(ctx context.Context, logger *slog.Logger, ipDB string, timescaleDB *sqlx.DB, tracer trace.Tracer) (callhome.Service, error) {
-	timescaleRepo := timescale.New(timescaleDB)
-	timescaleRepo = tracing.New(tracer, timescaleRepo)
+func newService(ctx context.Context, logger *slog.Logger, ipDB string, repo callhome.TelemetryRepo, hooks *callhome.Webhooks, tracer trace.Tracer) (callhome.Service, error) {
+	repo = tracing.New(tracer, repo)
 	locSvc, err := callhome.NewLocationService(ipDB)
 	if err != nil {
 		return nil, err
 	}
 	locSvc = stracing.NewLocationService(tracer, locSvc)
-	svc := callhome.New(timescaleRepo, locSvc)
+	svc := callhome.New(repo, locSvc, hooks)
 	svc = stracing.NewService(tracer, svc)
 	counter, latency := internal.MakeMetrics(svcName, "api")
 	svc = api.MetricsMiddleware(svc, counter, latency)
@@ -0,0 +1,186 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/absmach/callhome/internal/clients/postgres"
+	sqliteClient "github.com/absmach/callhome/internal/clients/sqlite"
+	"github.com/absmach/callhome/sqlite"
+	"github.com/absmach/callhome/timescale"
+	"github.com/jmoiron/sqlx"
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+const migrateUsage = `Usage: callhome migrate <command> [flags]
+
+Commands:
+  up      apply all pending migrations
+  down    roll back the latest migrations, one unless -steps is set
+  status  list migrations and when they were applied
+  redo    roll back and reapply the latest migration
+
+Flags:
+`
+
+var errMigrateUsage = errors.New("invalid migrate command")
+
+// migrations are the schema migrations of the configured database.
+type migrations struct {
+	db      *sqlx.DB
+	dialect string
+	source  migrate.MemoryMigrationSource
+	// lock serializes migrations across instances sharing the database and
+	// returns the function releasing the lock.
+	lock func(ctx context.Context) (func() error, error)
+}
+
+// newMigrations connects to the database of the given type without migrating it.
+func newMigrations(dbType string) (migrations, error) {
+	switch dbType {
+	case dbTypeSQLite:
+		cfg := sqliteClient.Config{}
+		if err := cfg.LoadEnv(envPrefix); err != nil {
+			return migrations{}, err
+		}
+		db, err := sqliteClient.Connect(cfg)
+		if err != nil {
+			return migrations{}, err
+		}
+		// SQLite serializes the migration transactions on its own.
+		noLock := func(context.Context) (func() error, error) {
+			return func() error { return nil }, nil
+		}
+		return migrations{db: db, dialect: sqliteClient.Dialect, source: sqlite.Migration(), lock: noLock}, nil
+	case dbTypeTimescale:
+		cfg := postgres.Config{}
+		if err := cfg.LoadEnv(envPrefix); err != nil {
+			return migrations{}, err
+		}
+		db, err := postgres.Connect(cfg)
+		if err != nil {
+			return migrations{}, err
+		}
+		lock := func(ctx context.Context) (func() error, error) {
+			return postgres.Lock(ctx, cfg)
+		}
+		return migrations{db: db, dialect: postgres.Dialect, source: timescale.Migration(), lock: lock}, nil
+	default:
+		return migrations{}, fmt.Errorf("unsupported database type %q", dbType)
+	}
+}
+
+// runMigrate runs the migrate subcommand with the given arguments.
+func runMigrate(ctx context.Context, dbType string, args []string, out io.Writer) (err error) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	steps := fs.Int("steps", 1, "number of migrations to roll back with down, 0 rolls back all of them")
+	fs.Usage = func() {
+		fmt.Fprint(out, migrateUsage)
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return errMigrateUsage
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *steps < 0 {
+		return fmt.Errorf("%w: negative steps", errMigrateUsage)
+	}
+
+	m, err := newMigrations(dbType)
+	if err != nil {
+		return err
+	}
+	defer m.db.Close()
+
+	switch command {
+	case "up":
+		return m.locked(ctx, func() error {
+			return m.exec(out, migrate.Up, 0)
+		})
+	case "down":
+		return m.locked(ctx, func() error {
+			return m.exec(out, migrate.Down, *steps)
+		})
+	case "redo":
+		// Other instances must not migrate between rolling back and
+		// reapplying.
+		return m.locked(ctx, func() error {
+			if err := m.exec(out, migrate.Down, 1); err != nil {
+				return err
+			}
+			return m.exec(out, migrate.Up, 1)
+		})
+	case "status":
+		return m.status(out)
+	default:
+		fs.Usage()
+		return fmt.Errorf("%w: %s", errMigrateUsage, command)
+	}
+}
+
+// locked runs fn while holding the migration lock.
+func (m migrations) locked(ctx context.Context, fn func() error) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, unlock())
+	}()
+	return fn()
+}
+
+// exec applies at most max migrations in the given direction, or all of them if
+// max is 0.
+func (m migrations) exec(out io.Writer, dir migrate.MigrationDirection, max int) error {
+	n, err := migrate.ExecMax(m.db.DB, m.dialect, m.source, dir, max)
+	if err != nil {
+		return err
+	}
+	action := "applied"
+	if dir == migrate.Down {
+		action = "rolled back"
+	}
+	fmt.Fprintf(out, "%s %d migrations\n", action, n)
+	return nil
+}
+
+// status prints every known migration and when it was applied.
+func (m migrations) status(out io.Writer) error {
+	known, err := m.source.FindMigrations()
+	if err != nil {
+		return err
+	}
+	records, err := migrate.GetMigrationRecords(m.db.DB, m.dialect)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, r := range records {
+		applied[r.Id] = r.AppliedAt
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tAPPLIED AT")
+	for _, mig := range known {
+		at := "pending"
+		if t, ok := applied[mig.Id]; ok {
+			at = t.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", mig.Id, at)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Baselines a summary is compared with.
+const (
+	// ComparePrevious compares with the period of equal length right before
+	// the summarised range.
+	ComparePrevious = "previous"
+	// CompareCustom compares with the range of the summary query baseline.
+	CompareCustom = "custom"
+)
+
+// ErrInvalidComparison indicates an unsupported baseline or an invalid range.
+var ErrInvalidComparison = errors.New("invalid comparison")
+
+// SummaryQuery specifies how many values of each dimension are summarised
+// and what the summary is compared with.
+type SummaryQuery struct {
+	// Top is the number of values of each dimension, all of them if zero.
+	Top int
+	// Compare is the baseline, none if empty.
+	Compare string
+	// BaselineFrom and BaselineTo bound a custom baseline.
+	BaselineFrom time.Time
+	BaselineTo   time.Time
+}
+
+// Validate checks the query uses a supported baseline.
+func (q SummaryQuery) Validate() error {
+	switch q.Compare {
+	case "", ComparePrevious:
+		return nil
+	case CompareCustom:
+		if q.BaselineFrom.IsZero() || !q.BaselineTo.After(q.BaselineFrom) {
+			return ErrInvalidComparison
+		}
+		return nil
+	default:
+		return ErrInvalidComparison
+	}
+}
+
+// baseline returns the filters of the baseline summary. The previous period
+// is only known for bounded ranges.
+func (q SummaryQuery) baseline(filters TelemetryFilters) (TelemetryFilters, error) {
+	switch q.Compare {
+	case ComparePrevious:
+		if filters.From.IsZero() || !filters.To.After(filters.From) {
+			return TelemetryFilters{}, ErrInvalidComparison
+		}
+		filters.From, filters.To = filters.From.Add(-filters.To.Sub(filters.From)), filters.From
+	case CompareCustom:
+		filters.From, filters.To = q.BaselineFrom, q.BaselineTo
+	}
+	return filters, nil
+}
+
+// Change compares a count with its baseline.
+type Change struct {
+	Baseline int `json:"baseline"`
+	Delta    int `json:"delta"`
+	// Percent is the change relative to the baseline, nil if the baseline is zero.
+	Percent *float64 `json:"percent"`
+}
+
+func newChange(current, baseline int) Change {
+	c := Change{Baseline: baseline, Delta: current - baseline}
+	if baseline != 0 {
+		p := 100 * float64(c.Delta) / float64(baseline)
+		c.Percent = &p
+	}
+	return c
+}
+
+// SummaryComparison compares a summary with its baseline.
+type SummaryComparison struct {
+	// From and To bound the baseline.
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	TotalDeployments Change    `json:"total_deployments"`
+	// Countries compares the number of countries.
+	Countries Change `json:"countries"`
+	// CountryChanges, CityChanges, ServiceChanges and VersionChanges are in the
+	// order of the values of the summary.
+	CountryChanges []Change `json:"country_changes,omitempty"`
+	CityChanges    []Change `json:"city_changes,omitempty"`
+	ServiceChanges []Change `json:"service_changes,omitempty"`
+	VersionChanges []Change `json:"version_changes,omitempty"`
+}
+
+// compareSummaries compares every count of the summary with the baseline
+// summary of the given range.
+func compareSummaries(s, baseline TelemetrySummary, from, to time.Time) SummaryComparison {
+	countries := make(map[string]int, len(baseline.Countries))
+	for _, c := range baseline.Countries {
+		countries[c.Country] = c.NoDeployments
+	}
+	sc := SummaryComparison{
+		From:             from,
+		To:               to,
+		TotalDeployments: newChange(s.TotalDeployments, baseline.TotalDeployments),
+		Countries:        newChange(s.Distinct.Countries, len(baseline.Countries)),
+		CityChanges:      compareValues(s.CityCounts, baseline.CityCounts),
+		ServiceChanges:   compareValues(s.ServiceCounts, baseline.ServiceCounts),
+		VersionChanges:   compareValues(s.VersionCounts, baseline.VersionCounts),
+	}
+	for _, c := range s.Countries {
+		sc.CountryChanges = append(sc.CountryChanges, newChange(c.NoDeployments, countries[c.Country]))
+	}
+	return sc
+}
+
+func compareValues(counts, baseline []ValueSummary) []Change {
+	prev := make(map[string]int, len(baseline))
+	for _, c := range baseline {
+		prev[c.Value] = c.NoDeployments
+	}
+	var changes []Change
+	for _, c := range counts {
+		changes = append(changes, newChange(c.NoDeployments, prev[c.Value]))
+	}
+	return changes
+}
+
+// growth is a change as shown on the dashboard.
+type growth struct {
+	Percent string
+	Up      bool
+}
+
+// dashboardGrowth formats the relative change, nil if the baseline is zero.
+func dashboardGrowth(c Change) *growth {
+	if c.Percent == nil {
+		return nil
+	}
+	return &growth{Percent: fmt.Sprintf("%+.0f%%", *c.Percent), Up: c.Delta >= 0}
+}
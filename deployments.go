@@ -0,0 +1,91 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"time"
+)
+
+// HeartbeatInterval is how often the callhome client reports.
+const HeartbeatInterval = 30 * time.Minute
+
+// gapThreshold is the silence after which a deployment is considered down. It
+// allows a single heartbeat to be lost.
+const gapThreshold = 2 * HeartbeatInterval
+
+// ErrDeploymentNotFound indicates there are no heartbeats of the deployment.
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
+// VersionPeriod is the time a deployment reported a version.
+type VersionPeriod struct {
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Deployment is the identity and history of a single deployment.
+type Deployment struct {
+	// ID is the public deployment identifier, see Telemetry.DeploymentID.
+	ID string
+	// Latest is the latest heartbeat, along with the services of all heartbeats.
+	Latest    Telemetry
+	FirstSeen time.Time
+	// Versions are ordered by the time they were first reported. A version the
+	// deployment returned to is reported once, spanning both periods.
+	Versions []VersionPeriod
+}
+
+// HeartbeatGap is a silence longer than the heartbeat interval allows.
+type HeartbeatGap struct {
+	Start time.Time
+	End   time.Time
+}
+
+// DeploymentDetail describes a deployment and its heartbeats in a time range.
+type DeploymentDetail struct {
+	Deployment
+	// From and To bound the analysed range, clipped to the first heartbeat of
+	// the deployment and the current time.
+	From time.Time
+	To   time.Time
+	// Heartbeats is the number of distinct heartbeat times in the range.
+	Heartbeats int
+	// Gaps are ordered by time. Silences at the bounds of the range are gaps
+	// starting at From or ending at To.
+	Gaps []HeartbeatGap
+	// Uptime is the estimated fraction of the range the deployment was up.
+	Uptime float64
+}
+
+// analyzeHeartbeats finds the gaps between the ordered heartbeats in the range
+// from until to and estimates uptime, counting each gap as down apart from a
+// single heartbeat interval. A deployment without heartbeats in the range was
+// down throughout it.
+func analyzeHeartbeats(beats []time.Time, from, to time.Time) ([]HeartbeatGap, float64) {
+	if !to.After(from) {
+		return nil, 0
+	}
+	var gaps []HeartbeatGap
+	var down time.Duration
+	prev, up := from, false
+	silence := func(until time.Time) {
+		if d := until.Sub(prev); d > gapThreshold {
+			gaps = append(gaps, HeartbeatGap{Start: prev, End: until})
+			down += d - HeartbeatInterval
+		}
+	}
+	for _, b := range beats {
+		if b.Before(from) || b.After(to) {
+			continue
+		}
+		silence(b)
+		prev, up = b, true
+	}
+	silence(to)
+	if !up {
+		return []HeartbeatGap{{Start: from, End: to}}, 0
+	}
+	return gaps, 1 - float64(down)/float64(to.Sub(from))
+}
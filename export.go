@@ -0,0 +1,181 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Export formats.
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Exported rows.
+const (
+	// ExportHeartbeats exports every heartbeat.
+	ExportHeartbeats = "heartbeats"
+	// ExportDeployments exports the latest heartbeat of each deployment.
+	ExportDeployments = "deployments"
+)
+
+// exportRowGroup is the number of rows buffered in a Parquet row group, which
+// bounds the memory used by Parquet exports.
+const exportRowGroup = 10000
+
+// ErrInvalidExport indicates an unsupported export format or rows.
+var ErrInvalidExport = errors.New("invalid export query")
+
+// exportColumns are the CSV header, in the order of ExportRow fields.
+var exportColumns = []string{"deployment_id", "time", "last_seen", "services", "version", "country", "city", "region", "latitude", "longitude"}
+
+// ExportQuery specifies what is exported and how it is encoded.
+type ExportQuery struct {
+	// Format is one of the Format constants.
+	Format string
+	// Rows is one of the Export constants.
+	Rows string
+}
+
+// Validate checks the format and the rows are supported.
+func (q ExportQuery) Validate() error {
+	switch q.Format {
+	case FormatCSV, FormatNDJSON, FormatParquet:
+	default:
+		return ErrInvalidExport
+	}
+	switch q.Rows {
+	case ExportHeartbeats, ExportDeployments:
+	default:
+		return ErrInvalidExport
+	}
+	return nil
+}
+
+// ContentType is the media type of the export format.
+func (q ExportQuery) ContentType() string {
+	switch q.Format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// ExportRow is an exported heartbeat, or the latest heartbeat of a deployment
+// along with all the services it runs. Heartbeats have a single service.
+type ExportRow struct {
+	DeploymentID string    `json:"deployment_id" parquet:"deployment_id"`
+	Time         time.Time `json:"time" parquet:"time,timestamp(millisecond)"`
+	// LastSeen is the time reported by the deployment.
+	LastSeen  time.Time `json:"last_seen" parquet:"last_seen,timestamp(millisecond)"`
+	Services  []string  `json:"services" parquet:"services,list"`
+	Version   string    `json:"version" parquet:"version"`
+	Country   string    `json:"country" parquet:"country"`
+	City      string    `json:"city" parquet:"city"`
+	Region    string    `json:"region" parquet:"region"`
+	Latitude  float64   `json:"latitude" parquet:"latitude"`
+	Longitude float64   `json:"longitude" parquet:"longitude"`
+}
+
+func newExportRow(t Telemetry) ExportRow {
+	services := []string(t.Services)
+	if t.Service != "" {
+		services = []string{t.Service}
+	}
+	return ExportRow{
+		DeploymentID: t.DeploymentID,
+		Time:         t.ServiceTime.UTC(),
+		LastSeen:     t.LastSeen.UTC(),
+		Services:     services,
+		Version:      t.Version,
+		Country:      t.Country,
+		City:         t.City,
+		Region:       t.Region,
+		Latitude:     t.Latitude,
+		Longitude:    t.Longitude,
+	}
+}
+
+// exportEncoder writes rows one at a time. Close must be called to flush
+// the buffered rows.
+type exportEncoder interface {
+	Encode(r ExportRow) error
+	Close() error
+}
+
+func newExportEncoder(format string, w io.Writer) (exportEncoder, error) {
+	switch format {
+	case FormatCSV:
+		enc := &csvEncoder{w: csv.NewWriter(w)}
+		return enc, enc.w.Write(exportColumns)
+	case FormatNDJSON:
+		return ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return parquetEncoder{w: parquet.NewGenericWriter[ExportRow](w, parquet.MaxRowsPerRowGroup(exportRowGroup))}, nil
+	default:
+		return nil, ErrInvalidExport
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (enc *csvEncoder) Encode(r ExportRow) error {
+	return enc.w.Write([]string{
+		r.DeploymentID,
+		r.Time.Format(time.RFC3339Nano),
+		r.LastSeen.Format(time.RFC3339Nano),
+		strings.Join(r.Services, ","),
+		r.Version,
+		r.Country,
+		r.City,
+		r.Region,
+		strconv.FormatFloat(r.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(r.Longitude, 'f', -1, 64),
+	})
+}
+
+func (enc *csvEncoder) Close() error {
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (enc ndjsonEncoder) Encode(r ExportRow) error {
+	return enc.enc.Encode(r)
+}
+
+func (enc ndjsonEncoder) Close() error {
+	return nil
+}
+
+type parquetEncoder struct {
+	w *parquet.GenericWriter[ExportRow]
+}
+
+func (enc parquetEncoder) Encode(r ExportRow) error {
+	_, err := enc.w.Write([]ExportRow{r})
+	return err
+}
+
+func (enc parquetEncoder) Close() error {
+	return enc.w.Close()
+}
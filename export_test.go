@@ -0,0 +1,104 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportQueryValidate(t *testing.T) {
+	cases := []struct {
+		desc  string
+		query callhome.ExportQuery
+		err   error
+	}{
+		{"csv heartbeats", callhome.ExportQuery{Format: callhome.FormatCSV, Rows: callhome.ExportHeartbeats}, nil},
+		{"parquet deployments", callhome.ExportQuery{Format: callhome.FormatParquet, Rows: callhome.ExportDeployments}, nil},
+		{"unknown format", callhome.ExportQuery{Format: "xlsx", Rows: callhome.ExportHeartbeats}, callhome.ErrInvalidExport},
+		{"unknown rows", callhome.ExportQuery{Format: callhome.FormatNDJSON, Rows: "countries"}, callhome.ErrInvalidExport},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.query.Validate())
+		})
+	}
+}
+
+func TestExportTelemetry(t *testing.T) {
+	ctx := context.TODO()
+	at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	repo := memory.New()
+	heartbeats := []callhome.Telemetry{
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.13.0", Country: "Serbia", City: "Belgrade", Latitude: 44.8, Longitude: 20.4, ServiceTime: at.Add(-time.Hour), LastSeen: at.Add(-time.Hour)},
+		{IpAddress: "10.0.0.1", Service: "things", Version: "0.14.0", Country: "Serbia", City: "Belgrade", Latitude: 44.8, Longitude: 20.4, ServiceTime: at, LastSeen: at},
+	}
+	for _, hb := range heartbeats {
+		require.Nil(t, repo.Save(ctx, hb))
+	}
+	svc := callhome.New(repo, nil, nil)
+	id := deploymentIDs(t, repo)["10.0.0.1"]
+
+	t.Run("invalid query", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := svc.ExportTelemetry(ctx, callhome.ExportQuery{Format: "xlsx", Rows: callhome.ExportHeartbeats}, callhome.TelemetryFilters{}, &buf)
+		assert.ErrorIs(t, err, callhome.ErrInvalidExport)
+		assert.Zero(t, buf.Len())
+	})
+	t.Run("csv heartbeats", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := svc.ExportTelemetry(ctx, callhome.ExportQuery{Format: callhome.FormatCSV, Rows: callhome.ExportHeartbeats}, callhome.TelemetryFilters{}, &buf)
+		require.Nil(t, err)
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.Nil(t, err)
+		assert.Equal(t, [][]string{
+			{"deployment_id", "time", "last_seen", "services", "version", "country", "city", "region", "latitude", "longitude"},
+			{id, "2024-03-01T11:00:00Z", "2024-03-01T11:00:00Z", "users", "0.13.0", "Serbia", "Belgrade", "", "44.8", "20.4"},
+			{id, "2024-03-01T12:00:00Z", "2024-03-01T12:00:00Z", "things", "0.14.0", "Serbia", "Belgrade", "", "44.8", "20.4"},
+		}, records)
+	})
+	t.Run("ndjson deployments", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := svc.ExportTelemetry(ctx, callhome.ExportQuery{Format: callhome.FormatNDJSON, Rows: callhome.ExportDeployments}, callhome.TelemetryFilters{}, &buf)
+		require.Nil(t, err)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 1)
+		var row callhome.ExportRow
+		require.Nil(t, json.Unmarshal([]byte(lines[0]), &row))
+		assert.Equal(t, callhome.ExportRow{
+			DeploymentID: id,
+			Time:         at,
+			LastSeen:     at,
+			Services:     []string{"things", "users"},
+			Version:      "0.14.0",
+			Country:      "Serbia",
+			City:         "Belgrade",
+			Latitude:     44.8,
+			Longitude:    20.4,
+		}, row)
+	})
+	t.Run("parquet heartbeats", func(t *testing.T) {
+		var buf bytes.Buffer
+		filters := callhome.TelemetryFilters{Version: "0.14.0"}
+		err := svc.ExportTelemetry(ctx, callhome.ExportQuery{Format: callhome.FormatParquet, Rows: callhome.ExportHeartbeats}, filters, &buf)
+		require.Nil(t, err)
+		rows, err := parquet.Read[callhome.ExportRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.Nil(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, id, rows[0].DeploymentID)
+		assert.True(t, at.Equal(rows[0].Time), "expected time %s, got %s", at, rows[0].Time)
+		assert.Equal(t, []string{"things"}, rows[0].Services)
+	})
+}
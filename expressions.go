@@ -0,0 +1,245 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/absmach/callhome/internal/semver"
+)
+
+// Version comparison operators of version ranges.
+const (
+	OpEqual        = "="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+)
+
+// ErrInvalidFilter indicates a malformed filter expression.
+var ErrInvalidFilter = errors.New("invalid filter expression")
+
+// VersionKey is the major, minor and patch numbers of a semantic version
+// followed by 0 for pre-releases and 1 for releases. Keys compare with the
+// keys of releases as the versions are ordered by SemVer 2.0.0, which is why
+// range bounds are releases. It reports false if the version is not semantic.
+func VersionKey(version string) ([]uint64, bool) {
+	v, err := semver.Parse(version)
+	if err != nil {
+		return nil, false
+	}
+	key := []uint64{v.Major, v.Minor, v.Patch, 1}
+	if v.IsPrerelease() {
+		key[3] = 0
+	}
+	return key, true
+}
+
+// VersionBound compares versions with a release.
+type VersionBound struct {
+	Op    string
+	Major uint64
+	Minor uint64
+	Patch uint64
+}
+
+// Key is the VersionKey of the release of the bound.
+func (b VersionBound) Key() []uint64 {
+	return []uint64{b.Major, b.Minor, b.Patch, 1}
+}
+
+// Contains reports whether the version key compares with the bound as its
+// operator requires.
+func (b VersionBound) Contains(key []uint64) bool {
+	c := slices.Compare(key, b.Key())
+	switch b.Op {
+	case OpLess:
+		return c < 0
+	case OpLessEqual:
+		return c <= 0
+	case OpGreater:
+		return c > 0
+	case OpGreaterEqual:
+		return c >= 0
+	default:
+		return c == 0
+	}
+}
+
+func (b VersionBound) String() string {
+	return fmt.Sprintf("%s%d.%d.%d", b.Op, b.Major, b.Minor, b.Patch)
+}
+
+// VersionRange is the versions within all its bounds.
+type VersionRange []VersionBound
+
+// Contains reports whether the version is semantic and within the range.
+func (r VersionRange) Contains(version string) bool {
+	key, ok := VersionKey(version)
+	if !ok {
+		return false
+	}
+	for _, b := range r {
+		if !b.Contains(key) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r VersionRange) String() string {
+	bounds := make([]string, len(r))
+	for i, b := range r {
+		bounds[i] = b.String()
+	}
+	return strings.Join(bounds, " ")
+}
+
+// ValueFilter is a parsed filter expression. An expression is a
+// comma-separated list of values, each excluded if prefixed with "!", such as
+// "Serbia,France" or "!bootstrap". Version expressions may also list ranges of
+// space-separated bounds, such as ">=0.14.0 <0.16".
+type ValueFilter struct {
+	// Values are matched exactly. Any value matches if there are neither
+	// values nor ranges.
+	Values []string
+	// Excluded values never match.
+	Excluded []string
+	// Ranges match the versions within any of them.
+	Ranges []VersionRange
+}
+
+// ParseValueFilter parses a filter expression of values. The empty
+// expression matches any value.
+func ParseValueFilter(expr string) (ValueFilter, error) {
+	return parseFilter(expr, false)
+}
+
+// ParseVersionFilter parses a filter expression of versions and version
+// ranges. The empty expression matches any version.
+func ParseVersionFilter(expr string) (ValueFilter, error) {
+	return parseFilter(expr, true)
+}
+
+func parseFilter(expr string, versions bool) (ValueFilter, error) {
+	var f ValueFilter
+	if expr == "" {
+		return f, nil
+	}
+	for _, item := range strings.Split(expr, ",") {
+		item = strings.TrimSpace(item)
+		excluded := strings.HasPrefix(item, "!")
+		if excluded {
+			item = strings.TrimSpace(item[1:])
+		}
+		// Tilde and caret ranges are rejected as unknown operators, rather
+		// than matched as versions.
+		isRange := versions && strings.ContainsAny(item, "<>=~^ ")
+		switch {
+		case item == "", excluded && isRange:
+			return ValueFilter{}, ErrInvalidFilter
+		case excluded:
+			f.Excluded = append(f.Excluded, item)
+		case isRange:
+			r, err := parseVersionRange(item)
+			if err != nil {
+				return ValueFilter{}, err
+			}
+			f.Ranges = append(f.Ranges, r)
+		default:
+			f.Values = append(f.Values, item)
+		}
+	}
+	f.Values = uniqueSorted(f.Values)
+	f.Excluded = uniqueSorted(f.Excluded)
+	sort.Slice(f.Ranges, func(i, j int) bool {
+		return f.Ranges[i].String() < f.Ranges[j].String()
+	})
+	return f, nil
+}
+
+func parseVersionRange(s string) (VersionRange, error) {
+	var r VersionRange
+	for _, b := range strings.Fields(s) {
+		// Bounds without an operator are exact.
+		op := OpEqual
+		for _, o := range []string{OpGreaterEqual, OpLessEqual, OpGreater, OpLess, OpEqual} {
+			if strings.HasPrefix(b, o) {
+				op, b = o, b[len(o):]
+				break
+			}
+		}
+		// Bounds are releases, whose minor and patch numbers default to zero.
+		v, err := semver.Parse(b)
+		if err != nil || v.IsPrerelease() {
+			return nil, ErrInvalidFilter
+		}
+		r = append(r, VersionBound{Op: op, Major: v.Major, Minor: v.Minor, Patch: v.Patch})
+	}
+	return r, nil
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	ret := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			ret = append(ret, v)
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// Matches reports whether the value passes the filter.
+func (f ValueFilter) Matches(value string) bool {
+	if contains(f.Excluded, value) {
+		return false
+	}
+	if len(f.Values) == 0 && len(f.Ranges) == 0 {
+		return true
+	}
+	if contains(f.Values, value) {
+		return true
+	}
+	for _, r := range f.Ranges {
+		if r.Contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// String is the canonical expression of the filter, with values, exclusions
+// and ranges each sorted, so equivalent expressions are equal.
+func (f ValueFilter) String() string {
+	items := append([]string{}, f.Values...)
+	for _, v := range f.Excluded {
+		items = append(items, "!"+v)
+	}
+	for _, r := range f.Ranges {
+		items = append(items, r.String())
+	}
+	return strings.Join(items, ",")
+}
+
+func contains(sorted []string, value string) bool {
+	i := sort.SearchStrings(sorted, value)
+	return i < len(sorted) && sorted[i] == value
+}
+
+// ValueFilters are the parsed country, city, service and version filters.
+type ValueFilters struct {
+	Country ValueFilter
+	City    ValueFilter
+	Service ValueFilter
+	Version ValueFilter
+}
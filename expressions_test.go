@@ -0,0 +1,111 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersionFilter(t *testing.T) {
+	cases := []struct {
+		desc      string
+		expr      string
+		canonical string
+		err       error
+	}{
+		{desc: "empty", expr: ""},
+		{desc: "single value", expr: "0.14.0", canonical: "0.14.0"},
+		{desc: "values are sorted and deduplicated", expr: "0.14.0, 0.13.0,0.14.0", canonical: "0.13.0,0.14.0"},
+		{desc: "negation", expr: "!0.13.0", canonical: "!0.13.0"},
+		{desc: "range with partial bounds", expr: ">=0.14 <v1", canonical: ">=0.14.0 <1.0.0"},
+		{desc: "values, negations and ranges", expr: "<0.12,!0.13.0,0.14.0,=0.15", canonical: "0.14.0,!0.13.0,<0.12.0,=0.15.0"},
+		{desc: "empty value", expr: "0.13.0,,0.14.0", err: callhome.ErrInvalidFilter},
+		{desc: "empty negation", expr: "!", err: callhome.ErrInvalidFilter},
+		{desc: "negated range", expr: "!<0.14", err: callhome.ErrInvalidFilter},
+		{desc: "pre-release bound", expr: "<0.14.0-rc1", err: callhome.ErrInvalidFilter},
+		{desc: "unknown operator", expr: "~0.14", err: callhome.ErrInvalidFilter},
+		{desc: "invalid operator", expr: "=>0.14", err: callhome.ErrInvalidFilter},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			f, err := callhome.ParseVersionFilter(tc.expr)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.canonical, f.String())
+		})
+	}
+}
+
+func TestValueFilterMatches(t *testing.T) {
+	countries, err := callhome.ParseValueFilter("Serbia,France")
+	assert.Nil(t, err)
+	assert.True(t, countries.Matches("France"))
+	assert.False(t, countries.Matches("Spain"))
+
+	services, err := callhome.ParseValueFilter("!bootstrap")
+	assert.Nil(t, err)
+	assert.True(t, services.Matches("users"))
+	assert.True(t, services.Matches(""))
+	assert.False(t, services.Matches("bootstrap"))
+
+	// Values of value filters are not version ranges.
+	cities, err := callhome.ParseValueFilter("<0.14")
+	assert.Nil(t, err)
+	assert.True(t, cities.Matches("<0.14"))
+
+	versions, err := callhome.ParseVersionFilter("0.13.0-rc1,>=0.14.0 <0.16,!0.15.2")
+	assert.Nil(t, err)
+	for v, ok := range map[string]bool{
+		"0.13.0-rc1":   true,
+		"0.13.0":       false,
+		"0.14.0":       true,
+		"v0.15.1":      true,
+		"0.15.1+build": true,
+		"0.15.2":       false,
+		"0.16.0-rc1":   true,
+		"0.16.0":       false,
+		"0.14.0-rc1":   false,
+		"0.15":         true,
+		"v0.14-rc.2":   false,
+		"latest":       false,
+	} {
+		assert.Equal(t, ok, versions.Matches(v), v)
+	}
+}
+
+func TestVersionKey(t *testing.T) {
+	key, ok := callhome.VersionKey("v0.14.2-rc1+build.5")
+	assert.True(t, ok)
+	assert.Equal(t, []uint64{0, 14, 2, 0}, key)
+
+	key, ok = callhome.VersionKey("1.0.0")
+	assert.True(t, ok)
+	assert.Equal(t, []uint64{1, 0, 0, 1}, key)
+
+	key, ok = callhome.VersionKey("v1")
+	assert.True(t, ok)
+	assert.Equal(t, []uint64{1, 0, 0, 1}, key)
+
+	for _, v := range []string{"", "1.0.0.0", "1.0.0-", "v", "dev"} {
+		_, ok := callhome.VersionKey(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestTelemetryFiltersValueFilters(t *testing.T) {
+	filters := callhome.TelemetryFilters{Country: "France,Serbia", City: "!Paris", Version: ">=0.14 <0.16,0.13.0"}
+	assert.Nil(t, filters.Validate())
+	assert.True(t, filters.MatchesValues(callhome.Telemetry{Country: "Serbia", City: "Belgrade", Version: "0.15.0", Service: "users"}))
+	assert.False(t, filters.MatchesValues(callhome.Telemetry{Country: "France", City: "Paris", Version: "0.15.0", Service: "users"}))
+
+	equivalent := callhome.TelemetryFilters{Country: "Serbia,France", City: "!Paris", Version: "0.13.0,>=0.14.0 <0.16.0"}
+	assert.Equal(t, filters.ValueFilters(), equivalent.ValueFilters())
+
+	// Invalid expressions are matched as a single value.
+	invalid := callhome.TelemetryFilters{Country: "Serbia,,France"}
+	assert.ErrorIs(t, invalid.Validate(), callhome.ErrInvalidFilter)
+	assert.Equal(t, []string{"Serbia,,France"}, invalid.ValueFilters().Country.Values)
+}
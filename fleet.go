@@ -0,0 +1,102 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultFleetWindow is the period deployments must have reported in to
+	// count as active.
+	DefaultFleetWindow = 24 * time.Hour
+	// DefaultFleetTop is the default number of values kept per dimension.
+	DefaultFleetTop = 20
+	// MaxFleetTop bounds the number of values kept per dimension, and so the
+	// cardinality of metrics labelled by them.
+	MaxFleetTop = 100
+)
+
+// Labels of values folded together by fleet metrics.
+const (
+	// FleetOther groups the values beyond the top ones.
+	FleetOther = "other"
+	// FleetUnknown groups heartbeats without a value.
+	FleetUnknown = "unknown"
+)
+
+// ErrInvalidFleetQuery indicates a malformed fleet metrics query.
+var ErrInvalidFleetQuery = errors.New("invalid fleet metrics query")
+
+// FleetQuery specifies how fleet metrics are computed.
+type FleetQuery struct {
+	// Window is DefaultFleetWindow if zero.
+	Window time.Duration
+	// Top is the number of values kept per dimension, DefaultFleetTop if zero.
+	// The remaining values are summed up as FleetOther.
+	Top int
+}
+
+// Validate checks the window is not negative and the top is bounded.
+func (q FleetQuery) Validate() error {
+	if q.Window < 0 || q.Top < 0 || q.Top > MaxFleetTop {
+		return ErrInvalidFleetQuery
+	}
+	return nil
+}
+
+// WithDefaults sets the default window and top.
+func (q FleetQuery) WithDefaults() FleetQuery {
+	if q.Window == 0 {
+		q.Window = DefaultFleetWindow
+	}
+	if q.Top == 0 {
+		q.Top = DefaultFleetTop
+	}
+	return q
+}
+
+// FleetMetrics are business metrics of the whole fleet.
+type FleetMetrics struct {
+	FleetQuery
+	// Versions, Countries and Services count the active deployments by
+	// value, most deployments first, with at most Top values and FleetOther.
+	Versions  []ValueSummary
+	Countries []ValueSummary
+	Services  []ValueSummary
+	// Heartbeats is the number of heartbeats ingested in the window.
+	Heartbeats int
+	// GeolocationFailures is the number of heartbeats rejected since the
+	// service started because their address could not be located.
+	GeolocationFailures uint64
+	// CacheHitRatio is the ratio of cache hits since the service started.
+	CacheHitRatio float64
+}
+
+// foldValues sorts the values and keeps the top ones, summing up the rest as
+// FleetOther. Empty values are counted as FleetUnknown.
+func foldValues(rows []AggregateRow, top int) []ValueSummary {
+	counts := make(map[string]int)
+	for _, r := range rows {
+		v := r.Groups[0]
+		if v == "" {
+			v = FleetUnknown
+		}
+		counts[v] += r.Metrics[0]
+	}
+	var values []ValueSummary
+	for v, n := range counts {
+		values = append(values, ValueSummary{Value: v, NoDeployments: n})
+	}
+	sortValues(values)
+	if len(values) <= top {
+		return values
+	}
+	other := ValueSummary{Value: FleetOther}
+	for _, v := range values[top:] {
+		other.NoDeployments += v.NoDeployments
+	}
+	return append(values[:top:top], other)
+}
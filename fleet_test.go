@@ -0,0 +1,89 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/absmach/callhome/mocks"
+	"github.com/ip2location/ip2location-go/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFleetQueryValidate(t *testing.T) {
+	cases := []struct {
+		desc  string
+		query callhome.FleetQuery
+		err   error
+	}{
+		{"defaults", callhome.FleetQuery{}, nil},
+		{"custom", callhome.FleetQuery{Window: time.Hour, Top: callhome.MaxFleetTop}, nil},
+		{"negative window", callhome.FleetQuery{Window: -time.Hour}, callhome.ErrInvalidFleetQuery},
+		{"negative top", callhome.FleetQuery{Top: -1}, callhome.ErrInvalidFleetQuery},
+		{"top too large", callhome.FleetQuery{Top: callhome.MaxFleetTop + 1}, callhome.ErrInvalidFleetQuery},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.query.Validate())
+		})
+	}
+}
+
+func TestRetrieveFleetMetrics(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	repo := memory.New()
+	heartbeats := []callhome.Telemetry{
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.14.0", Country: "Serbia", ServiceTime: now},
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.14.0", Country: "Serbia", ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.2", Service: "users", Version: "0.14.0", Country: "France", ServiceTime: now},
+		{IpAddress: "10.0.0.3", Service: "things", Version: "0.13.0", ServiceTime: now},
+		{IpAddress: "10.0.0.4", Service: "things", Version: "0.12.0", Country: "Serbia", ServiceTime: now},
+		// Out of the default window.
+		{IpAddress: "10.0.0.5", Service: "users", Version: "0.11.0", Country: "Spain", ServiceTime: now.Add(-48 * time.Hour)},
+	}
+	for _, hb := range heartbeats {
+		assert.Nil(t, repo.Save(ctx, hb))
+	}
+	locMock := mocks.NewLocationService(t)
+	locMock.On("GetLocation", mock.Anything, "10.0.0.6").Return(ip2location.IP2Locationrecord{}, fmt.Errorf("error getting loc"))
+	svc := callhome.New(repo, locMock, nil)
+	assert.NotNil(t, svc.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.6", Service: "users", ServiceTime: now}))
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := svc.RetrieveFleetMetrics(ctx, callhome.FleetQuery{Top: callhome.MaxFleetTop + 1})
+		assert.ErrorIs(t, err, callhome.ErrInvalidFleetQuery)
+	})
+	t.Run("success", func(t *testing.T) {
+		fm, err := svc.RetrieveFleetMetrics(ctx, callhome.FleetQuery{Top: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.FleetQuery{Window: callhome.DefaultFleetWindow, Top: 1}, fm.FleetQuery)
+		assert.Equal(t, []callhome.ValueSummary{
+			{Value: "0.14.0", NoDeployments: 2},
+			{Value: callhome.FleetOther, NoDeployments: 2},
+		}, fm.Versions)
+		assert.Equal(t, []callhome.ValueSummary{
+			{Value: "Serbia", NoDeployments: 2},
+			{Value: callhome.FleetOther, NoDeployments: 2},
+		}, fm.Countries)
+		assert.Equal(t, []callhome.ValueSummary{
+			{Value: "things", NoDeployments: 2},
+			{Value: callhome.FleetOther, NoDeployments: 2},
+		}, fm.Services)
+		assert.Equal(t, 5, fm.Heartbeats)
+		assert.Equal(t, uint64(1), fm.GeolocationFailures)
+	})
+	t.Run("unknown values", func(t *testing.T) {
+		fm, err := svc.RetrieveFleetMetrics(ctx, callhome.FleetQuery{})
+		assert.Nil(t, err)
+		assert.Contains(t, fm.Countries, callhome.ValueSummary{Value: callhome.FleetUnknown, NoDeployments: 1})
+		assert.Len(t, fm.Versions, 3)
+	})
+}
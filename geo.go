@@ -0,0 +1,249 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// EarthRadius is the mean radius of the Earth in kilometres.
+const EarthRadius = 6371.0088
+
+// Continents.
+const (
+	ContinentAfrica       = "Africa"
+	ContinentAntarctica   = "Antarctica"
+	ContinentAsia         = "Asia"
+	ContinentEurope       = "Europe"
+	ContinentNorthAmerica = "North America"
+	ContinentOceania      = "Oceania"
+	ContinentSouthAmerica = "South America"
+)
+
+// ErrInvalidGeoFilter indicates a malformed bounding box or radius, or an
+// unknown continent or sub-region.
+var ErrInvalidGeoFilter = errors.New("invalid geographic filter")
+
+// GeoCircle is the area within a radius of a point.
+type GeoCircle struct {
+	Latitude  float64
+	Longitude float64
+	// Radius is in kilometres.
+	Radius float64
+}
+
+// Validate checks the center is a valid coordinate and the radius is
+// positive and at most half the circumference of the Earth. The comparisons
+// are negated so NaN values are rejected.
+func (c GeoCircle) Validate() error {
+	if !(c.Latitude >= -90 && c.Latitude <= 90 && c.Longitude >= -180 && c.Longitude <= 180) {
+		return ErrInvalidGeoFilter
+	}
+	if !(c.Radius > 0 && c.Radius <= math.Pi*EarthRadius) {
+		return ErrInvalidGeoFilter
+	}
+	return nil
+}
+
+// Contains reports whether the point is within the radius.
+func (c GeoCircle) Contains(lon, lat float64) bool {
+	return Distance(c.Latitude, c.Longitude, lat, lon) <= c.Radius
+}
+
+// Bounds is the bounding box of the circle, which narrows the points to check
+// the distance of.
+func (c GeoCircle) Bounds() BoundingBox {
+	d := c.Radius / EarthRadius
+	south, north := c.Latitude-degrees(d), c.Latitude+degrees(d)
+	// Circles around a pole span every longitude.
+	if south <= -90 || north >= 90 {
+		return BoundingBox{West: -180, South: math.Max(south, -90), East: 180, North: math.Min(north, 90)}
+	}
+	dLon := degrees(math.Asin(math.Sin(d) / math.Cos(radians(c.Latitude))))
+	west, east := c.Longitude-dLon, c.Longitude+dLon
+	if west < -180 {
+		west += 360
+	}
+	if east > 180 {
+		east -= 360
+	}
+	return BoundingBox{West: west, South: south, East: east, North: north}
+}
+
+// Distance is the great-circle distance between two points in kilometres.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(math.Min(h, 1)))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Countries gets the names of the countries in the continent and the
+// sub-region, sorted. Either may be empty to match any.
+func Countries(continent, subRegion string) []string {
+	var ret []string
+	for name, sr := range subRegions {
+		if (continent == "" || sr.continent == continent) && (subRegion == "" || name == subRegion) {
+			ret = append(ret, sr.countries...)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// IsContinent reports whether countries are known in the continent.
+func IsContinent(continent string) bool {
+	for _, sr := range subRegions {
+		if sr.continent == continent {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSubRegion reports whether countries are known in the sub-region.
+func IsSubRegion(subRegion string) bool {
+	_, ok := subRegions[subRegion]
+	return ok
+}
+
+// IsCountry reports whether the country is known in any sub-region.
+func IsCountry(country string) bool {
+	return knownCountries[country]
+}
+
+type subRegion struct {
+	continent string
+	countries []string
+}
+
+var knownCountries = func() map[string]bool {
+	ret := make(map[string]bool)
+	for _, sr := range subRegions {
+		for _, c := range sr.countries {
+			ret[c] = true
+		}
+	}
+	return ret
+}()
+
+// subRegions are the UN M49 sub-regions, with the intermediate regions of
+// Latin America and Sub-Saharan Africa, along with the continents they belong
+// to. Countries are listed under the names reported by the geolocation
+// database, and their common alternative names.
+var subRegions = map[string]subRegion{
+	"Northern Africa": {ContinentAfrica, []string{
+		"Algeria", "Egypt", "Libya", "Morocco", "Sudan", "Tunisia", "Western Sahara",
+	}},
+	"Eastern Africa": {ContinentAfrica, []string{
+		"British Indian Ocean Territory", "Burundi", "Comoros", "Djibouti", "Eritrea", "Ethiopia",
+		"French Southern Territories", "Kenya", "Madagascar", "Malawi", "Mauritius", "Mayotte",
+		"Mozambique", "Reunion", "Rwanda", "Seychelles", "Somalia", "South Sudan", "Uganda",
+		"Tanzania, United Republic of", "Tanzania", "Zambia", "Zimbabwe",
+	}},
+	"Middle Africa": {ContinentAfrica, []string{
+		"Angola", "Cameroon", "Central African Republic", "Chad", "Congo",
+		"Congo (Democratic Republic of the)", "Congo, The Democratic Republic of the",
+		"Equatorial Guinea", "Gabon", "Sao Tome and Principe",
+	}},
+	"Southern Africa": {ContinentAfrica, []string{
+		"Botswana", "Eswatini", "Swaziland", "Lesotho", "Namibia", "South Africa",
+	}},
+	"Western Africa": {ContinentAfrica, []string{
+		"Benin", "Burkina Faso", "Cabo Verde", "Cape Verde", "Cote D'Ivoire", "Gambia", "Ghana",
+		"Guinea", "Guinea-Bissau", "Liberia", "Mali", "Mauritania", "Niger", "Nigeria",
+		"Saint Helena, Ascension and Tristan da Cunha", "Senegal", "Sierra Leone", "Togo",
+	}},
+	"Caribbean": {ContinentNorthAmerica, []string{
+		"Anguilla", "Antigua and Barbuda", "Aruba", "Bahamas", "Barbados",
+		"Bonaire, Sint Eustatius and Saba", "Cayman Islands", "Cuba", "Curacao", "Dominica",
+		"Dominican Republic", "Grenada", "Guadeloupe", "Haiti", "Jamaica", "Martinique",
+		"Montserrat", "Puerto Rico", "Saint Barthelemy", "Saint Kitts and Nevis", "Saint Lucia",
+		"Saint Martin (French Part)", "Saint Vincent and the Grenadines", "Sint Maarten (Dutch Part)",
+		"Trinidad and Tobago", "Turks and Caicos Islands", "Virgin Islands (British)",
+		"Virgin Islands (U.S.)",
+	}},
+	"Central America": {ContinentNorthAmerica, []string{
+		"Belize", "Costa Rica", "El Salvador", "Guatemala", "Honduras", "Mexico", "Nicaragua", "Panama",
+	}},
+	"South America": {ContinentSouthAmerica, []string{
+		"Argentina", "Bolivia (Plurinational State of)", "Bolivia", "Bouvet Island", "Brazil", "Chile",
+		"Colombia", "Ecuador", "Falkland Islands (Malvinas)", "French Guiana", "Guyana", "Paraguay",
+		"Peru", "South Georgia and the South Sandwich Islands", "Suriname", "Uruguay",
+		"Venezuela (Bolivarian Republic of)", "Venezuela",
+	}},
+	"Northern America": {ContinentNorthAmerica, []string{
+		"Bermuda", "Canada", "Greenland", "Saint Pierre and Miquelon", "United States of America",
+		"United States",
+	}},
+	"Central Asia": {ContinentAsia, []string{
+		"Kazakhstan", "Kyrgyzstan", "Tajikistan", "Turkmenistan", "Uzbekistan",
+	}},
+	"Eastern Asia": {ContinentAsia, []string{
+		"China", "Hong Kong", "Japan", "Korea (Democratic People's Republic of)", "North Korea",
+		"Korea (Republic of)", "South Korea", "Macao", "Mongolia", "Taiwan (Province of China)", "Taiwan",
+	}},
+	"South-eastern Asia": {ContinentAsia, []string{
+		"Brunei Darussalam", "Cambodia", "Indonesia", "Lao People's Democratic Republic", "Laos",
+		"Malaysia", "Myanmar", "Philippines", "Singapore", "Thailand", "Timor-Leste", "Viet Nam",
+		"Vietnam",
+	}},
+	"Southern Asia": {ContinentAsia, []string{
+		"Afghanistan", "Bangladesh", "Bhutan", "India", "Iran (Islamic Republic of)", "Iran",
+		"Maldives", "Nepal", "Pakistan", "Sri Lanka",
+	}},
+	"Western Asia": {ContinentAsia, []string{
+		"Armenia", "Azerbaijan", "Bahrain", "Cyprus", "Georgia", "Iraq", "Israel", "Jordan", "Kuwait",
+		"Lebanon", "Oman", "Qatar", "Saudi Arabia", "Palestine, State of", "Palestine",
+		"Syrian Arab Republic", "Syria", "Turkiye", "Turkey", "United Arab Emirates", "Yemen",
+	}},
+	"Eastern Europe": {ContinentEurope, []string{
+		"Belarus", "Bulgaria", "Czechia", "Czech Republic", "Hungary", "Poland",
+		"Moldova (Republic of)", "Moldova", "Romania", "Russian Federation", "Russia", "Slovakia",
+		"Ukraine",
+	}},
+	"Northern Europe": {ContinentEurope, []string{
+		"Aland Islands", "Denmark", "Estonia", "Faroe Islands", "Finland", "Guernsey", "Iceland",
+		"Ireland", "Isle of Man", "Jersey", "Latvia", "Lithuania", "Norway", "Svalbard and Jan Mayen",
+		"Sweden", "United Kingdom of Great Britain and Northern Ireland", "United Kingdom",
+	}},
+	"Southern Europe": {ContinentEurope, []string{
+		"Albania", "Andorra", "Bosnia and Herzegovina", "Croatia", "Gibraltar", "Greece", "Holy See",
+		"Italy", "Kosovo", "Malta", "Montenegro", "North Macedonia",
+		"Macedonia (the former Yugoslav Republic of)", "Portugal", "San Marino", "Serbia", "Slovenia",
+		"Spain",
+	}},
+	"Western Europe": {ContinentEurope, []string{
+		"Austria", "Belgium", "France", "Germany", "Liechtenstein", "Luxembourg", "Monaco",
+		"Netherlands (Kingdom of the)", "Netherlands", "Switzerland",
+	}},
+	"Australia and New Zealand": {ContinentOceania, []string{
+		"Australia", "Christmas Island", "Cocos (Keeling) Islands", "Heard Island and McDonald Islands",
+		"New Zealand", "Norfolk Island",
+	}},
+	"Melanesia": {ContinentOceania, []string{
+		"Fiji", "New Caledonia", "Papua New Guinea", "Solomon Islands", "Vanuatu",
+	}},
+	"Micronesia": {ContinentOceania, []string{
+		"Guam", "Kiribati", "Marshall Islands", "Micronesia (Federated States of)", "Nauru",
+		"Northern Mariana Islands", "Palau", "United States Minor Outlying Islands",
+	}},
+	"Polynesia": {ContinentOceania, []string{
+		"American Samoa", "Cook Islands", "French Polynesia", "Niue", "Pitcairn", "Samoa", "Tokelau",
+		"Tonga", "Tuvalu", "Wallis and Futuna",
+	}},
+	"Antarctica": {ContinentAntarctica, []string{
+		"Antarctica",
+	}},
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	// Belgrade to Novi Sad and Paris.
+	assert.InDelta(t, 68, callhome.Distance(44.82, 20.45, 45.25, 19.84), 1)
+	assert.InDelta(t, 1447, callhome.Distance(44.82, 20.45, 48.86, 2.35), 5)
+	assert.InDelta(t, math.Pi*callhome.EarthRadius, callhome.Distance(0, 0, 0, 180), 1e-6)
+}
+
+func TestGeoCircleBounds(t *testing.T) {
+	cases := []struct {
+		desc   string
+		circle callhome.GeoCircle
+		bounds callhome.BoundingBox
+	}{
+		{
+			desc:   "equator",
+			circle: callhome.GeoCircle{Latitude: 0, Longitude: 0, Radius: 111.195},
+			bounds: callhome.BoundingBox{West: -1, South: -1, East: 1, North: 1},
+		},
+		{
+			desc:   "across the antimeridian",
+			circle: callhome.GeoCircle{Latitude: 0, Longitude: 179.5, Radius: 111.195},
+			bounds: callhome.BoundingBox{West: 178.5, South: -1, East: -179.5, North: 1},
+		},
+		{
+			desc:   "around a pole",
+			circle: callhome.GeoCircle{Latitude: 89.5, Longitude: 20, Radius: 111.195},
+			bounds: callhome.BoundingBox{West: -180, South: 88.5, East: 180, North: 90},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			b := tc.circle.Bounds()
+			assert.InDelta(t, tc.bounds.West, b.West, 1e-3)
+			assert.InDelta(t, tc.bounds.South, b.South, 1e-3)
+			assert.InDelta(t, tc.bounds.East, b.East, 1e-3)
+			assert.InDelta(t, tc.bounds.North, b.North, 1e-3)
+		})
+	}
+}
+
+func TestTelemetryFiltersValidate(t *testing.T) {
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		err     error
+	}{
+		{desc: "no filters"},
+		{
+			desc: "geographic filters",
+			filters: callhome.TelemetryFilters{
+				BBox:      &callhome.BoundingBox{West: -10, South: 35, East: 30, North: 60},
+				Near:      &callhome.GeoCircle{Latitude: 44.8, Longitude: 20.46, Radius: 100},
+				Continent: callhome.ContinentEurope,
+				SubRegion: "Southern Europe",
+			},
+		},
+		{desc: "invalid bounding box", filters: callhome.TelemetryFilters{BBox: &callhome.BoundingBox{South: 10, North: -10}}, err: callhome.ErrInvalidGeoFilter},
+		{desc: "zero radius", filters: callhome.TelemetryFilters{Near: &callhome.GeoCircle{Latitude: 44.8, Longitude: 20.46}}, err: callhome.ErrInvalidGeoFilter},
+		{desc: "NaN center", filters: callhome.TelemetryFilters{Near: &callhome.GeoCircle{Latitude: math.NaN(), Radius: 1}}, err: callhome.ErrInvalidGeoFilter},
+		{desc: "unknown continent", filters: callhome.TelemetryFilters{Continent: "europe"}, err: callhome.ErrInvalidGeoFilter},
+		{desc: "unknown sub-region", filters: callhome.TelemetryFilters{SubRegion: "Balkans"}, err: callhome.ErrInvalidGeoFilter},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.filters.Validate())
+		})
+	}
+}
+
+func TestCountries(t *testing.T) {
+	europe := callhome.Countries(callhome.ContinentEurope, "")
+	assert.Contains(t, europe, "Serbia")
+	assert.Contains(t, europe, "United Kingdom of Great Britain and Northern Ireland")
+	assert.NotContains(t, europe, "Turkiye")
+	assert.IsIncreasing(t, europe)
+
+	assert.Equal(t, []string{"Fiji", "New Caledonia", "Papua New Guinea", "Solomon Islands", "Vanuatu"}, callhome.Countries("", "Melanesia"))
+	assert.Empty(t, callhome.Countries(callhome.ContinentAsia, "Melanesia"))
+
+	seen := make(map[string]bool)
+	for _, c := range callhome.Countries("", "") {
+		assert.False(t, seen[c], "%s is in more than one sub-region", c)
+		seen[c] = true
+	}
+}
@@ -4,8 +4,12 @@
 package postgres
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/absmach/callhome/internal/env"
 	_ "github.com/jackc/pgx/v5/stdlib" // required for SQL access
@@ -13,10 +17,20 @@ import (
 	migrate "github.com/rubenv/sql-migrate"
 )
 
+const (
+	// Dialect is the sql-migrate dialect of PostgreSQL databases.
+	Dialect = "postgres"
+
+	// migrationLockKey identifies the advisory lock taken while migrating.
+	// It spells "callhome" in ASCII.
+	migrationLockKey int64 = 0x63616c6c686f6d65
+)
+
 var (
 	errConfig    = errors.New("failed to load postgresql configuration")
 	errConnect   = errors.New("failed to connect to postgresql server")
 	errMigration = errors.New("failed to apply migrations")
+	errLock      = errors.New("failed to acquire migration lock")
 )
 
 // Config defines the options that are used when connecting to a TimescaleSQL instance.
@@ -30,6 +44,19 @@ type Config struct {
 	SSLCert     string `env:"TIMESCALE_SSL_CERT"        envDefault:""`
 	SSLKey      string `env:"TIMESCALE_SSL_KEY"         envDefault:""`
 	SSLRootCert string `env:"TIMESCALE_SSL_ROOT_CERT"   envDefault:""`
+
+	// Connection pool settings, applied to both the primary and the replica.
+	// Zero MaxOpenConns, ConnMaxLifetime and ConnMaxIdleTime mean no limit.
+	MaxOpenConns    int           `env:"TIMESCALE_MAX_OPEN_CONNS"      envDefault:"25"`
+	MaxIdleConns    int           `env:"TIMESCALE_MAX_IDLE_CONNS"      envDefault:"5"`
+	ConnMaxLifetime time.Duration `env:"TIMESCALE_CONN_MAX_LIFETIME"   envDefault:"30m"`
+	ConnMaxIdleTime time.Duration `env:"TIMESCALE_CONN_MAX_IDLE_TIME"  envDefault:"5m"`
+	// StatementTimeout aborts statements running longer than it. Zero disables
+	// the timeout, which long running migrations may require.
+	StatementTimeout time.Duration `env:"TIMESCALE_STATEMENT_TIMEOUT"  envDefault:"0"`
+
+	// ReplicaDSN is the connection string of an optional read replica.
+	ReplicaDSN string `env:"TIMESCALE_REPLICA_DSN"  envDefault:""`
 }
 
 // Setup creates a connection to the PostgreSQL instance and applies any
@@ -55,7 +82,7 @@ func SetupDB(cfg Config, migrations migrate.MemoryMigrationSource) (*sqlx.DB, er
 	if err != nil {
 		return nil, err
 	}
-	if err := MigrateDB(db, migrations); err != nil {
+	if err := MigrateDB(db, cfg, migrations); err != nil {
 		return nil, err
 	}
 	return db, nil
@@ -63,25 +90,103 @@ func SetupDB(cfg Config, migrations migrate.MemoryMigrationSource) (*sqlx.DB, er
 
 // Connect creates a connection to the PostgreSQL instance.
 func Connect(cfg Config) (*sqlx.DB, error) {
-	url := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s sslcert=%s sslkey=%s sslrootcert=%s", cfg.Host, cfg.Port, cfg.User, cfg.Name, cfg.Pass, cfg.SSLMode, cfg.SSLCert, cfg.SSLKey, cfg.SSLRootCert)
+	return open(cfg, primaryURL(cfg))
+}
+
+func primaryURL(cfg Config) string {
+	return fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s sslcert=%s sslkey=%s sslrootcert=%s", cfg.Host, cfg.Port, cfg.User, cfg.Name, cfg.Pass, cfg.SSLMode, cfg.SSLCert, cfg.SSLKey, cfg.SSLRootCert)
+}
+
+// ConnectReplica creates a connection to the read replica. It returns a nil
+// database if no replica is configured.
+func ConnectReplica(cfg Config) (*sqlx.DB, error) {
+	if cfg.ReplicaDSN == "" {
+		return nil, nil
+	}
+	return open(cfg, cfg.ReplicaDSN)
+}
+
+func open(cfg Config, url string) (*sqlx.DB, error) {
+	if cfg.StatementTimeout > 0 {
+		// Unknown connection string keys are sent to the server as run-time parameters.
+		url = withParam(url, "statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
 
 	db, err := sqlx.Open("pgx", url)
 	if err != nil {
 		return nil, errors.Join(errConnect, err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	return db, nil
 }
 
-// MigrateDB applies any unapplied database migrations.
-func MigrateDB(db *sqlx.DB, migrations migrate.MemoryMigrationSource) error {
-	_, err := migrate.Exec(db.DB, "postgres", migrations, migrate.Up)
+// withParam adds the parameter to a connection string in either the URL or
+// the keyword/value format.
+func withParam(dsn, key, value string) string {
+	if !strings.Contains(dsn, "://") {
+		return fmt.Sprintf("%s %s=%s", dsn, key, value)
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s%s=%s", dsn, sep, key, value)
+}
+
+// MigrateDB applies any unapplied database migrations while holding the
+// migration lock of the database configured by cfg, and then runs each of
+// after, such as reconciling settings the migrations create, under the same
+// lock.
+func MigrateDB(db *sqlx.DB, cfg Config, migrations migrate.MemoryMigrationSource, after ...func() error) (err error) {
+	unlock, err := Lock(context.Background(), cfg)
 	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, unlock())
+	}()
+
+	if _, err := migrate.Exec(db.DB, Dialect, migrations, migrate.Up); err != nil {
 		return errors.Join(errMigration, err)
 	}
+	for _, fn := range after {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Lock takes the session level advisory lock that serializes migrations across
+// instances sharing the database, waiting for other holders to release it.
+// The lock is held by a dedicated connection, so migrations may use every
+// connection of the pool. The returned function releases the lock.
+func Lock(ctx context.Context, cfg Config) (func() error, error) {
+	// Waiting for the lock must not time out.
+	cfg.StatementTimeout = 0
+	cfg.MaxOpenConns, cfg.MaxIdleConns = 1, 1
+	db, err := open(cfg, primaryURL(cfg))
+	if err != nil {
+		return nil, errors.Join(errLock, err)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Join(errLock, err, db.Close())
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLockKey); err != nil {
+		return nil, errors.Join(errLock, err, conn.Close(), db.Close())
+	}
+
+	return func() error {
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockKey)
+		return errors.Join(err, conn.Close(), db.Close())
+	}, nil
+}
+
 func (c *Config) LoadEnv(prefix string) error {
 	if err := env.Parse(c, env.Options{Prefix: prefix}); err != nil {
 		return errors.Join(errConfig, err)
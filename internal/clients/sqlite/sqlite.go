@@ -0,0 +1,83 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/absmach/callhome/internal/env"
+	"github.com/jmoiron/sqlx"
+	migrate "github.com/rubenv/sql-migrate"
+	_ "modernc.org/sqlite" // required for SQL access
+)
+
+const (
+	driver = "sqlite"
+	// Dialect is the sql-migrate dialect of SQLite databases.
+	Dialect = "sqlite3"
+)
+
+var (
+	errConfig    = errors.New("failed to load sqlite configuration")
+	errConnect   = errors.New("failed to open sqlite database")
+	errMigration = errors.New("failed to apply migrations")
+)
+
+// Config defines the options that are used when opening a SQLite database.
+type Config struct {
+	Path        string `env:"SQLITE_PATH"          envDefault:"./callhome.db"`
+	BusyTimeout int    `env:"SQLITE_BUSY_TIMEOUT"  envDefault:"5000"`
+}
+
+// Setup opens the SQLite database and applies any unapplied database
+// migrations. A non-nil error is returned to indicate failure.
+func Setup(prefix string, migrations migrate.MemoryMigrationSource) (*sqlx.DB, error) {
+	cfg := Config{}
+	if err := cfg.LoadEnv(prefix); err != nil {
+		return nil, err
+	}
+	return SetupDB(cfg, migrations)
+}
+
+// SetupDB opens the SQLite database and applies any unapplied database
+// migrations. A non-nil error is returned to indicate failure.
+func SetupDB(cfg Config, migrations migrate.MemoryMigrationSource) (*sqlx.DB, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := MigrateDB(db, migrations); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Connect opens the SQLite database in WAL mode, so reads do not block on writes.
+func Connect(cfg Config) (*sqlx.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)", cfg.Path, cfg.BusyTimeout)
+
+	db, err := sqlx.Open(driver, dsn)
+	if err != nil {
+		return nil, errors.Join(errConnect, err)
+	}
+
+	return db, nil
+}
+
+// LoadEnv loads the configuration from the environment variables with the given prefix.
+func (c *Config) LoadEnv(prefix string) error {
+	if err := env.Parse(c, env.Options{Prefix: prefix}); err != nil {
+		return errors.Join(errConfig, err)
+	}
+	return nil
+}
+
+// MigrateDB applies any unapplied database migrations.
+func MigrateDB(db *sqlx.DB, migrations migrate.MemoryMigrationSource) error {
+	if _, err := migrate.Exec(db.DB, Dialect, migrations, migrate.Up); err != nil {
+		return errors.Join(errMigration, err)
+	}
+	return nil
+}
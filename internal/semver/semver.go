@@ -0,0 +1,137 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package semver parses and orders semantic versions as reported by deployments,
+// which may carry a "v" prefix and omit the minor or patch numbers.
+package semver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidVersion indicates a string that is not a semantic version.
+var ErrInvalidVersion = errors.New("invalid semantic version")
+
+// Version is a parsed semantic version. Build metadata is dropped, since it
+// does not take part in ordering.
+type Version struct {
+	Major, Minor, Patch uint64
+	Prerelease          []string
+}
+
+// Parse parses a version such as "v0.14.1-rc.1+build".
+func Parse(s string) (Version, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v Version
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if i == len(s)-1 {
+			return Version{}, ErrInvalidVersion
+		}
+		v.Prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, ErrInvalidVersion
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return Version{}, ErrInvalidVersion
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// IsPrerelease reports whether the version is a pre-release.
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or greater than w.
+func (v Version) Compare(w Version) int {
+	for _, c := range [][2]uint64{{v.Major, w.Major}, {v.Minor, w.Minor}, {v.Patch, w.Patch}} {
+		switch {
+		case c[0] < c[1]:
+			return -1
+		case c[0] > c[1]:
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, w.Prerelease)
+}
+
+// Compare orders version strings semantically. Strings that are not semantic
+// versions sort before all versions, and among themselves lexically.
+func Compare(a, b string) int {
+	va, errA := Parse(a)
+	vb, errB := Parse(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	default:
+		return va.Compare(vb)
+	}
+}
+
+// comparePrerelease orders pre-release identifiers as specified by SemVer 2.0.0,
+// with a release ranking above any of its pre-releases.
+func comparePrerelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareIdentifier compares numeric identifiers numerically and ranks them
+// below alphanumeric ones, which are compared lexically.
+func compareIdentifier(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		default:
+			return 0
+		}
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
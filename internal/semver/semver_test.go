@@ -0,0 +1,63 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package semver
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in  string
+		v   Version
+		err error
+	}{
+		{in: "0.14.1", v: Version{Minor: 14, Patch: 1}},
+		{in: "v1.2.3", v: Version{Major: 1, Minor: 2, Patch: 3}},
+		{in: "1.2", v: Version{Major: 1, Minor: 2}},
+		{in: "1.2.3-rc.1+build.5", v: Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"rc", "1"}}},
+		{in: "1.2.3-", err: ErrInvalidVersion},
+		{in: "1.2.3.4", err: ErrInvalidVersion},
+		{in: "latest", err: ErrInvalidVersion},
+		{in: "", err: ErrInvalidVersion},
+	}
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			v, err := Parse(tc.in)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.v, v)
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Ordered as specified by SemVer 2.0.0, with invalid versions first.
+	ordered := []string{
+		"dev",
+		"latest",
+		"0.9.0",
+		"v0.13.0",
+		"0.14.0-alpha",
+		"0.14.0-alpha.1",
+		"0.14.0-alpha.beta",
+		"0.14.0-beta.2",
+		"0.14.0-beta.11",
+		"0.14.0-rc.1",
+		"0.14.0",
+		"0.14.1",
+		"1.0.0",
+	}
+	shuffled := []string{"0.14.0-beta.11", "1.0.0", "latest", "0.14.0", "0.14.0-alpha.beta", "0.9.0", "0.14.1",
+		"0.14.0-alpha", "v0.13.0", "0.14.0-rc.1", "dev", "0.14.0-alpha.1", "0.14.0-beta.2"}
+	sort.Slice(shuffled, func(i, j int) bool {
+		return Compare(shuffled[i], shuffled[j]) < 0
+	})
+	assert.Equal(t, ordered, shuffled)
+
+	assert.Equal(t, 0, Compare("v1.2.0", "1.2"))
+	assert.Equal(t, 0, Compare("1.2.0+a", "1.2.0+b"))
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sqlfilter builds the SQL conditions of filter expressions with
+// named parameters, for the databases to share.
+package sqlfilter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/absmach/callhome"
+)
+
+// Dialect is how a database compares versions with the bounds of version
+// ranges.
+type Dialect struct {
+	// VersionKey is the expression of the callhome.VersionKey of the version
+	// in the column.
+	VersionKey func(column string) string
+	// KeyParam is the placeholder of the named parameter of a version key
+	// and its value.
+	KeyParam func(name string, key []uint64) (string, interface{})
+}
+
+// ValueQueries appends the conditions of the country, city, service and
+// version filters to the queries.
+func (d Dialect) ValueQueries(queries []string, params map[string]interface{}, filters callhome.TelemetryFilters) []string {
+	vf := filters.ValueFilters()
+	for _, q := range []string{
+		d.ValueQuery("country", "country", vf.Country, params),
+		d.ValueQuery("city", "city", vf.City, params),
+		d.ValueQuery("mg_version", "version", vf.Version, params),
+		d.ValueQuery("service", "service", vf.Service, params),
+	} {
+		if q != "" {
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+// ValueQuery matches the values of the column passing the filter, with
+// parameters named after name. It is empty if the filter matches any value.
+func (d Dialect) ValueQuery(column, name string, f callhome.ValueFilter, params map[string]interface{}) string {
+	include, exclude := d.IncludeQuery(column, name, f, params), ExcludeQuery(column, name, f, params)
+	switch {
+	case include == "":
+		return exclude
+	case exclude == "":
+		return include
+	default:
+		return include + " AND " + exclude
+	}
+}
+
+// IncludeQuery matches the values and ranges of the filter, or is empty if
+// there are none.
+func (d Dialect) IncludeQuery(column, name string, f callhome.ValueFilter, params map[string]interface{}) string {
+	var queries []string
+	switch len(f.Values) {
+	case 0:
+	case 1:
+		queries = append(queries, fmt.Sprintf("%s = :%s", column, name))
+		params[name] = f.Values[0]
+	default:
+		queries = append(queries, fmt.Sprintf("%s IN (%s)", column, ListParams(name, f.Values, params)))
+	}
+	for i, r := range f.Ranges {
+		bounds := make([]string, len(r))
+		for j, b := range r {
+			key := fmt.Sprintf("%s_range_%d_%d", name, i, j)
+			placeholder, value := d.KeyParam(key, b.Key())
+			params[key] = value
+			bounds[j] = fmt.Sprintf("%s %s %s", d.VersionKey(column), b.Op, placeholder)
+		}
+		queries = append(queries, strings.Join(bounds, " AND "))
+	}
+	switch len(queries) {
+	case 0:
+		return ""
+	case 1:
+		return queries[0]
+	default:
+		return "(" + strings.Join(queries, " OR ") + ")"
+	}
+}
+
+// ExcludeQuery rejects the excluded values of the filter, or is empty if
+// there are none. Missing values are never excluded.
+func ExcludeQuery(column, name string, f callhome.ValueFilter, params map[string]interface{}) string {
+	if len(f.Excluded) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("COALESCE(%s, '') NOT IN (%s)", column, ListParams(name+"_not", f.Excluded, params))
+}
+
+// ListParams sets a parameter for each value and lists their names.
+func ListParams(name string, values []string, params map[string]interface{}) string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		key := fmt.Sprintf("%s_%d", name, i)
+		params[key] = v
+		names[i] = ":" + key
+	}
+	return strings.Join(names, ", ")
+}
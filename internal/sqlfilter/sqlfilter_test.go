@@ -0,0 +1,66 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlfilter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+var dialect = Dialect{
+	VersionKey: func(column string) string {
+		return fmt.Sprintf("key(%s)", column)
+	},
+	KeyParam: func(name string, key []uint64) (string, interface{}) {
+		return ":" + name, key
+	},
+}
+
+func TestValueQuery(t *testing.T) {
+	cases := []struct {
+		desc   string
+		expr   string
+		query  string
+		params map[string]interface{}
+	}{
+		{
+			desc:   "any",
+			params: map[string]interface{}{},
+		},
+		{
+			desc:   "value",
+			expr:   "0.14.0",
+			query:  "v = :version",
+			params: map[string]interface{}{"version": "0.14.0"},
+		},
+		{
+			desc:   "values and exclusions",
+			expr:   "0.14.0,0.13.0,!dev",
+			query:  "v IN (:version_0, :version_1) AND COALESCE(v, '') NOT IN (:version_not_0)",
+			params: map[string]interface{}{"version_0": "0.13.0", "version_1": "0.14.0", "version_not_0": "dev"},
+		},
+		{
+			desc:  "value and range",
+			expr:  "0.12.0,>=0.14 <1",
+			query: "(v = :version OR key(v) >= :version_range_0_0 AND key(v) < :version_range_0_1)",
+			params: map[string]interface{}{
+				"version":           "0.12.0",
+				"version_range_0_0": []uint64{0, 14, 0, 1},
+				"version_range_0_1": []uint64{1, 0, 0, 1},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			f, err := callhome.ParseVersionFilter(tc.expr)
+			assert.Nil(t, err)
+			params := map[string]interface{}{}
+			assert.Equal(t, tc.query, dialect.ValueQuery("v", "version", f, params))
+			assert.Equal(t, tc.params, params)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	// MaxMapZoom is the deepest zoom level of the map.
+	MaxMapZoom = 22
+	// ClusterMaxZoom is the zoom level from which deployments are no longer
+	// clustered.
+	ClusterMaxZoom = 10
+	// clusterRadius is the size of the clustering grid cells in pixels of
+	// 256 pixel map tiles.
+	clusterRadius = 60
+	// maxMercatorLatitude is the latitude Web Mercator maps are cut at.
+	maxMercatorLatitude = 85.05112878
+)
+
+// ErrInvalidMapQuery indicates a malformed bounding box or zoom level.
+var ErrInvalidMapQuery = errors.New("invalid map query")
+
+// BoundingBox is an area in degrees. West is greater than East for boxes
+// crossing the antimeridian.
+type BoundingBox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+// Validate checks the bounds are valid coordinates. The comparisons are
+// negated so NaN bounds are rejected.
+func (b BoundingBox) Validate() error {
+	if !(b.West >= -180 && b.West <= 180 && b.East >= -180 && b.East <= 180) {
+		return ErrInvalidMapQuery
+	}
+	if !(b.South >= -90 && b.North <= 90 && b.South <= b.North) {
+		return ErrInvalidMapQuery
+	}
+	return nil
+}
+
+// Contains reports whether the point is inside the box, bounds included.
+func (b BoundingBox) Contains(lon, lat float64) bool {
+	if lat < b.South || lat > b.North {
+		return false
+	}
+	if b.West <= b.East {
+		return lon >= b.West && lon <= b.East
+	}
+	return lon >= b.West || lon <= b.East
+}
+
+// MapQuery specifies the area and the zoom level of the map.
+type MapQuery struct {
+	// BBox is the whole world if nil.
+	BBox *BoundingBox
+	Zoom int
+}
+
+// Validate checks the bounding box and the zoom level.
+func (q MapQuery) Validate() error {
+	if q.Zoom < 0 || q.Zoom > MaxMapZoom {
+		return ErrInvalidMapQuery
+	}
+	if q.BBox != nil {
+		return q.BBox.Validate()
+	}
+	return nil
+}
+
+// MapPoint is a single deployment, or a cluster of nearby deployments placed
+// at their mean location.
+type MapPoint struct {
+	Longitude float64
+	Latitude  float64
+	// Count is the number of deployments in the point.
+	Count int
+	// Deployment is the latest heartbeat of a single deployment, nil for
+	// clusters.
+	Deployment *Telemetry
+}
+
+// MapPoints are the deployments inside the bounding box, clustered below
+// ClusterMaxZoom.
+type MapPoints struct {
+	MapQuery
+	Points []MapPoint
+	// Total is the number of deployments inside the bounding box.
+	Total int
+}
+
+// clusterPoints groups the deployments inside the bounding box by the cell of
+// a grid in Web Mercator pixels at the zoom level, so clusters do not overlap
+// on screen. Points are ordered by count, largest first.
+func clusterPoints(deployments []Telemetry, q MapQuery) MapPoints {
+	ret := MapPoints{MapQuery: q, Points: []MapPoint{}}
+	type cell struct{ x, y int }
+	cells := make(map[cell]int)
+	for i := range deployments {
+		d := deployments[i]
+		if q.BBox != nil && !q.BBox.Contains(d.Longitude, d.Latitude) {
+			continue
+		}
+		ret.Total++
+		if q.Zoom >= ClusterMaxZoom {
+			ret.Points = append(ret.Points, MapPoint{Longitude: d.Longitude, Latitude: d.Latitude, Count: 1, Deployment: &d})
+			continue
+		}
+		x, y := mercatorPixels(d.Longitude, d.Latitude, q.Zoom)
+		c := cell{int(x / clusterRadius), int(y / clusterRadius)}
+		j, ok := cells[c]
+		if !ok {
+			cells[c] = len(ret.Points)
+			ret.Points = append(ret.Points, MapPoint{Longitude: d.Longitude, Latitude: d.Latitude, Count: 1, Deployment: &d})
+			continue
+		}
+		// Keep the running mean of the locations in the cluster.
+		p := &ret.Points[j]
+		p.Count++
+		p.Longitude += (d.Longitude - p.Longitude) / float64(p.Count)
+		p.Latitude += (d.Latitude - p.Latitude) / float64(p.Count)
+		p.Deployment = nil
+	}
+	sort.SliceStable(ret.Points, func(i, j int) bool {
+		return ret.Points[i].Count > ret.Points[j].Count
+	})
+	return ret
+}
+
+// mercatorPixels projects the location to Web Mercator pixels at the zoom
+// level, with the world spanning 256 pixels at zoom 0.
+func mercatorPixels(lon, lat float64, zoom int) (x, y float64) {
+	lat = math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, lat))
+	size := 256 * math.Exp2(float64(zoom))
+	sin := math.Sin(lat * math.Pi / 180)
+	x = (lon + 180) / 360 * size
+	y = (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * size
+	return x, y
+}
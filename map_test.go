@@ -0,0 +1,143 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapQueryValidate(t *testing.T) {
+	cases := []struct {
+		desc  string
+		query callhome.MapQuery
+		err   error
+	}{
+		{desc: "whole world", query: callhome.MapQuery{}},
+		{desc: "bounding box", query: callhome.MapQuery{BBox: &callhome.BoundingBox{West: -10, South: 35, East: 30, North: 60}, Zoom: 4}},
+		{desc: "across the antimeridian", query: callhome.MapQuery{BBox: &callhome.BoundingBox{West: 170, South: -50, East: -170, North: -30}}},
+		{desc: "negative zoom", query: callhome.MapQuery{Zoom: -1}, err: callhome.ErrInvalidMapQuery},
+		{desc: "zoom too deep", query: callhome.MapQuery{Zoom: callhome.MaxMapZoom + 1}, err: callhome.ErrInvalidMapQuery},
+		{desc: "longitude out of range", query: callhome.MapQuery{BBox: &callhome.BoundingBox{West: -190, South: 0, East: 0, North: 10}}, err: callhome.ErrInvalidMapQuery},
+		{desc: "south above north", query: callhome.MapQuery{BBox: &callhome.BoundingBox{West: 0, South: 20, East: 10, North: 10}}, err: callhome.ErrInvalidMapQuery},
+		{desc: "NaN bound", query: callhome.MapQuery{BBox: &callhome.BoundingBox{West: math.NaN(), South: 0, East: 10, North: 10}}, err: callhome.ErrInvalidMapQuery},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.query.Validate())
+		})
+	}
+}
+
+func TestRetrieveMapPoints(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	repo := memory.New()
+	heartbeats := []callhome.Telemetry{
+		{IpAddress: "10.0.0.1", Service: "users", Country: "Serbia", City: "Belgrade", Latitude: 44.8, Longitude: 20.4, ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.1", Service: "things", Country: "Serbia", City: "Belgrade", Latitude: 44.8, Longitude: 20.4, ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.2", Service: "users", Country: "Serbia", City: "Novi Sad", Latitude: 45.2, Longitude: 19.8, ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.3", Service: "users", Country: "France", City: "Paris", Latitude: 48.8, Longitude: 2.3, ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.4", Service: "users", Country: "Fiji", City: "Suva", Latitude: -18.1, Longitude: 178.4, ServiceTime: now.Add(-time.Hour)},
+	}
+	for _, hb := range heartbeats {
+		require.Nil(t, repo.Save(ctx, hb))
+	}
+	svc := callhome.New(repo, nil, nil)
+	ids := deploymentIDs(t, repo)
+	filters := callhome.TelemetryFilters{From: now.AddDate(0, 0, -1), To: now}
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := svc.RetrieveMapPoints(ctx, callhome.MapQuery{Zoom: -1}, filters)
+		assert.ErrorIs(t, err, callhome.ErrInvalidMapQuery)
+	})
+	t.Run("clustered", func(t *testing.T) {
+		mp, err := svc.RetrieveMapPoints(ctx, callhome.MapQuery{Zoom: 2}, filters)
+		require.Nil(t, err)
+		assert.Equal(t, 4, mp.Total)
+		require.Len(t, mp.Points, 3)
+		cluster := mp.Points[0]
+		assert.Equal(t, 2, cluster.Count)
+		assert.Nil(t, cluster.Deployment)
+		assert.InDelta(t, 45.0, cluster.Latitude, 1e-9)
+		assert.InDelta(t, 20.1, cluster.Longitude, 1e-9)
+		for _, p := range mp.Points[1:] {
+			assert.Equal(t, 1, p.Count)
+			require.NotNil(t, p.Deployment)
+			assert.Equal(t, ids["10.0."+map[string]string{"Paris": "0.3", "Suva": "0.4"}[p.Deployment.City]], p.Deployment.DeploymentID)
+		}
+	})
+	t.Run("not clustered at high zoom", func(t *testing.T) {
+		bbox := &callhome.BoundingBox{West: 19, South: 44, East: 21, North: 46}
+		mp, err := svc.RetrieveMapPoints(ctx, callhome.MapQuery{BBox: bbox, Zoom: callhome.ClusterMaxZoom}, filters)
+		require.Nil(t, err)
+		assert.Equal(t, 2, mp.Total)
+		require.Len(t, mp.Points, 2)
+		for _, p := range mp.Points {
+			require.NotNil(t, p.Deployment)
+			assert.Equal(t, "Serbia", p.Deployment.Country)
+		}
+	})
+	t.Run("across the antimeridian", func(t *testing.T) {
+		bbox := &callhome.BoundingBox{West: 170, South: -30, East: -170, North: 0}
+		mp, err := svc.RetrieveMapPoints(ctx, callhome.MapQuery{BBox: bbox}, filters)
+		require.Nil(t, err)
+		require.Len(t, mp.Points, 1)
+		assert.Equal(t, "Suva", mp.Points[0].Deployment.City)
+	})
+	t.Run("filtered", func(t *testing.T) {
+		mp, err := svc.RetrieveMapPoints(ctx, callhome.MapQuery{}, callhome.TelemetryFilters{From: filters.From, To: filters.To, Service: "things"})
+		require.Nil(t, err)
+		require.Len(t, mp.Points, 1)
+		assert.Equal(t, []string{"things", "users"}, []string(mp.Points[0].Deployment.Services))
+	})
+}
+
+// slowExportRepo counts the unfiltered exports, which wait to be released.
+type slowExportRepo struct {
+	callhome.TelemetryRepo
+	exports atomic.Int32
+	release chan struct{}
+}
+
+func (r *slowExportRepo) ExportTelemetry(ctx context.Context, kind string, filters callhome.TelemetryFilters, fn func(callhome.Telemetry) error) error {
+	// The exports prefetched on start are filtered.
+	if filters.From.IsZero() {
+		r.exports.Add(1)
+	}
+	<-r.release
+	return r.TelemetryRepo.ExportTelemetry(ctx, kind, filters, fn)
+}
+
+func TestRetrieveMapPointsConcurrently(t *testing.T) {
+	ctx := context.TODO()
+	repo := &slowExportRepo{TelemetryRepo: memory.New(), release: make(chan struct{})}
+	require.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", Country: "Serbia", Latitude: 44.8, Longitude: 20.4, ServiceTime: time.Now()}))
+	svc := callhome.New(repo, nil, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mp, err := svc.RetrieveMapPoints(ctx, callhome.MapQuery{}, callhome.TelemetryFilters{})
+			assert.Nil(t, err)
+			assert.Equal(t, 1, mp.Total)
+		}()
+	}
+	// Let the requests reach the cold cache before the export finishes.
+	time.Sleep(50 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), repo.exports.Load(), "concurrent requests share a single export")
+}
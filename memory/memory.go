@@ -0,0 +1,897 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package memory contains an in-memory callhome.TelemetryRepo. It is the
+// reference implementation of the repository semantics checked by the
+// repotest conformance suite, and a realistic test double for the service.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/google/uuid"
+)
+
+var _ callhome.TelemetryRepo = (*repo)(nil)
+
+// key identifies a single heartbeat, like the unique key of the database repositories.
+type key struct {
+	ip      string
+	mac     string
+	service string
+	time    time.Time
+}
+
+// transition is a version transition of a deployment service.
+type transition struct {
+	telemetry callhome.Telemetry
+	from      string
+}
+
+type repo struct {
+	mu          sync.RWMutex
+	telemetry   map[key]callhome.Telemetry
+	transitions map[key]transition
+	// ids are the deployment IDs by IP address.
+	ids map[string]string
+}
+
+// New returns new in-memory repository.
+func New() callhome.TelemetryRepo {
+	return &repo{
+		telemetry:   make(map[key]callhome.Telemetry),
+		transitions: make(map[key]transition),
+		ids:         make(map[string]string),
+	}
+}
+
+// Save stores the heartbeat, along with version transitions if the version
+// differs from the adjacent heartbeats. Saving a heartbeat that is already
+// stored for the same deployment, service and time is a no-op.
+func (r *repo) Save(ctx context.Context, t callhome.Telemetry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := key{ip: t.IpAddress, mac: t.MacAddress, service: t.Service, time: t.ServiceTime.UTC()}
+	if _, ok := r.telemetry[k]; ok {
+		return nil
+	}
+	if _, ok := r.ids[t.IpAddress]; !ok {
+		r.ids[t.IpAddress] = strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+	t.DeploymentID = r.ids[t.IpAddress]
+	t.Services = nil
+	r.telemetry[k] = t
+
+	if t.Version == "" {
+		return nil
+	}
+	// Compare to the adjacent heartbeats of the deployment service reporting
+	// from the same MAC address that report a version. A heartbeat saved out of order replaces the transition of the
+	// next heartbeat.
+	var prev, next *callhome.Telemetry
+	for _, a := range r.telemetry {
+		if a.IpAddress != t.IpAddress || a.MacAddress != t.MacAddress || a.Service != t.Service || a.Version == "" {
+			continue
+		}
+		a := a
+		switch {
+		case a.ServiceTime.Before(t.ServiceTime):
+			if prev == nil || a.ServiceTime.After(prev.ServiceTime) {
+				prev = &a
+			}
+		case a.ServiceTime.After(t.ServiceTime):
+			if next == nil || a.ServiceTime.Before(next.ServiceTime) {
+				next = &a
+			}
+		}
+	}
+	tk := transitionKey(t)
+	if _, ok := r.transitions[tk]; !ok && prev != nil && prev.Version != t.Version {
+		r.transitions[tk] = transition{telemetry: t, from: prev.Version}
+	}
+	if next != nil {
+		nk := transitionKey(*next)
+		delete(r.transitions, nk)
+		if next.Version != t.Version {
+			r.transitions[nk] = transition{telemetry: *next, from: t.Version}
+		}
+	}
+	return nil
+}
+
+// transitionKey identifies the version transition of a deployment service at
+// the time of the heartbeat.
+func transitionKey(t callhome.Telemetry) key {
+	return key{ip: t.IpAddress, mac: t.MacAddress, service: t.Service, time: t.ServiceTime.UTC()}
+}
+
+// RetrieveAll gets the latest heartbeat of each deployment, ordered by time and
+// then by deployment ID, both descending.
+func (r *repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	var cursor callhome.PageCursor
+	if pm.Cursor != "" {
+		var err error
+		if cursor, err = callhome.ParsePageCursor(pm.Cursor); err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	latest := make(map[string]callhome.Telemetry)
+	services := make(map[string]map[string]bool)
+	for _, t := range r.telemetry {
+		if services[t.IpAddress] == nil {
+			services[t.IpAddress] = make(map[string]bool)
+		}
+		if t.Service != "" {
+			services[t.IpAddress][t.Service] = true
+		}
+		if !matches(t, filters) {
+			continue
+		}
+		if l, ok := latest[t.IpAddress]; !ok || t.ServiceTime.After(l.ServiceTime) {
+			latest[t.IpAddress] = t
+		}
+	}
+
+	deployments := make([]callhome.Telemetry, 0, len(latest))
+	for _, t := range latest {
+		deployments = append(deployments, t)
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return before(deployments[j], deployments[i])
+	})
+
+	rows := deployments
+	switch {
+	case pm.Cursor != "" && cursor.Backward:
+		rows = nil
+		for i := len(deployments) - 1; i >= 0; i-- {
+			if afterCursor(deployments[i], cursor) {
+				rows = append(rows, deployments[i])
+			}
+		}
+	case pm.Cursor != "":
+		rows = nil
+		for _, t := range deployments {
+			if beforeCursor(t, cursor) {
+				rows = append(rows, t)
+			}
+		}
+	case pm.Offset >= uint64(len(rows)):
+		rows = nil
+	default:
+		rows = rows[pm.Offset:]
+	}
+	// One extra row tells whether there is a page past this one.
+	if uint64(len(rows)) > pm.Limit+1 {
+		rows = rows[:pm.Limit+1]
+	}
+
+	page := make([]callhome.Telemetry, len(rows))
+	for i, t := range rows {
+		t.Service = ""
+		t.MacAddress = ""
+		t.Services = nil
+		for s := range services[t.IpAddress] {
+			t.Services = append(t.Services, s)
+		}
+		sort.Strings(t.Services)
+		page[i] = t
+	}
+
+	var res callhome.TelemetryPage
+	res.Telemetry, res.Next, res.Prev = callhome.KeysetPage(page, pm)
+	res.Total = uint64(len(latest))
+	if pm.Cursor == "" {
+		res.Offset = pm.Offset
+	}
+	res.Limit = pm.Limit
+
+	return res, nil
+}
+
+// RetrieveSummary counts deployments per value of each dimension.
+func (r *repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	countries := make(map[string]map[string]bool)
+	cities := make(map[string]map[string]bool)
+	services := make(map[string]map[string]bool)
+	versions := make(map[string]map[string]bool)
+	for _, t := range r.telemetry {
+		if !matches(t, filters) {
+			continue
+		}
+		addDeployment(countries, t.Country, t.IpAddress)
+		addDeployment(cities, t.City, t.IpAddress)
+		addDeployment(services, t.Service, t.IpAddress)
+		addDeployment(versions, t.Version, t.IpAddress)
+	}
+
+	var summary callhome.TelemetrySummary
+	for country, ips := range countries {
+		summary.Countries = append(summary.Countries, callhome.CountrySummary{Country: country, NoDeployments: len(ips)})
+		summary.TotalDeployments += len(ips)
+	}
+	summary.CityCounts = valueCounts(cities)
+	summary.ServiceCounts = valueCounts(services)
+	summary.VersionCounts = valueCounts(versions)
+
+	return summary, nil
+}
+
+// RetrieveTimeSeries counts distinct deployments reporting in each time bucket.
+func (r *repo) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) ([]callhome.TimeSeriesBucket, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type bucketKey struct {
+		time  time.Time
+		group string
+	}
+	buckets := make(map[bucketKey]map[string]bool)
+	for _, t := range r.telemetry {
+		if !matches(t, filters) {
+			continue
+		}
+		k := bucketKey{time: callhome.BucketStart(t.ServiceTime, q.Interval)}
+		switch q.SplitBy {
+		case callhome.SplitByCountry:
+			k.group = t.Country
+		case callhome.SplitByVersion:
+			k.group = t.Version
+		case callhome.SplitByService:
+			k.group = t.Service
+		}
+		if buckets[k] == nil {
+			buckets[k] = make(map[string]bool)
+		}
+		buckets[k][t.IpAddress] = true
+	}
+
+	ret := make([]callhome.TimeSeriesBucket, 0, len(buckets))
+	for k, ips := range buckets {
+		ret = append(ret, callhome.TimeSeriesBucket{Time: k.time, Group: k.group, ActiveDeployments: len(ips)})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].Time.Equal(ret[j].Time) {
+			return ret[i].Time.Before(ret[j].Time)
+		}
+		return ret[i].Group < ret[j].Group
+	})
+	return ret, nil
+}
+
+// RetrieveVersions gets the number of deployments running each version and
+// the time each version was first reported.
+func (r *repo) RetrieveVersions(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	latest := make(map[string]callhome.Telemetry)
+	usage := make(map[string]*callhome.VersionUsage)
+	for _, t := range r.telemetry {
+		if !matches(t, filters) {
+			continue
+		}
+		if l, ok := latest[t.IpAddress]; !ok || t.ServiceTime.After(l.ServiceTime) {
+			latest[t.IpAddress] = t
+		}
+		u, ok := usage[t.Version]
+		if !ok {
+			u = &callhome.VersionUsage{Version: t.Version, FirstSeen: t.ServiceTime.UTC()}
+			usage[t.Version] = u
+		}
+		if t.ServiceTime.Before(u.FirstSeen) {
+			u.FirstSeen = t.ServiceTime.UTC()
+		}
+	}
+	for _, t := range latest {
+		usage[t.Version].Deployments++
+	}
+
+	ret := make([]callhome.VersionUsage, 0, len(usage))
+	for _, u := range usage {
+		ret = append(ret, *u)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+	return ret, nil
+}
+
+// RetrieveTransitions counts deployments moving between versions in each time bucket.
+func (r *repo) RetrieveTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) ([]callhome.TransitionBucket, error) {
+	if err := (callhome.TimeSeriesQuery{Interval: interval}).Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type bucketKey struct {
+		time     time.Time
+		from, to string
+	}
+	buckets := make(map[bucketKey]map[string]bool)
+	for _, tr := range r.matchingTransitions(filters) {
+		k := bucketKey{time: callhome.BucketStart(tr.telemetry.ServiceTime, interval), from: tr.from, to: tr.telemetry.Version}
+		if buckets[k] == nil {
+			buckets[k] = make(map[string]bool)
+		}
+		buckets[k][tr.telemetry.IpAddress] = true
+	}
+
+	ret := make([]callhome.TransitionBucket, 0, len(buckets))
+	for k, ips := range buckets {
+		ret = append(ret, callhome.TransitionBucket{Time: k.time, From: k.from, To: k.to, Deployments: len(ips)})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		switch {
+		case !ret[i].Time.Equal(ret[j].Time):
+			return ret[i].Time.Before(ret[j].Time)
+		case ret[i].From != ret[j].From:
+			return ret[i].From < ret[j].From
+		default:
+			return ret[i].To < ret[j].To
+		}
+	})
+	return ret, nil
+}
+
+// RetrieveTransitionCounts counts deployments moving between versions over the
+// whole filtered range.
+func (r *repo) RetrieveTransitionCounts(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.TransitionCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type pair struct{ from, to string }
+	counts := make(map[pair]map[string]bool)
+	for _, tr := range r.matchingTransitions(filters) {
+		k := pair{from: tr.from, to: tr.telemetry.Version}
+		if counts[k] == nil {
+			counts[k] = make(map[string]bool)
+		}
+		counts[k][tr.telemetry.IpAddress] = true
+	}
+
+	ret := make([]callhome.TransitionCount, 0, len(counts))
+	for k, ips := range counts {
+		ret = append(ret, callhome.TransitionCount{From: k.from, To: k.to, Deployments: len(ips)})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].From != ret[j].From {
+			return ret[i].From < ret[j].From
+		}
+		return ret[i].To < ret[j].To
+	})
+	return ret, nil
+}
+
+// matchingTransitions gets the transitions matching the filters. The version
+// filter matches either side of a transition.
+func (r *repo) matchingTransitions(filters callhome.TelemetryFilters) []transition {
+	var ret []transition
+	version := filters.ValueFilters().Version
+	for _, tr := range r.transitions {
+		f := filters
+		if version.Matches(tr.from) {
+			f.Version = ""
+		}
+		if matches(tr.telemetry, f) {
+			ret = append(ret, tr)
+		}
+	}
+	return ret
+}
+
+// RetrieveActivity gets the time buckets each deployment reported in.
+func (r *repo) RetrieveActivity(ctx context.Context, interval string, filters callhome.TelemetryFilters) ([]callhome.ActivityBucket, error) {
+	if err := (callhome.TimeSeriesQuery{Interval: interval}).Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	buckets := make(map[callhome.ActivityBucket]bool)
+	for _, t := range r.telemetry {
+		if matches(t, filters) {
+			buckets[callhome.ActivityBucket{Time: callhome.BucketStart(t.ServiceTime, interval), IpAddress: t.IpAddress}] = true
+		}
+	}
+
+	ret := make([]callhome.ActivityBucket, 0, len(buckets))
+	for b := range buckets {
+		ret = append(ret, b)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].IpAddress != ret[j].IpAddress {
+			return ret[i].IpAddress < ret[j].IpAddress
+		}
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret, nil
+}
+
+// RetrieveAggregate groups heartbeats and measures each group.
+func (r *repo) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) ([]callhome.AggregateRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	q = q.WithDefaults()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type group struct {
+		values     []string
+		ips        map[string]bool
+		heartbeats int
+	}
+	groups := make(map[string]*group)
+	for _, t := range r.telemetry {
+		if !matches(t, filters) {
+			continue
+		}
+		values := make([]string, len(q.GroupBy))
+		for i, g := range q.GroupBy {
+			switch g {
+			case callhome.GroupByCountry:
+				values[i] = t.Country
+			case callhome.GroupByCity:
+				values[i] = t.City
+			case callhome.GroupByRegion:
+				values[i] = t.Region
+			case callhome.GroupByService:
+				values[i] = t.Service
+			case callhome.GroupByVersion:
+				values[i] = t.Version
+			case callhome.GroupByWeek:
+				values[i] = callhome.BucketStart(t.ServiceTime, callhome.IntervalWeek).Format(time.RFC3339)
+			}
+		}
+		k := strings.Join(values, "\x00")
+		g, ok := groups[k]
+		if !ok {
+			g = &group{values: values, ips: make(map[string]bool)}
+			groups[k] = g
+		}
+		g.ips[t.IpAddress] = true
+		g.heartbeats++
+	}
+
+	ret := make([]callhome.AggregateRow, 0, len(groups))
+	for _, g := range groups {
+		row := callhome.AggregateRow{Groups: g.values}
+		for _, m := range q.Metrics {
+			switch m {
+			case callhome.MetricDeployments:
+				row.Metrics = append(row.Metrics, len(g.ips))
+			case callhome.MetricHeartbeats:
+				row.Metrics = append(row.Metrics, g.heartbeats)
+			}
+		}
+		ret = append(ret, row)
+	}
+
+	by, desc := q.OrderBy()
+	field := func(row callhome.AggregateRow) (string, int) {
+		for i, g := range q.GroupBy {
+			if g == by {
+				return row.Groups[i], 0
+			}
+		}
+		for i, m := range q.Metrics {
+			if m == by {
+				return "", row.Metrics[i]
+			}
+		}
+		return "", 0
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		si, ni := field(ret[i])
+		sj, nj := field(ret[j])
+		if si != sj || ni != nj {
+			less := si < sj || (si == sj && ni < nj)
+			return less != desc
+		}
+		for k := range ret[i].Groups {
+			if ret[i].Groups[k] != ret[j].Groups[k] {
+				return ret[i].Groups[k] < ret[j].Groups[k]
+			}
+		}
+		return false
+	})
+	if len(ret) > q.Top {
+		ret = ret[:q.Top]
+	}
+	return ret, nil
+}
+
+// CountHeartbeats counts the heartbeats matching the filters.
+func (r *repo) CountHeartbeats(ctx context.Context, filters callhome.TelemetryFilters) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int
+	for _, t := range r.telemetry {
+		if matches(t, filters) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RetrieveServiceSets counts deployments by the set of services they run.
+func (r *repo) RetrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.ServiceSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	service := filters.ValueFilters().Service
+	filters.Service = ""
+	deployments := make(map[string]map[string]bool)
+	for _, t := range r.telemetry {
+		if t.Service == "" || !matches(t, filters) {
+			continue
+		}
+		if deployments[t.IpAddress] == nil {
+			deployments[t.IpAddress] = make(map[string]bool)
+		}
+		deployments[t.IpAddress][t.Service] = true
+	}
+
+	var sets []callhome.ServiceSet
+	index := make(map[string]int)
+	for _, services := range deployments {
+		if !runs(services, service) {
+			continue
+		}
+		s := keys(services)
+		k := strings.Join(s, ",")
+		i, ok := index[k]
+		if !ok {
+			i = len(sets)
+			index[k] = i
+			sets = append(sets, callhome.ServiceSet{Services: s})
+		}
+		sets[i].Deployments++
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Deployments != sets[j].Deployments {
+			return sets[i].Deployments > sets[j].Deployments
+		}
+		return strings.Join(sets[i].Services, ",") < strings.Join(sets[j].Services, ",")
+	})
+	return sets, nil
+}
+
+// RetrieveDeployment gets the identity, location, services and version history of a deployment.
+func (r *repo) RetrieveDeployment(ctx context.Context, id string) (callhome.Deployment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d := callhome.Deployment{ID: id}
+	var found bool
+	services := make(map[string]bool)
+	versions := make(map[string]*callhome.VersionPeriod)
+	for _, t := range r.telemetry {
+		if t.DeploymentID != id {
+			continue
+		}
+		if !found || t.ServiceTime.After(d.Latest.ServiceTime) {
+			d.Latest = t
+		}
+		if !found || t.ServiceTime.Before(d.FirstSeen) {
+			d.FirstSeen = t.ServiceTime.UTC()
+		}
+		found = true
+		services[t.Service] = true
+		if t.Version == "" {
+			continue
+		}
+		v, ok := versions[t.Version]
+		if !ok {
+			v = &callhome.VersionPeriod{Version: t.Version, FirstSeen: t.ServiceTime.UTC(), LastSeen: t.ServiceTime.UTC()}
+			versions[t.Version] = v
+		}
+		if t.ServiceTime.Before(v.FirstSeen) {
+			v.FirstSeen = t.ServiceTime.UTC()
+		}
+		if t.ServiceTime.After(v.LastSeen) {
+			v.LastSeen = t.ServiceTime.UTC()
+		}
+	}
+	if !found {
+		return callhome.Deployment{}, callhome.ErrDeploymentNotFound
+	}
+
+	d.Latest.Service = ""
+	d.Latest.MacAddress = ""
+	d.Latest.Services = keys(services)
+	for _, v := range versions {
+		d.Versions = append(d.Versions, *v)
+	}
+	sort.Slice(d.Versions, func(i, j int) bool {
+		return d.Versions[i].FirstSeen.Before(d.Versions[j].FirstSeen)
+	})
+	return d, nil
+}
+
+// RetrieveHeartbeats gets the distinct times a deployment reported at.
+func (r *repo) RetrieveHeartbeats(ctx context.Context, id string, filters callhome.TelemetryFilters) ([]time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	beats := make(map[time.Time]bool)
+	for _, t := range r.telemetry {
+		if t.DeploymentID == id && matches(t, filters) {
+			beats[t.ServiceTime.UTC()] = true
+		}
+	}
+
+	ret := make([]time.Time, 0, len(beats))
+	for b := range beats {
+		ret = append(ret, b)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Before(ret[j]) })
+	return ret, nil
+}
+
+// RetrieveLastSeen gets when each deployment first and last reported.
+func (r *repo) RetrieveLastSeen(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.DeploymentSeen, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]*callhome.DeploymentSeen)
+	beats := make(map[string]map[time.Time]bool)
+	for _, t := range r.telemetry {
+		if !matches(t, filters) {
+			continue
+		}
+		at := t.ServiceTime.UTC()
+		d, ok := seen[t.IpAddress]
+		if !ok {
+			d = &callhome.DeploymentSeen{ID: t.DeploymentID, IpAddress: t.IpAddress, FirstSeen: at}
+			seen[t.IpAddress] = d
+			beats[t.IpAddress] = make(map[time.Time]bool)
+		}
+		beats[t.IpAddress][at] = true
+		if at.Before(d.FirstSeen) {
+			d.FirstSeen = at
+		}
+		switch {
+		case at.After(d.LastSeen):
+			d.LastSeen, d.Country, d.City, d.Version = at, t.Country, t.City, t.Version
+		case at.Equal(d.LastSeen):
+			// Ties are broken by the greatest values, like in the SQL repositories.
+			d.Country, d.City, d.Version = max(d.Country, t.Country), max(d.City, t.City), max(d.Version, t.Version)
+		}
+	}
+
+	var ret []callhome.DeploymentSeen
+	for ip, d := range seen {
+		d.Heartbeats = len(beats[ip])
+		ret = append(ret, *d)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].LastSeen.Equal(ret[j].LastSeen) {
+			return ret[i].LastSeen.After(ret[j].LastSeen)
+		}
+		return ret[i].IpAddress < ret[j].IpAddress
+	})
+	return ret, nil
+}
+
+// RetrieveClientsSeen gets when each client first and last reported.
+func (r *repo) RetrieveClientsSeen(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.ClientSeen, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[key]*callhome.ClientSeen)
+	for k, t := range r.telemetry {
+		if !matches(t, filters) {
+			continue
+		}
+		ck := key{ip: k.ip, mac: k.mac, service: k.service}
+		c, ok := seen[ck]
+		if !ok {
+			c = &callhome.ClientSeen{DeploymentID: t.DeploymentID, MacAddress: k.mac, Service: k.service, FirstSeen: k.time, LastSeen: k.time}
+			seen[ck] = c
+		}
+		// Heartbeats of a client are unique by time.
+		c.Heartbeats++
+		if k.time.Before(c.FirstSeen) {
+			c.FirstSeen = k.time
+		}
+		if k.time.After(c.LastSeen) {
+			c.LastSeen = k.time
+		}
+	}
+
+	var ret []callhome.ClientSeen
+	for _, c := range seen {
+		ret = append(ret, *c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.DeploymentID != b.DeploymentID {
+			return a.DeploymentID < b.DeploymentID
+		}
+		if a.MacAddress != b.MacAddress {
+			return a.MacAddress < b.MacAddress
+		}
+		return a.Service < b.Service
+	})
+	return ret, nil
+}
+
+// RetrievePolicies returns no policies, since nothing is persisted.
+func (r *repo) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	return callhome.StoragePolicies{}, nil
+}
+
+func matches(t callhome.Telemetry, filters callhome.TelemetryFilters) bool {
+	switch {
+	case !filters.From.IsZero() && t.ServiceTime.Before(filters.From):
+		return false
+	case !filters.To.IsZero() && t.ServiceTime.After(filters.To):
+		return false
+	case !filters.MatchesValues(t):
+		return false
+	case !filters.MatchesLocation(t):
+		return false
+	default:
+		return true
+	}
+}
+
+// runs reports whether the deployment runs a service the filter matches, and
+// none it excludes.
+func runs(services map[string]bool, filter callhome.ValueFilter) bool {
+	for _, s := range filter.Excluded {
+		if services[s] {
+			return false
+		}
+	}
+	if len(filter.Values) == 0 {
+		return true
+	}
+	for _, s := range filter.Values {
+		if services[s] {
+			return true
+		}
+	}
+	return false
+}
+
+// before reports whether a sorts before b in ascending keyset order.
+func before(a, b callhome.Telemetry) bool {
+	if !a.ServiceTime.Equal(b.ServiceTime) {
+		return a.ServiceTime.Before(b.ServiceTime)
+	}
+	return a.DeploymentID < b.DeploymentID
+}
+
+func beforeCursor(t callhome.Telemetry, c callhome.PageCursor) bool {
+	if !t.ServiceTime.Equal(c.Time) {
+		return t.ServiceTime.Before(c.Time)
+	}
+	return t.DeploymentID < c.DeploymentID
+}
+
+func afterCursor(t callhome.Telemetry, c callhome.PageCursor) bool {
+	if !t.ServiceTime.Equal(c.Time) {
+		return t.ServiceTime.After(c.Time)
+	}
+	return t.DeploymentID > c.DeploymentID
+}
+
+// keys returns the non-empty keys of the set in ascending order.
+// addDeployment adds the deployment to the set of deployments reporting the value.
+func addDeployment(sets map[string]map[string]bool, value, ip string) {
+	if sets[value] == nil {
+		sets[value] = make(map[string]bool)
+	}
+	sets[value][ip] = true
+}
+
+// valueCounts counts the deployments reporting each non-empty value.
+func valueCounts(sets map[string]map[string]bool) []callhome.ValueSummary {
+	var counts []callhome.ValueSummary
+	for value, ips := range sets {
+		if value != "" {
+			counts = append(counts, callhome.ValueSummary{Value: value, NoDeployments: len(ips)})
+		}
+	}
+	return counts
+}
+
+func keys(set map[string]bool) []string {
+	var ret []string
+	for k := range set {
+		if k != "" {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ExportTelemetry calls fn with the matching heartbeats or deployments, in
+// ascending time order. The rows are copied so fn may use the repository.
+func (r *repo) ExportTelemetry(ctx context.Context, rows string, filters callhome.TelemetryFilters, fn func(callhome.Telemetry) error) error {
+	r.mu.RLock()
+	var export []callhome.Telemetry
+	switch rows {
+	case callhome.ExportDeployments:
+		latest := make(map[string]callhome.Telemetry)
+		services := make(map[string]map[string]bool)
+		// Services are those reported in the time range, regardless of the
+		// value filters.
+		timeRange := callhome.TelemetryFilters{From: filters.From, To: filters.To}
+		for _, t := range r.telemetry {
+			if services[t.IpAddress] == nil {
+				services[t.IpAddress] = make(map[string]bool)
+			}
+			if t.Service != "" && matches(t, timeRange) {
+				services[t.IpAddress][t.Service] = true
+			}
+			if !matches(t, filters) {
+				continue
+			}
+			if l, ok := latest[t.IpAddress]; !ok || t.ServiceTime.After(l.ServiceTime) {
+				latest[t.IpAddress] = t
+			}
+		}
+		for _, t := range latest {
+			t.Service = ""
+			t.Services = nil
+			for s := range services[t.IpAddress] {
+				t.Services = append(t.Services, s)
+			}
+			sort.Strings(t.Services)
+			export = append(export, t)
+		}
+	default:
+		for _, t := range r.telemetry {
+			if matches(t, filters) {
+				export = append(export, t)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(export, func(i, j int) bool {
+		a, b := export[i], export[j]
+		// Heartbeats of a deployment at the same time are ordered by service.
+		if a.ServiceTime.Equal(b.ServiceTime) && a.IpAddress == b.IpAddress {
+			return a.Service < b.Service
+		}
+		return before(a, b)
+	})
+	for _, t := range export {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.MacAddress = ""
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/absmach/callhome/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) callhome.TelemetryRepo {
+		return memory.New()
+	})
+}
+
+func TestWebhookConformance(t *testing.T) {
+	repotest.RunWebhooks(t, func(t *testing.T) callhome.WebhookRepo {
+		return memory.NewWebhookRepo()
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/absmach/callhome"
+)
+
+var _ callhome.WebhookRepo = (*webhookRepo)(nil)
+
+type webhookRepo struct {
+	mu         sync.RWMutex
+	webhooks   map[string]callhome.Webhook
+	deliveries map[string][]callhome.Delivery
+}
+
+// NewWebhookRepo returns new in-memory webhook repository.
+func NewWebhookRepo() callhome.WebhookRepo {
+	return &webhookRepo{
+		webhooks:   make(map[string]callhome.Webhook),
+		deliveries: make(map[string][]callhome.Delivery),
+	}
+}
+
+func (r *webhookRepo) SaveWebhook(ctx context.Context, w callhome.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.Events = append([]string(nil), w.Events...)
+	r.webhooks[w.ID] = w
+	return nil
+}
+
+func (r *webhookRepo) RetrieveWebhook(ctx context.Context, id string) (callhome.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	w, ok := r.webhooks[id]
+	if !ok {
+		return callhome.Webhook{}, callhome.ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+func (r *webhookRepo) RetrieveWebhooks(ctx context.Context) ([]callhome.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ret []callhome.Webhook
+	for _, w := range r.webhooks {
+		ret = append(ret, w)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].CreatedAt.Equal(ret[j].CreatedAt) {
+			return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+func (r *webhookRepo) RemoveWebhook(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[id]; !ok {
+		return callhome.ErrWebhookNotFound
+	}
+	delete(r.webhooks, id)
+	delete(r.deliveries, id)
+	return nil
+}
+
+func (r *webhookRepo) SaveDelivery(ctx context.Context, d callhome.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[d.WebhookID]; !ok {
+		return callhome.ErrWebhookNotFound
+	}
+	r.deliveries[d.WebhookID] = append(r.deliveries[d.WebhookID], d)
+	return nil
+}
+
+// RetrieveDeliveries gets the latest deliveries, ordered by time and then
+// by attempt.
+func (r *webhookRepo) RetrieveDeliveries(ctx context.Context, webhookID string, limit int) ([]callhome.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := append([]callhome.Delivery(nil), r.deliveries[webhookID]...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if !ret[i].Time.Equal(ret[j].Time) {
+			return ret[i].Time.After(ret[j].Time)
+		}
+		return ret[i].Attempt > ret[j].Attempt
+	})
+	if len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
@@ -5,6 +5,7 @@ package mocks
 
 import (
 	"context"
+	"io"
 
 	"github.com/absmach/callhome"
 	"github.com/stretchr/testify/mock"
@@ -55,8 +56,94 @@ func (s *Service) Save(ctx context.Context, t callhome.Telemetry) error {
 	return r0
 }
 
-func (*Service) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
-	return callhome.TelemetrySummary{}, nil
+func (s *Service) RetrieveSummary(ctx context.Context, q callhome.SummaryQuery, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+	ret := s.Called(ctx, q, filters)
+	return ret.Get(0).(callhome.TelemetrySummary), ret.Error(1)
+}
+
+func (s *Service) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	ret := s.Called(ctx)
+	return ret.Get(0).(callhome.StoragePolicies), ret.Error(1)
+}
+
+func (s *Service) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) (callhome.TimeSeries, error) {
+	ret := s.Called(ctx, q, filters)
+	return ret.Get(0).(callhome.TimeSeries), ret.Error(1)
+}
+
+func (s *Service) RetrieveVersionAnalytics(ctx context.Context, filters callhome.TelemetryFilters) (callhome.VersionAnalytics, error) {
+	ret := s.Called(ctx, filters)
+	return ret.Get(0).(callhome.VersionAnalytics), ret.Error(1)
+}
+
+func (s *Service) RetrieveNewVersions(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	ret := s.Called(ctx, filters)
+	return ret.Get(0).([]callhome.VersionUsage), ret.Error(1)
+}
+
+func (s *Service) RetrieveVersionTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) (callhome.VersionTransitions, error) {
+	ret := s.Called(ctx, interval, filters)
+	return ret.Get(0).(callhome.VersionTransitions), ret.Error(1)
+}
+
+func (s *Service) RetrieveRetention(ctx context.Context, q callhome.RetentionQuery, filters callhome.TelemetryFilters) (callhome.Retention, error) {
+	ret := s.Called(ctx, q, filters)
+	return ret.Get(0).(callhome.Retention), ret.Error(1)
+}
+
+func (s *Service) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) (callhome.Aggregate, error) {
+	ret := s.Called(ctx, q, filters)
+	return ret.Get(0).(callhome.Aggregate), ret.Error(1)
+}
+
+func (s *Service) RetrieveServiceComposition(ctx context.Context, profiles int, filters callhome.TelemetryFilters) (callhome.ServiceComposition, error) {
+	ret := s.Called(ctx, profiles, filters)
+	return ret.Get(0).(callhome.ServiceComposition), ret.Error(1)
+}
+
+func (s *Service) RetrieveDeployment(ctx context.Context, id string, filters callhome.TelemetryFilters) (callhome.DeploymentDetail, error) {
+	ret := s.Called(ctx, id, filters)
+	return ret.Get(0).(callhome.DeploymentDetail), ret.Error(1)
+}
+
+func (s *Service) RetrieveSilentDeployments(ctx context.Context, q callhome.SilentQuery, filters callhome.TelemetryFilters) (callhome.SilentDeployments, error) {
+	ret := s.Called(ctx, q, filters)
+	return ret.Get(0).(callhome.SilentDeployments), ret.Error(1)
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, w callhome.Webhook) (callhome.Webhook, error) {
+	ret := s.Called(ctx, w)
+	return ret.Get(0).(callhome.Webhook), ret.Error(1)
+}
+
+func (s *Service) RetrieveWebhooks(ctx context.Context) ([]callhome.Webhook, error) {
+	ret := s.Called(ctx)
+	return ret.Get(0).([]callhome.Webhook), ret.Error(1)
+}
+
+func (s *Service) RemoveWebhook(ctx context.Context, id string) error {
+	ret := s.Called(ctx, id)
+	return ret.Error(0)
+}
+
+func (s *Service) RetrieveFleetMetrics(ctx context.Context, q callhome.FleetQuery) (callhome.FleetMetrics, error) {
+	ret := s.Called(ctx, q)
+	return ret.Get(0).(callhome.FleetMetrics), ret.Error(1)
+}
+
+func (s *Service) RetrieveWebhookDeliveries(ctx context.Context, id string, limit int) ([]callhome.Delivery, error) {
+	ret := s.Called(ctx, id, limit)
+	return ret.Get(0).([]callhome.Delivery), ret.Error(1)
+}
+
+func (s *Service) ExportTelemetry(ctx context.Context, q callhome.ExportQuery, filters callhome.TelemetryFilters, w io.Writer) error {
+	ret := s.Called(ctx, q, filters, w)
+	return ret.Error(0)
+}
+
+func (s *Service) RetrieveMapPoints(ctx context.Context, q callhome.MapQuery, filters callhome.TelemetryFilters) (callhome.MapPoints, error) {
+	ret := s.Called(ctx, q, filters)
+	return ret.Get(0).(callhome.MapPoints), ret.Error(1)
 }
 
 type mockConstructorTestingTNewService interface {
@@ -0,0 +1,89 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor indicates a malformed page cursor.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PageCursor is a keyset position in a telemetry listing, which is ordered by
+// the time of the latest heartbeat and then by deployment ID, both descending.
+type PageCursor struct {
+	Time         time.Time `json:"t"`
+	DeploymentID string    `json:"d"`
+	// Backward cursors point to the page preceding the position rather than
+	// the one following it.
+	Backward bool `json:"b,omitempty"`
+}
+
+// String encodes the cursor into an opaque URL-safe token. The token is not
+// signed, since it only holds the time and the random deployment ID that are
+// listed anyway.
+func (c PageCursor) String() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParsePageCursor decodes a token produced by PageCursor.String.
+func ParsePageCursor(token string) (PageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	var c PageCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Time.IsZero() || c.DeploymentID == "" {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// KeysetPage takes telemetry fetched for the given page metadata in cursor
+// order, with one row past the limit if there is more data, and returns the page
+// in display order together with the cursors of the next and previous pages.
+func KeysetPage(rows []Telemetry, pm PageMetadata) (page []Telemetry, next, prev string) {
+	var backward bool
+	if pm.Cursor != "" {
+		c, err := ParsePageCursor(pm.Cursor)
+		if err != nil {
+			return rows, "", ""
+		}
+		backward = c.Backward
+	}
+
+	hasMore := uint64(len(rows)) > pm.Limit
+	page = rows
+	if hasMore {
+		page = rows[:pm.Limit]
+	}
+	if len(page) == 0 {
+		return page, "", ""
+	}
+
+	hasNext, hasPrev := hasMore, pm.Cursor != "" || pm.Offset > 0
+	if backward {
+		for i, j := 0, len(page)-1; i < j; i, j = i+1, j-1 {
+			page[i], page[j] = page[j], page[i]
+		}
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if hasNext {
+		last := page[len(page)-1]
+		next = PageCursor{Time: last.ServiceTime, DeploymentID: last.DeploymentID}.String()
+	}
+	if hasPrev {
+		first := page[0]
+		prev = PageCursor{Time: first.ServiceTime, DeploymentID: first.DeploymentID, Backward: true}.String()
+	}
+	return page, next, prev
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageCursor(t *testing.T) {
+	c := callhome.PageCursor{
+		Time:         time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC),
+		DeploymentID: "0f3b8e4c2a9d4c6e8b1a7d5f3e2c1b0a",
+		Backward:     true,
+	}
+	parsed, err := callhome.ParsePageCursor(c.String())
+	assert.Nil(t, err)
+	assert.True(t, c.Time.Equal(parsed.Time))
+	assert.Equal(t, c.DeploymentID, parsed.DeploymentID)
+	assert.True(t, parsed.Backward)
+
+	for _, token := range []string{"", "not base64!", "e30"} {
+		_, err := callhome.ParsePageCursor(token)
+		assert.ErrorIs(t, err, callhome.ErrInvalidCursor, token)
+	}
+}
+
+func TestKeysetPage(t *testing.T) {
+	now := time.Now()
+	rows := func(n int) []callhome.Telemetry {
+		var tel []callhome.Telemetry
+		for i := 0; i < n; i++ {
+			tel = append(tel, callhome.Telemetry{
+				IpAddress:   fmt.Sprintf("10.0.0.%d", i),
+				ServiceTime: now.Add(-time.Duration(i) * time.Minute),
+			})
+		}
+		return tel
+	}
+	cursor := callhome.PageCursor{Time: now, DeploymentID: "id"}
+
+	t.Run("first page with more data", func(t *testing.T) {
+		page, next, prev := callhome.KeysetPage(rows(3), callhome.PageMetadata{Limit: 2})
+		assert.Len(t, page, 2)
+		assert.NotEmpty(t, next)
+		assert.Empty(t, prev)
+	})
+	t.Run("last page", func(t *testing.T) {
+		page, next, prev := callhome.KeysetPage(rows(2), callhome.PageMetadata{Limit: 2, Cursor: cursor.String()})
+		assert.Len(t, page, 2)
+		assert.Empty(t, next)
+		assert.NotEmpty(t, prev)
+	})
+	t.Run("backward page", func(t *testing.T) {
+		cursor.Backward = true
+		// Backward pages are fetched in ascending order.
+		tel := rows(3)
+		tel[0], tel[2] = tel[2], tel[0]
+		page, next, prev := callhome.KeysetPage(tel, callhome.PageMetadata{Limit: 2, Cursor: cursor.String()})
+		assert.Len(t, page, 2)
+		assert.Equal(t, "10.0.0.1", page[0].IpAddress)
+		assert.Equal(t, "10.0.0.2", page[1].IpAddress)
+		assert.NotEmpty(t, next)
+		assert.NotEmpty(t, prev)
+	})
+}
@@ -0,0 +1,1295 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package repotest contains a conformance suite every callhome.TelemetryRepo
+// implementation is expected to pass.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewRepo returns an empty repository for a single test.
+type NewRepo func(t *testing.T) callhome.TelemetryRepo
+
+// Run runs the conformance suite against the repositories returned by newRepo.
+func Run(t *testing.T, newRepo NewRepo) {
+	t.Run("Save", func(t *testing.T) { testSave(t, newRepo) })
+	t.Run("ConcurrentSave", func(t *testing.T) { testConcurrentSave(t, newRepo) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newRepo) })
+	t.Run("Pagination", func(t *testing.T) { testPagination(t, newRepo) })
+	t.Run("Summary", func(t *testing.T) { testSummary(t, newRepo) })
+	t.Run("TimeSeries", func(t *testing.T) { testTimeSeries(t, newRepo) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newRepo) })
+	t.Run("Transitions", func(t *testing.T) { testTransitions(t, newRepo) })
+	t.Run("TransitionCounts", func(t *testing.T) { testTransitionCounts(t, newRepo) })
+	t.Run("Activity", func(t *testing.T) { testActivity(t, newRepo) })
+	t.Run("Aggregate", func(t *testing.T) { testAggregate(t, newRepo) })
+	t.Run("ServiceSets", func(t *testing.T) { testServiceSets(t, newRepo) })
+	t.Run("Deployment", func(t *testing.T) { testDeployment(t, newRepo) })
+	t.Run("LastSeen", func(t *testing.T) { testLastSeen(t, newRepo) })
+	t.Run("ClientsSeen", func(t *testing.T) { testClientsSeen(t, newRepo) })
+	t.Run("Export", func(t *testing.T) { testExport(t, newRepo) })
+}
+
+// base is the time of the latest fixture heartbeat, a Friday. Times are kept at
+// microsecond precision, which every repository is expected to preserve.
+var base = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// locations are the coordinates of the fixture cities by country and city.
+var locations = map[[2]string][2]float64{
+	{"Serbia", "Belgrade"}: {44.82, 20.45},
+	{"Serbia", "Novi Sad"}: {45.25, 19.84},
+	{"France", "Paris"}:    {48.86, 2.35},
+	{"USA", "Paris"}:       {33.66, -95.56},
+}
+
+func heartbeat(ip, service, version, country, city string, at time.Time) callhome.Telemetry {
+	loc := locations[[2]string{country, city}]
+	return callhome.Telemetry{
+		Service:     service,
+		IpAddress:   ip,
+		MacAddress:  "00:00:00:00:00:01",
+		Version:     version,
+		Country:     country,
+		City:        city,
+		Longitude:   loc[1],
+		Latitude:    loc[0],
+		LastSeen:    at,
+		ServiceTime: at,
+	}
+}
+
+// fixture has five deployments. The first one upgraded from 0.13.0 two days
+// before base, and Paris is a city in two countries.
+func fixture() []callhome.Telemetry {
+	return []callhome.Telemetry{
+		heartbeat("10.0.0.1", "users", "0.14.0", "Serbia", "Belgrade", base),
+		heartbeat("10.0.0.1", "things", "0.14.0", "Serbia", "Belgrade", base),
+		heartbeat("10.0.0.1", "users", "0.13.0", "Serbia", "Belgrade", base.Add(-48*time.Hour)),
+		heartbeat("10.0.0.2", "users", "0.13.0", "Serbia", "Novi Sad", base.Add(-1*time.Hour)),
+		heartbeat("10.0.0.3", "auth", "0.14.0", "France", "Paris", base.Add(-2*time.Hour)),
+		heartbeat("10.0.0.4", "users", "0.12.0", "France", "Paris", base.Add(-3*time.Hour)),
+		heartbeat("10.0.0.5", "things", "0.14.0", "USA", "Paris", base.Add(-4*time.Hour)),
+	}
+}
+
+func seed(t *testing.T, repo callhome.TelemetryRepo) {
+	for _, tel := range fixture() {
+		require.Nil(t, repo.Save(context.Background(), tel), fmt.Sprintf("saving %s heartbeat of %s", tel.Service, tel.IpAddress))
+	}
+}
+
+func ips(page callhome.TelemetryPage) []string {
+	ret := []string{}
+	for _, tel := range page.Telemetry {
+		ret = append(ret, tel.IpAddress)
+	}
+	return ret
+}
+
+// deploymentID gets the ID the repository assigned to the deployment.
+func deploymentID(t *testing.T, repo callhome.TelemetryRepo, ip string) string {
+	page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 100}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	for _, d := range page.Telemetry {
+		if d.IpAddress == ip {
+			return d.DeploymentID
+		}
+	}
+	require.Failf(t, "deployment not found", "no deployment reports from %s", ip)
+	return ""
+}
+
+func testSave(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	require.Len(t, page.Telemetry, 5)
+
+	latest := page.Telemetry[0]
+	assert.Equal(t, "10.0.0.1", latest.IpAddress)
+	assert.Equal(t, "0.14.0", latest.Version)
+	assert.Equal(t, "Serbia", latest.Country)
+	assert.Equal(t, "Belgrade", latest.City)
+	assert.Equal(t, 20.45, latest.Longitude)
+	assert.Equal(t, 44.82, latest.Latitude)
+	assert.True(t, base.Equal(latest.ServiceTime), "expected time %s, got %s", base, latest.ServiceTime)
+	assert.True(t, base.Equal(latest.LastSeen), "expected last seen %s, got %s", base, latest.LastSeen)
+	assert.ElementsMatch(t, []string{"users", "things"}, []string(latest.Services))
+
+	// Saving the same heartbeats again must not duplicate them.
+	seed(t, repo)
+	page, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, uint64(5), page.Total)
+	assert.Len(t, page.Telemetry, 5)
+}
+
+func testConcurrentSave(t *testing.T, newRepo NewRepo) {
+	const (
+		workers     = 8
+		deployments = 10
+	)
+	ctx := context.Background()
+	repo := newRepo(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*(deployments+1))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for d := 0; d < deployments; d++ {
+				ip := fmt.Sprintf("10.1.%d.%d", w, d)
+				errs <- repo.Save(ctx, heartbeat(ip, "users", "0.14.0", "Serbia", "Belgrade", base.Add(-time.Duration(d)*time.Minute)))
+			}
+			// Every worker saves the same heartbeat, which must be stored once.
+			errs <- repo.Save(ctx, heartbeat("10.2.0.1", "users", "0.14.0", "Serbia", "Belgrade", base))
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+
+	page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 1000}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, uint64(workers*deployments+1), page.Total)
+	assert.Len(t, page.Telemetry, workers*deployments+1)
+
+	summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, workers*deployments+1, summary.TotalDeployments)
+}
+
+func testFilters(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		ips     []string
+	}{
+		{
+			desc: "no filters",
+			ips:  []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"},
+		},
+		{
+			desc:    "from",
+			filters: callhome.TelemetryFilters{From: base.Add(-150 * time.Minute)},
+			ips:     []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			desc:    "to",
+			filters: callhome.TelemetryFilters{To: base.Add(-90 * time.Minute)},
+			ips:     []string{"10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.1"},
+		},
+		{
+			desc:    "from and to are inclusive",
+			filters: callhome.TelemetryFilters{From: base.Add(-3 * time.Hour), To: base.Add(-1 * time.Hour)},
+			ips:     []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		{
+			desc:    "country",
+			filters: callhome.TelemetryFilters{Country: "Serbia"},
+			ips:     []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			desc:    "city",
+			filters: callhome.TelemetryFilters{City: "Paris"},
+			ips:     []string{"10.0.0.3", "10.0.0.4", "10.0.0.5"},
+		},
+		{
+			desc:    "version",
+			filters: callhome.TelemetryFilters{Version: "0.13.0"},
+			ips:     []string{"10.0.0.2", "10.0.0.1"},
+		},
+		{
+			desc:    "service",
+			filters: callhome.TelemetryFilters{Service: "things"},
+			ips:     []string{"10.0.0.1", "10.0.0.5"},
+		},
+		{
+			desc:    "combined",
+			filters: callhome.TelemetryFilters{Country: "France", Version: "0.14.0"},
+			ips:     []string{"10.0.0.3"},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: "Serbia", City: "Paris"},
+			ips:     []string{},
+		},
+		{
+			desc:    "countries",
+			filters: callhome.TelemetryFilters{Country: "Serbia,France"},
+			ips:     []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		{
+			desc:    "excluded countries",
+			filters: callhome.TelemetryFilters{Country: "!Serbia,!USA"},
+			ips:     []string{"10.0.0.3", "10.0.0.4"},
+		},
+		{
+			desc:    "excluded service",
+			filters: callhome.TelemetryFilters{Service: "!users"},
+			ips:     []string{"10.0.0.1", "10.0.0.3", "10.0.0.5"},
+		},
+		{
+			desc:    "version range",
+			filters: callhome.TelemetryFilters{Version: ">=0.13.0 <0.14"},
+			ips:     []string{"10.0.0.2", "10.0.0.1"},
+		},
+		{
+			desc:    "versions and version ranges",
+			filters: callhome.TelemetryFilters{Version: "0.12.0,>0.13"},
+			ips:     []string{"10.0.0.1", "10.0.0.3", "10.0.0.4", "10.0.0.5"},
+		},
+		{
+			desc:    "version range with an excluded version",
+			filters: callhome.TelemetryFilters{Version: "<1,!0.14.0"},
+			ips:     []string{"10.0.0.2", "10.0.0.4", "10.0.0.1"},
+		},
+		{
+			desc:    "bounding box",
+			filters: callhome.TelemetryFilters{BBox: &callhome.BoundingBox{West: 0, South: 44, East: 20, North: 50}},
+			ips:     []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		{
+			desc:    "bounding box across the antimeridian",
+			filters: callhome.TelemetryFilters{BBox: &callhome.BoundingBox{West: 10, South: 30, East: -90, North: 50}},
+			ips:     []string{"10.0.0.1", "10.0.0.2", "10.0.0.5"},
+		},
+		{
+			desc:    "within 100 km of Belgrade",
+			filters: callhome.TelemetryFilters{Near: &callhome.GeoCircle{Latitude: 44.79, Longitude: 20.45, Radius: 100}},
+			ips:     []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			desc:    "within 10 km of Belgrade",
+			filters: callhome.TelemetryFilters{Near: &callhome.GeoCircle{Latitude: 44.79, Longitude: 20.45, Radius: 10}},
+			ips:     []string{"10.0.0.1"},
+		},
+		{
+			desc:    "continent",
+			filters: callhome.TelemetryFilters{Continent: callhome.ContinentEurope},
+			ips:     []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		{
+			desc:    "sub-region",
+			filters: callhome.TelemetryFilters{SubRegion: "Western Europe"},
+			ips:     []string{"10.0.0.3", "10.0.0.4"},
+		},
+		{
+			desc:    "continent and sub-region",
+			filters: callhome.TelemetryFilters{Continent: callhome.ContinentEurope, SubRegion: "Northern America"},
+			ips:     []string{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, tc.filters)
+			require.Nil(t, err)
+			assert.Equal(t, tc.ips, ips(page))
+			assert.Equal(t, uint64(len(tc.ips)), page.Total)
+		})
+	}
+
+	t.Run("latest matching heartbeat", func(t *testing.T) {
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{Version: "0.13.0"})
+		require.Nil(t, err)
+		require.Len(t, page.Telemetry, 2)
+		assert.Equal(t, "0.13.0", page.Telemetry[1].Version)
+		assert.True(t, base.Add(-48*time.Hour).Equal(page.Telemetry[1].ServiceTime))
+	})
+}
+
+func testPagination(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+	// Deployments reporting at the same time are ordered by deployment ID.
+	for i := 0; i < 3; i++ {
+		require.Nil(t, repo.Save(ctx, heartbeat(fmt.Sprintf("10.3.0.%d", i), "users", "0.14.0", "Spain", "Madrid", base.Add(-5*time.Hour))))
+	}
+
+	all, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 100}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	require.Len(t, all.Telemetry, 8)
+	assert.Empty(t, all.Next)
+	assert.Empty(t, all.Prev)
+	ids := make(map[string]bool)
+	for i, cur := range all.Telemetry {
+		assert.NotEmpty(t, cur.DeploymentID, "%s has no deployment ID", cur.IpAddress)
+		assert.False(t, ids[cur.DeploymentID], "%s has a duplicate deployment ID", cur.IpAddress)
+		ids[cur.DeploymentID] = true
+		if i == 0 {
+			continue
+		}
+		prev := all.Telemetry[i-1]
+		ordered := prev.ServiceTime.After(cur.ServiceTime) ||
+			(prev.ServiceTime.Equal(cur.ServiceTime) && prev.DeploymentID > cur.DeploymentID)
+		assert.True(t, ordered, "%s listed before %s", prev.IpAddress, cur.IpAddress)
+	}
+
+	t.Run("offset", func(t *testing.T) {
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Offset: 2, Limit: 2}, callhome.TelemetryFilters{})
+		require.Nil(t, err)
+		assert.Equal(t, ips(all)[2:4], ips(page))
+		assert.Equal(t, uint64(8), page.Total)
+		assert.Equal(t, uint64(2), page.Offset)
+		assert.Equal(t, uint64(2), page.Limit)
+		assert.NotEmpty(t, page.Next)
+		assert.NotEmpty(t, page.Prev)
+	})
+	t.Run("offset past the end", func(t *testing.T) {
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Offset: 100, Limit: 2}, callhome.TelemetryFilters{})
+		require.Nil(t, err)
+		assert.Empty(t, page.Telemetry)
+		assert.Equal(t, uint64(8), page.Total)
+	})
+	t.Run("cursor", func(t *testing.T) {
+		var seen []string
+		var pages []callhome.TelemetryPage
+		pm := callhome.PageMetadata{Limit: 3}
+		for {
+			page, err := repo.RetrieveAll(ctx, pm, callhome.TelemetryFilters{})
+			require.Nil(t, err)
+			assert.Equal(t, uint64(8), page.Total)
+			seen = append(seen, ips(page)...)
+			pages = append(pages, page)
+			if page.Next == "" {
+				break
+			}
+			require.Less(t, len(pages), 10, "pagination does not terminate")
+			pm.Cursor = page.Next
+		}
+		assert.Equal(t, ips(all), seen)
+		require.Len(t, pages, 3)
+		assert.Empty(t, pages[0].Prev)
+
+		// Walking back from the last page yields the same pages.
+		for i := len(pages) - 1; i > 0; i-- {
+			require.NotEmpty(t, pages[i].Prev)
+			prev, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 3, Cursor: pages[i].Prev}, callhome.TelemetryFilters{})
+			require.Nil(t, err)
+			assert.Equal(t, ips(pages[i-1]), ips(prev))
+			assert.NotEmpty(t, prev.Next)
+		}
+	})
+	t.Run("cursor with filters", func(t *testing.T) {
+		filters := callhome.TelemetryFilters{City: "Paris"}
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 2}, filters)
+		require.Nil(t, err)
+		assert.Equal(t, []string{"10.0.0.3", "10.0.0.4"}, ips(page))
+		// Keyset pages skip no rows, whatever the offset.
+		page, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Offset: 1, Limit: 2, Cursor: page.Next}, filters)
+		require.Nil(t, err)
+		assert.Equal(t, []string{"10.0.0.5"}, ips(page))
+		assert.Empty(t, page.Next)
+		assert.Equal(t, uint64(3), page.Total)
+		assert.Zero(t, page.Offset)
+	})
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 2, Cursor: "invalid"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidCursor)
+	})
+}
+
+func testSummary(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		summary callhome.TelemetrySummary
+	}{
+		{
+			desc: "no filters",
+			summary: callhome.TelemetrySummary{
+				Countries: []callhome.CountrySummary{
+					{Country: "Serbia", NoDeployments: 2},
+					{Country: "France", NoDeployments: 2},
+					{Country: "USA", NoDeployments: 1},
+				},
+				CityCounts: []callhome.ValueSummary{
+					{Value: "Belgrade", NoDeployments: 1},
+					{Value: "Novi Sad", NoDeployments: 1},
+					{Value: "Paris", NoDeployments: 3},
+				},
+				ServiceCounts: []callhome.ValueSummary{
+					{Value: "users", NoDeployments: 3},
+					{Value: "things", NoDeployments: 2},
+					{Value: "auth", NoDeployments: 1},
+				},
+				VersionCounts: []callhome.ValueSummary{
+					{Value: "0.14.0", NoDeployments: 3},
+					{Value: "0.13.0", NoDeployments: 2},
+					{Value: "0.12.0", NoDeployments: 1},
+				},
+				TotalDeployments: 5,
+			},
+		},
+		{
+			desc:    "service",
+			filters: callhome.TelemetryFilters{Service: "users"},
+			summary: callhome.TelemetrySummary{
+				Countries: []callhome.CountrySummary{
+					{Country: "Serbia", NoDeployments: 2},
+					{Country: "France", NoDeployments: 1},
+				},
+				CityCounts: []callhome.ValueSummary{
+					{Value: "Belgrade", NoDeployments: 1},
+					{Value: "Novi Sad", NoDeployments: 1},
+					{Value: "Paris", NoDeployments: 1},
+				},
+				ServiceCounts: []callhome.ValueSummary{
+					{Value: "users", NoDeployments: 3},
+				},
+				VersionCounts: []callhome.ValueSummary{
+					{Value: "0.14.0", NoDeployments: 1},
+					{Value: "0.13.0", NoDeployments: 2},
+					{Value: "0.12.0", NoDeployments: 1},
+				},
+				TotalDeployments: 3,
+			},
+		},
+		{
+			desc:    "time range",
+			filters: callhome.TelemetryFilters{From: base.Add(-time.Hour), To: base},
+			summary: callhome.TelemetrySummary{
+				Countries: []callhome.CountrySummary{
+					{Country: "Serbia", NoDeployments: 2},
+				},
+				CityCounts: []callhome.ValueSummary{
+					{Value: "Belgrade", NoDeployments: 1},
+					{Value: "Novi Sad", NoDeployments: 1},
+				},
+				ServiceCounts: []callhome.ValueSummary{
+					{Value: "users", NoDeployments: 2},
+					{Value: "things", NoDeployments: 1},
+				},
+				VersionCounts: []callhome.ValueSummary{
+					{Value: "0.14.0", NoDeployments: 1},
+					{Value: "0.13.0", NoDeployments: 1},
+				},
+				TotalDeployments: 2,
+			},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			summary, err := repo.RetrieveSummary(ctx, tc.filters)
+			require.Nil(t, err)
+			assert.ElementsMatch(t, tc.summary.Countries, summary.Countries)
+			assert.ElementsMatch(t, tc.summary.CityCounts, summary.CityCounts)
+			assert.ElementsMatch(t, tc.summary.ServiceCounts, summary.ServiceCounts)
+			assert.ElementsMatch(t, tc.summary.VersionCounts, summary.VersionCounts)
+			assert.Equal(t, tc.summary.TotalDeployments, summary.TotalDeployments)
+		})
+	}
+}
+
+func testTimeSeries(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	feb28 := time.Date(2024, time.February, 28, 0, 0, 0, 0, time.UTC)
+	mar1 := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc    string
+		query   callhome.TimeSeriesQuery
+		filters callhome.TelemetryFilters
+		buckets []callhome.TimeSeriesBucket
+	}{
+		{
+			desc:  "daily",
+			query: callhome.TimeSeriesQuery{Interval: callhome.IntervalDay},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: feb28, ActiveDeployments: 1},
+				{Time: mar1, ActiveDeployments: 5},
+			},
+		},
+		{
+			desc:  "weekly buckets start on Monday",
+			query: callhome.TimeSeriesQuery{Interval: callhome.IntervalWeek},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC), ActiveDeployments: 5},
+			},
+		},
+		{
+			desc:  "monthly",
+			query: callhome.TimeSeriesQuery{Interval: callhome.IntervalMonth},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), ActiveDeployments: 1},
+				{Time: mar1, ActiveDeployments: 5},
+			},
+		},
+		{
+			desc:    "hourly with filter",
+			query:   callhome.TimeSeriesQuery{Interval: callhome.IntervalHour},
+			filters: callhome.TelemetryFilters{Country: "France"},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: base.Add(-3 * time.Hour), ActiveDeployments: 1},
+				{Time: base.Add(-2 * time.Hour), ActiveDeployments: 1},
+			},
+		},
+		{
+			desc:  "split by country",
+			query: callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: callhome.SplitByCountry},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: feb28, Group: "Serbia", ActiveDeployments: 1},
+				{Time: mar1, Group: "France", ActiveDeployments: 2},
+				{Time: mar1, Group: "Serbia", ActiveDeployments: 2},
+				{Time: mar1, Group: "USA", ActiveDeployments: 1},
+			},
+		},
+		{
+			desc:  "split by version",
+			query: callhome.TimeSeriesQuery{Interval: callhome.IntervalMonth, SplitBy: callhome.SplitByVersion},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), Group: "0.13.0", ActiveDeployments: 1},
+				{Time: mar1, Group: "0.12.0", ActiveDeployments: 1},
+				{Time: mar1, Group: "0.13.0", ActiveDeployments: 1},
+				{Time: mar1, Group: "0.14.0", ActiveDeployments: 3},
+			},
+		},
+		{
+			desc:    "split by service with time range",
+			query:   callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: callhome.SplitByService},
+			filters: callhome.TelemetryFilters{From: base.Add(-time.Hour), To: base},
+			buckets: []callhome.TimeSeriesBucket{
+				{Time: mar1, Group: "things", ActiveDeployments: 1},
+				{Time: mar1, Group: "users", ActiveDeployments: 2},
+			},
+		},
+		{
+			desc:    "no match",
+			query:   callhome.TimeSeriesQuery{Interval: callhome.IntervalDay},
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buckets, err := repo.RetrieveTimeSeries(ctx, tc.query, tc.filters)
+			require.Nil(t, err)
+			require.Len(t, buckets, len(tc.buckets))
+			for i, b := range buckets {
+				assert.True(t, tc.buckets[i].Time.Equal(b.Time), "bucket %d: expected time %s, got %s", i, tc.buckets[i].Time, b.Time)
+				assert.Equal(t, tc.buckets[i].Group, b.Group, "bucket %d", i)
+				assert.Equal(t, tc.buckets[i].ActiveDeployments, b.ActiveDeployments, "bucket %d", i)
+			}
+		})
+	}
+
+	t.Run("invalid interval", func(t *testing.T) {
+		_, err := repo.RetrieveTimeSeries(ctx, callhome.TimeSeriesQuery{Interval: "fortnight"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+	t.Run("invalid split", func(t *testing.T) {
+		_, err := repo.RetrieveTimeSeries(ctx, callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: "ip_address"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+}
+
+func testVersions(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		usage   []callhome.VersionUsage
+	}{
+		{
+			desc: "all",
+			usage: []callhome.VersionUsage{
+				{Version: "0.12.0", Deployments: 1, FirstSeen: base.Add(-3 * time.Hour)},
+				{Version: "0.13.0", Deployments: 1, FirstSeen: base.Add(-48 * time.Hour)},
+				{Version: "0.14.0", Deployments: 3, FirstSeen: base.Add(-4 * time.Hour)},
+			},
+		},
+		{
+			desc:    "before the upgrade",
+			filters: callhome.TelemetryFilters{To: base.Add(-time.Hour)},
+			usage: []callhome.VersionUsage{
+				{Version: "0.12.0", Deployments: 1, FirstSeen: base.Add(-3 * time.Hour)},
+				{Version: "0.13.0", Deployments: 2, FirstSeen: base.Add(-48 * time.Hour)},
+				{Version: "0.14.0", Deployments: 2, FirstSeen: base.Add(-4 * time.Hour)},
+			},
+		},
+		{
+			desc:    "with filter",
+			filters: callhome.TelemetryFilters{Country: "Serbia", Service: "users"},
+			usage: []callhome.VersionUsage{
+				{Version: "0.13.0", Deployments: 1, FirstSeen: base.Add(-48 * time.Hour)},
+				{Version: "0.14.0", Deployments: 1, FirstSeen: base},
+			},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			usage, err := repo.RetrieveVersions(ctx, tc.filters)
+			require.Nil(t, err)
+			require.Len(t, usage, len(tc.usage))
+			for i, u := range usage {
+				assert.Equal(t, tc.usage[i].Version, u.Version, "version %d", i)
+				assert.Equal(t, tc.usage[i].Deployments, u.Deployments, "version %d", i)
+				assert.True(t, tc.usage[i].FirstSeen.Equal(u.FirstSeen), "version %d: expected first seen %s, got %s", i, tc.usage[i].FirstSeen, u.FirstSeen)
+			}
+		})
+	}
+}
+
+func testTransitions(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+	// 10.0.0.2 skips 0.14.0, and 10.0.0.4 downgrades after a heartbeat without
+	// a version, which is not a transition. Saving a heartbeat twice has no effect.
+	for _, tel := range []callhome.Telemetry{
+		heartbeat("10.0.0.2", "users", "0.15.0", "Serbia", "Novi Sad", base.Add(time.Hour)),
+		heartbeat("10.0.0.2", "users", "0.15.0", "Serbia", "Novi Sad", base.Add(time.Hour)),
+		heartbeat("10.0.0.4", "users", "", "France", "Paris", base.Add(time.Hour)),
+		heartbeat("10.0.0.4", "users", "0.11.0", "France", "Paris", base.Add(2*time.Hour)),
+	} {
+		require.Nil(t, repo.Save(ctx, tel))
+	}
+
+	mar1 := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc     string
+		interval string
+		filters  callhome.TelemetryFilters
+		buckets  []callhome.TransitionBucket
+	}{
+		{
+			desc:     "daily",
+			interval: callhome.IntervalDay,
+			buckets: []callhome.TransitionBucket{
+				{Time: mar1, From: "0.12.0", To: "0.11.0", Deployments: 1},
+				{Time: mar1, From: "0.13.0", To: "0.14.0", Deployments: 1},
+				{Time: mar1, From: "0.13.0", To: "0.15.0", Deployments: 1},
+			},
+		},
+		{
+			desc:     "hourly with time range",
+			interval: callhome.IntervalHour,
+			filters:  callhome.TelemetryFilters{From: base.Add(30 * time.Minute)},
+			buckets: []callhome.TransitionBucket{
+				{Time: base.Add(time.Hour), From: "0.13.0", To: "0.15.0", Deployments: 1},
+				{Time: base.Add(2 * time.Hour), From: "0.12.0", To: "0.11.0", Deployments: 1},
+			},
+		},
+		{
+			desc:     "by country",
+			interval: callhome.IntervalWeek,
+			filters:  callhome.TelemetryFilters{Country: "France"},
+			buckets: []callhome.TransitionBucket{
+				{Time: time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC), From: "0.12.0", To: "0.11.0", Deployments: 1},
+			},
+		},
+		{
+			desc:     "by version on either side",
+			interval: callhome.IntervalDay,
+			filters:  callhome.TelemetryFilters{Version: "0.13.0"},
+			buckets: []callhome.TransitionBucket{
+				{Time: mar1, From: "0.13.0", To: "0.14.0", Deployments: 1},
+				{Time: mar1, From: "0.13.0", To: "0.15.0", Deployments: 1},
+			},
+		},
+		{
+			desc:     "by version range on either side",
+			interval: callhome.IntervalDay,
+			filters:  callhome.TelemetryFilters{Version: ">=0.15"},
+			buckets: []callhome.TransitionBucket{
+				{Time: mar1, From: "0.13.0", To: "0.15.0", Deployments: 1},
+			},
+		},
+		{
+			desc:     "by service without transitions",
+			interval: callhome.IntervalDay,
+			filters:  callhome.TelemetryFilters{Service: "things"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buckets, err := repo.RetrieveTransitions(ctx, tc.interval, tc.filters)
+			require.Nil(t, err)
+			require.Len(t, buckets, len(tc.buckets))
+			for i, b := range buckets {
+				assert.True(t, tc.buckets[i].Time.Equal(b.Time), "bucket %d: expected time %s, got %s", i, tc.buckets[i].Time, b.Time)
+				assert.Equal(t, tc.buckets[i].From, b.From, "bucket %d", i)
+				assert.Equal(t, tc.buckets[i].To, b.To, "bucket %d", i)
+				assert.Equal(t, tc.buckets[i].Deployments, b.Deployments, "bucket %d", i)
+			}
+		})
+	}
+
+	t.Run("invalid interval", func(t *testing.T) {
+		_, err := repo.RetrieveTransitions(ctx, "fortnight", callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+}
+
+func testTransitionCounts(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	day := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	hb := func(ip, mac, version string, at time.Time) callhome.Telemetry {
+		tel := heartbeat(ip, "users", version, "Serbia", "Belgrade", at)
+		tel.MacAddress = mac
+		return tel
+	}
+	// 10.0.0.1 upgrades from two MAC addresses on different days, and a third
+	// reports the new version in between, which is no transition of the
+	// others.
+	for _, tel := range []callhome.Telemetry{
+		hb("10.0.0.1", "00:00:00:00:00:01", "0.13.0", day),
+		hb("10.0.0.1", "00:00:00:00:00:01", "0.14.0", day.AddDate(0, 0, 1)),
+		hb("10.0.0.1", "00:00:00:00:00:02", "0.13.0", day.AddDate(0, 0, 2)),
+		hb("10.0.0.1", "00:00:00:00:00:03", "0.14.0", day.AddDate(0, 0, 2).Add(time.Hour)),
+		hb("10.0.0.1", "00:00:00:00:00:02", "0.14.0", day.AddDate(0, 0, 3)),
+		hb("10.0.0.2", "00:00:00:00:00:01", "0.13.0", day),
+		hb("10.0.0.2", "00:00:00:00:00:01", "0.14.0", day.AddDate(0, 0, 3)),
+	} {
+		require.Nil(t, repo.Save(ctx, tel))
+	}
+
+	buckets, err := repo.RetrieveTransitions(ctx, callhome.IntervalDay, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	expected := []callhome.TransitionBucket{
+		{Time: day.AddDate(0, 0, 1), From: "0.13.0", To: "0.14.0", Deployments: 1},
+		{Time: day.AddDate(0, 0, 3), From: "0.13.0", To: "0.14.0", Deployments: 2},
+	}
+	require.Len(t, buckets, len(expected))
+	for i, b := range buckets {
+		assert.True(t, expected[i].Time.Equal(b.Time), "bucket %d: expected time %s, got %s", i, expected[i].Time, b.Time)
+		assert.Equal(t, expected[i].Deployments, b.Deployments, "bucket %d", i)
+	}
+
+	counts, err := repo.RetrieveTransitionCounts(ctx, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	assert.Equal(t, []callhome.TransitionCount{{From: "0.13.0", To: "0.14.0", Deployments: 2}}, counts, "deployments are counted once over the range")
+
+	counts, err = repo.RetrieveTransitionCounts(ctx, callhome.TelemetryFilters{From: day.AddDate(0, 0, 2)})
+	require.Nil(t, err)
+	assert.Equal(t, []callhome.TransitionCount{{From: "0.13.0", To: "0.14.0", Deployments: 2}}, counts)
+
+	counts, err = repo.RetrieveTransitionCounts(ctx, callhome.TelemetryFilters{Version: "0.15.0"})
+	require.Nil(t, err)
+	assert.Empty(t, counts)
+}
+
+func testActivity(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	feb28 := time.Date(2024, time.February, 28, 0, 0, 0, 0, time.UTC)
+	mar1 := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc     string
+		interval string
+		filters  callhome.TelemetryFilters
+		activity []callhome.ActivityBucket
+	}{
+		{
+			desc:     "daily",
+			interval: callhome.IntervalDay,
+			activity: []callhome.ActivityBucket{
+				{Time: feb28, IpAddress: "10.0.0.1"},
+				{Time: mar1, IpAddress: "10.0.0.1"},
+				{Time: mar1, IpAddress: "10.0.0.2"},
+				{Time: mar1, IpAddress: "10.0.0.3"},
+				{Time: mar1, IpAddress: "10.0.0.4"},
+				{Time: mar1, IpAddress: "10.0.0.5"},
+			},
+		},
+		{
+			desc:     "weekly with filter",
+			interval: callhome.IntervalWeek,
+			filters:  callhome.TelemetryFilters{Country: "Serbia"},
+			activity: []callhome.ActivityBucket{
+				{Time: time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC), IpAddress: "10.0.0.1"},
+				{Time: time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC), IpAddress: "10.0.0.2"},
+			},
+		},
+		{
+			desc:     "monthly with time range",
+			interval: callhome.IntervalMonth,
+			filters:  callhome.TelemetryFilters{To: base.Add(-24 * time.Hour), Service: "users"},
+			activity: []callhome.ActivityBucket{
+				{Time: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), IpAddress: "10.0.0.1"},
+			},
+		},
+		{
+			desc:     "no match",
+			interval: callhome.IntervalDay,
+			filters:  callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			activity, err := repo.RetrieveActivity(ctx, tc.interval, tc.filters)
+			require.Nil(t, err)
+			require.Len(t, activity, len(tc.activity))
+			for i, a := range activity {
+				assert.True(t, tc.activity[i].Time.Equal(a.Time), "bucket %d: expected time %s, got %s", i, tc.activity[i].Time, a.Time)
+				assert.Equal(t, tc.activity[i].IpAddress, a.IpAddress, "bucket %d", i)
+			}
+		})
+	}
+
+	t.Run("invalid interval", func(t *testing.T) {
+		_, err := repo.RetrieveActivity(ctx, "fortnight", callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+}
+
+func testDeployment(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+	id := deploymentID(t, repo, "10.0.0.1")
+
+	t.Run("identity and history", func(t *testing.T) {
+		d, err := repo.RetrieveDeployment(ctx, id)
+		require.Nil(t, err)
+		assert.Equal(t, id, d.ID)
+		assert.Equal(t, "10.0.0.1", d.Latest.IpAddress)
+		assert.Equal(t, "0.14.0", d.Latest.Version)
+		assert.Equal(t, "Serbia", d.Latest.Country)
+		assert.Equal(t, "Belgrade", d.Latest.City)
+		assert.InDelta(t, 44.82, d.Latest.Latitude, 1e-5)
+		assert.True(t, base.Equal(d.Latest.ServiceTime), "expected latest heartbeat at %s, got %s", base, d.Latest.ServiceTime)
+		assert.ElementsMatch(t, []string{"users", "things"}, []string(d.Latest.Services))
+		assert.True(t, base.Add(-48*time.Hour).Equal(d.FirstSeen), "expected first seen at %s, got %s", base.Add(-48*time.Hour), d.FirstSeen)
+
+		versions := []callhome.VersionPeriod{
+			{Version: "0.13.0", FirstSeen: base.Add(-48 * time.Hour), LastSeen: base.Add(-48 * time.Hour)},
+			{Version: "0.14.0", FirstSeen: base, LastSeen: base},
+		}
+		require.Len(t, d.Versions, len(versions))
+		for i, v := range d.Versions {
+			assert.Equal(t, versions[i].Version, v.Version)
+			assert.True(t, versions[i].FirstSeen.Equal(v.FirstSeen), "version %s: expected first seen at %s, got %s", v.Version, versions[i].FirstSeen, v.FirstSeen)
+			assert.True(t, versions[i].LastSeen.Equal(v.LastSeen), "version %s: expected last seen at %s, got %s", v.Version, versions[i].LastSeen, v.LastSeen)
+		}
+	})
+	t.Run("heartbeats", func(t *testing.T) {
+		beats, err := repo.RetrieveHeartbeats(ctx, id, callhome.TelemetryFilters{})
+		require.Nil(t, err)
+		// Heartbeats of several services at the same time are one heartbeat.
+		require.Len(t, beats, 2)
+		assert.True(t, base.Add(-48*time.Hour).Equal(beats[0]), "expected heartbeat at %s, got %s", base.Add(-48*time.Hour), beats[0])
+		assert.True(t, base.Equal(beats[1]), "expected heartbeat at %s, got %s", base, beats[1])
+	})
+	t.Run("heartbeats in time range", func(t *testing.T) {
+		beats, err := repo.RetrieveHeartbeats(ctx, id, callhome.TelemetryFilters{From: base.Add(-time.Hour)})
+		require.Nil(t, err)
+		require.Len(t, beats, 1)
+		assert.True(t, base.Equal(beats[0]), "expected heartbeat at %s, got %s", base, beats[0])
+	})
+	t.Run("not found", func(t *testing.T) {
+		_, err := repo.RetrieveDeployment(ctx, "unknown")
+		assert.ErrorIs(t, err, callhome.ErrDeploymentNotFound)
+		beats, err := repo.RetrieveHeartbeats(ctx, "unknown", callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Empty(t, beats)
+	})
+}
+
+func testServiceSets(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		sets    []callhome.ServiceSet
+	}{
+		{
+			desc: "all",
+			sets: []callhome.ServiceSet{
+				{Services: []string{"users"}, Deployments: 2},
+				{Services: []string{"auth"}, Deployments: 1},
+				{Services: []string{"things"}, Deployments: 1},
+				{Services: []string{"things", "users"}, Deployments: 1},
+			},
+		},
+		{
+			desc:    "service filter keeps other services",
+			filters: callhome.TelemetryFilters{Service: "things"},
+			sets: []callhome.ServiceSet{
+				{Services: []string{"things"}, Deployments: 1},
+				{Services: []string{"things", "users"}, Deployments: 1},
+			},
+		},
+		{
+			desc:    "excluded service applies to deployments",
+			filters: callhome.TelemetryFilters{Service: "!users"},
+			sets: []callhome.ServiceSet{
+				{Services: []string{"auth"}, Deployments: 1},
+				{Services: []string{"things"}, Deployments: 1},
+			},
+		},
+		{
+			desc:    "time range",
+			filters: callhome.TelemetryFilters{To: base.Add(-24 * time.Hour)},
+			sets:    []callhome.ServiceSet{{Services: []string{"users"}, Deployments: 1}},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			sets, err := repo.RetrieveServiceSets(ctx, tc.filters)
+			require.Nil(t, err)
+			require.Len(t, sets, len(tc.sets))
+			for i, s := range sets {
+				assert.Equal(t, tc.sets[i].Services, s.Services, "set %d", i)
+				assert.Equal(t, tc.sets[i].Deployments, s.Deployments, "set %d", i)
+			}
+		})
+	}
+}
+
+func testAggregate(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	week := time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	cases := []struct {
+		desc    string
+		q       callhome.AggregateQuery
+		filters callhome.TelemetryFilters
+		rows    []callhome.AggregateRow
+	}{
+		{
+			desc: "deployments by country",
+			q:    callhome.AggregateQuery{GroupBy: []string{callhome.GroupByCountry}},
+			rows: []callhome.AggregateRow{
+				{Groups: []string{"France"}, Metrics: []int{2}},
+				{Groups: []string{"Serbia"}, Metrics: []int{2}},
+				{Groups: []string{"USA"}, Metrics: []int{1}},
+			},
+		},
+		{
+			desc: "two groupings and metrics ordered by grouping",
+			q: callhome.AggregateQuery{
+				GroupBy: []string{callhome.GroupByVersion, callhome.GroupByWeek},
+				Metrics: []string{callhome.MetricHeartbeats, callhome.MetricDeployments},
+				Order:   "-" + callhome.GroupByVersion,
+			},
+			filters: callhome.TelemetryFilters{Country: "Serbia"},
+			rows: []callhome.AggregateRow{
+				{Groups: []string{"0.14.0", week}, Metrics: []int{2, 1}},
+				{Groups: []string{"0.13.0", week}, Metrics: []int{2, 2}},
+			},
+		},
+		{
+			desc: "top heartbeats by service",
+			q: callhome.AggregateQuery{
+				GroupBy: []string{callhome.GroupByService},
+				Metrics: []string{callhome.MetricHeartbeats},
+				Top:     2,
+			},
+			rows: []callhome.AggregateRow{
+				{Groups: []string{"users"}, Metrics: []int{4}},
+				{Groups: []string{"things"}, Metrics: []int{2}},
+			},
+		},
+		{
+			desc: "unknown regions",
+			q:    callhome.AggregateQuery{GroupBy: []string{callhome.GroupByRegion}, Order: callhome.GroupByRegion},
+			rows: []callhome.AggregateRow{{Groups: []string{""}, Metrics: []int{5}}},
+		},
+		{
+			desc:    "no match",
+			q:       callhome.AggregateQuery{GroupBy: []string{callhome.GroupByCity}},
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			rows, err := repo.RetrieveAggregate(ctx, tc.q, tc.filters)
+			require.Nil(t, err)
+			require.Len(t, rows, len(tc.rows))
+			for i, row := range rows {
+				assert.Equal(t, tc.rows[i], row, "row %d", i)
+			}
+		})
+	}
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := repo.RetrieveAggregate(ctx, callhome.AggregateQuery{GroupBy: []string{"ip_address"}}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidAggregateQuery)
+	})
+
+	t.Run("count heartbeats", func(t *testing.T) {
+		for _, tc := range []struct {
+			filters callhome.TelemetryFilters
+			count   int
+		}{
+			{callhome.TelemetryFilters{}, 7},
+			{callhome.TelemetryFilters{Country: "Serbia"}, 4},
+			{callhome.TelemetryFilters{Country: "Spain"}, 0},
+		} {
+			count, err := repo.CountHeartbeats(ctx, tc.filters)
+			require.Nil(t, err)
+			assert.Equal(t, tc.count, count, "filters %+v", tc.filters)
+		}
+	})
+}
+
+func testLastSeen(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+	ids := make(map[string]string)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		ids[ip] = deploymentID(t, repo, ip)
+	}
+
+	seen := func(ip, version, country, city string, first, last time.Time, heartbeats int) callhome.DeploymentSeen {
+		return callhome.DeploymentSeen{ID: ids[ip], IpAddress: ip, Country: country, City: city, Version: version, FirstSeen: first, LastSeen: last, Heartbeats: heartbeats}
+	}
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		seen    []callhome.DeploymentSeen
+	}{
+		{
+			desc: "no filters",
+			seen: []callhome.DeploymentSeen{
+				seen("10.0.0.1", "0.14.0", "Serbia", "Belgrade", base.Add(-48*time.Hour), base, 2),
+				seen("10.0.0.2", "0.13.0", "Serbia", "Novi Sad", base.Add(-time.Hour), base.Add(-time.Hour), 1),
+				seen("10.0.0.3", "0.14.0", "France", "Paris", base.Add(-2*time.Hour), base.Add(-2*time.Hour), 1),
+				seen("10.0.0.4", "0.12.0", "France", "Paris", base.Add(-3*time.Hour), base.Add(-3*time.Hour), 1),
+				seen("10.0.0.5", "0.14.0", "USA", "Paris", base.Add(-4*time.Hour), base.Add(-4*time.Hour), 1),
+			},
+		},
+		{
+			desc:    "version",
+			filters: callhome.TelemetryFilters{Version: "0.13.0"},
+			seen: []callhome.DeploymentSeen{
+				seen("10.0.0.2", "0.13.0", "Serbia", "Novi Sad", base.Add(-time.Hour), base.Add(-time.Hour), 1),
+				seen("10.0.0.1", "0.13.0", "Serbia", "Belgrade", base.Add(-48*time.Hour), base.Add(-48*time.Hour), 1),
+			},
+		},
+		{
+			desc:    "time range",
+			filters: callhome.TelemetryFilters{From: base.Add(-150 * time.Minute), To: base.Add(-time.Hour)},
+			seen: []callhome.DeploymentSeen{
+				seen("10.0.0.2", "0.13.0", "Serbia", "Novi Sad", base.Add(-time.Hour), base.Add(-time.Hour), 1),
+				seen("10.0.0.3", "0.14.0", "France", "Paris", base.Add(-2*time.Hour), base.Add(-2*time.Hour), 1),
+			},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			seen, err := repo.RetrieveLastSeen(ctx, tc.filters)
+			require.Nil(t, err)
+			assert.Equal(t, tc.seen, seen)
+		})
+	}
+}
+
+func testClientsSeen(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+	id := deploymentID(t, repo, "10.0.0.1")
+	// The same service reporting from another machine is another client.
+	other := heartbeat("10.0.0.1", "users", "0.14.0", "Serbia", "Belgrade", base.Add(-time.Hour))
+	other.MacAddress = "00:00:00:00:00:02"
+	require.Nil(t, repo.Save(ctx, other))
+
+	client := func(mac, service string, first, last time.Time, heartbeats int) callhome.ClientSeen {
+		return callhome.ClientSeen{DeploymentID: id, MacAddress: mac, Service: service, FirstSeen: first, LastSeen: last, Heartbeats: heartbeats}
+	}
+	cases := []struct {
+		desc    string
+		filters callhome.TelemetryFilters
+		seen    []callhome.ClientSeen
+	}{
+		{
+			desc:    "services of a deployment",
+			filters: callhome.TelemetryFilters{Country: "Serbia", City: "Belgrade"},
+			seen: []callhome.ClientSeen{
+				client("00:00:00:00:00:01", "things", base, base, 1),
+				client("00:00:00:00:00:01", "users", base.Add(-48*time.Hour), base, 2),
+				client("00:00:00:00:00:02", "users", base.Add(-time.Hour), base.Add(-time.Hour), 1),
+			},
+		},
+		{
+			desc:    "time range",
+			filters: callhome.TelemetryFilters{From: base.Add(-time.Hour), City: "Belgrade"},
+			seen: []callhome.ClientSeen{
+				client("00:00:00:00:00:01", "things", base, base, 1),
+				client("00:00:00:00:00:01", "users", base, base, 1),
+				client("00:00:00:00:00:02", "users", base.Add(-time.Hour), base.Add(-time.Hour), 1),
+			},
+		},
+		{
+			desc:    "no match",
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			seen, err := repo.RetrieveClientsSeen(ctx, tc.filters)
+			require.Nil(t, err)
+			assert.Equal(t, tc.seen, seen)
+		})
+	}
+
+	t.Run("all deployments", func(t *testing.T) {
+		seen, err := repo.RetrieveClientsSeen(ctx, callhome.TelemetryFilters{})
+		require.Nil(t, err)
+		// Five deployments with six clients in the fixture, and one more.
+		assert.Len(t, seen, 7)
+	})
+}
+
+func testExport(t *testing.T, newRepo NewRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	seed(t, repo)
+
+	// row describes an exported row by its deployment, time, services and version.
+	row := func(tel callhome.Telemetry) string {
+		services := tel.Service
+		if services == "" {
+			services = strings.Join(tel.Services, ",")
+		}
+		return fmt.Sprintf("%s %s %s %s", tel.IpAddress, tel.ServiceTime.UTC().Format(time.RFC3339), services, tel.Version)
+	}
+	at := func(d time.Duration) string {
+		return base.Add(d).Format(time.RFC3339)
+	}
+	cases := []struct {
+		desc    string
+		rows    string
+		filters callhome.TelemetryFilters
+		export  []string
+	}{
+		{
+			desc: "heartbeats",
+			rows: callhome.ExportHeartbeats,
+			export: []string{
+				"10.0.0.1 " + at(-48*time.Hour) + " users 0.13.0",
+				"10.0.0.5 " + at(-4*time.Hour) + " things 0.14.0",
+				"10.0.0.4 " + at(-3*time.Hour) + " users 0.12.0",
+				"10.0.0.3 " + at(-2*time.Hour) + " auth 0.14.0",
+				"10.0.0.2 " + at(-time.Hour) + " users 0.13.0",
+				"10.0.0.1 " + at(0) + " things 0.14.0",
+				"10.0.0.1 " + at(0) + " users 0.14.0",
+			},
+		},
+		{
+			desc:    "heartbeats with filters",
+			rows:    callhome.ExportHeartbeats,
+			filters: callhome.TelemetryFilters{Country: "Serbia", Version: "0.13.0"},
+			export: []string{
+				"10.0.0.1 " + at(-48*time.Hour) + " users 0.13.0",
+				"10.0.0.2 " + at(-time.Hour) + " users 0.13.0",
+			},
+		},
+		{
+			desc: "deployments",
+			rows: callhome.ExportDeployments,
+			export: []string{
+				"10.0.0.5 " + at(-4*time.Hour) + " things 0.14.0",
+				"10.0.0.4 " + at(-3*time.Hour) + " users 0.12.0",
+				"10.0.0.3 " + at(-2*time.Hour) + " auth 0.14.0",
+				"10.0.0.2 " + at(-time.Hour) + " users 0.13.0",
+				"10.0.0.1 " + at(0) + " things,users 0.14.0",
+			},
+		},
+		{
+			// Services reported after the range are left out.
+			desc:    "deployments in time range",
+			rows:    callhome.ExportDeployments,
+			filters: callhome.TelemetryFilters{To: base.Add(-24 * time.Hour)},
+			export: []string{
+				"10.0.0.1 " + at(-48*time.Hour) + " users 0.13.0",
+			},
+		},
+		{
+			// Services the value filters exclude are still listed.
+			desc:    "deployments of service",
+			rows:    callhome.ExportDeployments,
+			filters: callhome.TelemetryFilters{Service: "users"},
+			export: []string{
+				"10.0.0.4 " + at(-3*time.Hour) + " users 0.12.0",
+				"10.0.0.2 " + at(-time.Hour) + " users 0.13.0",
+				"10.0.0.1 " + at(0) + " things,users 0.14.0",
+			},
+		},
+		{
+			desc:    "no match",
+			rows:    callhome.ExportDeployments,
+			filters: callhome.TelemetryFilters{Country: "Spain"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var export []string
+			err := repo.ExportTelemetry(ctx, tc.rows, tc.filters, func(tel callhome.Telemetry) error {
+				assert.Empty(t, tel.MacAddress)
+				export = append(export, row(tel))
+				return nil
+			})
+			require.Nil(t, err)
+			assert.Equal(t, tc.export, export)
+		})
+	}
+
+	t.Run("stops at the first error", func(t *testing.T) {
+		errStop := fmt.Errorf("stop")
+		n := 0
+		err := repo.ExportTelemetry(ctx, callhome.ExportHeartbeats, callhome.TelemetryFilters{}, func(callhome.Telemetry) error {
+			n++
+			return errStop
+		})
+		assert.Equal(t, errStop, err)
+		assert.Equal(t, 1, n)
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewWebhookRepo returns an empty webhook repository for a single test.
+type NewWebhookRepo func(t *testing.T) callhome.WebhookRepo
+
+// RunWebhooks runs the webhook conformance suite against the repositories
+// returned by newRepo.
+func RunWebhooks(t *testing.T, newRepo NewWebhookRepo) {
+	t.Run("Webhooks", func(t *testing.T) { testWebhooks(t, newRepo) })
+	t.Run("Deliveries", func(t *testing.T) { testDeliveries(t, newRepo) })
+}
+
+func webhook(id string, createdAt time.Time, events ...string) callhome.Webhook {
+	return callhome.Webhook{
+		ID:        id,
+		URL:       "https://example.com/hooks/" + id,
+		Secret:    "secret-" + id,
+		Events:    events,
+		CreatedAt: createdAt,
+	}
+}
+
+func testWebhooks(t *testing.T, newRepo NewWebhookRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+
+	hooks, err := repo.RetrieveWebhooks(ctx)
+	require.Nil(t, err)
+	assert.Empty(t, hooks)
+
+	second := webhook("b", base, callhome.EventMilestone)
+	first := webhook("a", base.Add(-time.Hour), callhome.EventNewCountry, callhome.EventNewVersion)
+	require.Nil(t, repo.SaveWebhook(ctx, second))
+	require.Nil(t, repo.SaveWebhook(ctx, first))
+
+	got, err := repo.RetrieveWebhook(ctx, "a")
+	require.Nil(t, err)
+	assert.Equal(t, first, got)
+	_, err = repo.RetrieveWebhook(ctx, "c")
+	assert.ErrorIs(t, err, callhome.ErrWebhookNotFound)
+
+	hooks, err = repo.RetrieveWebhooks(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []callhome.Webhook{first, second}, hooks, "webhooks are ordered oldest first")
+
+	require.Nil(t, repo.RemoveWebhook(ctx, "a"))
+	assert.ErrorIs(t, repo.RemoveWebhook(ctx, "a"), callhome.ErrWebhookNotFound)
+	hooks, err = repo.RetrieveWebhooks(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []callhome.Webhook{second}, hooks)
+}
+
+func testDeliveries(t *testing.T, newRepo NewWebhookRepo) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	require.Nil(t, repo.SaveWebhook(ctx, webhook("a", base, callhome.EventNewCountry)))
+	require.Nil(t, repo.SaveWebhook(ctx, webhook("b", base, callhome.EventNewCountry)))
+
+	delivery := func(webhookID, eventID string, attempt int, at time.Time, status int) callhome.Delivery {
+		d := callhome.Delivery{WebhookID: webhookID, EventID: eventID, EventType: callhome.EventNewCountry, Attempt: attempt, Time: at, StatusCode: status}
+		if status != 200 {
+			d.Error = "unexpected status"
+		}
+		return d
+	}
+	failed := delivery("a", "e1", 1, base, 500)
+	retried := delivery("a", "e1", 2, base.Add(time.Second), 200)
+	other := delivery("a", "e2", 1, base.Add(time.Minute), 0)
+	for _, d := range []callhome.Delivery{failed, retried, other, delivery("b", "e1", 1, base, 200)} {
+		require.Nil(t, repo.SaveDelivery(ctx, d))
+	}
+	assert.ErrorIs(t, repo.SaveDelivery(ctx, delivery("c", "e1", 1, base, 200)), callhome.ErrWebhookNotFound)
+
+	ds, err := repo.RetrieveDeliveries(ctx, "a", 10)
+	require.Nil(t, err)
+	assert.Equal(t, []callhome.Delivery{other, retried, failed}, ds, "deliveries are ordered most recent first")
+
+	ds, err = repo.RetrieveDeliveries(ctx, "a", 2)
+	require.Nil(t, err)
+	assert.Equal(t, []callhome.Delivery{other, retried}, ds)
+
+	require.Nil(t, repo.RemoveWebhook(ctx, "a"))
+	ds, err = repo.RetrieveDeliveries(ctx, "a", 10)
+	require.Nil(t, err)
+	assert.Empty(t, ds, "deliveries are removed along with the webhook")
+	ds, err = repo.RetrieveDeliveries(ctx, "b", 10)
+	require.Nil(t, err)
+	assert.Len(t, ds, 1)
+}
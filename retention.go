@@ -0,0 +1,243 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultInactivityWindows are the inactivity windows of retention queries that
+// do not specify one, two periods long.
+var defaultInactivityWindows = map[string]time.Duration{
+	IntervalWeek:  14 * 24 * time.Hour,
+	IntervalMonth: 62 * 24 * time.Hour,
+}
+
+// ErrInvalidRetentionQuery indicates an unsupported cohort interval or inactivity window.
+var ErrInvalidRetentionQuery = errors.New("invalid retention query")
+
+// ActivityBucket marks a deployment as active in a single time bucket.
+type ActivityBucket struct {
+	Time      time.Time
+	IpAddress string
+}
+
+// RetentionQuery specifies how deployments are grouped into cohorts.
+type RetentionQuery struct {
+	// Interval is the cohort period, IntervalWeek or IntervalMonth.
+	Interval string
+	// InactivityWindow is how long a deployment may stay silent before it is
+	// considered churned, two periods if zero. Silence is measured between
+	// the starts of periods.
+	InactivityWindow time.Duration
+}
+
+// Validate checks the interval is supported and the inactivity window, if
+// set, spans at least one period.
+func (q RetentionQuery) Validate() error {
+	var period time.Duration
+	switch q.Interval {
+	case IntervalWeek:
+		period = 7 * 24 * time.Hour
+	case IntervalMonth:
+		period = 28 * 24 * time.Hour
+	default:
+		return ErrInvalidRetentionQuery
+	}
+	if q.InactivityWindow != 0 && q.InactivityWindow < period {
+		return ErrInvalidRetentionQuery
+	}
+	return nil
+}
+
+// withDefaults sets the default inactivity window if there is none.
+func (q RetentionQuery) withDefaults() RetentionQuery {
+	if q.InactivityWindow == 0 {
+		q.InactivityWindow = defaultInactivityWindows[q.Interval]
+	}
+	return q
+}
+
+// ActivityPeriod classifies the deployments in a single period. New deployments
+// report for the first time, active ones reported within the inactivity window
+// before the period, and returning ones after a longer silence. Churned
+// deployments went silent for longer than the inactivity window in the period.
+type ActivityPeriod struct {
+	Time      time.Time `json:"time"`
+	New       int       `json:"new"`
+	Active    int       `json:"active"`
+	Returning int       `json:"returning"`
+	Churned   int       `json:"churned"`
+}
+
+// Cohort is the deployments that first reported in the same period.
+type Cohort struct {
+	Start time.Time `json:"start"`
+	Size  int       `json:"size"`
+	// Retained counts the cohort deployments reporting in each period since
+	// the start of the cohort, starting with the size of the cohort.
+	Retained []int `json:"retained"`
+}
+
+// Retention describes how deployments join, stay and leave over time.
+type Retention struct {
+	RetentionQuery
+	Periods []ActivityPeriod
+	Cohorts []Cohort
+}
+
+// analyzeRetention classifies deployments in each period from start until end,
+// given the periods each deployment was active in. Activity before start only
+// tells whether a deployment is new.
+func analyzeRetention(q RetentionQuery, activity []ActivityBucket, start, end time.Time) Retention {
+	ret := Retention{RetentionQuery: q}
+
+	deployments := make(map[string][]time.Time)
+	for _, a := range activity {
+		deployments[a.IpAddress] = append(deployments[a.IpAddress], a.Time.UTC())
+	}
+	if len(deployments) == 0 {
+		return ret
+	}
+
+	end = BucketStart(end, q.Interval)
+	if start.IsZero() {
+		for _, periods := range deployments {
+			for _, p := range periods {
+				if start.IsZero() || p.Before(start) {
+					start = p
+				}
+			}
+		}
+	}
+	start = BucketStart(start, q.Interval)
+
+	var periods []time.Time
+	index := make(map[int64]int)
+	for p := start; !p.After(end); p = nextBucket(p, q.Interval) {
+		index[p.Unix()] = len(periods)
+		periods = append(periods, p)
+	}
+	ret.Periods = make([]ActivityPeriod, len(periods))
+	for i, p := range periods {
+		ret.Periods[i].Time = p
+	}
+	cohorts := make([]Cohort, len(periods))
+
+	for _, active := range deployments {
+		sort.Slice(active, func(i, j int) bool { return active[i].Before(active[j]) })
+
+		if i, ok := index[active[0].Unix()]; ok {
+			ret.Periods[i].New++
+			cohorts[i].Start = periods[i]
+			cohorts[i].Size++
+			if cohorts[i].Retained == nil {
+				cohorts[i].Retained = make([]int, len(periods)-i)
+			}
+			for _, p := range active {
+				if j, ok := index[p.Unix()]; ok {
+					cohorts[i].Retained[j-i]++
+				}
+			}
+		}
+		for k := 1; k < len(active); k++ {
+			i, ok := index[active[k].Unix()]
+			if !ok {
+				continue
+			}
+			if active[k].Sub(active[k-1]) > q.InactivityWindow {
+				ret.Periods[i].Returning++
+				continue
+			}
+			ret.Periods[i].Active++
+		}
+		// A deployment churns in the first period starting more than the
+		// inactivity window after it was last active, unless it reports then.
+		for k, p := range active {
+			churn := p
+			for !churn.After(p.Add(q.InactivityWindow)) {
+				churn = nextBucket(churn, q.Interval)
+			}
+			if k+1 < len(active) && !active[k+1].After(churn) {
+				continue
+			}
+			if i, ok := index[churn.Unix()]; ok {
+				ret.Periods[i].Churned++
+			}
+		}
+	}
+
+	for _, c := range cohorts {
+		if c.Size > 0 {
+			ret.Cohorts = append(ret.Cohorts, c)
+		}
+	}
+	return ret
+}
+
+// dashboardPeriods is the number of recent periods shown on the dashboard.
+const dashboardPeriods = 8
+
+// dashboardFilters bounds the filters to the recent weeks shown on the
+// dashboard.
+func dashboardFilters(filters TelemetryFilters) TelemetryFilters {
+	end := filters.To
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := BucketStart(end, IntervalWeek).AddDate(0, 0, -7*(dashboardPeriods-1))
+	if filters.From.Before(start) {
+		filters.From = start
+	}
+	return filters
+}
+
+// cohortRow is a retention cohort as shown on the dashboard, with the share of
+// the cohort retained in each period.
+type cohortRow struct {
+	Start    time.Time
+	Size     int
+	Retained []string
+}
+
+// dashboardRetention trims retention to the recent periods and cohorts shown
+// on the dashboard.
+func dashboardRetention(r Retention) ([]ActivityPeriod, []cohortRow) {
+	periods := r.Periods
+	if len(periods) > dashboardPeriods {
+		periods = periods[len(periods)-dashboardPeriods:]
+	}
+	cohorts := r.Cohorts
+	if len(cohorts) > dashboardPeriods {
+		cohorts = cohorts[len(cohorts)-dashboardPeriods:]
+	}
+	rows := make([]cohortRow, len(cohorts))
+	for i, c := range cohorts {
+		rows[i] = cohortRow{Start: c.Start, Size: c.Size}
+		for j, n := range c.Retained {
+			if j == dashboardPeriods {
+				break
+			}
+			rows[i].Retained = append(rows[i].Retained, fmt.Sprintf("%d%%", 100*n/c.Size))
+		}
+	}
+	return periods, rows
+}
+
+// nextBucket returns the start of the bucket following the one starting at t.
+func nextBucket(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return t.Add(time.Hour)
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
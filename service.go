@@ -10,23 +10,27 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
+	"golang.org/x/sync/singleflight"
 )
 
 const RoundPeriod = 20 * time.Minute // cache invalidation for empty params on every 10 mins.
 
 const (
-	pageLimit        = 1000
 	summaryCacheTTL  = 10 * time.Minute
 	cacheNumCounters = 1000      // Number of keys to track frequency (10x max items)
 	cacheMaxCost     = 500 << 20 // 500MB max cache size
 	cacheBufferItems = 64        // Number of keys per Get/Set buffer
 	cacheCost        = 1 << 20   // Estimated cost per entry (~1MB)
 	summaryCacheCost = 10 << 10  // Estimated cost per summary (~10KB)
+	deploymentCost   = 1 << 10   // Estimated cost per map deployment (~1KB)
 )
 
 // Service to receive homing telemetry data, persist and retrieve it.
@@ -35,37 +39,86 @@ type Service interface {
 	Save(ctx context.Context, t Telemetry) error
 	// Retrieve retrieves homing telemetry data from the specified repository.
 	Retrieve(ctx context.Context, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error)
-	// RetrieveSummary gets distinct countries and ip addresses
-	RetrieveSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error)
+	// RetrieveSummary counts deployments by country, city, service and version,
+	// and optionally compares the counts with a baseline.
+	RetrieveSummary(ctx context.Context, q SummaryQuery, filters TelemetryFilters) (TelemetrySummary, error)
+	// RetrieveSilentDeployments lists the deployments that recently stopped
+	// reporting, grouped by version and country. The time range of the filters
+	// is replaced by the lookback of the query.
+	RetrieveSilentDeployments(ctx context.Context, q SilentQuery, filters TelemetryFilters) (SilentDeployments, error)
 	// ServeUI gets the callhome index html page
 	ServeUI(ctx context.Context, filters TelemetryFilters) ([]byte, error)
+	// RetrievePolicies gets the storage policies active on the repository.
+	RetrievePolicies(ctx context.Context) (StoragePolicies, error)
+	// RetrieveTimeSeries gets the number of active deployments over time.
+	RetrieveTimeSeries(ctx context.Context, q TimeSeriesQuery, filters TelemetryFilters) (TimeSeries, error)
+	// RetrieveVersionAnalytics gets version adoption and upgrade lag across deployments.
+	RetrieveVersionAnalytics(ctx context.Context, filters TelemetryFilters) (VersionAnalytics, error)
+	// RetrieveNewVersions gets the versions first reported in the filtered
+	// range, ordered by the time they were first reported.
+	RetrieveNewVersions(ctx context.Context, filters TelemetryFilters) ([]VersionUsage, error)
+	// RetrieveVersionTransitions gets how deployments moved between versions over time.
+	RetrieveVersionTransitions(ctx context.Context, interval string, filters TelemetryFilters) (VersionTransitions, error)
+	// RetrieveRetention gets new, active, returning and churned deployments
+	// over time, along with retention cohorts.
+	RetrieveRetention(ctx context.Context, q RetentionQuery, filters TelemetryFilters) (Retention, error)
+	// RetrieveAggregate groups heartbeats by up to two dimensions and
+	// measures each group.
+	RetrieveAggregate(ctx context.Context, q AggregateQuery, filters TelemetryFilters) (Aggregate, error)
+	// RetrieveServiceComposition gets which services are deployed together,
+	// along with the given number of the most common service sets.
+	RetrieveServiceComposition(ctx context.Context, profiles int, filters TelemetryFilters) (ServiceComposition, error)
+	// RetrieveDeployment gets a single deployment along with the gaps in its
+	// heartbeats and its estimated uptime in the filtered range.
+	RetrieveDeployment(ctx context.Context, id string, filters TelemetryFilters) (DeploymentDetail, error)
+	// CreateWebhook subscribes a webhook to telemetry events.
+	CreateWebhook(ctx context.Context, w Webhook) (Webhook, error)
+	// RetrieveWebhooks gets all webhooks.
+	RetrieveWebhooks(ctx context.Context) ([]Webhook, error)
+	// RemoveWebhook removes the webhook with the given ID.
+	RemoveWebhook(ctx context.Context, id string) error
+	// RetrieveWebhookDeliveries gets up to limit of the latest delivery
+	// attempts to the webhook with the given ID.
+	RetrieveWebhookDeliveries(ctx context.Context, id string, limit int) ([]Delivery, error)
+	// RetrieveFleetMetrics gets the active deployments by version, country
+	// and service, along with ingestion and cache metrics.
+	RetrieveFleetMetrics(ctx context.Context, q FleetQuery) (FleetMetrics, error)
+	// ExportTelemetry streams the heartbeats, or the latest heartbeat of each
+	// deployment, matching the filters to w in the query format.
+	ExportTelemetry(ctx context.Context, q ExportQuery, filters TelemetryFilters, w io.Writer) error
+	// RetrieveMapPoints gets the location of the deployments inside the
+	// bounding box, clustered on the server at low zoom levels.
+	RetrieveMapPoints(ctx context.Context, q MapQuery, filters TelemetryFilters) (MapPoints, error)
 }
 
 var _ Service = (*telemetryService)(nil)
 
-type cachedSummary struct {
-	summary   TelemetrySummary
-	timestamp time.Time
-}
-
-type cachedTelemetryPage struct {
-	page      TelemetryPage
+type cached[T any] struct {
+	value     T
 	timestamp time.Time
 }
 
 type telemetryService struct {
 	repo   TelemetryRepo
 	locSvc LocationService
+	hooks  *Webhooks
 	cache  *ristretto.Cache
+	// mapFetches shares the export of map deployments between concurrent
+	// requests missing the cache.
+	mapFetches singleflight.Group
+	// geoFailures counts the heartbeats that could not be geolocated.
+	geoFailures atomic.Uint64
 }
 
-// New creates a new instance of the telemetry service.
+// New creates a new instance of the telemetry service. Notable events are
+// delivered to the webhooks, which are disabled if nil.
 // nolint: contextcheck
-func New(repo TelemetryRepo, locSvc LocationService) Service {
+func New(repo TelemetryRepo, locSvc LocationService, hooks *Webhooks) Service {
 	cache, err := ristretto.NewCache(&ristretto.Config{
 		NumCounters: cacheNumCounters,
 		MaxCost:     cacheMaxCost,
 		BufferItems: cacheBufferItems,
+		Metrics:     true,
 	})
 	if err != nil {
 		panic(fmt.Sprintf("failed to create cache: %v", err))
@@ -74,6 +127,7 @@ func New(repo TelemetryRepo, locSvc LocationService) Service {
 	ts := &telemetryService{
 		repo:   repo,
 		locSvc: locSvc,
+		hooks:  hooks,
 		cache:  cache,
 	}
 	go func() {
@@ -96,62 +150,333 @@ func (ts *telemetryService) Retrieve(ctx context.Context, pm PageMetadata, filte
 func (ts *telemetryService) Save(ctx context.Context, t Telemetry) error {
 	locRec, err := ts.locSvc.GetLocation(ctx, t.IpAddress)
 	if err != nil {
+		ts.geoFailures.Add(1)
 		return err
 	}
 	t.City = locRec.City
+	t.Region = locRec.Region
 	t.Country = locRec.Country_long
 	t.Latitude = float64(locRec.Latitude)
 	t.Longitude = float64(locRec.Longitude)
 	t.LastSeen = time.Now()
-	return ts.repo.Save(ctx, t)
+	if ts.hooks == nil {
+		return ts.repo.Save(ctx, t)
+	}
+
+	events := ts.hooks.Detect(t)
+	if err := ts.repo.Save(ctx, t); err != nil {
+		return err
+	}
+	// Webhooks must not fail ingestion, so publishing errors only cost the
+	// events.
+	_ = ts.hooks.Publish(ctx, ts.hooks.Seen(events)...)
+	return nil
 }
 
-func (ts *telemetryService) RetrieveSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error) {
-	return ts.repo.RetrieveSummary(ctx, filters)
+func (ts *telemetryService) RetrieveSummary(ctx context.Context, q SummaryQuery, filters TelemetryFilters) (TelemetrySummary, error) {
+	if err := q.Validate(); err != nil {
+		return TelemetrySummary{}, err
+	}
+	bf, err := q.baseline(filters)
+	if err != nil {
+		return TelemetrySummary{}, err
+	}
+	summary, err := ts.repo.RetrieveSummary(ctx, filters)
+	if err != nil {
+		return TelemetrySummary{}, err
+	}
+	summary = sortSummary(summary).Top(q.Top)
+	if q.Compare == "" {
+		return summary, nil
+	}
+
+	baseline, err := ts.getCachedOrFetchSummary(ctx, bf)
+	if err != nil {
+		return TelemetrySummary{}, err
+	}
+	sc := compareSummaries(summary, baseline, bf.From, bf.To)
+	summary.Comparison = &sc
+	return summary, nil
 }
 
-// getCachedOrFetchSummary retrieves summary from cache if available and fresh,
-// otherwise fetches it from the repository and updates the cache.
-// Thread-safe for concurrent access from multiple users using ristretto.
-func (ts *telemetryService) getCachedOrFetchSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error) {
-	cacheKey := "summary:" + generateCacheKey(filters)
+// RetrieveSilentDeployments lists the deployments that recently stopped reporting.
+func (ts *telemetryService) RetrieveSilentDeployments(ctx context.Context, q SilentQuery, filters TelemetryFilters) (SilentDeployments, error) {
+	if err := q.Validate(); err != nil {
+		return SilentDeployments{}, err
+	}
+	q = q.WithDefaults()
+	now := time.Now().UTC()
+	filters.From, filters.To = now.Add(-q.Lookback), now
+	seen, err := ts.repo.RetrieveLastSeen(ctx, filters)
+	if err != nil {
+		return SilentDeployments{}, err
+	}
+	return findSilent(seen, q, now), nil
+}
 
-	// Try to read from cache first
-	if val, found := ts.cache.Get(cacheKey); found {
-		if cached, ok := val.(*cachedSummary); ok {
-			if time.Since(cached.timestamp) < summaryCacheTTL {
-				// Cache hit and still fresh
-				return cached.summary, nil
-			}
+// RetrievePolicies gets the storage policies active on the repository.
+func (ts *telemetryService) RetrievePolicies(ctx context.Context) (StoragePolicies, error) {
+	return ts.repo.RetrievePolicies(ctx)
+}
+
+// RetrieveTimeSeries gets the number of active deployments over time.
+func (ts *telemetryService) RetrieveTimeSeries(ctx context.Context, q TimeSeriesQuery, filters TelemetryFilters) (TimeSeries, error) {
+	if err := q.Validate(); err != nil {
+		return TimeSeries{}, err
+	}
+	cacheKey := fmt.Sprintf("timeseries:%s:%s:%s", q.Interval, q.SplitBy, generateCacheKey(filters))
+	buckets, err := getCachedOrFetch(ts, cacheKey, cacheCost, func() ([]TimeSeriesBucket, error) {
+		return ts.repo.RetrieveTimeSeries(ctx, q, filters)
+	})
+	if err != nil {
+		return TimeSeries{}, err
+	}
+	return TimeSeries{TimeSeriesQuery: q, Buckets: buckets}, nil
+}
+
+// RetrieveVersionAnalytics gets version adoption and upgrade lag across deployments.
+func (ts *telemetryService) RetrieveVersionAnalytics(ctx context.Context, filters TelemetryFilters) (VersionAnalytics, error) {
+	return getCachedOrFetch(ts, "versions:"+generateCacheKey(filters), summaryCacheCost, func() (VersionAnalytics, error) {
+		usage, err := ts.repo.RetrieveVersions(ctx, filters)
+		if err != nil {
+			return VersionAnalytics{}, err
+		}
+		totals, err := ts.repo.RetrieveTimeSeries(ctx, TimeSeriesQuery{Interval: IntervalDay}, filters)
+		if err != nil {
+			return VersionAnalytics{}, err
+		}
+		byVersion, err := ts.repo.RetrieveTimeSeries(ctx, TimeSeriesQuery{Interval: IntervalDay, SplitBy: SplitByVersion}, filters)
+		if err != nil {
+			return VersionAnalytics{}, err
+		}
+		return analyzeVersions(usage, totals, byVersion), nil
+	})
+}
+
+// RetrieveNewVersions gets the versions first reported in the filtered range.
+// Versions are looked up over the whole history until the end of the range,
+// rounded up to RoundPeriod so ranges ending now share the cache entry.
+func (ts *telemetryService) RetrieveNewVersions(ctx context.Context, filters TelemetryFilters) ([]VersionUsage, error) {
+	history := filters
+	history.From = time.Time{}
+	if !history.To.IsZero() {
+		history.To = history.To.Truncate(RoundPeriod).Add(RoundPeriod)
+	}
+	usage, err := getCachedOrFetch(ts, "new-versions:"+generateCacheKey(history), summaryCacheCost, func() ([]VersionUsage, error) {
+		return ts.repo.RetrieveVersions(ctx, history)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []VersionUsage{}
+	for _, v := range usage {
+		if v.FirstSeen.Before(filters.From) || (!filters.To.IsZero() && v.FirstSeen.After(filters.To)) {
+			continue
 		}
+		versions = append(versions, v)
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].FirstSeen.Before(versions[j].FirstSeen)
+	})
+	return versions, nil
+}
+
+// RetrieveVersionTransitions gets how deployments moved between versions over time.
+func (ts *telemetryService) RetrieveVersionTransitions(ctx context.Context, interval string, filters TelemetryFilters) (VersionTransitions, error) {
+	if err := (TimeSeriesQuery{Interval: interval}).Validate(); err != nil {
+		return VersionTransitions{}, err
+	}
+	cacheKey := fmt.Sprintf("transitions:%s:%s", interval, generateCacheKey(filters))
+	return getCachedOrFetch(ts, cacheKey, summaryCacheCost, func() (VersionTransitions, error) {
+		counts, err := ts.repo.RetrieveTransitionCounts(ctx, filters)
+		if err != nil {
+			return VersionTransitions{}, err
+		}
+		buckets, err := ts.repo.RetrieveTransitions(ctx, interval, filters)
+		if err != nil {
+			return VersionTransitions{}, err
+		}
+		return summarizeTransitions(interval, counts, buckets), nil
+	})
+}
+
+// RetrieveRetention gets new, active, returning and churned deployments over
+// time, along with retention cohorts. Deployments are new in the period they
+// first reported in, even if that is before the start of the filtered range.
+// Only the first heartbeat of each deployment is loaded from the history
+// before the range, see retentionActivity.
+func (ts *telemetryService) RetrieveRetention(ctx context.Context, q RetentionQuery, filters TelemetryFilters) (Retention, error) {
+	if err := q.Validate(); err != nil {
+		return Retention{}, err
+	}
+	q = q.withDefaults()
+	cacheKey := fmt.Sprintf("retention:%s:%s:%s", q.Interval, q.InactivityWindow, generateCacheKey(filters))
+	return getCachedOrFetch(ts, cacheKey, cacheCost, func() (Retention, error) {
+		activity, err := ts.retentionActivity(ctx, q, filters)
+		if err != nil {
+			return Retention{}, err
+		}
+		end := filters.To
+		if end.IsZero() {
+			end = time.Now()
+		}
+		return analyzeRetention(q, activity, filters.From, end), nil
+	})
+}
+
+// retentionActivity gets the activity analyzeRetention needs to classify the
+// deployments in the filtered range. Deployments last active more than the
+// inactivity window and a period before the range neither stay active nor
+// churn in it, and return if they report again, so only their first period is
+// needed to tell they are not new.
+func (ts *telemetryService) retentionActivity(ctx context.Context, q RetentionQuery, filters TelemetryFilters) ([]ActivityBucket, error) {
+	if filters.From.IsZero() {
+		return ts.repo.RetrieveActivity(ctx, q.Interval, filters)
+	}
+	recent := filters
+	// Months are at most 31 days long.
+	recent.From = BucketStart(filters.From, q.Interval).Add(-q.InactivityWindow - 31*24*time.Hour)
+	activity, err := ts.repo.RetrieveActivity(ctx, q.Interval, recent)
+	if err != nil {
+		return nil, err
+	}
+	history := filters
+	history.From, history.To = time.Time{}, recent.From
+	seen, err := ts.repo.RetrieveLastSeen(ctx, history)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range seen {
+		activity = append(activity, ActivityBucket{Time: BucketStart(d.FirstSeen, q.Interval), IpAddress: d.IpAddress})
+	}
+	return activity, nil
+}
+
+// RetrieveAggregate groups heartbeats by up to two dimensions and measures each group.
+func (ts *telemetryService) RetrieveAggregate(ctx context.Context, q AggregateQuery, filters TelemetryFilters) (Aggregate, error) {
+	if err := q.Validate(); err != nil {
+		return Aggregate{}, err
+	}
+	q = q.WithDefaults()
+	cacheKey := fmt.Sprintf("aggregate:%s:%s:%s:%d:%s",
+		strings.Join(q.GroupBy, ","), strings.Join(q.Metrics, ","), q.Order, q.Top, generateCacheKey(filters))
+	rows, err := getCachedOrFetch(ts, cacheKey, summaryCacheCost, func() ([]AggregateRow, error) {
+		return ts.repo.RetrieveAggregate(ctx, q, filters)
+	})
+	if err != nil {
+		return Aggregate{}, err
+	}
+	return Aggregate{AggregateQuery: q, Rows: rows}, nil
+}
+
+// RetrieveServiceComposition gets which services are deployed together, along
+// with the given number of the most common service sets.
+func (ts *telemetryService) RetrieveServiceComposition(ctx context.Context, profiles int, filters TelemetryFilters) (ServiceComposition, error) {
+	sets, err := getCachedOrFetch(ts, "services:"+generateCacheKey(filters), summaryCacheCost, func() ([]ServiceSet, error) {
+		return ts.repo.RetrieveServiceSets(ctx, filters)
+	})
+	if err != nil {
+		return ServiceComposition{}, err
+	}
+	return analyzeServices(sets, profiles), nil
+}
+
+// RetrieveDeployment gets a single deployment along with the gaps in its
+// heartbeats and its estimated uptime in the filtered range.
+func (ts *telemetryService) RetrieveDeployment(ctx context.Context, id string, filters TelemetryFilters) (DeploymentDetail, error) {
+	d, err := ts.repo.RetrieveDeployment(ctx, id)
+	if err != nil {
+		return DeploymentDetail{}, err
+	}
+	d.Latest.DeploymentID = d.ID
+
+	dd := DeploymentDetail{Deployment: d, From: filters.From, To: filters.To}
+	if dd.From.Before(d.FirstSeen) {
+		dd.From = d.FirstSeen
+	}
+	if now := time.Now(); dd.To.IsZero() || dd.To.After(now) {
+		dd.To = now
+	}
+	beats, err := ts.repo.RetrieveHeartbeats(ctx, id, TelemetryFilters{From: dd.From, To: dd.To})
+	if err != nil {
+		return DeploymentDetail{}, err
+	}
+	dd.Heartbeats = len(beats)
+	dd.Gaps, dd.Uptime = analyzeHeartbeats(beats, dd.From, dd.To)
+	return dd, nil
+}
+
+// getCachedOrFetch retrieves the value from cache if available and fresh,
+// otherwise fetches it and updates the cache.
+// Thread-safe for concurrent access from multiple users using ristretto.
+func getCachedOrFetch[T any](ts *telemetryService, cacheKey string, cost int64, fetch func() (T, error)) (T, error) {
+	if value, ok := getCached[T](ts, cacheKey); ok {
+		return value, nil
 	}
 
 	// Cache miss or expired - fetch from repository
-	summary, err := ts.repo.RetrieveSummary(ctx, filters)
+	value, err := fetch()
 	if err != nil {
-		return TelemetrySummary{}, err
+		var zero T
+		return zero, err
 	}
+	setCached(ts, cacheKey, value, cost)
+	return value, nil
+}
 
-	// Update cache
-	ts.cache.Set(cacheKey, &cachedSummary{
-		summary:   summary,
+// getCached retrieves the value from cache if available and fresh.
+func getCached[T any](ts *telemetryService, cacheKey string) (T, bool) {
+	if val, found := ts.cache.Get(cacheKey); found {
+		if c, ok := val.(*cached[T]); ok {
+			if time.Since(c.timestamp) < summaryCacheTTL {
+				// Cache hit and still fresh
+				return c.value, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// setCached caches the value at the given cost.
+func setCached[T any](ts *telemetryService, cacheKey string, value T, cost int64) {
+	ts.cache.Set(cacheKey, &cached[T]{
+		value:     value,
 		timestamp: time.Now(),
-	}, summaryCacheCost)
+	}, cost)
 	ts.cache.Wait() // Wait for value to pass through buffers
+}
 
-	return summary, nil
+// getCachedOrFetchSummary retrieves summary from cache if available and fresh,
+// otherwise fetches it from the repository and updates the cache.
+func (ts *telemetryService) getCachedOrFetchSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error) {
+	return getCachedOrFetch(ts, "summary:"+generateCacheKey(filters), summaryCacheCost, func() (TelemetrySummary, error) {
+		summary, err := ts.repo.RetrieveSummary(ctx, filters)
+		if err != nil {
+			return TelemetrySummary{}, err
+		}
+		return sortSummary(summary), nil
+	})
 }
 
 // generateCacheKey creates a unique cache key from TelemetryFilters.
 func generateCacheKey(filters TelemetryFilters) string {
-	// Create a deterministic string representation of filters
-	key := fmt.Sprintf("%s|%s|%s|%s|%s|%s",
-		filters.Country,
-		filters.City,
-		filters.Service,
-		filters.Version,
+	// Create a deterministic string representation of filters. Expressions
+	// are canonical, so equivalent ones share entries. Geographic areas are
+	// formatted by value, &{...} or <nil>.
+	vf := filters.ValueFilters()
+	key := fmt.Sprintf("%s|%s|%s|%s|%s|%s|%v|%v|%s|%s",
+		vf.Country,
+		vf.City,
+		vf.Service,
+		vf.Version,
 		filters.From.Format(time.RFC3339Nano),
 		filters.To.Format(time.RFC3339Nano),
+		filters.BBox,
+		filters.Near,
+		filters.Continent,
+		filters.SubRegion,
 	)
 
 	// Hash to keep keys short and uniform
@@ -159,36 +484,37 @@ func generateCacheKey(filters TelemetryFilters) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// getCachedOrFetchTelemetryPage retrieves telemetry page from cache if available and fresh,
-// otherwise fetches it from the repository and updates the cache.
-// Thread-safe for concurrent access from multiple users using ristretto.
-func (ts *telemetryService) getCachedOrFetchTelemetryPage(ctx context.Context, filters TelemetryFilters) (TelemetryPage, error) {
-	cacheKey := "page:" + generateCacheKey(filters)
-
-	// Try to read from cache first
-	if val, found := ts.cache.Get(cacheKey); found {
-		if cached, ok := val.(*cachedTelemetryPage); ok {
-			if time.Since(cached.timestamp) < summaryCacheTTL {
-				// Cache hit and still fresh
-				return cached.page, nil
-			}
-		}
+// getCachedOrFetchMapDeployments retrieves the latest heartbeat of every
+// deployment from cache if available and fresh, otherwise streams them from
+// the repository and updates the cache. Map points of any bounding box and
+// zoom level are clustered from the same deployments. Concurrent requests
+// missing the cache share a single export, and the deployments cost the cache
+// by their number.
+func (ts *telemetryService) getCachedOrFetchMapDeployments(ctx context.Context, filters TelemetryFilters) ([]Telemetry, error) {
+	cacheKey := "map:" + generateCacheKey(filters)
+	if deployments, ok := getCached[[]Telemetry](ts, cacheKey); ok {
+		return deployments, nil
 	}
-
-	// Cache miss or expired - fetch from repository
-	telPage, err := ts.repo.RetrieveAll(ctx, PageMetadata{Limit: pageLimit}, filters)
+	val, err, _ := ts.mapFetches.Do(cacheKey, func() (interface{}, error) {
+		// A fetch finishing just before this one may have filled the cache.
+		if deployments, ok := getCached[[]Telemetry](ts, cacheKey); ok {
+			return deployments, nil
+		}
+		var deployments []Telemetry
+		err := ts.repo.ExportTelemetry(ctx, ExportDeployments, filters, func(t Telemetry) error {
+			deployments = append(deployments, t)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		setCached(ts, cacheKey, deployments, int64(len(deployments)+1)*deploymentCost)
+		return deployments, nil
+	})
 	if err != nil {
-		return TelemetryPage{}, err
+		return nil, err
 	}
-
-	// Update cache
-	ts.cache.Set(cacheKey, &cachedTelemetryPage{
-		page:      telPage,
-		timestamp: time.Now(),
-	}, cacheCost)
-	ts.cache.Wait() // Wait for value to pass through buffers
-
-	return telPage, nil
+	return val.([]Telemetry), nil
 }
 
 // ServeUI gets the callhome index html page.
@@ -199,21 +525,29 @@ func (ts *telemetryService) ServeUI(ctx context.Context, filters TelemetryFilter
 		return nil, err
 	}
 
+	// Show growth compared with the previous period of equal length.
+	var deploymentsGrowth, countriesGrowth *growth
+	if bf, err := (SummaryQuery{Compare: ComparePrevious}).baseline(filters); err == nil {
+		baseline, err := ts.getCachedOrFetchSummary(ctx, bf)
+		if err != nil {
+			return nil, err
+		}
+		sc := compareSummaries(summary, baseline, bf.From, bf.To)
+		deploymentsGrowth, countriesGrowth = dashboardGrowth(sc.TotalDeployments), dashboardGrowth(sc.Countries)
+	}
+
 	// Use cached unfiltered summary for filter dropdowns
 	unfilteredSummary, err := ts.getCachedOrFetchSummary(ctx, TelemetryFilters{})
 	if err != nil {
 		return nil, err
 	}
 
-	telPage, err := ts.getCachedOrFetchTelemetryPage(ctx, filters)
+	retention, err := ts.RetrieveRetention(ctx, RetentionQuery{Interval: IntervalWeek}, dashboardFilters(filters))
 	if err != nil {
 		return nil, err
 	}
+	activity, cohorts := dashboardRetention(retention)
 
-	pg, err := json.Marshal(telPage)
-	if err != nil {
-		return nil, err
-	}
 	countries, err := json.Marshal(summary.Countries)
 	if err != nil {
 		return nil, err
@@ -228,37 +562,50 @@ func (ts *telemetryService) ServeUI(ctx context.Context, filters TelemetryFilter
 		to = filters.To.Format(time.RFC3339)
 		to = strings.ReplaceAll(to, "Z", "")
 	}
+	vf := filters.ValueFilters()
 	data := struct {
-		Countries       string
-		Cities          string
-		FilterCountries []CountrySummary
-		FilterCities    []string
-		FilterServices  []string
-		FilterVersions  []string
-		NoDeployments   int
-		NoCountries     int
-		MapData         string
-		From            string
-		To              string
-		SelectedCountry string
-		SelectedCity    string
-		SelectedService string
-		SelectedVersion string
+		Countries         string
+		Cities            string
+		FilterCountries   []CountrySummary
+		FilterCities      []string
+		FilterServices    []string
+		FilterVersions    []string
+		NoDeployments     int
+		NoCountries       int
+		DeploymentsGrowth *growth
+		CountriesGrowth   *growth
+		From              string
+		To                string
+		SelectedCountry   string
+		SelectedCity      string
+		SelectedService   string
+		SelectedVersion   string
+		Activity          []ActivityPeriod
+		Cohorts           []cohortRow
+		CohortPeriods     []int
 	}{
-		Countries:       string(countries),
-		FilterCountries: unfilteredSummary.Countries,
-		FilterCities:    unfilteredSummary.Cities,
-		FilterServices:  unfilteredSummary.Services,
-		FilterVersions:  unfilteredSummary.Versions,
-		NoDeployments:   summary.TotalDeployments,
-		NoCountries:     len(summary.Countries),
-		MapData:         string(pg),
-		From:            from,
-		To:              to,
-		SelectedCountry: filters.Country,
-		SelectedCity:    filters.City,
-		SelectedService: filters.Service,
-		SelectedVersion: filters.Version,
+		Countries:         string(countries),
+		FilterCountries:   unfilteredSummary.Countries,
+		FilterCities:      unfilteredSummary.Cities,
+		FilterServices:    unfilteredSummary.Services,
+		FilterVersions:    unfilteredSummary.Versions,
+		NoDeployments:     summary.TotalDeployments,
+		NoCountries:       len(summary.Countries),
+		DeploymentsGrowth: deploymentsGrowth,
+		CountriesGrowth:   countriesGrowth,
+		From:              from,
+		To:                to,
+		SelectedCountry:   selectedValue(vf.Country),
+		SelectedCity:      selectedValue(vf.City),
+		SelectedService:   selectedValue(vf.Service),
+		SelectedVersion:   selectedValue(vf.Version),
+		Activity:          activity,
+		Cohorts:           cohorts,
+	}
+	if len(cohorts) > 0 {
+		for i := range cohorts[0].Retained {
+			data.CohortPeriods = append(data.CohortPeriods, i)
+		}
 	}
 	var res bytes.Buffer
 	if err = tmpl.Execute(&res, data); err != nil {
@@ -267,6 +614,15 @@ func (ts *telemetryService) ServeUI(ctx context.Context, filters TelemetryFilter
 	return res.Bytes(), nil
 }
 
+// selectedValue is the value a filter dropdown selects, which is the empty
+// option for all values unless the filter matches exactly one value.
+func selectedValue(f ValueFilter) string {
+	if len(f.Values) != 1 || len(f.Excluded) > 0 || len(f.Ranges) > 0 {
+		return ""
+	}
+	return f.Values[0]
+}
+
 // nolint:errcheck
 func (ts *telemetryService) prefetch(ctx context.Context) {
 	ts.getCachedOrFetchSummary(ctx, TelemetryFilters{})
@@ -275,7 +631,112 @@ func (ts *telemetryService) prefetch(ctx context.Context) {
 		From: t.AddDate(0, 0, -30).Round(RoundPeriod),
 		To:   t.Round(RoundPeriod),
 	}
-	ts.getCachedOrFetchTelemetryPage(ctx, filters)
+	ts.getCachedOrFetchMapDeployments(ctx, filters)
 	filters.From = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
-	ts.getCachedOrFetchTelemetryPage(ctx, filters)
+	ts.getCachedOrFetchMapDeployments(ctx, filters)
+}
+
+// CreateWebhook subscribes a webhook to telemetry events.
+func (ts *telemetryService) CreateWebhook(ctx context.Context, w Webhook) (Webhook, error) {
+	if ts.hooks == nil {
+		return Webhook{}, ErrWebhooksDisabled
+	}
+	return ts.hooks.Create(ctx, w)
+}
+
+// RetrieveWebhooks gets all webhooks.
+func (ts *telemetryService) RetrieveWebhooks(ctx context.Context) ([]Webhook, error) {
+	if ts.hooks == nil {
+		return nil, ErrWebhooksDisabled
+	}
+	return ts.hooks.repo.RetrieveWebhooks(ctx)
+}
+
+// RemoveWebhook removes the webhook with the given ID.
+func (ts *telemetryService) RemoveWebhook(ctx context.Context, id string) error {
+	if ts.hooks == nil {
+		return ErrWebhooksDisabled
+	}
+	return ts.hooks.repo.RemoveWebhook(ctx, id)
+}
+
+// RetrieveWebhookDeliveries gets the latest delivery attempts to the webhook.
+func (ts *telemetryService) RetrieveWebhookDeliveries(ctx context.Context, id string, limit int) ([]Delivery, error) {
+	if ts.hooks == nil {
+		return nil, ErrWebhooksDisabled
+	}
+	if _, err := ts.hooks.repo.RetrieveWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxDeliveries {
+		limit = MaxDeliveries
+	}
+	return ts.hooks.repo.RetrieveDeliveries(ctx, id, limit)
+}
+
+// RetrieveFleetMetrics gets the active deployments by version, country and
+// service, along with ingestion and cache metrics.
+func (ts *telemetryService) RetrieveFleetMetrics(ctx context.Context, q FleetQuery) (FleetMetrics, error) {
+	if err := q.Validate(); err != nil {
+		return FleetMetrics{}, err
+	}
+	q = q.WithDefaults()
+	now := time.Now().UTC()
+	filters := TelemetryFilters{From: now.Add(-q.Window), To: now}
+	fm := FleetMetrics{
+		FleetQuery:          q,
+		GeolocationFailures: ts.geoFailures.Load(),
+		CacheHitRatio:       ts.cache.Metrics.Ratio(),
+	}
+	for _, dim := range []struct {
+		groupBy string
+		values  *[]ValueSummary
+	}{
+		{GroupByVersion, &fm.Versions},
+		{GroupByCountry, &fm.Countries},
+		{GroupByService, &fm.Services},
+	} {
+		aq := AggregateQuery{GroupBy: []string{dim.groupBy}, Metrics: []string{MetricDeployments}}
+		rows, err := ts.repo.RetrieveAggregate(ctx, aq, filters)
+		if err != nil {
+			return FleetMetrics{}, err
+		}
+		*dim.values = foldValues(rows, q.Top)
+	}
+	// The aggregates are capped at the top groups, so they can't be summed.
+	heartbeats, err := ts.repo.CountHeartbeats(ctx, filters)
+	if err != nil {
+		return FleetMetrics{}, err
+	}
+	fm.Heartbeats = heartbeats
+	return fm, nil
+}
+
+// ExportTelemetry streams the telemetry to w, one row at a time.
+func (ts *telemetryService) ExportTelemetry(ctx context.Context, q ExportQuery, filters TelemetryFilters, w io.Writer) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	enc, err := newExportEncoder(q.Format, w)
+	if err != nil {
+		return err
+	}
+	if err := ts.repo.ExportTelemetry(ctx, q.Rows, filters, func(t Telemetry) error {
+		return enc.Encode(newExportRow(t))
+	}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// RetrieveMapPoints clusters the latest location of the deployments.
+func (ts *telemetryService) RetrieveMapPoints(ctx context.Context, q MapQuery, filters TelemetryFilters) (MapPoints, error) {
+	if err := q.Validate(); err != nil {
+		return MapPoints{}, err
+	}
+	deployments, err := ts.getCachedOrFetchMapDeployments(ctx, filters)
+	if err != nil {
+		return MapPoints{}, err
+	}
+	return clusterPoints(deployments, q), nil
 }
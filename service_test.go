@@ -5,139 +5,724 @@ package callhome_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
 	"github.com/absmach/callhome/mocks"
-	"github.com/absmach/callhome/timescale"
-	repoMocks "github.com/absmach/callhome/timescale/mocks"
 	"github.com/ip2location/ip2location-go/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+var errRepoFailed = errors.New("repo failed")
+
+// deploymentIDs maps the IP addresses of the stored deployments to the IDs the
+// repository assigned them.
+func deploymentIDs(t *testing.T, repo callhome.TelemetryRepo) map[string]string {
+	page, err := repo.RetrieveAll(context.Background(), callhome.PageMetadata{Limit: 1000}, callhome.TelemetryFilters{})
+	require.Nil(t, err)
+	ids := make(map[string]string)
+	for _, d := range page.Telemetry {
+		ids[d.IpAddress] = d.DeploymentID
+	}
+	return ids
+}
+
+// errRepo fails saving and retrieving heartbeats with err.
+type errRepo struct {
+	callhome.TelemetryRepo
+	err error
+}
+
+func (r errRepo) Save(ctx context.Context, t callhome.Telemetry) error {
+	return r.err
+}
+
+func (r errRepo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	return callhome.TelemetryPage{}, r.err
+}
+
+func (r errRepo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+	return callhome.TelemetrySummary{}, r.err
+}
+
 func TestRetrieve(t *testing.T) {
 	ctx := context.TODO()
-	t.Run("failed repo save", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock all calls - background prefetch and test calls
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, timescale.ErrSaveEvent)
-		svc := callhome.New(timescaleRepo, nil)
+	t.Run("failed repo retrieve", func(t *testing.T) {
+		svc := callhome.New(errRepo{TelemetryRepo: memory.New(), err: errRepoFailed}, nil, nil)
 		_, err := svc.Retrieve(ctx, callhome.PageMetadata{}, callhome.TelemetryFilters{})
-		assert.NotNil(t, err)
-		assert.Equal(t, timescale.ErrSaveEvent, err)
+		assert.Equal(t, errRepoFailed, err)
 	})
 	t.Run("success", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock all calls - background prefetch and test calls
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
-		svc := callhome.New(timescaleRepo, nil)
-		_, err := svc.Retrieve(ctx, callhome.PageMetadata{}, callhome.TelemetryFilters{})
+		repo := memory.New()
+		require.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", ServiceTime: time.Now()}))
+		svc := callhome.New(repo, nil, nil)
+		page, err := svc.Retrieve(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
 		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), page.Total)
 	})
 }
 
 func TestSave(t *testing.T) {
 	ctx := context.TODO()
+	location := ip2location.IP2Locationrecord{
+		Latitude:     1.2,
+		Longitude:    30,
+		Country_long: "SomeCountry",
+		City:         "someCity",
+	}
 	t.Run("error obtaining location", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock the background prefetch calls
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
+		repo := memory.New()
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", mock.Anything, "").Return(ip2location.IP2Locationrecord{}, fmt.Errorf("error getting loc"))
-		svc := callhome.New(timescaleRepo, locMock)
-		err := svc.Save(ctx, callhome.Telemetry{})
+		locMock.On("GetLocation", mock.Anything, "10.0.0.1").Return(ip2location.IP2Locationrecord{}, fmt.Errorf("error getting loc"))
+		svc := callhome.New(repo, locMock, nil)
+		err := svc.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", ServiceTime: time.Now()})
 		assert.NotNil(t, err)
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Empty(t, page.Telemetry)
 	})
-	t.Run("error saving to timescale", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock the background prefetch calls
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
+	t.Run("error saving to repo", func(t *testing.T) {
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", mock.Anything, "").Return(ip2location.IP2Locationrecord{
-			Latitude:     1.2,
-			Longitude:    30,
-			Country_long: "SomeCountry",
-			City:         "someCity",
-		}, nil)
-		timescaleRepo.On("Save", ctx, mock.AnythingOfType("callhome.Telemetry")).Return(timescale.ErrSaveEvent)
-		svc := callhome.New(timescaleRepo, locMock)
-		err := svc.Save(ctx, callhome.Telemetry{})
-		assert.NotNil(t, err)
-		assert.Equal(t, timescale.ErrSaveEvent, err)
+		locMock.On("GetLocation", mock.Anything, "10.0.0.1").Return(location, nil)
+		svc := callhome.New(errRepo{TelemetryRepo: memory.New(), err: errRepoFailed}, locMock, nil)
+		err := svc.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", ServiceTime: time.Now()})
+		assert.Equal(t, errRepoFailed, err)
 	})
 	t.Run("successful save", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock the background prefetch calls
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
+		repo := memory.New()
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", mock.Anything, "").Return(ip2location.IP2Locationrecord{
-			Latitude:     1.2,
-			Longitude:    30,
-			Country_long: "SomeCountry",
-			City:         "someCity",
-		}, nil)
-		timescaleRepo.On("Save", ctx, mock.AnythingOfType("callhome.Telemetry")).Return(nil)
-		svc := callhome.New(timescaleRepo, locMock)
-		err := svc.Save(ctx, callhome.Telemetry{})
+		locMock.On("GetLocation", mock.Anything, "10.0.0.1").Return(location, nil)
+		svc := callhome.New(repo, locMock, nil)
+		assert.Nil(t, svc.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", ServiceTime: time.Now()}))
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
 		assert.Nil(t, err)
+		if assert.Len(t, page.Telemetry, 1) {
+			assert.Equal(t, "SomeCountry", page.Telemetry[0].Country)
+			assert.Equal(t, "someCity", page.Telemetry[0].City)
+			assert.InDelta(t, 1.2, page.Telemetry[0].Latitude, 1e-5)
+			assert.InDelta(t, 30, page.Telemetry[0].Longitude, 1e-5)
+		}
 	})
 	t.Run("successful update", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock the background prefetch calls
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
+		repo := memory.New()
 		locMock := mocks.NewLocationService(t)
-		locMock.On("GetLocation", mock.Anything, "").Return(ip2location.IP2Locationrecord{
-			Latitude:     1.2,
-			Longitude:    30,
-			Country_long: "SomeCountry",
-			City:         "someCity",
-		}, nil)
-		timescaleRepo.On("Save", ctx, mock.AnythingOfType("callhome.Telemetry")).Return(nil)
-		svc := callhome.New(timescaleRepo, locMock)
-		err := svc.Save(ctx, callhome.Telemetry{})
+		locMock.On("GetLocation", mock.Anything, "10.0.0.1").Return(location, nil)
+		svc := callhome.New(repo, locMock, nil)
+		now := time.Now()
+		assert.Nil(t, svc.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", ServiceTime: now.Add(-time.Hour)}))
+		assert.Nil(t, svc.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", ServiceTime: now}))
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
 		assert.Nil(t, err)
+		if assert.Len(t, page.Telemetry, 1) {
+			assert.True(t, page.Telemetry[0].ServiceTime.Equal(now))
+		}
 	})
 }
 
 func TestRetrieveSummary(t *testing.T) {
 	ctx := context.TODO()
-	mockSummary := callhome.TelemetrySummary{
-		Countries: []callhome.CountrySummary{
-			{Country: "TestCountry", NoDeployments: 5},
-		},
-		Cities:           []string{"TestCity"},
-		Services:         []string{"TestService"},
-		Versions:         []string{"v1.0"},
-		TotalDeployments: 5,
+	repo := memory.New()
+	// Nine deployments run auth, four of them users too.
+	for i := 1; i <= 9; i++ {
+		hb := callhome.Telemetry{IpAddress: fmt.Sprintf("10.0.0.%d", i), Service: "auth", Version: "v1.0", ServiceTime: time.Now()}
+		switch {
+		case i <= 5:
+			hb.Country, hb.City = "TestCountry", "TestCity"
+		case i <= 7:
+			hb.Country = "OtherCountry"
+		default:
+			hb.Country = "AnotherCountry"
+		}
+		require.Nil(t, repo.Save(ctx, hb))
+		if i <= 4 {
+			hb.Service = "users"
+			require.Nil(t, repo.Save(ctx, hb))
+		}
 	}
 
 	t.Run("failed repo retrieve", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock all calls - background prefetch and test calls will return error
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(callhome.TelemetrySummary{}, timescale.ErrSaveEvent)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
-		svc := callhome.New(timescaleRepo, nil)
-		_, err := svc.RetrieveSummary(ctx, callhome.TelemetryFilters{})
-		assert.NotNil(t, err)
-		assert.Equal(t, timescale.ErrSaveEvent, err)
+		svc := callhome.New(errRepo{TelemetryRepo: memory.New(), err: errRepoFailed}, nil, nil)
+		_, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{}, callhome.TelemetryFilters{})
+		assert.Equal(t, errRepoFailed, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		svc := callhome.New(repo, nil, nil)
+		summary, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.TelemetrySummary{
+			Countries: []callhome.CountrySummary{
+				{Country: "TestCountry", NoDeployments: 5},
+				{Country: "AnotherCountry", NoDeployments: 2},
+				{Country: "OtherCountry", NoDeployments: 2},
+			},
+			Cities:           []string{"TestCity"},
+			Services:         []string{"auth", "users"},
+			Versions:         []string{"v1.0"},
+			CityCounts:       []callhome.ValueSummary{{Value: "TestCity", NoDeployments: 5}},
+			ServiceCounts:    []callhome.ValueSummary{{Value: "auth", NoDeployments: 9}, {Value: "users", NoDeployments: 4}},
+			VersionCounts:    []callhome.ValueSummary{{Value: "v1.0", NoDeployments: 9}},
+			Distinct:         callhome.DistinctValues{Countries: 3, Cities: 1, Services: 2, Versions: 1},
+			TotalDeployments: 9,
+		}, summary)
+	})
+
+	t.Run("top", func(t *testing.T) {
+		svc := callhome.New(repo, nil, nil)
+		summary, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{Top: 1}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.CountrySummary{{Country: "TestCountry", NoDeployments: 5}}, summary.Countries)
+		assert.Equal(t, []string{"auth"}, summary.Services)
+		assert.Equal(t, []callhome.ValueSummary{{Value: "auth", NoDeployments: 9}}, summary.ServiceCounts)
+		assert.Equal(t, callhome.DistinctValues{Countries: 3, Cities: 1, Services: 2, Versions: 1}, summary.Distinct)
+		assert.Equal(t, 9, summary.TotalDeployments)
+	})
+}
+
+func TestRetrievePolicies(t *testing.T) {
+	svc := callhome.New(memory.New(), nil, nil)
+	res, err := svc.RetrievePolicies(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, callhome.StoragePolicies{}, res, "the memory repo persists nothing")
+}
+
+func TestSaveAndRetrieve(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	locMock := mocks.NewLocationService(t)
+	locMock.On("GetLocation", mock.Anything, "10.0.0.1").Return(ip2location.IP2Locationrecord{
+		Latitude:     44.8,
+		Longitude:    20.4,
+		Country_long: "Serbia",
+		City:         "Belgrade",
+	}, nil)
+	locMock.On("GetLocation", mock.Anything, "10.0.0.2").Return(ip2location.IP2Locationrecord{
+		Country_long: "France",
+		City:         "Paris",
+	}, nil)
+	svc := callhome.New(memory.New(), locMock, nil)
+
+	heartbeats := []callhome.Telemetry{
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.14.0", ServiceTime: now},
+		{IpAddress: "10.0.0.1", Service: "things", Version: "0.14.0", ServiceTime: now},
+		{IpAddress: "10.0.0.2", Service: "users", Version: "0.13.0", ServiceTime: now.Add(-time.Hour)},
+	}
+	for _, hb := range heartbeats {
+		assert.Nil(t, svc.Save(ctx, hb))
+	}
+
+	page, err := svc.Retrieve(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), page.Total)
+	if assert.Len(t, page.Telemetry, 2) {
+		assert.NotEmpty(t, page.Telemetry[0].DeploymentID)
+		assert.NotEqual(t, page.Telemetry[0].DeploymentID, page.Telemetry[1].DeploymentID)
+		assert.Equal(t, "Serbia", page.Telemetry[0].Country)
+		assert.Equal(t, "Belgrade", page.Telemetry[0].City)
+		assert.InDelta(t, 44.8, page.Telemetry[0].Latitude, 1e-5)
+		assert.ElementsMatch(t, []string{"users", "things"}, []string(page.Telemetry[0].Services))
+		assert.False(t, page.Telemetry[0].LastSeen.IsZero())
+	}
+
+	summary, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{}, callhome.TelemetryFilters{Version: "0.13.0"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.TotalDeployments)
+	assert.Equal(t, []callhome.CountrySummary{{Country: "France", NoDeployments: 1}}, summary.Countries)
+}
+
+func TestRetrieveTimeSeries(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	repo := memory.New()
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: "users", Country: "Serbia", ServiceTime: now}))
+	}
+	svc := callhome.New(repo, nil, nil)
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := svc.RetrieveTimeSeries(ctx, callhome.TimeSeriesQuery{Interval: "fortnight"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+	t.Run("success", func(t *testing.T) {
+		q := callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: callhome.SplitByCountry}
+		ts, err := svc.RetrieveTimeSeries(ctx, q, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, q, ts.TimeSeriesQuery)
+		assert.Equal(t, []callhome.TimeSeriesBucket{
+			{Time: callhome.BucketStart(now, callhome.IntervalDay), Group: "Serbia", ActiveDeployments: 2},
+		}, ts.Buckets)
+	})
+	t.Run("cached", func(t *testing.T) {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.3", Service: "users", Country: "Serbia", ServiceTime: now}))
+		ts, err := svc.RetrieveTimeSeries(ctx, callhome.TimeSeriesQuery{Interval: callhome.IntervalDay, SplitBy: callhome.SplitByCountry}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, ts.Buckets[0].ActiveDeployments)
 	})
+}
+
+func TestRetrieveVersionAnalytics(t *testing.T) {
+	ctx := context.TODO()
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	repo := memory.New()
+	heartbeats := []struct {
+		ip      string
+		version string
+		at      time.Time
+	}{
+		// The whole fleet runs 1.0.0 on the first day.
+		{"10.0.0.1", "1.0.0", day},
+		{"10.0.0.2", "1.0.0", day},
+		{"10.0.0.3", "1.0.0", day},
+		{"10.0.0.4", "1.0.0", day},
+		// 1.1.0 appears the next day, and most of the fleet runs it the day after.
+		{"10.0.0.1", "1.1.0", day.Add(34 * time.Hour)},
+		{"10.0.0.2", "1.0.0", day.Add(34 * time.Hour)},
+		{"10.0.0.1", "1.1.0", day.Add(50 * time.Hour)},
+		{"10.0.0.2", "1.1.0", day.Add(50 * time.Hour)},
+		{"10.0.0.3", "1.1.0", day.Add(50 * time.Hour)},
+		{"10.0.0.4", "1.2.0-rc.1", day.Add(50 * time.Hour)},
+	}
+	for _, hb := range heartbeats {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: hb.ip, Service: "users", Version: hb.version, ServiceTime: hb.at}))
+	}
+	svc := callhome.New(repo, nil, nil)
+
+	va, err := svc.RetrieveVersionAnalytics(ctx, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, va.TotalDeployments)
+	assert.Equal(t, "1.1.0", va.Latest)
+	assert.Equal(t, 0.75, va.LatestShare)
+	assert.Equal(t, 38*time.Hour, va.MedianTimeToMajority)
 
+	versions := []string{}
+	for _, vs := range va.Versions {
+		versions = append(versions, vs.Version)
+	}
+	assert.Equal(t, []string{"1.2.0-rc.1", "1.1.0", "1.0.0"}, versions)
+	assert.Equal(t, 1, va.Versions[0].Deployments)
+	assert.Nil(t, va.Versions[0].TimeToMajority)
+	if assert.NotNil(t, va.Versions[1].TimeToMajority) {
+		assert.Equal(t, 38*time.Hour, *va.Versions[1].TimeToMajority)
+	}
+	assert.Equal(t, 0, va.Versions[2].Deployments)
+	assert.Nil(t, va.Versions[2].TimeToMajority, "release present since the first day")
+}
+
+func TestRetrieveNewVersions(t *testing.T) {
+	ctx := context.TODO()
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	repo := memory.New()
+	heartbeats := []struct {
+		ip      string
+		version string
+		at      time.Time
+	}{
+		{"10.0.0.1", "1.0.0", day},
+		{"10.0.0.2", "1.1.0", day.Add(26 * time.Hour)},
+		{"10.0.0.1", "1.2.0", day.Add(25 * time.Hour)},
+		{"10.0.0.1", "1.3.0", day.Add(48*time.Hour + 50*time.Minute)},
+	}
+	for _, hb := range heartbeats {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: hb.ip, Service: "users", Version: hb.version, ServiceTime: hb.at}))
+	}
+	svc := callhome.New(repo, nil, nil)
+
+	// 1.3.0 is reported after the range but before its rounded end, which
+	// deployments are counted at.
+	versions, err := svc.RetrieveNewVersions(ctx, callhome.TelemetryFilters{From: day.Add(time.Hour), To: day.Add(48*time.Hour + 45*time.Minute)})
+	assert.Nil(t, err)
+	assert.Equal(t, []callhome.VersionUsage{
+		{Version: "1.2.0", Deployments: 0, FirstSeen: day.Add(25 * time.Hour)},
+		{Version: "1.1.0", Deployments: 1, FirstSeen: day.Add(26 * time.Hour)},
+	}, versions)
+}
+
+func TestRetrieveVersionTransitions(t *testing.T) {
+	ctx := context.TODO()
+	week := time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC)
+	repo := memory.New()
+	heartbeats := []struct {
+		ip      string
+		version string
+		at      time.Time
+	}{
+		{"10.0.0.1", "0.13.0", week},
+		{"10.0.0.1", "0.15.0", week.AddDate(0, 0, 1)},
+		{"10.0.0.2", "0.13.0", week},
+		{"10.0.0.2", "0.15.0", week.AddDate(0, 0, 2)},
+		{"10.0.0.3", "0.14.0", week},
+		{"10.0.0.3", "0.15.0", week.AddDate(0, 0, 7)},
+		{"10.0.0.3", "0.14.0", week.AddDate(0, 0, 8)},
+	}
+	for _, hb := range heartbeats {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: hb.ip, Service: "users", Version: hb.version, ServiceTime: hb.at}))
+	}
+	// Another service of 10.0.0.1 makes the same transition a week later.
+	assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "things", Version: "0.13.0", ServiceTime: week}))
+	assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "things", Version: "0.15.0", ServiceTime: week.AddDate(0, 0, 7)}))
+	svc := callhome.New(repo, nil, nil)
+
+	t.Run("invalid interval", func(t *testing.T) {
+		_, err := svc.RetrieveVersionTransitions(ctx, "fortnight", callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
 	t.Run("success", func(t *testing.T) {
-		timescaleRepo := repoMocks.NewTelemetryRepo(t)
-		// Mock all calls - background prefetch and test calls will return mockSummary
-		timescaleRepo.On("RetrieveSummary", mock.Anything, mock.Anything).Return(mockSummary, nil)
-		timescaleRepo.On("RetrieveAll", mock.Anything, mock.Anything, mock.Anything).Return(callhome.TelemetryPage{}, nil)
-		svc := callhome.New(timescaleRepo, nil)
-		summary, err := svc.RetrieveSummary(ctx, callhome.TelemetryFilters{})
-		assert.Nil(t, err)
-		assert.Equal(t, mockSummary, summary)
+		vt, err := svc.RetrieveVersionTransitions(ctx, callhome.IntervalWeek, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.IntervalWeek, vt.Interval)
+		assert.Equal(t, []callhome.TransitionCount{
+			{From: "0.13.0", To: "0.15.0", Deployments: 2},
+			{From: "0.14.0", To: "0.15.0", Deployments: 1},
+			{From: "0.15.0", To: "0.14.0", Deployments: 1},
+		}, vt.Matrix)
+		assert.Equal(t, []callhome.UpgradeBucket{
+			{Time: week, Upgrades: 2},
+			{Time: week.AddDate(0, 0, 7), Upgrades: 2, Downgrades: 1},
+		}, vt.Periods)
+	})
+}
+
+func TestRetrieveRetention(t *testing.T) {
+	ctx := context.TODO()
+	// Weeks starting on Monday.
+	w := func(n int) time.Time { return time.Date(2024, time.January, 1+7*n, 0, 0, 0, 0, time.UTC) }
+	repo := memory.New()
+	active := map[string][]int{
+		"10.0.0.1": {0, 1, 2, 3, 4, 5},
+		"10.0.0.2": {0, 4},
+		"10.0.0.3": {2, 3},
+	}
+	for ip, weeks := range active {
+		for _, n := range weeks {
+			assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: "users", ServiceTime: w(n).Add(58 * time.Hour)}))
+		}
+	}
+	svc := callhome.New(repo, nil, nil)
+	filters := callhome.TelemetryFilters{To: w(5).Add(72 * time.Hour)}
+
+	t.Run("invalid interval", func(t *testing.T) {
+		_, err := svc.RetrieveRetention(ctx, callhome.RetentionQuery{Interval: callhome.IntervalDay}, filters)
+		assert.ErrorIs(t, err, callhome.ErrInvalidRetentionQuery)
+	})
+	t.Run("inactivity window shorter than a period", func(t *testing.T) {
+		_, err := svc.RetrieveRetention(ctx, callhome.RetentionQuery{Interval: callhome.IntervalWeek, InactivityWindow: 24 * time.Hour}, filters)
+		assert.ErrorIs(t, err, callhome.ErrInvalidRetentionQuery)
+	})
+	t.Run("weekly", func(t *testing.T) {
+		r, err := svc.RetrieveRetention(ctx, callhome.RetentionQuery{Interval: callhome.IntervalWeek}, filters)
+		assert.Nil(t, err)
+		assert.Equal(t, 14*24*time.Hour, r.InactivityWindow)
+		assert.Equal(t, []callhome.ActivityPeriod{
+			{Time: w(0), New: 2},
+			{Time: w(1), Active: 1},
+			{Time: w(2), New: 1, Active: 1},
+			{Time: w(3), Active: 2, Churned: 1},
+			{Time: w(4), Active: 1, Returning: 1},
+			{Time: w(5), Active: 1},
+		}, r.Periods)
+		assert.Equal(t, []callhome.Cohort{
+			{Start: w(0), Size: 2, Retained: []int{2, 1, 1, 1, 2, 1}},
+			{Start: w(2), Size: 1, Retained: []int{1, 1, 0, 0}},
+		}, r.Cohorts)
+	})
+	t.Run("new before the range", func(t *testing.T) {
+		f := filters
+		f.From = w(1)
+		r, err := svc.RetrieveRetention(ctx, callhome.RetentionQuery{Interval: callhome.IntervalWeek, InactivityWindow: 21 * 24 * time.Hour}, f)
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.ActivityPeriod{
+			{Time: w(1), Active: 1},
+			{Time: w(2), New: 1, Active: 1},
+			{Time: w(3), Active: 2},
+			{Time: w(4), Active: 1, Returning: 1},
+			{Time: w(5), Active: 1},
+		}, r.Periods)
+		assert.Equal(t, []callhome.Cohort{{Start: w(2), Size: 1, Retained: []int{1, 1, 0, 0}}}, r.Cohorts)
+	})
+	t.Run("long history", func(t *testing.T) {
+		repo := memory.New()
+		active := map[string][]int{
+			"10.0.1.1": {0, 20},
+			"10.0.1.2": {0},
+			"10.0.1.3": {16, 19},
+			"10.0.1.4": {19},
+		}
+		for ip, weeks := range active {
+			for _, n := range weeks {
+				assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: "users", ServiceTime: w(n).Add(58 * time.Hour)}))
+			}
+		}
+		f := callhome.TelemetryFilters{From: w(18), To: w(21).Add(72 * time.Hour)}
+		r, err := callhome.New(repo, nil, nil).RetrieveRetention(ctx, callhome.RetentionQuery{Interval: callhome.IntervalWeek}, f)
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.ActivityPeriod{
+			{Time: w(18)},
+			{Time: w(19), New: 1, Returning: 1},
+			{Time: w(20), Returning: 1},
+			{Time: w(21)},
+		}, r.Periods)
+		assert.Equal(t, []callhome.Cohort{{Start: w(19), Size: 1, Retained: []int{1, 0, 0}}}, r.Cohorts)
+	})
+}
+
+func TestServeUI(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	repo := memory.New()
+	assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", Country: "Serbia", ServiceTime: now}))
+	svc := callhome.New(repo, nil, nil)
+
+	page, err := svc.ServeUI(ctx, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Contains(t, string(page), `id="activity-table"`)
+	assert.Contains(t, string(page), `id="cohort-table"`)
+	assert.NotContains(t, string(page), `class="growth`)
+	assert.Contains(t, string(page), `window.COUNTRY_DATA = [{"country":"Serbia","number_of_deployments":1}];`)
+
+	assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", Country: "Serbia", ServiceTime: now.AddDate(0, 0, -10)}))
+	assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.2", Service: "users", Country: "France", ServiceTime: now.Add(-time.Hour)}))
+	page, err = svc.ServeUI(ctx, callhome.TelemetryFilters{From: now.AddDate(0, 0, -7), To: now})
+	assert.Nil(t, err)
+	assert.Contains(t, string(page), `<span class="growth growth-up" title="Compared with the previous period">+100%</span>`)
+
+	page, err = svc.ServeUI(ctx, callhome.TelemetryFilters{Country: " Serbia "})
+	assert.Nil(t, err)
+	assert.Contains(t, string(page), `<option value="Serbia" selected>`)
+	page, err = svc.ServeUI(ctx, callhome.TelemetryFilters{Country: "Serbia,France"})
+	assert.Nil(t, err)
+	assert.NotContains(t, string(page), `selected>`)
+}
+
+func TestRetrieveSummaryComparison(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Hour)
+	repo := memory.New()
+	heartbeats := []callhome.Telemetry{
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.13.0", Country: "Serbia", ServiceTime: now.Add(-36 * time.Hour)},
+		{IpAddress: "10.0.0.2", Service: "users", Version: "0.13.0", Country: "Serbia", ServiceTime: now.Add(-30 * time.Hour)},
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.14.0", Country: "Serbia", ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.3", Service: "users", Version: "0.14.0", Country: "France", ServiceTime: now.Add(-time.Hour)},
+		{IpAddress: "10.0.0.4", Service: "users", Version: "0.14.0", Country: "France", ServiceTime: now.Add(-time.Hour)},
+	}
+	for _, hb := range heartbeats {
+		assert.Nil(t, repo.Save(ctx, hb))
+	}
+	svc := callhome.New(repo, nil, nil)
+	filters := callhome.TelemetryFilters{From: now.Add(-24 * time.Hour), To: now}
+	pct := func(p float64) *float64 { return &p }
+
+	t.Run("invalid baseline", func(t *testing.T) {
+		_, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{Compare: "last_year"}, filters)
+		assert.ErrorIs(t, err, callhome.ErrInvalidComparison)
+		_, err = svc.RetrieveSummary(ctx, callhome.SummaryQuery{Compare: callhome.CompareCustom}, filters)
+		assert.ErrorIs(t, err, callhome.ErrInvalidComparison)
+		_, err = svc.RetrieveSummary(ctx, callhome.SummaryQuery{Compare: callhome.ComparePrevious}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidComparison)
+	})
+	t.Run("no comparison", func(t *testing.T) {
+		summary, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{}, filters)
+		assert.Nil(t, err)
+		assert.Nil(t, summary.Comparison)
+	})
+	t.Run("previous period", func(t *testing.T) {
+		summary, err := svc.RetrieveSummary(ctx, callhome.SummaryQuery{Compare: callhome.ComparePrevious}, filters)
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.CountrySummary{{Country: "France", NoDeployments: 2}, {Country: "Serbia", NoDeployments: 1}}, summary.Countries)
+		assert.Equal(t, &callhome.SummaryComparison{
+			From:             now.Add(-48 * time.Hour),
+			To:               now.Add(-24 * time.Hour),
+			TotalDeployments: callhome.Change{Baseline: 2, Delta: 1, Percent: pct(50)},
+			Countries:        callhome.Change{Baseline: 1, Delta: 1, Percent: pct(100)},
+			CountryChanges:   []callhome.Change{{Baseline: 0, Delta: 2}, {Baseline: 2, Delta: -1, Percent: pct(-50)}},
+			ServiceChanges:   []callhome.Change{{Baseline: 2, Delta: 1, Percent: pct(50)}},
+			VersionChanges:   []callhome.Change{{Baseline: 0, Delta: 3}},
+		}, summary.Comparison)
+	})
+	t.Run("custom baseline", func(t *testing.T) {
+		q := callhome.SummaryQuery{Compare: callhome.CompareCustom, BaselineFrom: now.Add(-31 * time.Hour), BaselineTo: now.Add(-29 * time.Hour)}
+		summary, err := svc.RetrieveSummary(ctx, q, filters)
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.Change{Baseline: 1, Delta: 2, Percent: pct(200)}, summary.Comparison.TotalDeployments)
+		assert.Equal(t, []callhome.Change{{Baseline: 0, Delta: 3}}, summary.Comparison.VersionChanges)
+	})
+}
+
+func TestRetrieveDeployment(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Minute)
+	start := now.Add(-24 * time.Hour)
+	repo := memory.New()
+	// Half-hourly heartbeats for 18 hours, with a 4 hour gap after the first 4 hours.
+	for k := 0; k <= 36; k++ {
+		if k > 8 && k < 16 {
+			continue
+		}
+		version := "0.13.0"
+		if k > 20 {
+			version = "0.14.0"
+		}
+		at := start.Add(time.Duration(k) * callhome.HeartbeatInterval)
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", Version: version, Country: "Serbia", ServiceTime: at}))
+	}
+	svc := callhome.New(repo, nil, nil)
+	id := deploymentIDs(t, repo)["10.0.0.1"]
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := svc.RetrieveDeployment(ctx, "unknown", callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrDeploymentNotFound)
+	})
+	t.Run("success", func(t *testing.T) {
+		d, err := svc.RetrieveDeployment(ctx, id, callhome.TelemetryFilters{From: start.Add(-24 * time.Hour)})
+		assert.Nil(t, err)
+		assert.Equal(t, id, d.ID)
+		assert.Equal(t, "0.14.0", d.Latest.Version)
+		assert.Equal(t, []string{"users"}, []string(d.Latest.Services))
+		assert.Len(t, d.Versions, 2)
+		// The range starts when the deployment first reported.
+		assert.Equal(t, start, d.From)
+		assert.Equal(t, 30, d.Heartbeats)
+		if assert.Len(t, d.Gaps, 2) {
+			assert.Equal(t, callhome.HeartbeatGap{Start: start.Add(4 * time.Hour), End: start.Add(8 * time.Hour)}, d.Gaps[0])
+			assert.Equal(t, start.Add(18*time.Hour), d.Gaps[1].Start)
+			assert.Equal(t, d.To, d.Gaps[1].End)
+		}
+		// Both gaps count as down apart from a single heartbeat interval.
+		assert.InDelta(t, 1-9.0/24, d.Uptime, 0.001)
+	})
+	t.Run("no heartbeats in range", func(t *testing.T) {
+		d, err := svc.RetrieveDeployment(ctx, id, callhome.TelemetryFilters{From: now.Add(-time.Hour)})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, d.Heartbeats)
+		assert.Equal(t, []callhome.HeartbeatGap{{Start: d.From, End: d.To}}, d.Gaps)
+		assert.Equal(t, 0.0, d.Uptime)
+	})
+}
+
+func TestRetrieveServiceComposition(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	repo := memory.New()
+	deployments := map[string][]string{
+		"10.0.0.1": {"users", "things", "bootstrap"},
+		"10.0.0.2": {"users", "things"},
+		"10.0.0.3": {"users", "things"},
+		"10.0.0.4": {"users"},
+	}
+	for ip, services := range deployments {
+		for _, s := range services {
+			assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: s, ServiceTime: now}))
+		}
+	}
+	svc := callhome.New(repo, nil, nil)
+
+	sc, err := svc.RetrieveServiceComposition(ctx, 2, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, sc.TotalDeployments)
+	assert.Equal(t, []callhome.ServiceUsage{
+		{Service: "users", Deployments: 4},
+		{Service: "things", Deployments: 3},
+		{Service: "bootstrap", Deployments: 1},
+	}, sc.Services)
+	assert.Equal(t, [][]int{
+		{4, 3, 1},
+		{3, 3, 1},
+		{1, 1, 1},
+	}, sc.CoOccurrence)
+	assert.Equal(t, []callhome.ServiceSet{
+		{Services: []string{"things", "users"}, Deployments: 2},
+		{Services: []string{"bootstrap", "things", "users"}, Deployments: 1},
+	}, sc.Profiles)
+}
+
+func TestRetrieveAggregate(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	repo := memory.New()
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: "users", Country: "Serbia", ServiceTime: now}))
+	}
+	svc := callhome.New(repo, nil, nil)
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := svc.RetrieveAggregate(ctx, callhome.AggregateQuery{GroupBy: []string{"mac_address"}}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidAggregateQuery)
+	})
+	t.Run("success", func(t *testing.T) {
+		a, err := svc.RetrieveAggregate(ctx, callhome.AggregateQuery{GroupBy: []string{callhome.GroupByCountry}}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.AggregateQuery{
+			GroupBy: []string{callhome.GroupByCountry},
+			Metrics: []string{callhome.MetricDeployments},
+			Order:   "-" + callhome.MetricDeployments,
+			Top:     callhome.MaxAggregateTop,
+		}, a.AggregateQuery)
+		assert.Equal(t, []callhome.AggregateRow{{Groups: []string{"Serbia"}, Metrics: []int{2}}}, a.Rows)
+	})
+	t.Run("cached", func(t *testing.T) {
+		assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.3", Service: "users", Country: "Serbia", ServiceTime: now}))
+		a, err := svc.RetrieveAggregate(ctx, callhome.AggregateQuery{GroupBy: []string{callhome.GroupByCountry}}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, a.Rows[0].Metrics[0])
+	})
+}
+
+func TestRetrieveSilentDeployments(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Minute)
+	repo := memory.New()
+	beats := func(ip, version, country string, last time.Time, every time.Duration, n int) {
+		for k := 0; k < n; k++ {
+			at := last.Add(-time.Duration(k) * every)
+			assert.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: ip, Service: "users", Version: version, Country: country, ServiceTime: at}))
+		}
+	}
+	// Reporting half-hourly.
+	beats("10.0.0.1", "0.14.0", "Serbia", now.Add(-10*time.Minute), callhome.HeartbeatInterval, 48)
+	// Silent for three hours.
+	beats("10.0.0.2", "0.14.0", "Serbia", now.Add(-3*time.Hour), callhome.HeartbeatInterval, 48)
+	// Reporting every six hours, so three hours is not silent.
+	beats("10.0.0.3", "0.13.0", "France", now.Add(-3*time.Hour), 6*time.Hour, 8)
+	// Silent for a day.
+	beats("10.0.0.4", "0.13.0", "France", now.Add(-24*time.Hour), callhome.HeartbeatInterval, 48)
+	// Silent for longer than the lookback.
+	beats("10.0.0.5", "0.14.0", "Serbia", now.AddDate(0, 0, -10), callhome.HeartbeatInterval, 48)
+	svc := callhome.New(repo, nil, nil)
+	ids := deploymentIDs(t, repo)
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := svc.RetrieveSilentDeployments(ctx, callhome.SilentQuery{Threshold: 48 * time.Hour, Lookback: 24 * time.Hour}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidSilentQuery)
+	})
+	t.Run("defaults", func(t *testing.T) {
+		sd, err := svc.RetrieveSilentDeployments(ctx, callhome.SilentQuery{}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.SilentQuery{Threshold: callhome.DefaultSilenceThreshold, Lookback: callhome.DefaultSilentLookback}, sd.SilentQuery)
+		if assert.Len(t, sd.Deployments, 2) {
+			assert.Equal(t, ids["10.0.0.2"], sd.Deployments[0].ID)
+			assert.Equal(t, callhome.HeartbeatInterval, sd.Deployments[0].Cadence)
+			assert.Equal(t, now.Add(-3*time.Hour), sd.Deployments[0].LastSeen)
+			assert.Equal(t, ids["10.0.0.4"], sd.Deployments[1].ID)
+			assert.GreaterOrEqual(t, sd.Deployments[1].Silence, 24*time.Hour)
+		}
+		assert.Equal(t, []callhome.SilentGroup{
+			{Version: "0.13.0", Country: "France", Deployments: 1},
+			{Version: "0.14.0", Country: "Serbia", Deployments: 1},
+		}, sd.Groups)
+	})
+	t.Run("threshold", func(t *testing.T) {
+		sd, err := svc.RetrieveSilentDeployments(ctx, callhome.SilentQuery{Threshold: 12 * time.Hour}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.SilentGroup{{Version: "0.13.0", Country: "France", Deployments: 1}}, sd.Groups)
+	})
+	t.Run("lookback", func(t *testing.T) {
+		sd, err := svc.RetrieveSilentDeployments(ctx, callhome.SilentQuery{Lookback: 30 * 24 * time.Hour}, callhome.TelemetryFilters{Version: "0.14.0"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.SilentGroup{{Version: "0.14.0", Country: "Serbia", Deployments: 2}}, sd.Groups)
 	})
 }
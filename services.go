@@ -0,0 +1,83 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"sort"
+	"strings"
+)
+
+// ServiceSet is the number of deployments running exactly the given services.
+type ServiceSet struct {
+	// Services are in ascending order.
+	Services    []string `json:"services"`
+	Deployments int      `json:"deployments"`
+}
+
+// ServiceUsage is the number of deployments running a service.
+type ServiceUsage struct {
+	Service     string `json:"service"`
+	Deployments int    `json:"deployments"`
+}
+
+// ServiceComposition describes which services are deployed together.
+type ServiceComposition struct {
+	TotalDeployments int
+	// Services are ordered from the most deployed.
+	Services []ServiceUsage
+	// CoOccurrence counts the deployments running both of two services, in the
+	// order of Services. The diagonal is the number of deployments running
+	// each service.
+	CoOccurrence [][]int
+	// Profiles are the most common service sets, most common first.
+	Profiles []ServiceSet
+}
+
+// analyzeServices builds the co-occurrence matrix from the service sets, and
+// keeps the given number of the most common sets as profiles.
+func analyzeServices(sets []ServiceSet, profiles int) ServiceComposition {
+	var sc ServiceComposition
+	usage := make(map[string]int)
+	for _, s := range sets {
+		sc.TotalDeployments += s.Deployments
+		for _, svc := range s.Services {
+			usage[svc] += s.Deployments
+		}
+	}
+	for svc, n := range usage {
+		sc.Services = append(sc.Services, ServiceUsage{Service: svc, Deployments: n})
+	}
+	sort.Slice(sc.Services, func(i, j int) bool {
+		if sc.Services[i].Deployments != sc.Services[j].Deployments {
+			return sc.Services[i].Deployments > sc.Services[j].Deployments
+		}
+		return sc.Services[i].Service < sc.Services[j].Service
+	})
+
+	index := make(map[string]int, len(sc.Services))
+	sc.CoOccurrence = make([][]int, len(sc.Services))
+	for i, u := range sc.Services {
+		index[u.Service] = i
+		sc.CoOccurrence[i] = make([]int, len(sc.Services))
+	}
+	for _, s := range sets {
+		for _, a := range s.Services {
+			for _, b := range s.Services {
+				sc.CoOccurrence[index[a]][index[b]] += s.Deployments
+			}
+		}
+	}
+
+	sc.Profiles = append([]ServiceSet(nil), sets...)
+	sort.SliceStable(sc.Profiles, func(i, j int) bool {
+		if sc.Profiles[i].Deployments != sc.Profiles[j].Deployments {
+			return sc.Profiles[i].Deployments > sc.Profiles[j].Deployments
+		}
+		return strings.Join(sc.Profiles[i].Services, ",") < strings.Join(sc.Profiles[j].Services, ",")
+	})
+	if len(sc.Profiles) > profiles {
+		sc.Profiles = sc.Profiles[:profiles]
+	}
+	return sc
+}
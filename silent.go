@@ -0,0 +1,174 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	// silentCadences is the number of heartbeats a silent deployment missed at least.
+	silentCadences = 3
+	// DefaultSilenceThreshold is the default minimum silence of a silent deployment.
+	DefaultSilenceThreshold = 2 * time.Hour
+	// DefaultSilentLookback is how long ago silent deployments last reported at most, by default.
+	DefaultSilentLookback = 7 * 24 * time.Hour
+	// MaxSilentLookback is the longest supported lookback.
+	MaxSilentLookback = 90 * 24 * time.Hour
+)
+
+// ErrInvalidSilentQuery indicates an invalid threshold or lookback.
+var ErrInvalidSilentQuery = errors.New("invalid silent deployments query")
+
+// DeploymentSeen is when a deployment reported in a time range.
+type DeploymentSeen struct {
+	// ID is the public deployment identifier, see Telemetry.DeploymentID.
+	ID        string
+	IpAddress string
+	// Country, City and Version are those of the latest heartbeat.
+	Country   string
+	City      string
+	Version   string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Heartbeats is the number of distinct heartbeat times.
+	Heartbeats int
+}
+
+// Cadence estimates the heartbeat interval of the deployment as the mean
+// interval between its heartbeats, or HeartbeatInterval if it reported once.
+func (d DeploymentSeen) Cadence() time.Duration {
+	return cadence(d.FirstSeen, d.LastSeen, d.Heartbeats)
+}
+
+// ClientSeen is when a single client, one service of a deployment reporting
+// from one MAC address, reported in a time range. The services of a deployment
+// report independently, so together they report more often than any of them.
+type ClientSeen struct {
+	// DeploymentID is the public identifier of the deployment of the client.
+	DeploymentID string
+	MacAddress   string
+	Service      string
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	// Heartbeats is the number of distinct heartbeat times.
+	Heartbeats int
+}
+
+// Cadence estimates the heartbeat interval of the client as the mean
+// interval between its heartbeats, or HeartbeatInterval if it reported once.
+func (c ClientSeen) Cadence() time.Duration {
+	return cadence(c.FirstSeen, c.LastSeen, c.Heartbeats)
+}
+
+func cadence(first, last time.Time, heartbeats int) time.Duration {
+	if heartbeats < 2 {
+		return HeartbeatInterval
+	}
+	return (last.Sub(first) / time.Duration(heartbeats-1)).Round(time.Second)
+}
+
+// SilentQuery specifies which deployments are silent.
+type SilentQuery struct {
+	// Threshold is the minimum silence of a silent deployment, which must
+	// also have missed several heartbeats at its cadence.
+	Threshold time.Duration
+	// Lookback is how long ago silent deployments last reported at most.
+	Lookback time.Duration
+}
+
+// Validate checks the threshold is shorter than the lookback.
+func (q SilentQuery) Validate() error {
+	if q.Threshold < 0 || q.Lookback < 0 || q.Lookback > MaxSilentLookback {
+		return ErrInvalidSilentQuery
+	}
+	q = q.WithDefaults()
+	if q.Threshold >= q.Lookback {
+		return ErrInvalidSilentQuery
+	}
+	return nil
+}
+
+// WithDefaults sets the default threshold and lookback.
+func (q SilentQuery) WithDefaults() SilentQuery {
+	if q.Threshold == 0 {
+		q.Threshold = DefaultSilenceThreshold
+	}
+	if q.Lookback == 0 {
+		q.Lookback = DefaultSilentLookback
+	}
+	return q
+}
+
+// SilentDeployment is a deployment that stopped reporting.
+type SilentDeployment struct {
+	// ID is the public deployment identifier, see Telemetry.DeploymentID.
+	ID       string
+	Country  string
+	City     string
+	Version  string
+	LastSeen time.Time
+	Cadence  time.Duration
+	Silence  time.Duration
+}
+
+// SilentGroup is the number of silent deployments of a version in a country.
+type SilentGroup struct {
+	Version     string `json:"version"`
+	Country     string `json:"country"`
+	Deployments int    `json:"deployments"`
+}
+
+// SilentDeployments lists the deployments that recently went silent.
+type SilentDeployments struct {
+	SilentQuery
+	// Deployments are ordered from the most recently seen.
+	Deployments []SilentDeployment
+	// Groups are ordered from the most deployments, then by version and country.
+	Groups []SilentGroup
+}
+
+// findSilent selects the deployments silent at the given time for longer than
+// both the threshold and silentCadences heartbeats at their cadence.
+func findSilent(seen []DeploymentSeen, q SilentQuery, now time.Time) SilentDeployments {
+	sd := SilentDeployments{SilentQuery: q}
+	groups := make(map[SilentGroup]int)
+	for _, d := range seen {
+		cadence := d.Cadence()
+		silence := now.Sub(d.LastSeen)
+		if silence <= q.Threshold || silence <= silentCadences*cadence {
+			continue
+		}
+		sd.Deployments = append(sd.Deployments, SilentDeployment{
+			ID:       d.ID,
+			Country:  d.Country,
+			City:     d.City,
+			Version:  d.Version,
+			LastSeen: d.LastSeen,
+			Cadence:  cadence,
+			Silence:  silence,
+		})
+		groups[SilentGroup{Version: d.Version, Country: d.Country}]++
+	}
+	sort.SliceStable(sd.Deployments, func(i, j int) bool {
+		return sd.Deployments[i].LastSeen.After(sd.Deployments[j].LastSeen)
+	})
+	for g, n := range groups {
+		g.Deployments = n
+		sd.Groups = append(sd.Groups, g)
+	}
+	sort.Slice(sd.Groups, func(i, j int) bool {
+		a, b := sd.Groups[i], sd.Groups[j]
+		if a.Deployments != b.Deployments {
+			return a.Deployments > b.Deployments
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Country < b.Country
+	})
+	return sd
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCadence(t *testing.T) {
+	first := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc    string
+		seen    callhome.DeploymentSeen
+		cadence time.Duration
+	}{
+		{"single heartbeat", callhome.DeploymentSeen{FirstSeen: first, LastSeen: first, Heartbeats: 1}, callhome.HeartbeatInterval},
+		{"half-hourly", callhome.DeploymentSeen{FirstSeen: first, LastSeen: first.Add(24 * time.Hour), Heartbeats: 49}, 30 * time.Minute},
+		{"hourly", callhome.DeploymentSeen{FirstSeen: first, LastSeen: first.Add(24 * time.Hour), Heartbeats: 25}, time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.cadence, tc.seen.Cadence())
+		})
+	}
+}
+
+func TestSilentQueryValidate(t *testing.T) {
+	cases := []struct {
+		desc  string
+		query callhome.SilentQuery
+		err   error
+	}{
+		{"defaults", callhome.SilentQuery{}, nil},
+		{"custom", callhome.SilentQuery{Threshold: 6 * time.Hour, Lookback: 24 * time.Hour}, nil},
+		{"negative threshold", callhome.SilentQuery{Threshold: -time.Hour}, callhome.ErrInvalidSilentQuery},
+		{"lookback too long", callhome.SilentQuery{Lookback: callhome.MaxSilentLookback + time.Hour}, callhome.ErrInvalidSilentQuery},
+		{"threshold beyond lookback", callhome.SilentQuery{Threshold: 2 * time.Hour, Lookback: time.Hour}, callhome.ErrInvalidSilentQuery},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.err, tc.query.Validate())
+		})
+	}
+}
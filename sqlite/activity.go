@@ -0,0 +1,51 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/absmach/callhome"
+)
+
+// RetrieveActivity gets the time buckets each deployment reported in.
+func (r repo) RetrieveActivity(ctx context.Context, interval string, filters callhome.TelemetryFilters) ([]callhome.ActivityBucket, error) {
+	start, ok := bucketStarts[interval]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	filterQuery, params := generateQuery(filters)
+
+	// Bucket start is taken from the map, never from the input.
+	q := fmt.Sprintf(`
+		SELECT DISTINCT ip_address, %s AS bucket
+		FROM telemetry
+		%s
+		ORDER BY ip_address, bucket;
+	`, start, filterQuery)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []callhome.ActivityBucket
+	for rows.Next() {
+		var res struct {
+			IpAddress string `db:"ip_address"`
+			Bucket    string `db:"bucket"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		t, err := parseTime(res.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, callhome.ActivityBucket{Time: t, IpAddress: res.IpAddress})
+	}
+	return activity, rows.Err()
+}
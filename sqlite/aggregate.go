@@ -0,0 +1,125 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+// aggregateGroups maps aggregate groupings to telemetry expressions.
+var aggregateGroups = map[string]string{
+	callhome.GroupByCountry: "COALESCE(country, '')",
+	callhome.GroupByCity:    "COALESCE(city, '')",
+	callhome.GroupByRegion:  "COALESCE(region, '')",
+	callhome.GroupByService: "service",
+	callhome.GroupByVersion: "COALESCE(mg_version, '')",
+	callhome.GroupByWeek:    bucketStarts[callhome.IntervalWeek],
+}
+
+// aggregateMetrics maps aggregate metrics to aggregate functions.
+var aggregateMetrics = map[string]string{
+	callhome.MetricDeployments: "COUNT(DISTINCT ip_address)",
+	callhome.MetricHeartbeats:  "COUNT(*)",
+}
+
+// RetrieveAggregate groups heartbeats and measures each group.
+func (r repo) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) ([]callhome.AggregateRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	q = q.WithDefaults()
+	filterQuery, params := generateQuery(filters)
+
+	// Expressions are taken from the maps, never from the input.
+	var selects, groups, fields []string
+	for i, g := range q.GroupBy {
+		selects = append(selects, fmt.Sprintf("%s AS g%d", aggregateGroups[g], i))
+		groups = append(groups, fmt.Sprintf("g%d", i))
+	}
+	for i, m := range q.Metrics {
+		selects = append(selects, fmt.Sprintf("%s AS m%d", aggregateMetrics[m], i))
+		fields = append(fields, fmt.Sprintf("m%d", i))
+	}
+	order := aggregateOrder(q, groups, fields)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM telemetry
+		%s
+		GROUP BY %s
+		ORDER BY %s
+		LIMIT :top;
+	`, strings.Join(selects, ", "), filterQuery, strings.Join(groups, ", "), order)
+	params["top"] = q.Top
+
+	rows, err := r.db.NamedQueryContext(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []callhome.AggregateRow
+	for rows.Next() {
+		row := callhome.AggregateRow{
+			Groups:  make([]string, len(q.GroupBy)),
+			Metrics: make([]int, len(q.Metrics)),
+		}
+		dest := make([]interface{}, 0, len(selects))
+		for i := range row.Groups {
+			dest = append(dest, &row.Groups[i])
+		}
+		for i := range row.Metrics {
+			dest = append(dest, &row.Metrics[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, g := range q.GroupBy {
+			if g != callhome.GroupByWeek {
+				continue
+			}
+			t, err := parseTime(row.Groups[i])
+			if err != nil {
+				return nil, err
+			}
+			row.Groups[i] = t.Format(time.RFC3339)
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
+
+// CountHeartbeats counts the heartbeats matching the filters.
+func (r repo) CountHeartbeats(ctx context.Context, filters callhome.TelemetryFilters) (int, error) {
+	filterQuery, params := generateQuery(filters)
+	count, err := r.count(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM telemetry %s;`, filterQuery), params)
+	return int(count), err
+}
+
+// aggregateOrder orders rows by the grouping or metric of the query, and then
+// by the groups.
+func aggregateOrder(q callhome.AggregateQuery, groups, fields []string) string {
+	by, desc := q.OrderBy()
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	order := []string{}
+	for i, g := range q.GroupBy {
+		if g == by {
+			order = append(order, fmt.Sprintf("%s %s", groups[i], dir))
+		}
+	}
+	for i, m := range q.Metrics {
+		if m == by {
+			order = append(order, fmt.Sprintf("%s %s", fields[i], dir))
+		}
+	}
+	return strings.Join(append(order, groups...), ", ")
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+)
+
+// RetrieveDeployment gets the identity, location, services and version history of a deployment.
+func (r repo) RetrieveDeployment(ctx context.Context, id string) (callhome.Deployment, error) {
+	params := map[string]interface{}{"id": id}
+
+	q := `
+		SELECT t.ip_address, t.time, t.service_time, t.longitude, t.latitude, t.mg_version, t.country, t.city,
+			(SELECT group_concat(DISTINCT NULLIF(service, '')) FROM telemetry WHERE ip_address = t.ip_address) AS services,
+			(SELECT MIN(time) FROM telemetry WHERE ip_address = t.ip_address) AS first_seen
+		FROM telemetry t
+		WHERE t.ip_address = (SELECT ip_address FROM deployments WHERE id = :id)
+		ORDER BY t.time DESC
+		LIMIT 1;
+	`
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return callhome.Deployment{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return callhome.Deployment{}, err
+		}
+		return callhome.Deployment{}, callhome.ErrDeploymentNotFound
+	}
+	var latest struct {
+		dbTelemetry
+		FirstSeen string `db:"first_seen"`
+	}
+	if err := rows.StructScan(&latest); err != nil {
+		return callhome.Deployment{}, err
+	}
+	d := callhome.Deployment{ID: id}
+	if d.Latest, err = latest.toTelemetry(); err != nil {
+		return callhome.Deployment{}, err
+	}
+	if d.FirstSeen, err = parseTime(latest.FirstSeen); err != nil {
+		return callhome.Deployment{}, err
+	}
+
+	q = `
+		SELECT mg_version, MIN(time) AS first_seen, MAX(time) AS last_seen
+		FROM telemetry
+		WHERE ip_address = (SELECT ip_address FROM deployments WHERE id = :id) AND mg_version <> ''
+		GROUP BY mg_version
+		ORDER BY first_seen;
+	`
+	vrows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return callhome.Deployment{}, err
+	}
+	defer vrows.Close()
+
+	for vrows.Next() {
+		var res struct {
+			Version   string `db:"mg_version"`
+			FirstSeen string `db:"first_seen"`
+			LastSeen  string `db:"last_seen"`
+		}
+		if err := vrows.StructScan(&res); err != nil {
+			return callhome.Deployment{}, err
+		}
+		v := callhome.VersionPeriod{Version: res.Version}
+		if v.FirstSeen, err = parseTime(res.FirstSeen); err != nil {
+			return callhome.Deployment{}, err
+		}
+		if v.LastSeen, err = parseTime(res.LastSeen); err != nil {
+			return callhome.Deployment{}, err
+		}
+		d.Versions = append(d.Versions, v)
+	}
+	return d, vrows.Err()
+}
+
+// RetrieveHeartbeats gets the distinct times a deployment reported at.
+func (r repo) RetrieveHeartbeats(ctx context.Context, id string, filters callhome.TelemetryFilters) ([]time.Time, error) {
+	filterQuery, params := generateQuery(filters)
+	params["id"] = id
+	filterQuery = andWhere(filterQuery, "ip_address = (SELECT ip_address FROM deployments WHERE id = :id)")
+
+	q := fmt.Sprintf(`SELECT DISTINCT time FROM telemetry %s ORDER BY time;`, filterQuery)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var beats []time.Time
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, err
+		}
+		beats = append(beats, t)
+	}
+	return beats, rows.Err()
+}
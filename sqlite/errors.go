@@ -0,0 +1,9 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import "errors"
+
+// ErrSaveEvent indicates a failure to persist a telemetry event.
+var ErrSaveEvent = errors.New("failed to save event to database")
@@ -0,0 +1,74 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/absmach/callhome"
+)
+
+// ExportTelemetry streams the heartbeats or deployments as SQLite steps
+// through the result rows.
+func (r repo) ExportTelemetry(ctx context.Context, rows string, filters callhome.TelemetryFilters, fn func(callhome.Telemetry) error) error {
+	filterQuery, params := generateQuery(filters)
+	rangeQuery, _ := generateQuery(callhome.TelemetryFilters{From: filters.From, To: filters.To})
+	q := fmt.Sprintf(`
+		SELECT (SELECT id FROM deployments d WHERE d.ip_address = telemetry.ip_address) AS deployment_id,
+			ip_address, time, service_time, longitude, latitude, mg_version, country, city, region,
+			service, NULL AS services
+		FROM telemetry
+		%s
+		ORDER BY time, deployment_id, service;
+	`, filterQuery)
+	if rows == callhome.ExportDeployments {
+		q = fmt.Sprintf(`
+		WITH latest_per_ip AS (
+			SELECT ip_address, time, service_time, longitude, latitude, mg_version, country, city, region
+			FROM (
+				SELECT *, ROW_NUMBER() OVER (PARTITION BY ip_address ORDER BY time DESC) AS rn
+				FROM telemetry
+				%s
+			)
+			WHERE rn = 1
+		)
+		SELECT d.id AS deployment_id, lpi.*, '' AS service,
+			(SELECT group_concat(DISTINCT service) FROM telemetry t %s) AS services
+		FROM latest_per_ip lpi
+		INNER JOIN deployments d ON d.ip_address = lpi.ip_address
+		ORDER BY lpi.time, d.id;
+		`, filterQuery, andWhere(rangeQuery, "t.ip_address = lpi.ip_address AND t.service <> ''"))
+	}
+
+	res, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for res.Next() {
+		var dbt struct {
+			dbTelemetry
+			Service string         `db:"service"`
+			Region  sql.NullString `db:"region"`
+		}
+		if err := res.StructScan(&dbt); err != nil {
+			return err
+		}
+		t, err := dbt.toTelemetry()
+		if err != nil {
+			return err
+		}
+		t.Service = dbt.Service
+		t.Region = dbt.Region.String
+		sort.Strings(t.Services)
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return res.Err()
+}
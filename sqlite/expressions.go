@@ -0,0 +1,26 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/absmach/callhome/internal/sqlfilter"
+)
+
+// dialect compares versions by the version_key function.
+var dialect = sqlfilter.Dialect{
+	VersionKey: func(column string) string {
+		return fmt.Sprintf("version_key(%s)", column)
+	},
+	KeyParam: func(name string, key []uint64) (string, interface{}) {
+		return ":" + name, formatVersionKey(key)
+	},
+}
+
+// formatVersionKey formats the callhome.VersionKey as fixed width text, so
+// keys compare as text.
+func formatVersionKey(key []uint64) string {
+	return fmt.Sprintf("%020d.%020d.%020d.%d", key[0], key[1], key[2], key[3])
+}
@@ -0,0 +1,139 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	migrate "github.com/rubenv/sql-migrate"
+	_ "modernc.org/sqlite" // required for SQL access
+)
+
+// Migration of Telemetry service.
+func Migration() migrate.MemoryMigrationSource {
+	return migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id: "telemetry_1",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS telemetry (
+						time			TEXT	NOT NULL,
+						service_time	TEXT,
+						ip_address		TEXT	NOT NULL,
+						mac_address		TEXT	NOT NULL DEFAULT '',
+						longitude		REAL	NOT NULL,
+						latitude		REAL	NOT NULL,
+						mg_version		TEXT,
+						service			TEXT	NOT NULL DEFAULT '',
+						country			TEXT,
+						city			TEXT,
+						PRIMARY KEY (ip_address, mac_address, service, time)
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_time ON telemetry (time DESC);`,
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_ip_time ON telemetry (ip_address, time DESC);`,
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_country_time ON telemetry (country, time DESC);`,
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_city ON telemetry (city);`,
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_service ON telemetry (service);`,
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_mg_version ON telemetry (mg_version);`,
+				},
+				Down: []string{"DROP TABLE telemetry;"},
+			},
+			{
+				// Version transitions are detected on save from then on, and
+				// backfilled here from the heartbeats already stored.
+				Id: "telemetry_2",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS version_transitions (
+						time			TEXT	NOT NULL,
+						ip_address		TEXT	NOT NULL,
+						mac_address		TEXT	NOT NULL DEFAULT '',
+						service			TEXT	NOT NULL DEFAULT '',
+						from_version	TEXT	NOT NULL,
+						to_version		TEXT	NOT NULL,
+						country			TEXT,
+						city			TEXT,
+						PRIMARY KEY (ip_address, mac_address, service, time)
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_version_transitions_time ON version_transitions (time DESC);`,
+					`INSERT OR IGNORE INTO version_transitions (time, ip_address, mac_address, service, from_version, to_version, country, city)
+						SELECT time, ip_address, mac_address, service, prev, mg_version, country, city
+						FROM (
+							SELECT time, ip_address, mac_address, service, mg_version, country, city,
+								LAG(mg_version) OVER (PARTITION BY ip_address, mac_address, service ORDER BY time) AS prev
+							FROM telemetry
+							WHERE mg_version <> ''
+						) heartbeats
+						WHERE prev <> mg_version;`,
+				},
+				Down: []string{"DROP TABLE IF EXISTS version_transitions;"},
+			},
+			{
+				// Regions are only known for heartbeats saved from then on.
+				Id:   "telemetry_3",
+				Up:   []string{`ALTER TABLE telemetry ADD COLUMN region TEXT;`},
+				Down: []string{"ALTER TABLE telemetry DROP COLUMN region;"},
+			},
+			{
+				Id: "telemetry_4",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS webhooks (
+						id			TEXT	PRIMARY KEY,
+						url			TEXT	NOT NULL,
+						secret		TEXT	NOT NULL,
+						events		TEXT	NOT NULL,
+						created_at	TEXT	NOT NULL
+					);`,
+					`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+						webhook_id	TEXT	NOT NULL,
+						event_id	TEXT	NOT NULL,
+						event_type	TEXT	NOT NULL,
+						attempt		INTEGER	NOT NULL,
+						time		TEXT	NOT NULL,
+						status_code	INTEGER	NOT NULL DEFAULT 0,
+						error		TEXT	NOT NULL DEFAULT '',
+						PRIMARY KEY (webhook_id, event_id, attempt)
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_time ON webhook_deliveries (webhook_id, time DESC);`,
+				},
+				Down: []string{
+					"DROP TABLE IF EXISTS webhook_deliveries;",
+					"DROP TABLE IF EXISTS webhooks;",
+				},
+			},
+			{
+				// Geographic filters narrow heartbeats by latitude before the
+				// longitude and the distance are checked. Transitions are located
+				// from then on, and backfilled here from their heartbeats.
+				Id: "telemetry_5",
+				Up: []string{
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_location ON telemetry (latitude, longitude);`,
+					`ALTER TABLE version_transitions ADD COLUMN latitude REAL;`,
+					`ALTER TABLE version_transitions ADD COLUMN longitude REAL;`,
+					`UPDATE version_transitions
+						SET latitude = t.latitude, longitude = t.longitude
+						FROM telemetry t
+						WHERE t.ip_address = version_transitions.ip_address AND t.mac_address = version_transitions.mac_address
+							AND t.service = version_transitions.service AND t.time = version_transitions.time;`,
+				},
+				Down: []string{
+					"ALTER TABLE version_transitions DROP COLUMN longitude;",
+					"ALTER TABLE version_transitions DROP COLUMN latitude;",
+					"DROP INDEX IF EXISTS idx_telemetry_location;",
+				},
+			},
+			{
+				// Deployments are identified publicly by a random ID, which does
+				// not reveal their IP address. It is assigned on the first save,
+				// and backfilled here for the deployments already stored.
+				Id: "telemetry_6",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS deployments (
+						ip_address	TEXT	PRIMARY KEY,
+						id			TEXT	NOT NULL UNIQUE DEFAULT (lower(hex(randomblob(16))))
+					);`,
+					`INSERT OR IGNORE INTO deployments (ip_address) SELECT DISTINCT ip_address FROM telemetry;`,
+				},
+				Down: []string{"DROP TABLE IF EXISTS deployments;"},
+			},
+		},
+	}
+}
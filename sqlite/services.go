@@ -0,0 +1,83 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/sqlfilter"
+)
+
+// RetrieveServiceSets counts deployments by the set of services they run.
+func (r repo) RetrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.ServiceSet, error) {
+	service := filters.ValueFilters().Service
+	filters.Service = ""
+	filterQuery, params := generateQuery(filters)
+	if filterQuery == "" {
+		filterQuery = "WHERE service <> ''"
+	} else {
+		filterQuery += " AND service <> ''"
+	}
+	// The service filter applies to deployments rather than heartbeats, which
+	// run a matching service and none of the excluded ones.
+	var conds []string
+	if q := dialect.IncludeQuery("service", "service", service, params); q != "" {
+		conds = append(conds, fmt.Sprintf("SUM(%s) > 0", q))
+	}
+	if q := sqlfilter.ExcludeQuery("service", "service", service, params); q != "" {
+		conds = append(conds, fmt.Sprintf("MIN(%s) = 1", q))
+	}
+	having := ""
+	if len(conds) > 0 {
+		having = "HAVING " + strings.Join(conds, " AND ")
+	}
+
+	// SQLite cannot group by the set, so sets are counted below.
+	q := fmt.Sprintf(`
+		SELECT group_concat(DISTINCT service) AS services
+		FROM telemetry
+		%s
+		GROUP BY ip_address
+		%s;
+	`, filterQuery, having)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []callhome.ServiceSet
+	index := make(map[string]int)
+	for rows.Next() {
+		var services string
+		if err := rows.Scan(&services); err != nil {
+			return nil, err
+		}
+		s := strings.Split(services, ",")
+		sort.Strings(s)
+		k := strings.Join(s, ",")
+		i, ok := index[k]
+		if !ok {
+			i = len(sets)
+			index[k] = i
+			sets = append(sets, callhome.ServiceSet{Services: s})
+		}
+		sets[i].Deployments++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Deployments != sets[j].Deployments {
+			return sets[i].Deployments > sets[j].Deployments
+		}
+		return strings.Join(sets[i].Services, ",") < strings.Join(sets[j].Services, ",")
+	})
+	return sets, nil
+}
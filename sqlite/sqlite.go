@@ -0,0 +1,348 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sqlite contains a callhome.TelemetryRepo backed by an embedded SQLite
+// database, meant for single-binary evaluation and small self-hosted installs.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	msqlite "modernc.org/sqlite"
+)
+
+// timeLayout is a fixed width UTC layout, so stored times sort as text and
+// remain readable by SQLite date functions.
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+var _ callhome.TelemetryRepo = (*repo)(nil)
+
+func init() {
+	// version_key compares semantic versions, NULL for other versions.
+	msqlite.MustRegisterDeterministicScalarFunction("version_key", 1, func(_ *msqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var v string
+		switch a := args[0].(type) {
+		case string:
+			v = a
+		case []byte:
+			v = string(a)
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("version_key: unsupported argument type %T", a)
+		}
+		key, ok := callhome.VersionKey(v)
+		if !ok {
+			return nil, nil
+		}
+		return formatVersionKey(key), nil
+	})
+}
+
+type repo struct {
+	db *sqlx.DB
+}
+
+// New returns new SQLite repository.
+func New(db *sqlx.DB) callhome.TelemetryRepo {
+	return &repo{db: db}
+}
+
+type dbTelemetry struct {
+	DeploymentID string         `db:"deployment_id"`
+	IpAddress    string         `db:"ip_address"`
+	Longitude    float64        `db:"longitude"`
+	Latitude     float64        `db:"latitude"`
+	Version      sql.NullString `db:"mg_version"`
+	Country      sql.NullString `db:"country"`
+	City         sql.NullString `db:"city"`
+	Time         string         `db:"time"`
+	ServiceTime  sql.NullString `db:"service_time"`
+	Services     sql.NullString `db:"services"`
+}
+
+func (dbt dbTelemetry) toTelemetry() (callhome.Telemetry, error) {
+	t := callhome.Telemetry{
+		DeploymentID: dbt.DeploymentID,
+		IpAddress:    dbt.IpAddress,
+		Longitude:    dbt.Longitude,
+		Latitude:     dbt.Latitude,
+		Version:      dbt.Version.String,
+		Country:      dbt.Country.String,
+		City:         dbt.City.String,
+	}
+	if dbt.Services.String != "" {
+		t.Services = strings.Split(dbt.Services.String, ",")
+	}
+	var err error
+	if t.ServiceTime, err = parseTime(dbt.Time); err != nil {
+		return callhome.Telemetry{}, err
+	}
+	if dbt.ServiceTime.Valid {
+		if t.LastSeen, err = parseTime(dbt.ServiceTime.String); err != nil {
+			return callhome.Telemetry{}, err
+		}
+	}
+	return t, nil
+}
+
+// insertDeploymentQuery assigns a random ID to the deployment on its first heartbeat.
+const insertDeploymentQuery = `INSERT INTO deployments (ip_address) VALUES (:ip_address) ON CONFLICT DO NOTHING;`
+
+// Save creates record in repo, along with version transitions if the version
+// differs from the adjacent heartbeats. Saving a heartbeat that is already
+// stored for the same deployment, service and time is a no-op.
+func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
+	q := `INSERT INTO telemetry (ip_address, mac_address, longitude, latitude,
+		mg_version, service, time, country, city, region, service_time)
+		VALUES (:ip_address, :mac_address, :longitude, :latitude,
+			:mg_version, :service, :time, :country, :city, :region, :service_time)
+		ON CONFLICT (ip_address, mac_address, service, time) DO NOTHING;`
+
+	params := map[string]interface{}{
+		"ip_address":   t.IpAddress,
+		"mac_address":  t.MacAddress,
+		"longitude":    t.Longitude,
+		"latitude":     t.Latitude,
+		"mg_version":   t.Version,
+		"service":      t.Service,
+		"time":         formatTime(t.ServiceTime),
+		"country":      t.Country,
+		"city":         t.City,
+		"region":       t.Region,
+		"service_time": formatTime(t.LastSeen),
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(ErrSaveEvent, err.Error())
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	res, err := tx.NamedExecContext(ctx, q, params)
+	if err != nil {
+		return errors.Wrap(ErrSaveEvent, err.Error())
+	}
+	n, _ := res.RowsAffected()
+	// Duplicates belong to a known deployment.
+	if n > 0 {
+		if _, err := tx.NamedExecContext(ctx, insertDeploymentQuery, params); err != nil {
+			return errors.Wrap(ErrSaveEvent, err.Error())
+		}
+	}
+	// Duplicates and heartbeats without a version cannot change the version.
+	if n > 0 && t.Version != "" {
+		for _, tq := range transitionQueries {
+			if _, err := tx.NamedExecContext(ctx, tq, params); err != nil {
+				return errors.Wrap(ErrSaveEvent, err.Error())
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(ErrSaveEvent, err.Error())
+	}
+	return nil
+}
+
+// RetrieveAll gets the latest record of each deployment.
+func (r repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	filterQuery, params := generateQuery(filters)
+
+	// A heartbeat is the latest of its deployment if no later heartbeat
+	// matches, with ties broken by service and MAC address.
+	later := andWhere(filterQuery, "l.ip_address = t.ip_address AND (l.time, l.service, l.mac_address) > (t.time, t.service, t.mac_address)")
+	query := andWhere(filterQuery, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM telemetry l %s)", later))
+
+	order, pagination := "DESC", "LIMIT :limit OFFSET :offset"
+	if pm.Cursor != "" {
+		cursor, err := callhome.ParsePageCursor(pm.Cursor)
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		cmp := "<"
+		if cursor.Backward {
+			cmp, order = ">", "ASC"
+		}
+		query = andWhere(query, fmt.Sprintf("(t.time, d.id) %s (:cursor_time, :cursor_id)", cmp))
+		pagination = "LIMIT :limit"
+		params["cursor_time"] = formatTime(cursor.Time)
+		params["cursor_id"] = cursor.DeploymentID
+	}
+
+	q := fmt.Sprintf(`
+	SELECT
+		d.id AS deployment_id,
+		t.ip_address,
+		t.time,
+		t.service_time,
+		t.longitude,
+		t.latitude,
+		t.mg_version,
+		t.country,
+		t.city,
+		(SELECT group_concat(DISTINCT service) FROM telemetry WHERE ip_address = t.ip_address) AS services
+	FROM telemetry t
+	INNER JOIN deployments d ON d.ip_address = t.ip_address
+	%s
+	ORDER BY t.time %s, d.id %s
+	%s;
+	`, query, order, order, pagination)
+
+	// One extra row tells whether there is a page past this one.
+	params["limit"] = pm.Limit + 1
+	params["offset"] = pm.Offset
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+	defer rows.Close()
+
+	var results callhome.TelemetryPage
+	for rows.Next() {
+		var dbt dbTelemetry
+		if err := rows.StructScan(&dbt); err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		t, err := dbt.toTelemetry()
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		results.Telemetry = append(results.Telemetry, t)
+	}
+	if err := rows.Err(); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+
+	results.Telemetry, results.Next, results.Prev = callhome.KeysetPage(results.Telemetry, pm)
+
+	// SQLite has no planner estimate, so the total is always exact.
+	if results.Total, err = r.count(ctx, fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) FROM telemetry %s;`, filterQuery), params); err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+	if pm.Cursor == "" {
+		results.Offset = pm.Offset
+	}
+	results.Limit = pm.Limit
+
+	return results, nil
+}
+
+// RetrieveSummary counts deployments per value of each dimension in a single query.
+func (r repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+	filterQuery, params := generateQuery(filters)
+	var summary callhome.TelemetrySummary
+
+	q := fmt.Sprintf(`
+		SELECT 'country' AS dimension, COALESCE(country, '') AS value, COUNT(DISTINCT ip_address) AS count
+		FROM telemetry %[1]s GROUP BY 2
+		UNION ALL
+		SELECT 'city', COALESCE(city, ''), COUNT(DISTINCT ip_address) FROM telemetry %[1]s GROUP BY 2
+		UNION ALL
+		SELECT 'service', COALESCE(service, ''), COUNT(DISTINCT ip_address) FROM telemetry %[1]s GROUP BY 2
+		UNION ALL
+		SELECT 'version', COALESCE(mg_version, ''), COUNT(DISTINCT ip_address) FROM telemetry %[1]s GROUP BY 2;
+	`, filterQuery)
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dimension string
+		var vs callhome.ValueSummary
+		if err := rows.Scan(&dimension, &vs.Value, &vs.NoDeployments); err != nil {
+			return callhome.TelemetrySummary{}, err
+		}
+		if dimension == callhome.GroupByCountry {
+			summary.Countries = append(summary.Countries, callhome.CountrySummary{Country: vs.Value, NoDeployments: vs.NoDeployments})
+			summary.TotalDeployments += vs.NoDeployments
+			continue
+		}
+		if vs.Value == "" {
+			continue
+		}
+		switch dimension {
+		case callhome.GroupByCity:
+			summary.CityCounts = append(summary.CityCounts, vs)
+		case callhome.GroupByService:
+			summary.ServiceCounts = append(summary.ServiceCounts, vs)
+		case callhome.GroupByVersion:
+			summary.VersionCounts = append(summary.VersionCounts, vs)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return callhome.TelemetrySummary{}, err
+	}
+
+	return summary, nil
+}
+
+// RetrievePolicies returns no policies, since SQLite has no chunking,
+// retention or compression.
+func (r repo) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	return callhome.StoragePolicies{}, nil
+}
+
+func (r repo) count(ctx context.Context, q string, params map[string]interface{}) (uint64, error) {
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total uint64
+	if rows.Next() {
+		if err := rows.Scan(&total); err != nil {
+			return 0, err
+		}
+	}
+	return total, rows.Err()
+}
+
+// andWhere adds the condition to the WHERE clause of the filter query.
+func andWhere(filterQuery, condition string) string {
+	if filterQuery == "" {
+		return "WHERE " + condition
+	}
+	return filterQuery + " AND " + condition
+}
+
+func generateQuery(filters callhome.TelemetryFilters) (string, map[string]interface{}) {
+	var queries []string
+	params := make(map[string]interface{})
+
+	if !filters.From.IsZero() {
+		queries = append(queries, "time >= :from")
+		params["from"] = formatTime(filters.From)
+	}
+	if !filters.To.IsZero() {
+		queries = append(queries, "time <= :to")
+		params["to"] = formatTime(filters.To)
+	}
+	queries = dialect.ValueQueries(queries, params, filters)
+	queries = geoQueries(queries, params, filters)
+
+	switch len(queries) {
+	case 0:
+		return "", params
+	default:
+		return fmt.Sprintf("WHERE %s", strings.Join(queries, " AND ")), params
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	sqliteClient "github.com/absmach/callhome/internal/clients/sqlite"
+	"github.com/absmach/callhome/repotest"
+	"github.com/absmach/callhome/sqlite"
+	migrate "github.com/rubenv/sql-migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRepo(t *testing.T) callhome.TelemetryRepo {
+	cfg := sqliteClient.Config{Path: filepath.Join(t.TempDir(), "callhome.db"), BusyTimeout: 5000}
+	db, err := sqliteClient.SetupDB(cfg, sqlite.Migration())
+	require.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	return sqlite.New(db)
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, newRepo)
+}
+
+func TestWebhookConformance(t *testing.T) {
+	repotest.RunWebhooks(t, func(t *testing.T) callhome.WebhookRepo {
+		cfg := sqliteClient.Config{Path: filepath.Join(t.TempDir(), "callhome.db"), BusyTimeout: 5000}
+		db, err := sqliteClient.SetupDB(cfg, sqlite.Migration())
+		require.Nil(t, err)
+		t.Cleanup(func() { db.Close() })
+		return sqlite.NewWebhookRepo(db)
+	})
+}
+
+func heartbeat(ip, service, version, country string, at time.Time) callhome.Telemetry {
+	return callhome.Telemetry{
+		Service:     service,
+		IpAddress:   ip,
+		Version:     version,
+		Country:     country,
+		City:        country + " city",
+		Longitude:   1.2,
+		Latitude:    30.2,
+		LastSeen:    at,
+		ServiceTime: at,
+	}
+}
+
+func TestSave(t *testing.T) {
+	ctx := context.TODO()
+	repo := newRepo(t)
+	now := time.Now()
+
+	t.Run("successful save", func(t *testing.T) {
+		err := repo.Save(ctx, heartbeat("192.168.0.1", "users", "0.13", "Serbia", now))
+		assert.Nil(t, err)
+	})
+	t.Run("duplicate save is idempotent", func(t *testing.T) {
+		err := repo.Save(ctx, heartbeat("192.168.0.1", "users", "0.13", "Serbia", now))
+		assert.Nil(t, err)
+
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), page.Total)
+	})
+	t.Run("same time for different services", func(t *testing.T) {
+		err := repo.Save(ctx, heartbeat("192.168.0.1", "things", "0.13", "Serbia", now))
+		assert.Nil(t, err)
+
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		require.Len(t, page.Telemetry, 1)
+		assert.ElementsMatch(t, []string{"users", "things"}, page.Telemetry[0].Services)
+	})
+}
+
+func TestRetrieveAll(t *testing.T) {
+	ctx := context.TODO()
+	repo := newRepo(t)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	for i := 0; i < 5; i++ {
+		at := now.Add(-time.Duration(i) * time.Hour)
+		country := "Serbia"
+		if i%2 == 1 {
+			country = "France"
+		}
+		require.Nil(t, repo.Save(ctx, heartbeat(fmt.Sprintf("10.0.0.%d", i), "users", "0.14", country, at)))
+		// An older heartbeat, which must not be reported as the latest one.
+		require.Nil(t, repo.Save(ctx, heartbeat(fmt.Sprintf("10.0.0.%d", i), "users", "0.13", country, at.Add(-time.Minute))))
+	}
+
+	t.Run("latest per deployment", func(t *testing.T) {
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(5), page.Total)
+		require.Len(t, page.Telemetry, 5)
+		assert.Equal(t, "10.0.0.0", page.Telemetry[0].IpAddress)
+		assert.Equal(t, "0.14", page.Telemetry[0].Version)
+		assert.True(t, now.Equal(page.Telemetry[0].ServiceTime))
+		assert.Empty(t, page.Next)
+	})
+	t.Run("filter by country", func(t *testing.T) {
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, callhome.TelemetryFilters{Country: "France"})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), page.Total)
+		for _, tel := range page.Telemetry {
+			assert.Equal(t, "France", tel.Country)
+		}
+	})
+	t.Run("filter by time", func(t *testing.T) {
+		filters := callhome.TelemetryFilters{From: now.Add(-90 * time.Minute), To: now}
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10}, filters)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), page.Total)
+	})
+	t.Run("keyset pagination", func(t *testing.T) {
+		var seen []string
+		pm := callhome.PageMetadata{Limit: 2}
+		for {
+			page, err := repo.RetrieveAll(ctx, pm, callhome.TelemetryFilters{})
+			require.Nil(t, err)
+			for _, tel := range page.Telemetry {
+				seen = append(seen, tel.IpAddress)
+			}
+			if page.Next == "" {
+				break
+			}
+			pm.Cursor = page.Next
+		}
+		assert.Equal(t, []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, seen)
+
+		page, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 2, Cursor: pm.Cursor}, callhome.TelemetryFilters{})
+		require.Nil(t, err)
+		prev, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 2, Cursor: page.Prev}, callhome.TelemetryFilters{})
+		require.Nil(t, err)
+		require.Len(t, prev.Telemetry, 2)
+		assert.Equal(t, "10.0.0.2", prev.Telemetry[0].IpAddress)
+		assert.Equal(t, "10.0.0.3", prev.Telemetry[1].IpAddress)
+	})
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 2, Cursor: "invalid"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidCursor)
+	})
+}
+
+func TestRetrieveSummary(t *testing.T) {
+	ctx := context.TODO()
+	repo := newRepo(t)
+	now := time.Now()
+
+	require.Nil(t, repo.Save(ctx, heartbeat("10.0.0.1", "users", "0.14.0", "USA", now)))
+	require.Nil(t, repo.Save(ctx, heartbeat("10.0.0.1", "auth", "0.14.0", "USA", now)))
+	require.Nil(t, repo.Save(ctx, heartbeat("10.0.0.2", "users", "0.13.0", "USA", now)))
+	require.Nil(t, repo.Save(ctx, heartbeat("10.0.0.3", "things", "0.14.0", "UK", now)))
+
+	summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, summary.TotalDeployments)
+	assert.ElementsMatch(t, []callhome.CountrySummary{
+		{Country: "USA", NoDeployments: 2},
+		{Country: "UK", NoDeployments: 1},
+	}, summary.Countries)
+	assert.ElementsMatch(t, []callhome.ValueSummary{
+		{Value: "USA city", NoDeployments: 2},
+		{Value: "UK city", NoDeployments: 1},
+	}, summary.CityCounts)
+	assert.ElementsMatch(t, []callhome.ValueSummary{
+		{Value: "users", NoDeployments: 2},
+		{Value: "auth", NoDeployments: 1},
+		{Value: "things", NoDeployments: 1},
+	}, summary.ServiceCounts)
+	assert.ElementsMatch(t, []callhome.ValueSummary{
+		{Value: "0.14.0", NoDeployments: 2},
+		{Value: "0.13.0", NoDeployments: 1},
+	}, summary.VersionCounts)
+
+	summary, err = repo.RetrieveSummary(ctx, callhome.TelemetryFilters{Service: "users"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.TotalDeployments)
+}
+
+func TestTransitionsBackfill(t *testing.T) {
+	cfg := sqliteClient.Config{Path: filepath.Join(t.TempDir(), "callhome.db"), BusyTimeout: 5000}
+	migrations := sqlite.Migration()
+	db, err := sqliteClient.SetupDB(cfg, migrate.MemoryMigrationSource{Migrations: migrations.Migrations[:1]})
+	require.Nil(t, err)
+	defer db.Close()
+
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for i, version := range []string{"0.13.0", "", "0.13.0", "0.14.0"} {
+		_, err := db.Exec(`INSERT INTO telemetry (ip_address, longitude, latitude, mg_version, service, time, country)
+			VALUES ('10.0.0.1', 0, 0, ?, 'users', ?, 'Serbia')`, version, day.Add(time.Duration(i)*time.Hour).Format("2006-01-02T15:04:05.000000000Z"))
+		require.Nil(t, err)
+	}
+	require.Nil(t, sqliteClient.MigrateDB(db, migrations))
+
+	buckets, err := sqlite.New(db).RetrieveTransitions(context.Background(), callhome.IntervalHour, callhome.TelemetryFilters{})
+	assert.Nil(t, err)
+	assert.Equal(t, []callhome.TransitionBucket{{Time: day.Add(3 * time.Hour), From: "0.13.0", To: "0.14.0", Deployments: 1}}, buckets)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/absmach/callhome"
+)
+
+// bucketStarts maps time series intervals to expressions of the bucket start,
+// formatted like stored times. Week buckets start on Monday. Colons are doubled,
+// since a single one starts a named parameter.
+var bucketStarts = map[string]string{
+	callhome.IntervalHour:  `strftime('%Y-%m-%dT%H::00::00.000000000Z', time)`,
+	callhome.IntervalDay:   `strftime('%Y-%m-%dT00::00::00.000000000Z', time)`,
+	callhome.IntervalWeek:  `strftime('%Y-%m-%dT00::00::00.000000000Z', time, 'weekday 0', '-6 days')`,
+	callhome.IntervalMonth: `strftime('%Y-%m-01T00::00::00.000000000Z', time)`,
+}
+
+// splitColumns maps time series split dimensions to telemetry columns.
+var splitColumns = map[string]string{
+	"":                      "''",
+	callhome.SplitByCountry: "country",
+	callhome.SplitByVersion: "mg_version",
+	callhome.SplitByService: "service",
+}
+
+// RetrieveTimeSeries counts distinct deployments reporting in each time bucket.
+func (r repo) RetrieveTimeSeries(ctx context.Context, tq callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) ([]callhome.TimeSeriesBucket, error) {
+	start, ok := bucketStarts[tq.Interval]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	column, ok := splitColumns[tq.SplitBy]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	filterQuery, params := generateQuery(filters)
+
+	// Bucket start and column are taken from the maps above, never from the input.
+	q := fmt.Sprintf(`
+		SELECT %s AS bucket, COALESCE(%s, '') AS grp, COUNT(DISTINCT ip_address) AS count
+		FROM telemetry
+		%s
+		GROUP BY bucket, grp
+		ORDER BY bucket, grp;
+	`, start, column, filterQuery)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []callhome.TimeSeriesBucket
+	for rows.Next() {
+		var res struct {
+			Bucket string `db:"bucket"`
+			Group  string `db:"grp"`
+			Count  int    `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		t, err := parseTime(res.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, callhome.TimeSeriesBucket{Time: t, Group: res.Group, ActiveDeployments: res.Count})
+	}
+	return buckets, rows.Err()
+}
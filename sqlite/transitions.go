@@ -0,0 +1,153 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/absmach/callhome"
+)
+
+// transitionQueries record the version transitions around a saved heartbeat,
+// compared to the previous and the next heartbeat of the same deployment, MAC
+// address and service that report a version. A heartbeat saved out of order
+// replaces the transition of the next heartbeat.
+var transitionQueries = []string{
+	`INSERT OR IGNORE INTO version_transitions (time, ip_address, mac_address, service, from_version, to_version, country, city, latitude, longitude)
+	SELECT :time, :ip_address, :mac_address, :service, prev.mg_version, :mg_version, :country, :city, :latitude, :longitude
+	FROM (
+		SELECT mg_version FROM telemetry
+		WHERE ip_address = :ip_address AND mac_address = :mac_address AND service = :service
+			AND time < :time AND mg_version <> ''
+		ORDER BY time DESC
+		LIMIT 1
+	) prev
+	WHERE prev.mg_version <> :mg_version;`,
+	`DELETE FROM version_transitions
+	WHERE ip_address = :ip_address AND mac_address = :mac_address AND service = :service AND time = (
+		SELECT time FROM telemetry
+		WHERE ip_address = :ip_address AND mac_address = :mac_address AND service = :service
+			AND time > :time AND mg_version <> ''
+		ORDER BY time
+		LIMIT 1
+	);`,
+	`INSERT OR IGNORE INTO version_transitions (time, ip_address, mac_address, service, from_version, to_version, country, city, latitude, longitude)
+	SELECT next.time, :ip_address, :mac_address, :service, :mg_version, next.mg_version, next.country, next.city, next.latitude, next.longitude
+	FROM (
+		SELECT time, mg_version, country, city, latitude, longitude FROM telemetry
+		WHERE ip_address = :ip_address AND mac_address = :mac_address AND service = :service
+			AND time > :time AND mg_version <> ''
+		ORDER BY time
+		LIMIT 1
+	) next
+	WHERE next.mg_version <> :mg_version;`,
+}
+
+// RetrieveTransitions counts deployments moving between versions in each time bucket.
+func (r repo) RetrieveTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) ([]callhome.TransitionBucket, error) {
+	start, ok := bucketStarts[interval]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	filterQuery, params := generateTransitionQuery(filters)
+
+	// Bucket start is taken from the map, never from the input.
+	q := fmt.Sprintf(`
+		SELECT %s AS bucket, from_version, to_version, COUNT(DISTINCT ip_address) AS count
+		FROM version_transitions
+		%s
+		GROUP BY bucket, from_version, to_version
+		ORDER BY bucket, from_version, to_version;
+	`, start, filterQuery)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []callhome.TransitionBucket
+	for rows.Next() {
+		var res struct {
+			Bucket string `db:"bucket"`
+			From   string `db:"from_version"`
+			To     string `db:"to_version"`
+			Count  int    `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		t, err := parseTime(res.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, callhome.TransitionBucket{Time: t, From: res.From, To: res.To, Deployments: res.Count})
+	}
+	return buckets, rows.Err()
+}
+
+// RetrieveTransitionCounts counts deployments moving between versions over the
+// whole filtered range.
+func (r repo) RetrieveTransitionCounts(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.TransitionCount, error) {
+	filterQuery, params := generateTransitionQuery(filters)
+
+	q := fmt.Sprintf(`
+		SELECT from_version, to_version, COUNT(DISTINCT ip_address) AS count
+		FROM version_transitions
+		%s
+		GROUP BY from_version, to_version
+		ORDER BY from_version, to_version;
+	`, filterQuery)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []callhome.TransitionCount
+	for rows.Next() {
+		var res struct {
+			From  string `db:"from_version"`
+			To    string `db:"to_version"`
+			Count int    `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		counts = append(counts, callhome.TransitionCount{From: res.From, To: res.To, Deployments: res.Count})
+	}
+	return counts, rows.Err()
+}
+
+// generateTransitionQuery applies telemetry filters to version transitions. The
+// version filter matches either side of a transition.
+func generateTransitionQuery(filters callhome.TelemetryFilters) (string, map[string]interface{}) {
+	var queries []string
+	params := make(map[string]interface{})
+
+	if !filters.From.IsZero() {
+		queries = append(queries, "time >= :from")
+		params["from"] = formatTime(filters.From)
+	}
+	if !filters.To.IsZero() {
+		queries = append(queries, "time <= :to")
+		params["to"] = formatTime(filters.To)
+	}
+	// The version filter matches either side of a transition.
+	version := filters.ValueFilters().Version
+	filters.Version = ""
+	queries = dialect.ValueQueries(queries, params, filters)
+	if q := dialect.ValueQuery("from_version", "version", version, params); q != "" {
+		queries = append(queries, fmt.Sprintf("(%s OR %s)", q, dialect.ValueQuery("to_version", "version", version, params)))
+	}
+	queries = geoQueries(queries, params, filters)
+
+	if len(queries) == 0 {
+		return "", params
+	}
+	return fmt.Sprintf("WHERE %s", strings.Join(queries, " AND ")), params
+}
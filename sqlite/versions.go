@@ -0,0 +1,58 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/absmach/callhome"
+)
+
+// RetrieveVersions gets the number of deployments running each version and
+// the time each version was first reported.
+func (r repo) RetrieveVersions(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	filterQuery, params := generateQuery(filters)
+
+	// A deployment runs the version reported by its latest heartbeat.
+	q := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT ip_address, COALESCE(mg_version, '') AS version, time
+			FROM telemetry
+			%s
+		),
+		latest AS (
+			SELECT version, ROW_NUMBER() OVER (PARTITION BY ip_address ORDER BY time DESC) AS rn
+			FROM filtered
+		)
+		SELECT f.version, f.first_seen, COALESCE(l.count, 0) AS count
+		FROM (SELECT version, MIN(time) AS first_seen FROM filtered GROUP BY version) f
+		LEFT JOIN (SELECT version, COUNT(*) AS count FROM latest WHERE rn = 1 GROUP BY version) l USING (version)
+		ORDER BY f.version;
+	`, filterQuery)
+
+	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []callhome.VersionUsage
+	for rows.Next() {
+		var res struct {
+			Version   string `db:"version"`
+			FirstSeen string `db:"first_seen"`
+			Count     int    `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		firstSeen, err := parseTime(res.FirstSeen)
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, callhome.VersionUsage{Version: res.Version, Deployments: res.Count, FirstSeen: firstSeen})
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var _ callhome.WebhookRepo = (*webhookRepo)(nil)
+
+type webhookRepo struct {
+	db *sqlx.DB
+}
+
+// NewWebhookRepo returns new SQLite webhook repository.
+func NewWebhookRepo(db *sqlx.DB) callhome.WebhookRepo {
+	return &webhookRepo{db: db}
+}
+
+type dbWebhook struct {
+	ID        string `db:"id"`
+	URL       string `db:"url"`
+	Secret    string `db:"secret"`
+	Events    string `db:"events"`
+	CreatedAt string `db:"created_at"`
+}
+
+func (dbw dbWebhook) toWebhook() (callhome.Webhook, error) {
+	createdAt, err := parseTime(dbw.CreatedAt)
+	if err != nil {
+		return callhome.Webhook{}, err
+	}
+	return callhome.Webhook{
+		ID:        dbw.ID,
+		URL:       dbw.URL,
+		Secret:    dbw.Secret,
+		Events:    strings.Split(dbw.Events, ","),
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (r webhookRepo) SaveWebhook(ctx context.Context, w callhome.Webhook) error {
+	q := `INSERT INTO webhooks (id, url, secret, events, created_at)
+		VALUES (:id, :url, :secret, :events, :created_at);`
+	_, err := r.db.NamedExecContext(ctx, q, dbWebhook{
+		ID:        w.ID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    strings.Join(w.Events, ","),
+		CreatedAt: formatTime(w.CreatedAt),
+	})
+	return err
+}
+
+func (r webhookRepo) RetrieveWebhook(ctx context.Context, id string) (callhome.Webhook, error) {
+	var dbw dbWebhook
+	err := r.db.GetContext(ctx, &dbw, `SELECT id, url, secret, events, created_at FROM webhooks WHERE id = ?;`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return callhome.Webhook{}, callhome.ErrWebhookNotFound
+	}
+	if err != nil {
+		return callhome.Webhook{}, err
+	}
+	return dbw.toWebhook()
+}
+
+func (r webhookRepo) RetrieveWebhooks(ctx context.Context) ([]callhome.Webhook, error) {
+	var dbws []dbWebhook
+	if err := r.db.SelectContext(ctx, &dbws, `SELECT id, url, secret, events, created_at FROM webhooks ORDER BY created_at, id;`); err != nil {
+		return nil, err
+	}
+	var ret []callhome.Webhook
+	for _, dbw := range dbws {
+		w, err := dbw.toWebhook()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, w)
+	}
+	return ret, nil
+}
+
+func (r webhookRepo) RemoveWebhook(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return callhome.ErrWebhookNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?;`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type dbDelivery struct {
+	WebhookID  string `db:"webhook_id"`
+	EventID    string `db:"event_id"`
+	EventType  string `db:"event_type"`
+	Attempt    int    `db:"attempt"`
+	Time       string `db:"time"`
+	StatusCode int    `db:"status_code"`
+	Error      string `db:"error"`
+}
+
+// SaveDelivery logs the delivery, unless the webhook was removed meanwhile.
+func (r webhookRepo) SaveDelivery(ctx context.Context, d callhome.Delivery) error {
+	q := `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, time, status_code, error)
+		SELECT :webhook_id, :event_id, :event_type, :attempt, :time, :status_code, :error
+		WHERE EXISTS (SELECT 1 FROM webhooks WHERE id = :webhook_id);`
+	res, err := r.db.NamedExecContext(ctx, q, dbDelivery{
+		WebhookID:  d.WebhookID,
+		EventID:    d.EventID,
+		EventType:  d.EventType,
+		Attempt:    d.Attempt,
+		Time:       formatTime(d.Time),
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+	})
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return callhome.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r webhookRepo) RetrieveDeliveries(ctx context.Context, webhookID string, limit int) ([]callhome.Delivery, error) {
+	q := `SELECT webhook_id, event_id, event_type, attempt, time, status_code, error
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY time DESC, attempt DESC
+		LIMIT ?;`
+	var dbds []dbDelivery
+	if err := r.db.SelectContext(ctx, &dbds, q, webhookID, limit); err != nil {
+		return nil, err
+	}
+	var ret []callhome.Delivery
+	for _, dbd := range dbds {
+		t, err := parseTime(dbd.Time)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, callhome.Delivery{
+			WebhookID:  dbd.WebhookID,
+			EventID:    dbd.EventID,
+			EventType:  dbd.EventType,
+			Attempt:    dbd.Attempt,
+			Time:       t,
+			StatusCode: dbd.StatusCode,
+			Error:      dbd.Error,
+		})
+	}
+	return ret, nil
+}
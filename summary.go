@@ -0,0 +1,69 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import "sort"
+
+// sortSummary orders the values of each dimension from the most deployments,
+// then by value, lists the cities, services and versions in that order, and
+// counts the distinct values. The dimensions are copied before sorting.
+func sortSummary(s TelemetrySummary) TelemetrySummary {
+	s.Countries = append([]CountrySummary(nil), s.Countries...)
+	s.CityCounts = append([]ValueSummary(nil), s.CityCounts...)
+	s.ServiceCounts = append([]ValueSummary(nil), s.ServiceCounts...)
+	s.VersionCounts = append([]ValueSummary(nil), s.VersionCounts...)
+	sort.Slice(s.Countries, func(i, j int) bool {
+		if s.Countries[i].NoDeployments != s.Countries[j].NoDeployments {
+			return s.Countries[i].NoDeployments > s.Countries[j].NoDeployments
+		}
+		return s.Countries[i].Country < s.Countries[j].Country
+	})
+	s.Cities = sortValues(s.CityCounts)
+	s.Services = sortValues(s.ServiceCounts)
+	s.Versions = sortValues(s.VersionCounts)
+	s.Distinct = DistinctValues{
+		Countries: len(s.Countries),
+		Cities:    len(s.CityCounts),
+		Services:  len(s.ServiceCounts),
+		Versions:  len(s.VersionCounts),
+	}
+	return s
+}
+
+func sortValues(counts []ValueSummary) []string {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].NoDeployments != counts[j].NoDeployments {
+			return counts[i].NoDeployments > counts[j].NoDeployments
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	var values []string
+	for _, c := range counts {
+		values = append(values, c.Value)
+	}
+	return values
+}
+
+// Top keeps the n values of each dimension with the most deployments, and all
+// of them if n is zero. TotalDeployments and Distinct still count the dropped
+// values.
+func (s TelemetrySummary) Top(n int) TelemetrySummary {
+	if n <= 0 {
+		return s
+	}
+	if len(s.Countries) > n {
+		s.Countries = s.Countries[:n]
+	}
+	for _, values := range []*[]string{&s.Cities, &s.Services, &s.Versions} {
+		if len(*values) > n {
+			*values = (*values)[:n]
+		}
+	}
+	for _, counts := range []*[]ValueSummary{&s.CityCounts, &s.ServiceCounts, &s.VersionCounts} {
+		if len(*counts) > n {
+			*counts = (*counts)[:n]
+		}
+	}
+	return s
+}
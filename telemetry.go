@@ -5,43 +5,136 @@ package callhome
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/lib/pq"
 )
 
 type Telemetry struct {
-	Services    pq.StringArray `json:"services,omitempty" db:"services"`
-	Service     string         `json:"service,omitempty" db:"service"`
-	Longitude   float64        `json:"longitude,omitempty" db:"longitude"`
-	Latitude    float64        `json:"latitude,omitempty" db:"latitude"`
-	IpAddress   string         `json:"-" db:"ip_address"`
-	MacAddress  string         `json:"-" db:"mac_address"`
-	Version     string         `json:"magistrala_version,omitempty" db:"mg_version"`
-	LastSeen    time.Time      `json:"last_seen" db:"service_time"`
-	Country     string         `json:"country,omitempty" db:"country"`
-	City        string         `json:"city,omitempty" db:"city"`
-	ServiceTime time.Time      `json:"timestamp" db:"time"`
+	// DeploymentID is the random public identifier of the deployment. It
+	// is assigned by the repository and set on retrieval.
+	DeploymentID string         `json:"deployment_id,omitempty" db:"deployment_id"`
+	Services     pq.StringArray `json:"services,omitempty" db:"services"`
+	Service      string         `json:"service,omitempty" db:"service"`
+	Longitude    float64        `json:"longitude,omitempty" db:"longitude"`
+	Latitude     float64        `json:"latitude,omitempty" db:"latitude"`
+	IpAddress    string         `json:"-" db:"ip_address"`
+	MacAddress   string         `json:"-" db:"mac_address"`
+	Version      string         `json:"magistrala_version,omitempty" db:"mg_version"`
+	LastSeen     time.Time      `json:"last_seen" db:"service_time"`
+	Country      string         `json:"country,omitempty" db:"country"`
+	City         string         `json:"city,omitempty" db:"city"`
+	Region       string         `json:"region,omitempty" db:"region"`
+	ServiceTime  time.Time      `json:"timestamp" db:"time"`
 }
 
 type TelemetryFilters struct {
-	From    time.Time
-	To      time.Time
+	From time.Time
+	To   time.Time
+	// Country, City, Version and Service are filter expressions, see
+	// ValueFilter.
 	Country string
 	City    string
 	Version string
 	Service string
+	// BBox keeps the heartbeats located inside the box.
+	BBox *BoundingBox
+	// Near keeps the heartbeats located within the radius of a point.
+	Near *GeoCircle
+	// Continent and SubRegion keep the heartbeats from the countries in
+	// them, see Countries.
+	Continent string
+	SubRegion string
+}
+
+// Validate checks the filter expressions and the geographic filters.
+func (f TelemetryFilters) Validate() error {
+	for _, expr := range []string{f.Country, f.City, f.Service} {
+		if _, err := ParseValueFilter(expr); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseVersionFilter(f.Version); err != nil {
+		return err
+	}
+	if f.BBox != nil && f.BBox.Validate() != nil {
+		return ErrInvalidGeoFilter
+	}
+	if f.Near != nil {
+		if err := f.Near.Validate(); err != nil {
+			return err
+		}
+	}
+	if f.Continent != "" && !IsContinent(f.Continent) {
+		return ErrInvalidGeoFilter
+	}
+	if f.SubRegion != "" && !IsSubRegion(f.SubRegion) {
+		return ErrInvalidGeoFilter
+	}
+	return nil
+}
+
+// ValueFilters parses the filter expressions. Expressions rejected by
+// Validate are matched as a single value.
+func (f TelemetryFilters) ValueFilters() ValueFilters {
+	return ValueFilters{
+		Country: parseOrLiteral(f.Country, ParseValueFilter),
+		City:    parseOrLiteral(f.City, ParseValueFilter),
+		Service: parseOrLiteral(f.Service, ParseValueFilter),
+		Version: parseOrLiteral(f.Version, ParseVersionFilter),
+	}
+}
+
+func parseOrLiteral(expr string, parse func(string) (ValueFilter, error)) ValueFilter {
+	vf, err := parse(expr)
+	if err != nil {
+		return ValueFilter{Values: []string{expr}}
+	}
+	return vf
+}
+
+// MatchesValues reports whether the heartbeat passes the country, city,
+// service and version filters.
+func (f TelemetryFilters) MatchesValues(t Telemetry) bool {
+	vf := f.ValueFilters()
+	return vf.Country.Matches(t.Country) && vf.City.Matches(t.City) &&
+		vf.Service.Matches(t.Service) && vf.Version.Matches(t.Version)
+}
+
+// MatchesLocation reports whether the heartbeat passes the geographic filters.
+func (f TelemetryFilters) MatchesLocation(t Telemetry) bool {
+	if f.BBox != nil && !f.BBox.Contains(t.Longitude, t.Latitude) {
+		return false
+	}
+	if f.Near != nil && !f.Near.Contains(t.Longitude, t.Latitude) {
+		return false
+	}
+	if f.Continent != "" || f.SubRegion != "" {
+		countries := Countries(f.Continent, f.SubRegion)
+		i := sort.SearchStrings(countries, t.Country)
+		return i < len(countries) && countries[i] == t.Country
+	}
+	return true
 }
 
 type PageMetadata struct {
 	Total  uint64
 	Offset uint64
 	Limit  uint64
+	// Cursor is an opaque keyset position produced by PageCursor.String.
+	// If set, Offset is ignored.
+	Cursor string
+	// EstimateTotal trades the exact Total for a fast planner estimate.
+	EstimateTotal bool
 }
 
 type TelemetryPage struct {
 	PageMetadata
 	Telemetry []Telemetry
+	// Next and Prev are cursors of the adjacent pages, empty if there are none.
+	Next string
+	Prev string
 }
 
 type CountrySummary struct {
@@ -49,12 +142,47 @@ type CountrySummary struct {
 	NoDeployments int    `json:"number_of_deployments" db:"count"`
 }
 
+// ValueSummary is the number of deployments reporting a value of a dimension.
+type ValueSummary struct {
+	Value         string `json:"value"`
+	NoDeployments int    `json:"number_of_deployments"`
+}
+
+// DistinctValues is the number of distinct values of each dimension of a
+// summary, including those beyond its limit.
+type DistinctValues struct {
+	Countries int `json:"countries"`
+	Cities    int `json:"cities"`
+	Services  int `json:"services"`
+	Versions  int `json:"versions"`
+}
+
+// TelemetrySummary counts deployments by country, city, service and version.
+// Each dimension is ordered from the most deployments, and then by value.
 type TelemetrySummary struct {
-	Countries        []CountrySummary `json:"countries,omitempty"`
-	Cities           []string         `json:"cities,omitempty"`
-	Services         []string         `json:"services,omitempty"`
-	Versions         []string         `json:"versions,omitempty"`
-	TotalDeployments int              `json:"total_deployments,omitempty"`
+	Countries []CountrySummary `json:"countries,omitempty"`
+	// Cities, Services and Versions are the values of CityCounts, ServiceCounts
+	// and VersionCounts, in the same order.
+	Cities           []string       `json:"cities,omitempty"`
+	Services         []string       `json:"services,omitempty"`
+	Versions         []string       `json:"versions,omitempty"`
+	CityCounts       []ValueSummary `json:"city_counts,omitempty"`
+	ServiceCounts    []ValueSummary `json:"service_counts,omitempty"`
+	VersionCounts    []ValueSummary `json:"version_counts,omitempty"`
+	Distinct         DistinctValues `json:"distinct"`
+	TotalDeployments int            `json:"total_deployments,omitempty"`
+	// Comparison compares the summary with its baseline, if requested.
+	Comparison *SummaryComparison `json:"comparison,omitempty"`
+}
+
+// StoragePolicies describes the chunking, retention and compression policies
+// active on the telemetry store. Zero durations mean the policy is not set.
+type StoragePolicies struct {
+	ChunkInterval      time.Duration
+	RetentionPeriod    time.Duration
+	CompressionEnabled bool
+	CompressAfter      time.Duration
+	CompressSegmentBy  string
 }
 
 // TelemetryRepository specifies an account persistence API.
@@ -64,6 +192,53 @@ type TelemetryRepo interface {
 	Save(ctx context.Context, t Telemetry) error
 	// RetrieveAll retrieves all telemetry events.
 	RetrieveAll(ctx context.Context, pm PageMetadata, filters TelemetryFilters) (TelemetryPage, error)
-	// RetrieveSummary gets distinct countries, cities,services and versions in a summarised form.
+	// RetrieveSummary counts deployments per country and per non-empty city,
+	// service and version, in any order.
 	RetrieveSummary(ctx context.Context, filters TelemetryFilters) (TelemetrySummary, error)
+	// RetrievePolicies gets the storage policies currently active on the repository.
+	RetrievePolicies(ctx context.Context) (StoragePolicies, error)
+	// RetrieveTimeSeries counts distinct deployments reporting in each time bucket.
+	RetrieveTimeSeries(ctx context.Context, q TimeSeriesQuery, filters TelemetryFilters) ([]TimeSeriesBucket, error)
+	// RetrieveVersions gets the number of deployments running each version and
+	// the time each version was first reported.
+	RetrieveVersions(ctx context.Context, filters TelemetryFilters) ([]VersionUsage, error)
+	// RetrieveTransitions counts deployments moving between versions in each
+	// time bucket. Transitions are detected and stored on Save.
+	RetrieveTransitions(ctx context.Context, interval string, filters TelemetryFilters) ([]TransitionBucket, error)
+	// RetrieveTransitionCounts counts deployments moving between each pair of
+	// versions over the whole filtered range, ordered by the source and then
+	// the target version.
+	RetrieveTransitionCounts(ctx context.Context, filters TelemetryFilters) ([]TransitionCount, error)
+	// RetrieveActivity gets the time buckets each deployment reported in,
+	// ordered by deployment and then by time.
+	RetrieveActivity(ctx context.Context, interval string, filters TelemetryFilters) ([]ActivityBucket, error)
+	// RetrieveAggregate groups heartbeats and measures each group, as
+	// specified by the query.
+	RetrieveAggregate(ctx context.Context, q AggregateQuery, filters TelemetryFilters) ([]AggregateRow, error)
+	// CountHeartbeats counts the heartbeats matching the filters.
+	CountHeartbeats(ctx context.Context, filters TelemetryFilters) (int, error)
+	// RetrieveServiceSets counts deployments by the set of services they run,
+	// most common first. The service filter selects deployments running the
+	// service, along with all their other services.
+	RetrieveServiceSets(ctx context.Context, filters TelemetryFilters) ([]ServiceSet, error)
+	// RetrieveDeployment gets the identity, location, services and version
+	// history of the deployment with the given ID. ErrDeploymentNotFound is
+	// returned if the deployment never reported.
+	RetrieveDeployment(ctx context.Context, id string) (Deployment, error)
+	// RetrieveHeartbeats gets the distinct times the deployment with the given
+	// ID reported at, in ascending order.
+	RetrieveHeartbeats(ctx context.Context, id string, filters TelemetryFilters) ([]time.Time, error)
+	// RetrieveLastSeen gets when each deployment first and last reported and
+	// how many times, ordered from the most recently seen.
+	RetrieveLastSeen(ctx context.Context, filters TelemetryFilters) ([]DeploymentSeen, error)
+	// RetrieveClientsSeen gets when each client, a service of a deployment
+	// reporting from one MAC address, first and last reported and how many
+	// times, ordered by deployment ID, MAC address and service.
+	RetrieveClientsSeen(ctx context.Context, filters TelemetryFilters) ([]ClientSeen, error)
+	// ExportTelemetry calls fn with each heartbeat matching the filters, or
+	// with the latest heartbeat of each deployment and all the services it
+	// reported in the time range, including those the value filters exclude,
+	// in ascending time order, without holding the rows in memory. It stops
+	// at the first error fn returns.
+	ExportTelemetry(ctx context.Context, rows string, filters TelemetryFilters, fn func(Telemetry) error) error
 }
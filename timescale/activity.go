@@ -0,0 +1,54 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// RetrieveActivity gets the time buckets each deployment reported in.
+func (r repo) RetrieveActivity(ctx context.Context, interval string, filters callhome.TelemetryFilters) ([]callhome.ActivityBucket, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.ActivityBucket, error) {
+		return retrieveActivity(ctx, db, interval, filters)
+	})
+}
+
+func retrieveActivity(ctx context.Context, db *sqlx.DB, interval string, filters callhome.TelemetryFilters) ([]callhome.ActivityBucket, error) {
+	width, ok := bucketWidths[interval]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	filterQuery, params := generateQuery(filters)
+
+	q := fmt.Sprintf(`
+		SELECT DISTINCT ip_address, time_bucket(INTERVAL '%s', time) AS bucket
+		FROM telemetry
+		%s
+		ORDER BY ip_address, bucket;
+	`, width, filterQuery)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []callhome.ActivityBucket
+	for rows.Next() {
+		var res struct {
+			IpAddress string    `db:"ip_address"`
+			Bucket    time.Time `db:"bucket"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		activity = append(activity, callhome.ActivityBucket{Time: res.Bucket.UTC(), IpAddress: res.IpAddress})
+	}
+	return activity, rows.Err()
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// aggregateGroups maps aggregate groupings to telemetry expressions.
+var aggregateGroups = map[string]string{
+	callhome.GroupByCountry: "COALESCE(country, '')",
+	callhome.GroupByCity:    "COALESCE(city, '')",
+	callhome.GroupByRegion:  "COALESCE(region, '')",
+	callhome.GroupByService: "service",
+	callhome.GroupByVersion: "COALESCE(mg_version, '')",
+	callhome.GroupByWeek:    fmt.Sprintf("time_bucket(INTERVAL '%s', time)", bucketWidths[callhome.IntervalWeek]),
+}
+
+// aggregateMetrics maps aggregate metrics to aggregate functions.
+var aggregateMetrics = map[string]string{
+	callhome.MetricDeployments: "COUNT(DISTINCT ip_address)",
+	callhome.MetricHeartbeats:  "COUNT(*)",
+}
+
+// RetrieveAggregate groups heartbeats and measures each group.
+func (r repo) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) ([]callhome.AggregateRow, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.AggregateRow, error) {
+		return retrieveAggregate(ctx, db, q, filters)
+	})
+}
+
+func retrieveAggregate(ctx context.Context, db *sqlx.DB, q callhome.AggregateQuery, filters callhome.TelemetryFilters) ([]callhome.AggregateRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	q = q.WithDefaults()
+	filterQuery, params := generateQuery(filters)
+
+	// Expressions are taken from the maps, never from the input.
+	var selects, groups, fields []string
+	for i, g := range q.GroupBy {
+		selects = append(selects, fmt.Sprintf("%s AS g%d", aggregateGroups[g], i))
+		groups = append(groups, fmt.Sprintf("g%d", i))
+	}
+	for i, m := range q.Metrics {
+		selects = append(selects, fmt.Sprintf("%s AS m%d", aggregateMetrics[m], i))
+		fields = append(fields, fmt.Sprintf("m%d", i))
+	}
+	order := aggregateOrder(q, groups, fields)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM telemetry
+		%s
+		GROUP BY %s
+		ORDER BY %s
+		LIMIT :top;
+	`, strings.Join(selects, ", "), filterQuery, strings.Join(groups, ", "), order)
+	params["top"] = q.Top
+
+	rows, err := db.NamedQueryContext(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []callhome.AggregateRow
+	for rows.Next() {
+		row := callhome.AggregateRow{
+			Groups:  make([]string, len(q.GroupBy)),
+			Metrics: make([]int, len(q.Metrics)),
+		}
+		values := make([]interface{}, len(q.GroupBy))
+		dest := make([]interface{}, 0, len(selects))
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		for i := range row.Metrics {
+			dest = append(dest, &row.Metrics[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			switch v := v.(type) {
+			case time.Time:
+				row.Groups[i] = v.UTC().Format(time.RFC3339)
+			case []byte:
+				row.Groups[i] = string(v)
+			case string:
+				row.Groups[i] = v
+			}
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
+
+// CountHeartbeats counts the heartbeats matching the filters.
+func (r repo) CountHeartbeats(ctx context.Context, filters callhome.TelemetryFilters) (int, error) {
+	return read(ctx, r, func(db *sqlx.DB) (int, error) {
+		return countHeartbeats(ctx, db, filters)
+	})
+}
+
+func countHeartbeats(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) (int, error) {
+	filterQuery, params := generateQuery(filters)
+	q := fmt.Sprintf(`SELECT COUNT(*) FROM telemetry %s;`, filterQuery)
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, rows.Err()
+}
+
+// aggregateOrder orders rows by the grouping or metric of the query, and then
+// by the groups.
+func aggregateOrder(q callhome.AggregateQuery, groups, fields []string) string {
+	by, desc := q.OrderBy()
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	order := []string{}
+	for i, g := range q.GroupBy {
+		if g == by {
+			order = append(order, fmt.Sprintf("%s %s", groups[i], dir))
+		}
+	}
+	for i, m := range q.Metrics {
+		if m == by {
+			order = append(order, fmt.Sprintf("%s %s", fields[i], dir))
+		}
+	}
+	return strings.Join(append(order, groups...), ", ")
+}
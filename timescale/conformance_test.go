@@ -0,0 +1,82 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/clients/postgres"
+	"github.com/absmach/callhome/repotest"
+	"github.com/absmach/callhome/timescale"
+	"github.com/stretchr/testify/require"
+)
+
+// testPrefix prefixes the connection configuration of the TimescaleDB instance
+// the conformance suite runs against, e.g. MG_CALLHOME_TEST_TIMESCALE_HOST.
+const testPrefix = "MG_CALLHOME_TEST_"
+
+func TestConformance(t *testing.T) {
+	if os.Getenv(testPrefix+"TIMESCALE_HOST") == "" {
+		t.Skipf("%sTIMESCALE_HOST is not set", testPrefix)
+	}
+	db, err := postgres.Setup(testPrefix, timescale.Migration())
+	require.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	repotest.Run(t, func(t *testing.T) callhome.TelemetryRepo {
+		_, err := db.Exec(`TRUNCATE telemetry, version_transitions, deployments;`)
+		require.Nil(t, err)
+		return timescale.New(db)
+	})
+	t.Run("export legacy heartbeats", func(t *testing.T) {
+		_, err := db.Exec(`TRUNCATE telemetry, version_transitions, deployments;`)
+		require.Nil(t, err)
+		// Heartbeats stored before services, versions and locations were
+		// required.
+		_, err = db.Exec(`INSERT INTO deployments (ip_address) VALUES ('10.0.0.1');`)
+		require.Nil(t, err)
+		_, err = db.Exec(`INSERT INTO telemetry (time, service_time, ip_address, longitude, latitude, mg_version, service, country, city)
+			VALUES (now(), now(), '10.0.0.1', 0, 0, NULL, NULL, NULL, NULL);`)
+		require.Nil(t, err)
+
+		repo := timescale.New(db)
+		for _, rows := range []string{callhome.ExportHeartbeats, callhome.ExportDeployments} {
+			var export []callhome.Telemetry
+			err := repo.ExportTelemetry(context.Background(), rows, callhome.TelemetryFilters{From: time.Now().Add(-time.Hour)}, func(tel callhome.Telemetry) error {
+				export = append(export, tel)
+				return nil
+			})
+			require.Nil(t, err, rows)
+			require.Len(t, export, 1, rows)
+			require.Empty(t, export[0].Service, rows)
+			require.Empty(t, export[0].Version, rows)
+		}
+	})
+	t.Run("transitions from legacy heartbeats", func(t *testing.T) {
+		_, err := db.Exec(`TRUNCATE telemetry, version_transitions, deployments;`)
+		require.Nil(t, err)
+		_, err = db.Exec(`INSERT INTO deployments (ip_address) VALUES ('10.0.0.1');`)
+		require.Nil(t, err)
+		_, err = db.Exec(`INSERT INTO telemetry (time, service_time, ip_address, longitude, latitude, mg_version, service)
+			VALUES (now() - INTERVAL '1 hour', now() - INTERVAL '1 hour', '10.0.0.1', 0, 0, '0.13.0', NULL);`)
+		require.Nil(t, err)
+
+		// A heartbeat without a service follows the legacy ones.
+		repo := timescale.New(db)
+		now := time.Now()
+		require.Nil(t, repo.Save(context.Background(), callhome.Telemetry{IpAddress: "10.0.0.1", Version: "0.14.0", ServiceTime: now, LastSeen: now}))
+		counts, err := repo.RetrieveTransitionCounts(context.Background(), callhome.TelemetryFilters{From: now.Add(-2 * time.Hour)})
+		require.Nil(t, err)
+		require.Equal(t, []callhome.TransitionCount{{From: "0.13.0", To: "0.14.0", Deployments: 1}}, counts)
+	})
+	repotest.RunWebhooks(t, func(t *testing.T) callhome.WebhookRepo {
+		_, err := db.Exec(`TRUNCATE webhooks, webhook_deliveries;`)
+		require.Nil(t, err)
+		return timescale.NewWebhookRepo(db)
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// RetrieveDeployment gets the identity, location, services and version history of a deployment.
+func (r repo) RetrieveDeployment(ctx context.Context, id string) (callhome.Deployment, error) {
+	return read(ctx, r, func(db *sqlx.DB) (callhome.Deployment, error) {
+		return retrieveDeployment(ctx, db, id)
+	})
+}
+
+func retrieveDeployment(ctx context.Context, db *sqlx.DB, id string) (callhome.Deployment, error) {
+	params := map[string]interface{}{"id": id}
+
+	q := `
+		SELECT t.ip_address, t.time, t.service_time, t.longitude, t.latitude, t.mg_version, t.country, t.city,
+			(SELECT ARRAY_AGG(DISTINCT service) FILTER (WHERE service <> '') FROM telemetry WHERE ip_address = t.ip_address) AS services,
+			(SELECT MIN(time) FROM telemetry WHERE ip_address = t.ip_address) AS first_seen
+		FROM telemetry t
+		WHERE t.ip_address = (SELECT ip_address FROM deployments WHERE id = :id)
+		ORDER BY t.time DESC
+		LIMIT 1;
+	`
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return callhome.Deployment{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return callhome.Deployment{}, err
+		}
+		return callhome.Deployment{}, callhome.ErrDeploymentNotFound
+	}
+	var latest struct {
+		callhome.Telemetry
+		FirstSeen time.Time `db:"first_seen"`
+	}
+	if err := rows.StructScan(&latest); err != nil {
+		return callhome.Deployment{}, err
+	}
+	d := callhome.Deployment{ID: id, Latest: latest.Telemetry, FirstSeen: latest.FirstSeen.UTC()}
+
+	q = `
+		SELECT mg_version, MIN(time) AS first_seen, MAX(time) AS last_seen
+		FROM telemetry
+		WHERE ip_address = (SELECT ip_address FROM deployments WHERE id = :id) AND mg_version <> ''
+		GROUP BY mg_version
+		ORDER BY first_seen;
+	`
+	vrows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return callhome.Deployment{}, err
+	}
+	defer vrows.Close()
+
+	for vrows.Next() {
+		var res struct {
+			Version   string    `db:"mg_version"`
+			FirstSeen time.Time `db:"first_seen"`
+			LastSeen  time.Time `db:"last_seen"`
+		}
+		if err := vrows.StructScan(&res); err != nil {
+			return callhome.Deployment{}, err
+		}
+		d.Versions = append(d.Versions, callhome.VersionPeriod{Version: res.Version, FirstSeen: res.FirstSeen.UTC(), LastSeen: res.LastSeen.UTC()})
+	}
+	return d, vrows.Err()
+}
+
+// RetrieveHeartbeats gets the distinct times a deployment reported at.
+func (r repo) RetrieveHeartbeats(ctx context.Context, id string, filters callhome.TelemetryFilters) ([]time.Time, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]time.Time, error) {
+		return retrieveHeartbeats(ctx, db, id, filters)
+	})
+}
+
+func retrieveHeartbeats(ctx context.Context, db *sqlx.DB, id string, filters callhome.TelemetryFilters) ([]time.Time, error) {
+	filterQuery, params := deploymentQuery(id, filters)
+
+	q := fmt.Sprintf(`SELECT DISTINCT time FROM telemetry %s ORDER BY time;`, filterQuery)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var beats []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		beats = append(beats, t.UTC())
+	}
+	return beats, rows.Err()
+}
+
+// deploymentQuery narrows the filter query down to a single deployment.
+func deploymentQuery(id string, filters callhome.TelemetryFilters) (string, map[string]interface{}) {
+	filterQuery, params := generateQuery(filters)
+	params["id"] = id
+	return andWhere(filterQuery, "ip_address = (SELECT ip_address FROM deployments WHERE id = :id)"), params
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// exportBatch is the number of rows fetched from the export cursor at once,
+// which bounds the memory used by exports.
+const exportBatch = 1000
+
+// ExportTelemetry streams the heartbeats or deployments through a server-side cursor.
+func (r repo) ExportTelemetry(ctx context.Context, rows string, filters callhome.TelemetryFilters, fn func(callhome.Telemetry) error) error {
+	// Rows are streamed as they are read, so an export cannot fall back to
+	// the primary once it started on the replica.
+	db := r.db
+	if r.replica != nil && r.replica.available(ctx) {
+		db = r.replica.db
+	}
+	return exportTelemetry(ctx, db, rows, filters, fn)
+}
+
+func exportTelemetry(ctx context.Context, db *sqlx.DB, rows string, filters callhome.TelemetryFilters, fn func(callhome.Telemetry) error) error {
+	filterQuery, params := generateQuery(filters)
+	rangeQuery, _ := generateQuery(callhome.TelemetryFilters{From: filters.From, To: filters.To})
+	q := fmt.Sprintf(`
+		SELECT (SELECT id FROM deployments d WHERE d.ip_address = telemetry.ip_address) AS deployment_id,
+			ip_address, time, service_time, longitude, latitude, COALESCE(mg_version, '') AS mg_version,
+			COALESCE(country, '') AS country, COALESCE(city, '') AS city, COALESCE(region, '') AS region,
+			COALESCE(service, '') AS service, NULL::text[] AS services
+		FROM telemetry
+		%s
+		ORDER BY time, deployment_id, service
+	`, filterQuery)
+	if rows == callhome.ExportDeployments {
+		q = fmt.Sprintf(`
+		WITH latest_per_ip AS (
+			SELECT DISTINCT ON (ip_address) ip_address, time, service_time, longitude, latitude, mg_version, country, city, region
+			FROM telemetry
+			%s
+			ORDER BY ip_address, time DESC
+		),
+		services_per_ip AS (
+			SELECT ip_address, ARRAY_AGG(DISTINCT service) FILTER (WHERE service <> '') AS services
+			FROM telemetry
+			%s
+			GROUP BY ip_address
+		)
+		SELECT d.id AS deployment_id, lpi.ip_address, lpi.time, lpi.service_time, lpi.longitude, lpi.latitude, COALESCE(lpi.mg_version, '') AS mg_version,
+			COALESCE(lpi.country, '') AS country, COALESCE(lpi.city, '') AS city, COALESCE(lpi.region, '') AS region,
+			'' AS service, s.services
+		FROM latest_per_ip lpi
+		INNER JOIN deployments d ON d.ip_address = lpi.ip_address
+		LEFT JOIN services_per_ip s ON s.ip_address = lpi.ip_address
+		ORDER BY lpi.time, d.id
+		`, filterQuery, andWhere(rangeQuery, "ip_address IN (SELECT ip_address FROM latest_per_ip)"))
+	}
+
+	// Cursors only exist within a transaction.
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	if _, err := tx.NamedExecContext(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+q, params); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH %d FROM export_cursor;", exportBatch)
+	for {
+		n, err := fetchExport(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportBatch {
+			return tx.Commit()
+		}
+	}
+}
+
+// fetchExport calls fn with each fetched row and returns the number of rows.
+func fetchExport(ctx context.Context, tx *sqlx.Tx, fetch string, fn func(callhome.Telemetry) error) (int, error) {
+	rows, err := tx.QueryxContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var t callhome.Telemetry
+		if err := rows.StructScan(&t); err != nil {
+			return n, err
+		}
+		n++
+		if err := fn(t); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/absmach/callhome/internal/sqlfilter"
+	"github.com/lib/pq"
+)
+
+// dialect compares versions as numeric arrays, which fit any version number.
+var dialect = sqlfilter.Dialect{
+	VersionKey: versionKeyQuery,
+	KeyParam: func(name string, key []uint64) (string, interface{}) {
+		nums := make(pq.StringArray, len(key))
+		for i, n := range key {
+			nums[i] = strconv.FormatUint(n, 10)
+		}
+		return fmt.Sprintf("CAST(:%s AS NUMERIC[])", name), nums
+	},
+}
+
+const (
+	// versionPattern matches the versions semver.Parse accepts.
+	versionPattern = `^\s*v?[0-9]+(\.[0-9]+){0,2}(-[^+]+)?(\+.*)?\s*$`
+	// numbersPattern captures the major, minor and patch numbers of a version.
+	numbersPattern = `^\s*v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?`
+	// prereleasePattern matches pre-releases.
+	prereleasePattern = `^\s*v?[0-9.]+-`
+)
+
+// versionKeyQuery is the callhome.VersionKey of the version in the column,
+// NULL if it is not semantic. Omitted minor and patch numbers are zero.
+func versionKeyQuery(column string) string {
+	return fmt.Sprintf(`(CASE WHEN %[1]s ~ '%[2]s' THEN CAST(array_replace(regexp_match(%[1]s, '%[3]s'), NULL, '0') || CASE WHEN %[1]s ~ '%[4]s' THEN '0' ELSE '1' END AS NUMERIC[]) END)`,
+		column, versionPattern, numbersPattern, prereleasePattern)
+}
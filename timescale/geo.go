@@ -0,0 +1,60 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"fmt"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/sqlfilter"
+)
+
+// distanceQuery is the haversine distance in kilometres of a heartbeat from
+// the center of the near filter. The haversine is capped at one, which
+// rounding errors may exceed for antipodal points.
+var distanceQuery = fmt.Sprintf(`2 * %g * ASIN(SQRT(LEAST(1,
+	POWER(SIN(RADIANS(latitude - :near_latitude) / 2), 2) +
+	COS(RADIANS(:near_latitude)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - :near_longitude) / 2), 2))))`, callhome.EarthRadius)
+
+// geoQueries appends the conditions of the geographic filters to the queries.
+// The near filter is narrowed to its bounding box first, so the location
+// index is used before distances are computed. Continents and sub-regions
+// are matched by their countries.
+func geoQueries(queries []string, params map[string]interface{}, filters callhome.TelemetryFilters) []string {
+	if filters.BBox != nil {
+		queries = append(queries, bboxQuery("bbox", *filters.BBox, params))
+	}
+	if c := filters.Near; c != nil {
+		queries = append(queries, bboxQuery("near", c.Bounds(), params))
+		queries = append(queries, distanceQuery+" <= :near_radius")
+		params["near_latitude"] = c.Latitude
+		params["near_longitude"] = c.Longitude
+		params["near_radius"] = c.Radius
+	}
+	if filters.Continent != "" || filters.SubRegion != "" {
+		queries = append(queries, countriesQuery(callhome.Countries(filters.Continent, filters.SubRegion), params))
+	}
+	return queries
+}
+
+// bboxQuery matches the heartbeats inside the box, which crosses the
+// antimeridian if its west is greater than its east.
+func bboxQuery(name string, b callhome.BoundingBox, params map[string]interface{}) string {
+	params[name+"_west"] = b.West
+	params[name+"_south"] = b.South
+	params[name+"_east"] = b.East
+	params[name+"_north"] = b.North
+	op := "AND"
+	if b.West > b.East {
+		op = "OR"
+	}
+	return fmt.Sprintf("latitude BETWEEN :%[1]s_south AND :%[1]s_north AND (longitude >= :%[1]s_west %[2]s longitude <= :%[1]s_east)", name, op)
+}
+
+func countriesQuery(countries []string, params map[string]interface{}) string {
+	if len(countries) == 0 {
+		return "FALSE"
+	}
+	return fmt.Sprintf("country IN (%s)", sqlfilter.ListParams("geo_country", countries, params))
+}
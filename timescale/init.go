@@ -99,6 +99,135 @@ func Migration() migrate.MemoryMigrationSource {
 					`SELECT add_retention_policy('telemetry', INTERVAL '90 days');`,
 				},
 			},
+			{
+				// Replaces the time-only primary key, on which heartbeats sharing a
+				// timestamp collide, with a key over deployment, service and time.
+				// Missing MAC addresses and services are keyed as empty, which new
+				// heartbeats default to, so existing rows are not rewritten.
+				// TimescaleDB builds unique indexes in a single transaction, so
+				// writes wait until the index covers the existing chunks.
+				//
+				// The migration is irreversible, since heartbeats sharing a
+				// timestamp no longer fit the time-only primary key.
+				Id: "telemetry_8",
+				Up: []string{
+					`ALTER TABLE telemetry ALTER COLUMN mac_address SET DEFAULT '';`,
+					`ALTER TABLE telemetry ALTER COLUMN service SET DEFAULT '';`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS telemetry_deployment_service_time_key
+						ON telemetry (ip_address, COALESCE(mac_address, ''), COALESCE(service, ''), time);`,
+					`ALTER TABLE telemetry DROP CONSTRAINT IF EXISTS telemetry_pkey;`,
+				},
+				Down: []string{
+					`DO $$ BEGIN
+						RAISE EXCEPTION 'telemetry_8 is irreversible: heartbeats sharing a timestamp do not fit the time primary key';
+					END $$;`,
+				},
+			},
+			{
+				// Version transitions are detected on save from then on, and
+				// backfilled here from the heartbeats already stored.
+				Id: "telemetry_9",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS version_transitions (
+						time			TIMESTAMPTZ	NOT NULL,
+						ip_address		TEXT		NOT NULL,
+						mac_address		TEXT		NOT NULL DEFAULT '',
+						service			TEXT		NOT NULL DEFAULT '',
+						from_version	TEXT		NOT NULL,
+						to_version		TEXT		NOT NULL,
+						country			TEXT,
+						city			TEXT,
+						PRIMARY KEY (ip_address, mac_address, service, time)
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_version_transitions_time ON version_transitions (time DESC);`,
+					`INSERT INTO version_transitions (time, ip_address, mac_address, service, from_version, to_version, country, city)
+						SELECT time, ip_address, mac_address, service, prev, mg_version, country, city
+						FROM (
+							SELECT time, ip_address, COALESCE(mac_address, '') AS mac_address, COALESCE(service, '') AS service,
+								mg_version, country, city,
+								LAG(mg_version) OVER (
+									PARTITION BY ip_address, COALESCE(mac_address, ''), COALESCE(service, '') ORDER BY time
+								) AS prev
+							FROM telemetry
+							WHERE mg_version <> ''
+						) heartbeats
+						WHERE prev <> mg_version
+						ON CONFLICT DO NOTHING;`,
+				},
+				Down: []string{"DROP TABLE IF EXISTS version_transitions;"},
+			},
+			{
+				// Deployments are identified publicly by a random ID, which does
+				// not reveal their IP address. It is assigned on the first save,
+				// and backfilled here for the deployments already stored.
+				Id: "telemetry_10",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS deployments (
+						ip_address	TEXT	PRIMARY KEY,
+						id			TEXT	NOT NULL UNIQUE DEFAULT replace(gen_random_uuid()::text, '-', '')
+					);`,
+					`INSERT INTO deployments (ip_address)
+						SELECT DISTINCT ip_address FROM telemetry
+						ON CONFLICT DO NOTHING;`,
+				},
+				Down: []string{"DROP TABLE IF EXISTS deployments;"},
+			},
+			{
+				// Regions are only known for heartbeats saved from then on.
+				Id: "telemetry_11",
+				Up: []string{
+					`ALTER TABLE telemetry ADD COLUMN IF NOT EXISTS region TEXT;`,
+				},
+				Down: []string{"ALTER TABLE telemetry DROP COLUMN IF EXISTS region;"},
+			},
+			{
+				Id: "telemetry_12",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS webhooks (
+						id			TEXT		PRIMARY KEY,
+						url			TEXT		NOT NULL,
+						secret		TEXT		NOT NULL,
+						events		TEXT[]		NOT NULL,
+						created_at	TIMESTAMPTZ	NOT NULL
+					);`,
+					`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+						webhook_id	TEXT		NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+						event_id	TEXT		NOT NULL,
+						event_type	TEXT		NOT NULL,
+						attempt		INTEGER		NOT NULL,
+						time		TIMESTAMPTZ	NOT NULL,
+						status_code	INTEGER		NOT NULL DEFAULT 0,
+						error		TEXT		NOT NULL DEFAULT '',
+						PRIMARY KEY (webhook_id, event_id, attempt)
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_time ON webhook_deliveries (webhook_id, time DESC);`,
+				},
+				Down: []string{
+					"DROP TABLE IF EXISTS webhook_deliveries;",
+					"DROP TABLE IF EXISTS webhooks;",
+				},
+			},
+			{
+				// Geographic filters narrow heartbeats by latitude before the
+				// longitude and the distance are checked. Transitions are located
+				// from then on, and backfilled here from their heartbeats.
+				Id: "telemetry_13",
+				Up: []string{
+					`CREATE INDEX IF NOT EXISTS idx_telemetry_location ON telemetry (latitude, longitude);`,
+					`ALTER TABLE version_transitions ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;`,
+					`ALTER TABLE version_transitions ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;`,
+					`UPDATE version_transitions vt
+						SET latitude = t.latitude, longitude = t.longitude
+						FROM telemetry t
+						WHERE t.ip_address = vt.ip_address AND COALESCE(t.mac_address, '') = vt.mac_address
+							AND COALESCE(t.service, '') = vt.service AND t.time = vt.time;`,
+				},
+				Down: []string{
+					"ALTER TABLE version_transitions DROP COLUMN IF EXISTS longitude;",
+					"ALTER TABLE version_transitions DROP COLUMN IF EXISTS latitude;",
+					"DROP INDEX IF EXISTS idx_telemetry_location;",
+				},
+			},
 		},
 	}
 }
@@ -0,0 +1,282 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/semver"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	hypertable         = "telemetry"
+	retentionProc      = "policy_retention"
+	compressionProc    = "policy_compression"
+	retentionConfigKey = "drop_after"
+	compressConfigKey  = "compress_after"
+	// minCompressionVersion is the first TimescaleDB version providing the
+	// hypertable_compression_settings view compression settings are read from.
+	minCompressionVersion = "2.14.0"
+)
+
+var (
+	// ErrPolicy indicates a failure to reconcile storage policies.
+	ErrPolicy = errors.New("failed to reconcile storage policies")
+	// ErrInvalidPolicy indicates an invalid storage policy configuration.
+	ErrInvalidPolicy = errors.New("invalid storage policy configuration")
+	// ErrUnsupportedVersion indicates a TimescaleDB version older than
+	// minCompressionVersion, which compression is not reconciled with.
+	ErrUnsupportedVersion = errors.New("compression requires TimescaleDB " + minCompressionVersion + " or later")
+)
+
+// keyColumns are the columns of the telemetry unique key besides time. Compression
+// requires each of them to be either segmented or ordered by.
+var keyColumns = []string{"ip_address", "mac_address", "service"}
+
+// segmentByColumns lists the columns telemetry compression may be segmented by.
+var segmentByColumns = map[string]bool{
+	"ip_address": true,
+	"service":    true,
+	"mg_version": true,
+	"country":    true,
+}
+
+// PolicyConfig defines the storage policies applied to the telemetry hypertable.
+// A zero RetentionPeriod disables retention.
+type PolicyConfig struct {
+	ChunkInterval      time.Duration `env:"TIMESCALE_CHUNK_INTERVAL"       envDefault:"24h"`
+	RetentionPeriod    time.Duration `env:"TIMESCALE_RETENTION_PERIOD"     envDefault:"8760h"`
+	CompressionEnabled bool          `env:"TIMESCALE_COMPRESSION_ENABLED"  envDefault:"false"`
+	CompressAfter      time.Duration `env:"TIMESCALE_COMPRESS_AFTER"       envDefault:"168h"`
+	CompressSegmentBy  string        `env:"TIMESCALE_COMPRESS_SEGMENT_BY"  envDefault:"ip_address"`
+}
+
+func (cfg PolicyConfig) validate() error {
+	if cfg.ChunkInterval <= 0 || cfg.RetentionPeriod < 0 {
+		return ErrInvalidPolicy
+	}
+	if cfg.CompressionEnabled {
+		if cfg.CompressAfter <= 0 || !segmentByColumns[cfg.CompressSegmentBy] {
+			return ErrInvalidPolicy
+		}
+	}
+	return nil
+}
+
+// ReconcilePolicies brings the chunk interval, retention and compression policies
+// of the telemetry hypertable in line with the given configuration. Policies that
+// already match are left untouched, so it is safe to call on every startup.
+// Disabling compression decompresses the compressed chunks. Enabling it
+// requires TimescaleDB 2.14 or later.
+func ReconcilePolicies(ctx context.Context, db *sqlx.DB, cfg PolicyConfig) (err error) {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(ErrPolicy, err.Error())
+	}
+	defer func() {
+		if err != nil {
+			if txErr := tx.Rollback(); txErr != nil {
+				err = errors.Wrap(err, errors.Wrap(ErrTransRollback, txErr.Error()).Error())
+			}
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			err = errors.Wrap(ErrPolicy, err.Error())
+		}
+	}()
+
+	// Changing the chunk interval only affects chunks created afterwards.
+	if _, err := tx.ExecContext(ctx, `SELECT set_chunk_time_interval($1, make_interval(secs => $2));`, hypertable, cfg.ChunkInterval.Seconds()); err != nil {
+		return errors.Wrap(ErrPolicy, err.Error())
+	}
+
+	if err := reconcileJob(ctx, tx, retentionProc, retentionConfigKey, "add_retention_policy", "remove_retention_policy", cfg.RetentionPeriod); err != nil {
+		return errors.Wrap(ErrPolicy, err.Error())
+	}
+
+	compressAfter := time.Duration(0)
+	if cfg.CompressionEnabled {
+		if err := checkCompressionVersion(ctx, tx); err != nil {
+			return errors.Wrap(ErrPolicy, err.Error())
+		}
+		if err := enableCompression(ctx, tx, cfg.CompressSegmentBy); err != nil {
+			return errors.Wrap(ErrPolicy, err.Error())
+		}
+		compressAfter = cfg.CompressAfter
+	}
+	if err := reconcileJob(ctx, tx, compressionProc, compressConfigKey, "add_compression_policy", "remove_compression_policy", compressAfter); err != nil {
+		return errors.Wrap(ErrPolicy, err.Error())
+	}
+	// Compression can only be disabled once its policy is removed.
+	if !cfg.CompressionEnabled {
+		if err := disableCompression(ctx, tx); err != nil {
+			return errors.Wrap(ErrPolicy, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// checkCompressionVersion makes sure the installed TimescaleDB version is at
+// least minCompressionVersion.
+func checkCompressionVersion(ctx context.Context, tx *sqlx.Tx) error {
+	var version string
+	if err := tx.QueryRowxContext(ctx, `SELECT extversion FROM pg_extension WHERE extname = 'timescaledb';`).Scan(&version); err != nil {
+		return err
+	}
+	if !compressionSupported(version) {
+		return errors.Wrap(ErrUnsupportedVersion, version)
+	}
+	return nil
+}
+
+// compressionSupported reports whether the TimescaleDB version is at least
+// minCompressionVersion.
+func compressionSupported(version string) bool {
+	return semver.Compare(version, minCompressionVersion) >= 0
+}
+
+// reconcileJob makes sure the background job of the given policy procedure runs
+// with the given interval, or is removed when the interval is zero.
+func reconcileJob(ctx context.Context, tx *sqlx.Tx, proc, key, add, remove string, interval time.Duration) error {
+	q := fmt.Sprintf(`SELECT (config->>'%s')::interval = make_interval(secs => $1)
+		FROM timescaledb_information.jobs
+		WHERE proc_name = $2 AND hypertable_name = $3;`, key)
+
+	var matches bool
+	err := tx.QueryRowxContext(ctx, q, interval.Seconds(), proc, hypertable).Scan(&matches)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if interval <= 0 {
+			return nil
+		}
+	case err != nil:
+		return err
+	case matches && interval > 0:
+		return nil
+	default:
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`SELECT %s($1);`, remove), hypertable); err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return nil
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`SELECT %s($1, make_interval(secs => $2));`, add), hypertable, interval.Seconds())
+	return err
+}
+
+// enableCompression turns on compression for the hypertable unless it is
+// already enabled with the same segmentation.
+func enableCompression(ctx context.Context, tx *sqlx.Tx, segmentBy string) error {
+	q := `SELECT COALESCE(segmentby, '')
+		FROM timescaledb_information.hypertable_compression_settings
+		WHERE hypertable = $1::regclass;`
+
+	var current string
+	err := tx.QueryRowxContext(ctx, q, hypertable).Scan(&current)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	case current == segmentBy:
+		return nil
+	}
+
+	var orderBy []string
+	for _, col := range keyColumns {
+		if col != segmentBy {
+			orderBy = append(orderBy, col)
+		}
+	}
+	orderBy = append(orderBy, "time DESC")
+
+	// Column name is validated against segmentByColumns.
+	q = fmt.Sprintf(`ALTER TABLE %s SET (
+		timescaledb.compress,
+		timescaledb.compress_segmentby = '%s',
+		timescaledb.compress_orderby = '%s'
+	);`, hypertable, segmentBy, strings.Join(orderBy, ", "))
+	_, err = tx.ExecContext(ctx, q)
+	return err
+}
+
+// disableCompression turns off compression for the hypertable if it is
+// enabled, decompressing the chunks compressed so far.
+func disableCompression(ctx context.Context, tx *sqlx.Tx) error {
+	q := `SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_name = $1;`
+
+	var enabled bool
+	if err := tx.QueryRowxContext(ctx, q, hypertable).Scan(&enabled); err != nil || !enabled {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT decompress_chunk(c, true) FROM show_chunks($1::regclass) c;`, hypertable); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s SET (timescaledb.compress = false);`, hypertable))
+	return err
+}
+
+// RetrievePolicies gets the storage policies currently active on the telemetry
+// hypertable. The compression segmentation is only read from TimescaleDB 2.14
+// or later, and is left empty on earlier versions.
+func (r repo) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	q := `
+	SELECT
+		(SELECT EXTRACT(EPOCH FROM time_interval) FROM timescaledb_information.dimensions
+			WHERE hypertable_name = $1 AND column_name = 'time') AS chunk_interval,
+		(SELECT EXTRACT(EPOCH FROM (config->>'drop_after')::interval) FROM timescaledb_information.jobs
+			WHERE proc_name = 'policy_retention' AND hypertable_name = $1) AS retention_period,
+		(SELECT compression_enabled FROM timescaledb_information.hypertables
+			WHERE hypertable_name = $1) AS compression_enabled,
+		(SELECT EXTRACT(EPOCH FROM (config->>'compress_after')::interval) FROM timescaledb_information.jobs
+			WHERE proc_name = 'policy_compression' AND hypertable_name = $1) AS compress_after,
+		(SELECT extversion FROM pg_extension WHERE extname = 'timescaledb') AS version;
+	`
+
+	var res struct {
+		ChunkInterval      sql.NullFloat64 `db:"chunk_interval"`
+		RetentionPeriod    sql.NullFloat64 `db:"retention_period"`
+		CompressionEnabled sql.NullBool    `db:"compression_enabled"`
+		CompressAfter      sql.NullFloat64 `db:"compress_after"`
+		Version            sql.NullString  `db:"version"`
+	}
+	if err := r.db.QueryRowxContext(ctx, q, hypertable).StructScan(&res); err != nil {
+		return callhome.StoragePolicies{}, err
+	}
+	var segmentBy sql.NullString
+	if res.CompressionEnabled.Bool && compressionSupported(res.Version.String) {
+		q = `SELECT segmentby FROM timescaledb_information.hypertable_compression_settings
+			WHERE hypertable = $1::regclass;`
+		err := r.db.QueryRowxContext(ctx, q, hypertable).Scan(&segmentBy)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return callhome.StoragePolicies{}, err
+		}
+	}
+
+	return callhome.StoragePolicies{
+		ChunkInterval:      seconds(res.ChunkInterval),
+		RetentionPeriod:    seconds(res.RetentionPeriod),
+		CompressionEnabled: res.CompressionEnabled.Bool,
+		CompressAfter:      seconds(res.CompressAfter),
+		CompressSegmentBy:  segmentBy.String,
+	}, nil
+}
+
+func seconds(s sql.NullFloat64) time.Duration {
+	return time.Duration(s.Float64 * float64(time.Second))
+}
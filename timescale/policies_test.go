@@ -0,0 +1,214 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcilePolicies(t *testing.T) {
+	ctx := context.TODO()
+	cfg := PolicyConfig{
+		ChunkInterval:      24 * time.Hour,
+		RetentionPeriod:    365 * 24 * time.Hour,
+		CompressionEnabled: true,
+		CompressAfter:      7 * 24 * time.Hour,
+		CompressSegmentBy:  "ip_address",
+	}
+
+	t.Run("invalid segment by column", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		invalid := cfg
+		invalid.CompressSegmentBy = "ip_address; DROP TABLE telemetry"
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), invalid)
+		assert.ErrorIs(t, err, ErrInvalidPolicy)
+	})
+	t.Run("policies already match", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT set_chunk_time_interval").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WithArgs(cfg.RetentionPeriod.Seconds(), retentionProc, hypertable).
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}).AddRow(true))
+		mock.ExpectQuery("SELECT extversion FROM pg_extension").
+			WillReturnRows(sqlmock.NewRows([]string{"extversion"}).AddRow("2.17.2"))
+		mock.ExpectQuery("FROM timescaledb_information.hypertable_compression_settings").
+			WillReturnRows(sqlmock.NewRows([]string{"segmentby"}).AddRow("ip_address"))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WithArgs(cfg.CompressAfter.Seconds(), compressionProc, hypertable).
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}).AddRow(true))
+		mock.ExpectCommit()
+
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("replace retention and add compression", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT set_chunk_time_interval").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}).AddRow(false))
+		mock.ExpectExec("SELECT remove_retention_policy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("SELECT add_retention_policy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT extversion FROM pg_extension").
+			WillReturnRows(sqlmock.NewRows([]string{"extversion"}).AddRow("2.14.0"))
+		mock.ExpectQuery("FROM timescaledb_information.hypertable_compression_settings").
+			WillReturnRows(sqlmock.NewRows([]string{"segmentby"}))
+		mock.ExpectExec("ALTER TABLE telemetry SET").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}))
+		mock.ExpectExec("SELECT add_compression_policy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("remove disabled policies", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		disabled := PolicyConfig{ChunkInterval: time.Hour}
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT set_chunk_time_interval").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}).AddRow(false))
+		mock.ExpectExec("SELECT remove_retention_policy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}).AddRow(false))
+		mock.ExpectExec("SELECT remove_compression_policy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT compression_enabled FROM timescaledb_information.hypertables").
+			WithArgs(hypertable).
+			WillReturnRows(sqlmock.NewRows([]string{"compression_enabled"}).AddRow(true))
+		mock.ExpectExec("SELECT decompress_chunk").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`ALTER TABLE telemetry SET \(timescaledb.compress = false\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), disabled)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("compression already disabled", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		disabled := PolicyConfig{ChunkInterval: time.Hour}
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT set_chunk_time_interval").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}))
+		mock.ExpectQuery("SELECT compression_enabled FROM timescaledb_information.hypertables").
+			WillReturnRows(sqlmock.NewRows([]string{"compression_enabled"}).AddRow(false))
+		mock.ExpectCommit()
+
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), disabled)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("compression on unsupported version", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT set_chunk_time_interval").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM timescaledb_information.jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"matches"}).AddRow(true))
+		mock.ExpectQuery("SELECT extversion FROM pg_extension").
+			WillReturnRows(sqlmock.NewRows([]string{"extversion"}).AddRow("2.13.1"))
+		mock.ExpectRollback()
+
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+		assert.ErrorIs(t, err, ErrPolicy)
+		assert.Contains(t, err.Error(), ErrUnsupportedVersion.Error())
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("failed to set chunk interval", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT set_chunk_time_interval").WillReturnError(fmt.Errorf("any error"))
+		mock.ExpectRollback()
+
+		err = ReconcilePolicies(ctx, sqlx.NewDb(sqlDB, "sqlmock"), cfg)
+		assert.ErrorIs(t, err, ErrPolicy)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrievePolicies(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrievePolicies(ctx)
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		rows := sqlmock.NewRows(
+			[]string{"chunk_interval", "retention_period", "compression_enabled", "compress_after", "version"},
+		).AddRow(86400.0, 31536000.0, true, nil, "2.17.2")
+		mock.ExpectQuery("SELECT(.*)").WillReturnRows(rows)
+		mock.ExpectQuery("FROM timescaledb_information.hypertable_compression_settings").
+			WithArgs(hypertable).
+			WillReturnRows(sqlmock.NewRows([]string{"segmentby"}).AddRow("ip_address"))
+
+		policies, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrievePolicies(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 24*time.Hour, policies.ChunkInterval)
+		assert.Equal(t, 365*24*time.Hour, policies.RetentionPeriod)
+		assert.True(t, policies.CompressionEnabled)
+		assert.Equal(t, time.Duration(0), policies.CompressAfter)
+		assert.Equal(t, "ip_address", policies.CompressSegmentBy)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("compression settings unavailable", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		rows := sqlmock.NewRows(
+			[]string{"chunk_interval", "retention_period", "compression_enabled", "compress_after", "version"},
+		).AddRow(86400.0, nil, true, 604800.0, "2.13.1")
+		mock.ExpectQuery("SELECT(.*)").WillReturnRows(rows)
+
+		policies, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrievePolicies(ctx)
+		assert.Nil(t, err)
+		assert.True(t, policies.CompressionEnabled)
+		assert.Equal(t, 7*24*time.Hour, policies.CompressAfter)
+		assert.Empty(t, policies.CompressSegmentBy)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
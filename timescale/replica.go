@@ -0,0 +1,100 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	// replicaCheckInterval is how long the replica health is trusted before
+	// it is checked again.
+	replicaCheckInterval = 10 * time.Second
+	replicaPingTimeout   = time.Second
+)
+
+// replica tracks the health of the read replica. An unhealthy replica is not
+// used until the next health check succeeds.
+type replica struct {
+	db      *sqlx.DB
+	mu      sync.Mutex
+	healthy bool
+	checked time.Time
+}
+
+func newReplica(db *sqlx.DB) *replica {
+	return &replica{db: db}
+}
+
+// available reports whether the replica is healthy, pinging it if the last
+// check is older than replicaCheckInterval.
+func (rp *replica) available(ctx context.Context) bool {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if time.Since(rp.checked) < replicaCheckInterval {
+		return rp.healthy
+	}
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+	rp.healthy = rp.db.PingContext(ctx) == nil
+	rp.checked = time.Now()
+	return rp.healthy
+}
+
+// fail marks the replica unhealthy until the next health check.
+func (rp *replica) fail() {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.healthy = false
+	rp.checked = time.Now()
+}
+
+// read runs the query on the replica if it is available, falling back to the
+// primary db if it is not or if the replica connection fails. Failing queries,
+// such as those timing out or canceled, fail on the replica.
+func read[T any](ctx context.Context, r repo, query func(db *sqlx.DB) (T, error)) (T, error) {
+	if r.replica != nil && r.replica.available(ctx) {
+		res, err := query(r.replica.db)
+		if err == nil || ctx.Err() != nil || !connectionError(err) {
+			return res, err
+		}
+		r.replica.fail()
+	}
+	return query(r.db)
+}
+
+// connectionError reports whether the error is a failure to reach the
+// database, rather than of the query.
+func connectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgerrcode.AdminShutdown, pgerrcode.CrashShutdown, pgerrcode.CannotConnectNow:
+			return true
+		default:
+			return pgerrcode.IsConnectionException(pgErr.Code)
+		}
+	}
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) || errors.As(err, &connectErr)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/absmach/callhome"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func summaryRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"dimension", "value", "count"}).
+		AddRow("country", "Serbia", 2)
+}
+
+func TestReplicaRouting(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("reads from healthy replica", func(t *testing.T) {
+		primaryDB, primary, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer primaryDB.Close()
+		replicaDB, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		assert.Nil(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectPing()
+		replicaMock.ExpectQuery("SELECT(.*)").WillReturnRows(summaryRows())
+		replicaMock.ExpectQuery("SELECT(.*)").WillReturnRows(summaryRows())
+
+		repo := NewWithReplica(sqlx.NewDb(primaryDB, "sqlmock"), sqlx.NewDb(replicaDB, "sqlmock"))
+		for i := 0; i < 2; i++ {
+			summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+			assert.Nil(t, err)
+			assert.Equal(t, 2, summary.TotalDeployments)
+		}
+		assert.Nil(t, replicaMock.ExpectationsWereMet())
+		assert.Nil(t, primary.ExpectationsWereMet())
+	})
+	t.Run("falls back to primary when replica is down", func(t *testing.T) {
+		primaryDB, primary, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer primaryDB.Close()
+		replicaDB, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		assert.Nil(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+		primary.ExpectQuery("SELECT(.*)").WillReturnRows(summaryRows())
+
+		repo := NewWithReplica(sqlx.NewDb(primaryDB, "sqlmock"), sqlx.NewDb(replicaDB, "sqlmock"))
+		summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, summary.TotalDeployments)
+		assert.Nil(t, replicaMock.ExpectationsWereMet())
+		assert.Nil(t, primary.ExpectationsWereMet())
+	})
+	t.Run("falls back to primary when replica connection fails", func(t *testing.T) {
+		primaryDB, primary, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer primaryDB.Close()
+		replicaDB, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		assert.Nil(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectPing()
+		replicaMock.ExpectQuery("SELECT(.*)").WillReturnError(&pgconn.PgError{Code: pgerrcode.AdminShutdown})
+		// The failed replica is skipped until the next health check.
+		primary.ExpectQuery("SELECT(.*)").WillReturnRows(summaryRows())
+		primary.ExpectQuery("SELECT(.*)").WillReturnRows(summaryRows())
+
+		repo := NewWithReplica(sqlx.NewDb(primaryDB, "sqlmock"), sqlx.NewDb(replicaDB, "sqlmock"))
+		for i := 0; i < 2; i++ {
+			summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+			assert.Nil(t, err)
+			assert.Equal(t, 2, summary.TotalDeployments)
+		}
+		assert.Nil(t, replicaMock.ExpectationsWereMet())
+		assert.Nil(t, primary.ExpectationsWereMet())
+	})
+	t.Run("query failures are returned", func(t *testing.T) {
+		cases := map[string]error{
+			"statement timeout": &pgconn.PgError{Code: pgerrcode.QueryCanceled},
+			"canceled":          context.Canceled,
+			"query error":       fmt.Errorf("replica error"),
+		}
+		for desc, qerr := range cases {
+			t.Run(desc, func(t *testing.T) {
+				primaryDB, primary, err := sqlmock.New()
+				assert.Nil(t, err)
+				defer primaryDB.Close()
+				replicaDB, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+				assert.Nil(t, err)
+				defer replicaDB.Close()
+
+				replicaMock.ExpectPing()
+				replicaMock.ExpectQuery("SELECT(.*)").WillReturnError(qerr)
+				// The replica stays healthy.
+				replicaMock.ExpectQuery("SELECT(.*)").WillReturnRows(summaryRows())
+
+				repo := NewWithReplica(sqlx.NewDb(primaryDB, "sqlmock"), sqlx.NewDb(replicaDB, "sqlmock"))
+				_, err = repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+				assert.ErrorIs(t, err, qerr)
+				_, err = repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+				assert.Nil(t, err)
+				assert.Nil(t, replicaMock.ExpectationsWereMet())
+				assert.Nil(t, primary.ExpectationsWereMet())
+			})
+		}
+	})
+	t.Run("invalid cursor is not a replica failure", func(t *testing.T) {
+		primaryDB, primary, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer primaryDB.Close()
+		replicaDB, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		assert.Nil(t, err)
+		defer replicaDB.Close()
+
+		replicaMock.ExpectPing()
+
+		repo := NewWithReplica(sqlx.NewDb(primaryDB, "sqlmock"), sqlx.NewDb(replicaDB, "sqlmock"))
+		_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Cursor: "invalid"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidCursor)
+		assert.Nil(t, replicaMock.ExpectationsWereMet())
+		assert.Nil(t, primary.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/internal/sqlfilter"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// RetrieveServiceSets counts deployments by the set of services they run.
+func (r repo) RetrieveServiceSets(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.ServiceSet, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.ServiceSet, error) {
+		return retrieveServiceSets(ctx, db, filters)
+	})
+}
+
+func retrieveServiceSets(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) ([]callhome.ServiceSet, error) {
+	service := filters.ValueFilters().Service
+	filters.Service = ""
+	filterQuery, params := generateQuery(filters)
+	if filterQuery == "" {
+		filterQuery = "WHERE service <> ''"
+	} else {
+		filterQuery += " AND service <> ''"
+	}
+	// The service filter applies to deployments rather than heartbeats, which
+	// run a matching service and none of the excluded ones.
+	var conds []string
+	if q := dialect.IncludeQuery("service", "service", service, params); q != "" {
+		conds = append(conds, fmt.Sprintf("BOOL_OR(%s)", q))
+	}
+	if q := sqlfilter.ExcludeQuery("service", "service", service, params); q != "" {
+		conds = append(conds, fmt.Sprintf("BOOL_AND(%s)", q))
+	}
+	having := ""
+	if len(conds) > 0 {
+		having = "HAVING " + strings.Join(conds, " AND ")
+	}
+
+	q := fmt.Sprintf(`
+		SELECT services, COUNT(*) AS count
+		FROM (
+			SELECT ip_address, ARRAY_AGG(DISTINCT service ORDER BY service) AS services
+			FROM telemetry
+			%s
+			GROUP BY ip_address
+			%s
+		) deployments
+		GROUP BY services
+		ORDER BY count DESC, services;
+	`, filterQuery, having)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []callhome.ServiceSet
+	for rows.Next() {
+		var res struct {
+			Services pq.StringArray `db:"services"`
+			Count    int            `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		sets = append(sets, callhome.ServiceSet{Services: res.Services, Deployments: res.Count})
+	}
+	return sets, rows.Err()
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// RetrieveLastSeen gets when each deployment first and last reported.
+func (r repo) RetrieveLastSeen(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.DeploymentSeen, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.DeploymentSeen, error) {
+		return retrieveLastSeen(ctx, db, filters)
+	})
+}
+
+func retrieveLastSeen(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) ([]callhome.DeploymentSeen, error) {
+	filterQuery, params := generateQuery(filters)
+	q := fmt.Sprintf(`
+		WITH seen AS (
+			SELECT ip_address, MIN(time) AS first_seen, MAX(time) AS last_seen, COUNT(DISTINCT time) AS heartbeats
+			FROM telemetry
+			%s
+			GROUP BY ip_address
+		)
+		SELECT s.ip_address, d.id AS deployment_id, COALESCE(MAX(t.country), '') AS country, COALESCE(MAX(t.city), '') AS city,
+			COALESCE(MAX(t.mg_version), '') AS mg_version, s.first_seen, s.last_seen, s.heartbeats
+		FROM seen s
+		JOIN deployments d ON d.ip_address = s.ip_address
+		JOIN telemetry t ON t.ip_address = s.ip_address AND t.time = s.last_seen
+		GROUP BY s.ip_address, d.id, s.first_seen, s.last_seen, s.heartbeats
+		ORDER BY s.last_seen DESC, s.ip_address;
+	`, filterQuery)
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seen []callhome.DeploymentSeen
+	for rows.Next() {
+		var res struct {
+			ID         string    `db:"deployment_id"`
+			IpAddress  string    `db:"ip_address"`
+			Country    string    `db:"country"`
+			City       string    `db:"city"`
+			Version    string    `db:"mg_version"`
+			FirstSeen  time.Time `db:"first_seen"`
+			LastSeen   time.Time `db:"last_seen"`
+			Heartbeats int       `db:"heartbeats"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		seen = append(seen, callhome.DeploymentSeen{
+			ID:         res.ID,
+			IpAddress:  res.IpAddress,
+			Country:    res.Country,
+			City:       res.City,
+			Version:    res.Version,
+			FirstSeen:  res.FirstSeen.UTC(),
+			LastSeen:   res.LastSeen.UTC(),
+			Heartbeats: res.Heartbeats,
+		})
+	}
+	return seen, rows.Err()
+}
+
+// RetrieveClientsSeen gets when each client first and last reported.
+func (r repo) RetrieveClientsSeen(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.ClientSeen, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.ClientSeen, error) {
+		return retrieveClientsSeen(ctx, db, filters)
+	})
+}
+
+func retrieveClientsSeen(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) ([]callhome.ClientSeen, error) {
+	filterQuery, params := generateQuery(filters)
+	q := fmt.Sprintf(`
+		SELECT d.id AS deployment_id, COALESCE(t.mac_address, '') AS mac_address, COALESCE(t.service, '') AS service,
+			MIN(t.time) AS first_seen, MAX(t.time) AS last_seen, COUNT(DISTINCT t.time) AS heartbeats
+		FROM telemetry t
+		INNER JOIN deployments d ON d.ip_address = t.ip_address
+		%s
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3;
+	`, filterQuery)
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seen []callhome.ClientSeen
+	for rows.Next() {
+		var res struct {
+			DeploymentID string    `db:"deployment_id"`
+			MacAddress   string    `db:"mac_address"`
+			Service      string    `db:"service"`
+			FirstSeen    time.Time `db:"first_seen"`
+			LastSeen     time.Time `db:"last_seen"`
+			Heartbeats   int       `db:"heartbeats"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		seen = append(seen, callhome.ClientSeen{
+			DeploymentID: res.DeploymentID,
+			MacAddress:   res.MacAddress,
+			Service:      res.Service,
+			FirstSeen:    res.FirstSeen.UTC(),
+			LastSeen:     res.LastSeen.UTC(),
+			Heartbeats:   res.Heartbeats,
+		})
+	}
+	return seen, rows.Err()
+}
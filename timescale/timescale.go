@@ -5,6 +5,7 @@ package timescale
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -12,14 +13,14 @@ import (
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
 var _ callhome.TelemetryRepo = (*repo)(nil)
 
 type repo struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	replica *replica
 }
 
 // New returns new TimescaleSQL writer.
@@ -27,60 +28,73 @@ func New(db *sqlx.DB) callhome.TelemetryRepo {
 	return &repo{db: db}
 }
 
+// NewWithReplica returns new TimescaleSQL writer, which serves telemetry reads
+// from the replica while it is healthy and from the primary db otherwise.
+func NewWithReplica(db, replicaDB *sqlx.DB) callhome.TelemetryRepo {
+	if replicaDB == nil {
+		return New(db)
+	}
+	return &repo{db: db, replica: newReplica(replicaDB)}
+}
+
 // RetrieveAll gets all records from repo - optimized query.
 func (r repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
+	return read(ctx, r, func(db *sqlx.DB) (callhome.TelemetryPage, error) {
+		return retrieveAll(ctx, db, pm, filters)
+	})
+}
+
+func retrieveAll(ctx context.Context, db *sqlx.DB, pm callhome.PageMetadata, filters callhome.TelemetryFilters) (callhome.TelemetryPage, error) {
 	filterQuery, params := generateQuery(filters)
 
-	// Optimized query using DISTINCT ON for better performance
-	// DISTINCT ON is much faster than ROW_NUMBER() window function
+	// A heartbeat is the latest of its deployment if no later heartbeat
+	// matches, with ties broken by service and MAC address. Unlike grouping
+	// every matching heartbeat by deployment first, this lets the scan in
+	// time order stop once the page is full.
+	later := andWhere(filterQuery, `l.ip_address = t.ip_address
+		AND (l.time, COALESCE(l.service, ''), COALESCE(l.mac_address, '')) > (t.time, COALESCE(t.service, ''), COALESCE(t.mac_address, ''))`)
+	query := andWhere(filterQuery, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM telemetry l %s)", later))
+
+	order, pagination := "DESC", "LIMIT :limit OFFSET :offset"
+	if pm.Cursor != "" {
+		cursor, err := callhome.ParsePageCursor(pm.Cursor)
+		if err != nil {
+			return callhome.TelemetryPage{}, err
+		}
+		cmp := "<"
+		if cursor.Backward {
+			cmp, order = ">", "ASC"
+		}
+		query = andWhere(query, fmt.Sprintf("(t.time, d.id) %s (:cursor_time, :cursor_id)", cmp))
+		pagination = "LIMIT :limit"
+		params["cursor_time"] = cursor.Time
+		params["cursor_id"] = cursor.DeploymentID
+	}
+
 	q := fmt.Sprintf(`
-	WITH latest_per_ip AS (
-		SELECT DISTINCT ON (ip_address)
-			ip_address,
-			time,
-			service_time,
-			longitude,
-			latitude,
-			mg_version,
-			country,
-			city
-		FROM telemetry
-		%s
-		ORDER BY ip_address, time DESC
-	),
-	limited_ips AS (
-		SELECT *
-		FROM latest_per_ip
-		ORDER BY time DESC
-		LIMIT :limit OFFSET :offset
-	),
-	services_per_ip AS (
-		SELECT
-			t.ip_address,
-			ARRAY_AGG(DISTINCT t.service) as services
-		FROM limited_ips lpi
-		INNER JOIN telemetry t ON t.ip_address = lpi.ip_address
-		GROUP BY t.ip_address
-	)
 	SELECT
-		lpi.ip_address,
-		lpi.time,
-		lpi.service_time,
-		lpi.longitude,
-		lpi.latitude,
-		lpi.mg_version,
-		lpi.country,
-		lpi.city,
-		s.services
-	FROM limited_ips lpi
-	LEFT JOIN services_per_ip s ON lpi.ip_address = s.ip_address
-	ORDER BY lpi.time DESC;
-	`, filterQuery)
-
-	params["limit"] = pm.Limit
+		d.id AS deployment_id,
+		t.ip_address,
+		t.time,
+		t.service_time,
+		t.longitude,
+		t.latitude,
+		t.mg_version,
+		t.country,
+		t.city,
+		(SELECT ARRAY_AGG(DISTINCT service) FROM telemetry WHERE ip_address = t.ip_address) AS services
+	FROM telemetry t
+	INNER JOIN deployments d ON d.ip_address = t.ip_address
+	%s
+	ORDER BY t.time %s, d.id %s
+	%s;
+	`, query, order, order, pagination)
+
+	// One extra row tells whether there is a page past this one.
+	params["limit"] = pm.Limit + 1
 	params["offset"] = pm.Offset
 
-	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	rows, err := db.NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return callhome.TelemetryPage{}, err
 	}
@@ -96,19 +110,80 @@ func (r repo) RetrieveAll(ctx context.Context, pm callhome.PageMetadata, filters
 		results.Telemetry = append(results.Telemetry, result)
 	}
 
-	// Set total to the number of results for simplicity
-	// Since UI loads all data at once, exact count is less critical
-	results.Total = uint64(len(results.Telemetry))
+	results.Telemetry, results.Next, results.Prev = callhome.KeysetPage(results.Telemetry, pm)
+
+	count, err := total(ctx, db, filterQuery, params, pm.EstimateTotal)
+	if err != nil {
+		return callhome.TelemetryPage{}, err
+	}
+	results.Total = count
+	if pm.Cursor == "" {
+		results.Offset = pm.Offset
+	}
+	results.Limit = pm.Limit
 
 	return results, nil
 }
 
-// Save creates record in repo.
+// total counts the distinct deployments matching the filter, either exactly or
+// from the query planner estimate, which avoids scanning the matching rows.
+func total(ctx context.Context, db *sqlx.DB, filterQuery string, params map[string]interface{}, estimate bool) (uint64, error) {
+	if !estimate {
+		q := fmt.Sprintf(`SELECT COUNT(DISTINCT ip_address) FROM telemetry %s;`, filterQuery)
+		rows, err := db.NamedQueryContext(ctx, q, params)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		var total uint64
+		if rows.Next() {
+			if err := rows.Scan(&total); err != nil {
+				return 0, err
+			}
+		}
+		return total, rows.Err()
+	}
+
+	q := fmt.Sprintf(`EXPLAIN (FORMAT JSON) SELECT DISTINCT ip_address FROM telemetry %s;`, filterQuery)
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var plan []byte
+	if rows.Next() {
+		if err := rows.Scan(&plan); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return 0, err
+	}
+	if len(explained) == 0 {
+		return 0, nil
+	}
+	return uint64(explained[0].Plan.Rows), nil
+}
+
+// insertDeploymentQuery assigns a random ID to the deployment on its first heartbeat.
+const insertDeploymentQuery = `INSERT INTO deployments (ip_address) VALUES (:ip_address) ON CONFLICT DO NOTHING;`
+
+// Save creates record in repo. Saving a heartbeat that is already stored for
+// the same deployment, service and time is a no-op.
 func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
 	q := `INSERT INTO telemetry (ip_address, mac_address, longitude, latitude,
-		mg_version, service, time, country, city, service_time)
+		mg_version, service, time, country, city, region, service_time)
 		VALUES (:ip_address, :mac_address, :longitude, :latitude,
-			:mg_version, :service, :time, :country, :city, :service_time);`
+			:mg_version, :service, :time, :country, :city, :region, :service_time)
+		ON CONFLICT DO NOTHING;`
 
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
@@ -127,7 +202,8 @@ func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
 		}
 	}()
 
-	if _, err := tx.NamedExec(q, t); err != nil {
+	res, err := tx.NamedExec(q, t)
+	if err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if pgErr.Code == pgerrcode.InvalidTextRepresentation {
 				return errors.Wrap(ErrSaveEvent, ErrInvalidEvent.Error())
@@ -135,89 +211,90 @@ func (r repo) Save(ctx context.Context, t callhome.Telemetry) error {
 		}
 		return errors.Wrap(ErrSaveEvent, err.Error())
 	}
+	// Duplicates belong to a known deployment and cannot change the version.
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err = tx.NamedExec(insertDeploymentQuery, t); err != nil {
+		return errors.Wrap(ErrSaveEvent, err.Error())
+	}
+	if t.Version == "" {
+		return nil
+	}
+	for _, tq := range transitionQueries {
+		if _, err = tx.NamedExec(tq, t); err != nil {
+			return errors.Wrap(ErrSaveEvent, err.Error())
+		}
+	}
 	return nil
 }
 
-// RetrieveSummary retrieve distinct - optimized to use single query.
+// RetrieveSummary counts deployments per value of each dimension in a single query.
 func (r repo) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+	return read(ctx, r, func(db *sqlx.DB) (callhome.TelemetrySummary, error) {
+		return retrieveSummary(ctx, db, filters)
+	})
+}
+
+func retrieveSummary(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
 	filterQuery, params := generateQuery(filters)
 	var summary callhome.TelemetrySummary
 
-	// Single optimized query that gets all distinct values and country counts at once
 	q := fmt.Sprintf(`
-		SELECT
-			country,
-			COUNT(DISTINCT ip_address) as number_of_deployments,
-			ARRAY_AGG(DISTINCT city) FILTER (WHERE city IS NOT NULL) as cities,
-			ARRAY_AGG(DISTINCT service) FILTER (WHERE service IS NOT NULL) as services,
-			ARRAY_AGG(DISTINCT mg_version) FILTER (WHERE mg_version IS NOT NULL) as versions
-		FROM telemetry
-		%s
-		GROUP BY country;
+		SELECT 'country' AS dimension, COALESCE(country, '') AS value, COUNT(DISTINCT ip_address) AS count
+		FROM telemetry %[1]s GROUP BY 2
+		UNION ALL
+		SELECT 'city', COALESCE(city, ''), COUNT(DISTINCT ip_address) FROM telemetry %[1]s GROUP BY 2
+		UNION ALL
+		SELECT 'service', COALESCE(service, ''), COUNT(DISTINCT ip_address) FROM telemetry %[1]s GROUP BY 2
+		UNION ALL
+		SELECT 'version', COALESCE(mg_version, ''), COUNT(DISTINCT ip_address) FROM telemetry %[1]s GROUP BY 2;
 	`, filterQuery)
 
-	type queryResult struct {
-		Country       string         `db:"country"`
-		NoDeployments int            `db:"number_of_deployments"`
-		Cities        pq.StringArray `db:"cities"`
-		Services      pq.StringArray `db:"services"`
-		Versions      pq.StringArray `db:"versions"`
-	}
-
-	rows, err := r.db.NamedQueryContext(ctx, q, params)
+	rows, err := db.NamedQueryContext(ctx, q, params)
 	if err != nil {
 		return callhome.TelemetrySummary{}, err
 	}
 	defer rows.Close()
 
-	citiesMap := make(map[string]bool)
-	servicesMap := make(map[string]bool)
-	versionsMap := make(map[string]bool)
-
 	for rows.Next() {
-		var result queryResult
-		if err := rows.StructScan(&result); err != nil {
+		var dimension string
+		var vs callhome.ValueSummary
+		if err := rows.Scan(&dimension, &vs.Value, &vs.NoDeployments); err != nil {
 			return callhome.TelemetrySummary{}, err
 		}
-
-		summary.Countries = append(summary.Countries, callhome.CountrySummary{
-			Country:       result.Country,
-			NoDeployments: result.NoDeployments,
-		})
-		summary.TotalDeployments += result.NoDeployments
-
-		// Collect unique cities, services, versions across all countries
-		for _, city := range result.Cities {
-			if city != "" {
-				citiesMap[city] = true
-			}
+		if dimension == callhome.GroupByCountry {
+			summary.Countries = append(summary.Countries, callhome.CountrySummary{Country: vs.Value, NoDeployments: vs.NoDeployments})
+			summary.TotalDeployments += vs.NoDeployments
+			continue
 		}
-		for _, service := range result.Services {
-			if service != "" {
-				servicesMap[service] = true
-			}
+		if vs.Value == "" {
+			continue
 		}
-		for _, version := range result.Versions {
-			if version != "" {
-				versionsMap[version] = true
-			}
+		switch dimension {
+		case callhome.GroupByCity:
+			summary.CityCounts = append(summary.CityCounts, vs)
+		case callhome.GroupByService:
+			summary.ServiceCounts = append(summary.ServiceCounts, vs)
+		case callhome.GroupByVersion:
+			summary.VersionCounts = append(summary.VersionCounts, vs)
 		}
 	}
-
-	// Convert maps to slices
-	for city := range citiesMap {
-		summary.Cities = append(summary.Cities, city)
-	}
-	for service := range servicesMap {
-		summary.Services = append(summary.Services, service)
-	}
-	for version := range versionsMap {
-		summary.Versions = append(summary.Versions, version)
+	if err := rows.Err(); err != nil {
+		return callhome.TelemetrySummary{}, err
 	}
 
 	return summary, nil
 }
 
+// andWhere adds the condition to the WHERE clause of the filter query.
+func andWhere(filterQuery, condition string) string {
+	if filterQuery == "" {
+		return "WHERE " + condition
+	}
+	return filterQuery + " AND " + condition
+}
+
 func generateQuery(filters callhome.TelemetryFilters) (string, map[string]interface{}) {
 	var queries []string
 	params := make(map[string]interface{})
@@ -230,25 +307,8 @@ func generateQuery(filters callhome.TelemetryFilters) (string, map[string]interf
 		queries = append(queries, "time <= :to")
 		params["to"] = filters.To
 	}
-	if filters.Country != "" {
-		queries = append(queries, "country = :country")
-		params["country"] = filters.Country
-	}
-
-	if filters.City != "" {
-		queries = append(queries, "city = :city")
-		params["city"] = filters.City
-	}
-
-	if filters.Version != "" {
-		queries = append(queries, "mg_version = :version")
-		params["version"] = filters.Version
-	}
-
-	if filters.Service != "" {
-		queries = append(queries, "service = :service")
-		params["service"] = filters.Service
-	}
+	queries = dialect.ValueQueries(queries, params, filters)
+	queries = geoQueries(queries, params, filters)
 
 	switch len(queries) {
 	case 0:
@@ -6,6 +6,9 @@ package timescale
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,6 +93,11 @@ func TestSave(t *testing.T) {
 		mock.ExpectBegin()
 
 		mock.ExpectExec("INSERT INTO telemetry").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO deployments \\(ip_address\\) VALUES \\(\\?\\) ON CONFLICT DO NOTHING").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO version_transitions (.*) FROM \\(\\s*SELECT mg_version FROM telemetry").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM version_transitions").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO version_transitions (.*) FROM \\(\\s*SELECT time, mg_version").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
 
 		defer sqlDB.Close()
 		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
@@ -98,6 +106,44 @@ func TestSave(t *testing.T) {
 
 		err = repo.Save(ctx, mockTelemetry)
 		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("failed to save transition", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO telemetry").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO deployments").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO version_transitions").WillReturnError(fmt.Errorf("any error"))
+		mock.ExpectRollback()
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB)
+
+		err = repo.Save(ctx, mockTelemetry)
+		assert.ErrorIs(t, err, ErrSaveEvent)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("duplicate save is idempotent", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		mock.ExpectBegin()
+
+		mock.ExpectExec("INSERT INTO telemetry (.*) ON CONFLICT DO NOTHING").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB)
+
+		err = repo.Save(ctx, mockTelemetry)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -143,14 +189,83 @@ func TestRetrieveAll(t *testing.T) {
 			[]string{"ip_address", "time", "service_time", "longitude", "latitude", "mg_version", "country", "city", "services"},
 		).AddRow(mTel.IpAddress, mTel.LastSeen, mTel.ServiceTime, mTel.Longitude, mTel.Latitude, mTel.Version, mTel.Country, mTel.City, services)
 
-		mock.ExpectQuery("WITH latest_per_ip(.*)").WillReturnRows(rows)
+		mock.ExpectQuery("FROM telemetry t\\s+INNER JOIN deployments d (.*) WHERE NOT EXISTS \\(SELECT 1 FROM telemetry l WHERE l.ip_address = t.ip_address").WillReturnRows(rows)
+		mock.ExpectQuery("SELECT COUNT\\(DISTINCT ip_address\\) FROM telemetry").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
 
 		tp, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Offset: 0}, callhome.TelemetryFilters{})
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(tp.Telemetry))
 		assert.Equal(t, mTel.IpAddress, tp.Telemetry[0].IpAddress)
 		assert.Equal(t, mTel.Country, tp.Telemetry[0].Country)
-		assert.Equal(t, uint64(1), tp.Total)
+		assert.Equal(t, uint64(42), tp.Total)
+		assert.Empty(t, tp.Next)
+		assert.Empty(t, tp.Prev)
+	})
+	t.Run("estimated total", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB)
+
+		rows := sqlmock.NewRows(
+			[]string{"ip_address", "time", "service_time", "longitude", "latitude", "mg_version", "country", "city", "services"},
+		)
+		plan := sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Node Type": "Unique", "Plan Rows": 1234}}]`)
+
+		mock.ExpectQuery("FROM telemetry t\\s+INNER JOIN deployments d").WillReturnRows(rows)
+		mock.ExpectQuery("EXPLAIN \\(FORMAT JSON\\) SELECT DISTINCT ip_address FROM telemetry").WillReturnRows(plan)
+
+		tp, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, EstimateTotal: true}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1234), tp.Total)
+	})
+	t.Run("keyset pagination", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
+
+		repo := New(sqlxDB)
+
+		services := pq.Array([]string{mTel.Service})
+		rows := sqlmock.NewRows(
+			[]string{"deployment_id", "ip_address", "time", "service_time", "longitude", "latitude", "mg_version", "country", "city", "services"},
+		)
+		for i := 0; i < 3; i++ {
+			rows.AddRow(fmt.Sprintf("d%d", i), fmt.Sprintf("10.0.0.%d", i), now.Add(-time.Duration(i)*time.Minute), now, mTel.Longitude, mTel.Latitude, mTel.Version, mTel.Country, mTel.City, services)
+		}
+		cursor := callhome.PageCursor{Time: now, DeploymentID: "d9"}.String()
+
+		mock.ExpectQuery("NOT EXISTS (.*) AND \\(t.time, d.id\\) < \\(\\?, \\?\\)\\s+ORDER BY t.time DESC, d.id DESC\\s+LIMIT \\?;").WillReturnRows(rows)
+		mock.ExpectQuery("SELECT COUNT\\(DISTINCT ip_address\\) FROM telemetry").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+
+		tp, err := repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 2, Cursor: cursor}, callhome.TelemetryFilters{})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(tp.Telemetry))
+
+		next, err := callhome.ParsePageCursor(tp.Next)
+		assert.Nil(t, err)
+		assert.Equal(t, "d1", next.DeploymentID)
+		assert.False(t, next.Backward)
+
+		prev, err := callhome.ParsePageCursor(tp.Prev)
+		assert.Nil(t, err)
+		assert.Equal(t, "d0", prev.DeploymentID)
+		assert.True(t, prev.Backward)
+	})
+	t.Run("invalid cursor", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+
+		defer sqlDB.Close()
+		repo := New(sqlx.NewDb(sqlDB, "sqlmock"))
+
+		_, err = repo.RetrieveAll(ctx, callhome.PageMetadata{Limit: 10, Cursor: "invalid"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidCursor)
 	})
 }
 
@@ -171,10 +286,7 @@ func TestRetrieveSummary(t *testing.T) {
 		assert.NotNil(t, err)
 	})
 
-	// Note: sqlmock has limitations with PostgreSQL array types
-	// Full array handling requires integration tests with real database
-	// This test just verifies the query executes without error
-	t.Run("successful summary retrieval - query validation", func(t *testing.T) {
+	t.Run("successful summary retrieval", func(t *testing.T) {
 		sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 		assert.Nil(t, err)
 
@@ -183,82 +295,693 @@ func TestRetrieveSummary(t *testing.T) {
 
 		repo := New(sqlxDB)
 
-		// Return empty result set to just verify query structure
-		rows := sqlmock.NewRows(
-			[]string{"country", "number_of_deployments", "cities", "services", "versions"},
-		)
+		rows := sqlmock.NewRows([]string{"dimension", "value", "count"}).
+			AddRow("country", "USA", 5).
+			AddRow("country", "UK", 3).
+			AddRow("city", "New York", 4).
+			AddRow("city", "", 2).
+			AddRow("city", "London", 3).
+			AddRow("service", "users", 8).
+			AddRow("version", "0.14.0", 6)
+
+		mock.ExpectQuery(`(?s)SELECT 'country' AS dimension, COALESCE\(country, ''\) AS value, COUNT\(DISTINCT ip_address\) AS count.*`+
+			`UNION ALL\s+SELECT 'city'.*UNION ALL\s+SELECT 'service'.*UNION ALL\s+SELECT 'version', COALESCE\(mg_version, ''\)`).
+			WithArgs("users", "users", "users", "users").
+			WillReturnRows(rows)
+
+		summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{Service: "users"})
+		assert.Nil(t, err)
+		assert.Equal(t, callhome.TelemetrySummary{
+			Countries: []callhome.CountrySummary{
+				{Country: "USA", NoDeployments: 5},
+				{Country: "UK", NoDeployments: 3},
+			},
+			CityCounts: []callhome.ValueSummary{
+				{Value: "New York", NoDeployments: 4},
+				{Value: "London", NoDeployments: 3},
+			},
+			ServiceCounts:    []callhome.ValueSummary{{Value: "users", NoDeployments: 8}},
+			VersionCounts:    []callhome.ValueSummary{{Value: "0.14.0", NoDeployments: 6}},
+			TotalDeployments: 8,
+		}, summary)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
 
-		mock.ExpectQuery("SELECT.*country.*number_of_deployments.*cities.*services.*versions.*FROM telemetry.*GROUP BY country").WillReturnRows(rows)
+func TestRetrieveTimeSeries(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("invalid interval", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
-		summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTimeSeries(ctx, callhome.TimeSeriesQuery{Interval: "1 day'; --"}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
 		assert.Nil(t, err)
-		assert.NotNil(t, summary)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTimeSeries(ctx, callhome.TimeSeriesQuery{Interval: callhome.IntervalDay}, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"bucket", "grp", "count"}).
+			AddRow(day, "0.13.0", 2).
+			AddRow(day, "0.14.0", 5)
+		mock.ExpectQuery(`time_bucket\(INTERVAL '1 week', time\) AS bucket,\s+COALESCE\(mg_version, ''\) AS grp`).
+			WithArgs("Serbia").
+			WillReturnRows(rows)
+
+		q := callhome.TimeSeriesQuery{Interval: callhome.IntervalWeek, SplitBy: callhome.SplitByVersion}
+		buckets, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTimeSeries(ctx, q, callhome.TelemetryFilters{Country: "Serbia"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.TimeSeriesBucket{
+			{Time: day, Group: "0.13.0", ActiveDeployments: 2},
+			{Time: day, Group: "0.14.0", ActiveDeployments: 5},
+		}, buckets)
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
+}
 
-	t.Run("successful summary with PostgreSQL arrays", func(t *testing.T) {
-		sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+func TestRetrieveVersions(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
 		assert.Nil(t, err)
+		defer sqlDB.Close()
 
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveVersions(ctx, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
 		defer sqlDB.Close()
-		sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 
-		repo := New(sqlxDB)
+		day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"version", "first_seen", "count"}).
+			AddRow("0.13.0", day, 0).
+			AddRow("0.14.0", day.Add(time.Hour), 5)
+		mock.ExpectQuery(`SELECT DISTINCT ON \(ip_address\) ip_address, version`).
+			WithArgs("Serbia").
+			WillReturnRows(rows)
+
+		usage, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveVersions(ctx, callhome.TelemetryFilters{Country: "Serbia"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.VersionUsage{
+			{Version: "0.13.0", Deployments: 0, FirstSeen: day},
+			{Version: "0.14.0", Deployments: 5, FirstSeen: day.Add(time.Hour)},
+		}, usage)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveTransitions(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("invalid interval", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
-		// Mock data for multiple countries with arrays
-		cities1 := pq.Array([]string{"New York", "Los Angeles"})
-		services1 := pq.Array([]string{"auth", "users"})
-		versions1 := pq.Array([]string{"0.14.0", "0.13.0"})
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTransitions(ctx, "fortnight", callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
-		cities2 := pq.Array([]string{"London", "Manchester"})
-		services2 := pq.Array([]string{"things", "users"})
-		versions2 := pq.Array([]string{"0.14.0"})
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTransitions(ctx, callhome.IntervalDay, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
-		rows := sqlmock.NewRows(
-			[]string{"country", "number_of_deployments", "cities", "services", "versions"},
-		).AddRow("USA", 5, cities1, services1, versions1).
-			AddRow("UK", 3, cities2, services2, versions2)
+		day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"bucket", "from_version", "to_version", "count"}).
+			AddRow(day, "0.13.0", "0.15.0", 2)
+		mock.ExpectQuery(`(?s)time_bucket\(INTERVAL '1 month', time\) AS bucket.*FROM version_transitions\s+WHERE country = \? AND \(from_version = \? OR to_version = \?\)`).
+			WithArgs("Serbia", "0.13.0", "0.13.0").
+			WillReturnRows(rows)
+
+		buckets, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTransitions(ctx, callhome.IntervalMonth, callhome.TelemetryFilters{Country: "Serbia", Version: "0.13.0"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.TransitionBucket{{Time: day, From: "0.13.0", To: "0.15.0", Deployments: 2}}, buckets)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveTransitionCounts(t *testing.T) {
+	ctx := context.TODO()
+	sqlDB, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer sqlDB.Close()
+
+	rows := sqlmock.NewRows([]string{"from_version", "to_version", "count"}).
+		AddRow("0.13.0", "0.15.0", 2)
+	mock.ExpectQuery(`(?s)COUNT\(DISTINCT ip_address\) AS count\s+FROM version_transitions\s+WHERE country = \?\s+GROUP BY from_version, to_version`).
+		WithArgs("Serbia").
+		WillReturnRows(rows)
+
+	counts, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveTransitionCounts(ctx, callhome.TelemetryFilters{Country: "Serbia"})
+	assert.Nil(t, err)
+	assert.Equal(t, []callhome.TransitionCount{{From: "0.13.0", To: "0.15.0", Deployments: 2}}, counts)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGenerateGeoQuery(t *testing.T) {
+	t.Run("bounding box across the antimeridian", func(t *testing.T) {
+		q, params := generateQuery(callhome.TelemetryFilters{BBox: &callhome.BoundingBox{West: 170, South: -20, East: -170, North: 0}})
+		assert.Equal(t, "WHERE latitude BETWEEN :bbox_south AND :bbox_north AND (longitude >= :bbox_west OR longitude <= :bbox_east)", q)
+		assert.Equal(t, map[string]interface{}{"bbox_west": 170.0, "bbox_south": -20.0, "bbox_east": -170.0, "bbox_north": 0.0}, params)
+	})
+	t.Run("near", func(t *testing.T) {
+		near := &callhome.GeoCircle{Latitude: 44.8, Longitude: 20.45, Radius: 100}
+		q, params := generateQuery(callhome.TelemetryFilters{Country: "Serbia", Near: near})
+		assert.Regexp(t, `^WHERE country = :country AND latitude BETWEEN :near_south AND :near_north AND \(longitude >= :near_west AND longitude <= :near_east\) AND 2 \* 6371.0088 \* ASIN\(.*\) <= :near_radius$`, strings.ReplaceAll(q, "\n", " "))
+		assert.Equal(t, 100.0, params["near_radius"])
+		assert.InDelta(t, 43.90, params["near_south"], 0.01)
+		assert.InDelta(t, 45.70, params["near_north"], 0.01)
+		assert.InDelta(t, 19.18, params["near_west"], 0.01)
+		assert.InDelta(t, 21.72, params["near_east"], 0.01)
+	})
+	t.Run("continent and sub-region", func(t *testing.T) {
+		q, params := generateQuery(callhome.TelemetryFilters{Continent: callhome.ContinentEurope, SubRegion: "Western Europe"})
+		countries := callhome.Countries(callhome.ContinentEurope, "Western Europe")
+		assert.Contains(t, countries, "France")
+		assert.Len(t, params, len(countries))
+		assert.True(t, strings.HasPrefix(q, "WHERE country IN (:geo_country_0, :geo_country_1"), q)
+	})
+	t.Run("no countries", func(t *testing.T) {
+		q, _ := generateTransitionQuery(callhome.TelemetryFilters{Continent: callhome.ContinentEurope, SubRegion: "Polynesia"})
+		assert.Equal(t, "WHERE FALSE", q)
+	})
+}
+
+func TestGenerateValueQuery(t *testing.T) {
+	t.Run("multiple values and exclusions", func(t *testing.T) {
+		q, params := generateQuery(callhome.TelemetryFilters{Country: "Serbia,France", Service: "!bootstrap"})
+		assert.Equal(t, "WHERE country IN (:country_0, :country_1) AND COALESCE(service, '') NOT IN (:service_not_0)", q)
+		assert.Equal(t, map[string]interface{}{"country_0": "France", "country_1": "Serbia", "service_not_0": "bootstrap"}, params)
+	})
+	t.Run("version range", func(t *testing.T) {
+		q, params := generateQuery(callhome.TelemetryFilters{Version: "0.13.0,>=0.14.0 <0.16"})
+		assert.Regexp(t, `^WHERE \(mg_version = :version OR \(CASE WHEN mg_version ~ .* END\) >= CAST\(:version_range_0_0 AS NUMERIC\[\]\) AND \(CASE WHEN mg_version ~ .* END\) < CAST\(:version_range_0_1 AS NUMERIC\[\]\)\)$`, q)
+		assert.Equal(t, map[string]interface{}{
+			"version":           "0.13.0",
+			"version_range_0_0": pq.StringArray{"0", "14", "0", "1"},
+			"version_range_0_1": pq.StringArray{"0", "16", "0", "1"},
+		}, params)
+	})
+	t.Run("version key patterns", func(t *testing.T) {
+		// The patterns parse versions in SQL as callhome.VersionKey does.
+		version, numbers, prerelease := regexp.MustCompile(versionPattern), regexp.MustCompile(numbersPattern), regexp.MustCompile(prereleasePattern)
+		for _, v := range []string{"0.14.2", "v1", "1.2", " 1.2.3-rc.1+build.5", "1.2.3+build-5", "1.2.3-", "1.2.3.4", "v", "dev", ""} {
+			want, ok := callhome.VersionKey(v)
+			assert.Equal(t, ok, version.MatchString(v), v)
+			if !ok {
+				continue
+			}
+			var key []uint64
+			for _, n := range numbers.FindStringSubmatch(v)[1:] {
+				num, _ := strconv.ParseUint(n, 10, 64)
+				key = append(key, num)
+			}
+			if prerelease.MatchString(v) {
+				key = append(key, 0)
+			} else {
+				key = append(key, 1)
+			}
+			assert.Equal(t, want, key, v)
+		}
+	})
+	t.Run("transitions match either version", func(t *testing.T) {
+		q, _ := generateTransitionQuery(callhome.TelemetryFilters{City: "Paris", Version: "!0.13.0"})
+		assert.Equal(t, "WHERE city = :city AND (COALESCE(from_version, '') NOT IN (:version_not_0) OR COALESCE(to_version, '') NOT IN (:version_not_0))", q)
+	})
+}
+
+func TestRetrieveActivity(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("invalid interval", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveActivity(ctx, "fortnight", callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidTimeSeries)
+	})
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveActivity(ctx, callhome.IntervalWeek, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		week := time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"ip_address", "bucket"}).
+			AddRow("10.0.0.1", week).
+			AddRow("10.0.0.1", week.AddDate(0, 0, 7))
+		mock.ExpectQuery(`SELECT DISTINCT ip_address, time_bucket\(INTERVAL '1 week', time\) AS bucket`).
+			WithArgs("users").
+			WillReturnRows(rows)
+
+		activity, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveActivity(ctx, callhome.IntervalWeek, callhome.TelemetryFilters{Service: "users"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.ActivityBucket{
+			{Time: week, IpAddress: "10.0.0.1"},
+			{Time: week.AddDate(0, 0, 7), IpAddress: "10.0.0.1"},
+		}, activity)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveDeployment(t *testing.T) {
+	ctx := context.TODO()
+	id := "0f3b8e4c2a9d4c6e8b1a7d5f3e2c1b0a"
+	t.Run("not found", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery(`(?s)FROM telemetry t\s+WHERE t.ip_address = \(SELECT ip_address FROM deployments WHERE id = \?\)`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"ip_address"}))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveDeployment(ctx, id)
+		assert.ErrorIs(t, err, callhome.ErrDeploymentNotFound)
+	})
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveDeployment(ctx, id)
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+		first := now.AddDate(0, 0, -2)
+		mock.ExpectQuery(`(?s)ORDER BY t.time DESC\s+LIMIT 1`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"ip_address", "time", "service_time", "longitude", "latitude", "mg_version", "country", "city", "services", "first_seen"}).
+				AddRow("10.0.0.1", now, now, 20.45, 44.82, "0.14.0", "Serbia", "Belgrade", "{things,users}", first))
+		mock.ExpectQuery(`(?s)GROUP BY mg_version\s+ORDER BY first_seen`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"mg_version", "first_seen", "last_seen"}).
+				AddRow("0.13.0", first, first).
+				AddRow("0.14.0", now, now))
+
+		d, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveDeployment(ctx, id)
+		assert.Nil(t, err)
+		assert.Equal(t, id, d.ID)
+		assert.Equal(t, "Belgrade", d.Latest.City)
+		assert.Equal(t, pq.StringArray{"things", "users"}, d.Latest.Services)
+		assert.Equal(t, first, d.FirstSeen)
+		assert.Equal(t, []callhome.VersionPeriod{
+			{Version: "0.13.0", FirstSeen: first, LastSeen: first},
+			{Version: "0.14.0", FirstSeen: now, LastSeen: now},
+		}, d.Versions)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveHeartbeats(t *testing.T) {
+	ctx := context.TODO()
+	id := "0f3b8e4c2a9d4c6e8b1a7d5f3e2c1b0a"
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveHeartbeats(ctx, id, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`SELECT DISTINCT time FROM telemetry WHERE time >= \? AND ip_address = \(SELECT ip_address FROM deployments WHERE id = \?\) ORDER BY time`).
+			WithArgs(from, id).
+			WillReturnRows(sqlmock.NewRows([]string{"time"}).
+				AddRow(from.Add(time.Hour)).
+				AddRow(from.Add(90 * time.Minute)))
+
+		beats, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveHeartbeats(ctx, id, callhome.TelemetryFilters{From: from})
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Time{from.Add(time.Hour), from.Add(90 * time.Minute)}, beats)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveServiceSets(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveServiceSets(ctx, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		rows := sqlmock.NewRows([]string{"services", "count"}).
+			AddRow("{things,users}", 3).
+			AddRow("{users}", 1)
+		mock.ExpectQuery(`(?s)WHERE country = \? AND service <> ''\s+GROUP BY ip_address\s+HAVING BOOL_OR\(service = \?\)\s`).
+			WithArgs("Serbia", "users").
+			WillReturnRows(rows)
+
+		sets, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveServiceSets(ctx, callhome.TelemetryFilters{Country: "Serbia", Service: "users"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.ServiceSet{
+			{Services: []string{"things", "users"}, Deployments: 3},
+			{Services: []string{"users"}, Deployments: 1},
+		}, sets)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("service expression", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
-		mock.ExpectQuery("SELECT.*country.*number_of_deployments.*cities.*services.*versions.*FROM telemetry.*GROUP BY country").WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"services", "count"}).
+			AddRow("{things,users}", 3)
+		mock.ExpectQuery(`(?s)HAVING BOOL_OR\(service IN \(\?, \?\)\) AND BOOL_AND\(COALESCE\(service, ''\) NOT IN \(\?\)\)`).
+			WithArgs("things", "users", "bootstrap").
+			WillReturnRows(rows)
 
-		summary, err := repo.RetrieveSummary(ctx, callhome.TelemetryFilters{})
+		sets, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveServiceSets(ctx, callhome.TelemetryFilters{Service: "users,things,!bootstrap"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.ServiceSet{{Services: []string{"things", "users"}, Deployments: 3}}, sets)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveAggregate(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("invalid query", func(t *testing.T) {
+		sqlDB, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveAggregate(ctx, callhome.AggregateQuery{GroupBy: []string{"ip_address"}}, callhome.TelemetryFilters{})
+		assert.ErrorIs(t, err, callhome.ErrInvalidAggregateQuery)
+	})
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
 		assert.Nil(t, err)
-		assert.NotNil(t, summary)
+		defer sqlDB.Close()
 
-		// Verify countries
-		assert.Equal(t, 2, len(summary.Countries))
-		assert.Equal(t, 8, summary.TotalDeployments) // 5 + 3
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveAggregate(ctx, callhome.AggregateQuery{GroupBy: []string{callhome.GroupByCountry}}, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
-		// Verify unique cities (should have 4 unique cities)
-		assert.Equal(t, 4, len(summary.Cities))
-		citiesMap := make(map[string]bool)
-		for _, city := range summary.Cities {
-			citiesMap[city] = true
+		week := time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"g0", "g1", "m0", "m1"}).
+			AddRow("Belgrade", week, 12, 3).
+			AddRow("Paris", week, 4, 1)
+		mock.ExpectQuery(`(?s)SELECT COALESCE\(city, ''\) AS g0, time_bucket\(INTERVAL '1 week', time\) AS g1, COUNT\(\*\) AS m0, COUNT\(DISTINCT ip_address\) AS m1\s+`+
+			`FROM telemetry\s+WHERE service = \?\s+GROUP BY g0, g1\s+ORDER BY m0 DESC, g0, g1\s+LIMIT \?`).
+			WithArgs("users", 5).
+			WillReturnRows(rows)
+
+		q := callhome.AggregateQuery{
+			GroupBy: []string{callhome.GroupByCity, callhome.GroupByWeek},
+			Metrics: []string{callhome.MetricHeartbeats, callhome.MetricDeployments},
+			Top:     5,
 		}
-		assert.True(t, citiesMap["New York"])
-		assert.True(t, citiesMap["Los Angeles"])
-		assert.True(t, citiesMap["London"])
-		assert.True(t, citiesMap["Manchester"])
-
-		// Verify unique services (should have 3 unique services)
-		assert.Equal(t, 3, len(summary.Services))
-		servicesMap := make(map[string]bool)
-		for _, service := range summary.Services {
-			servicesMap[service] = true
+		res, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveAggregate(ctx, q, callhome.TelemetryFilters{Service: "users"})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.AggregateRow{
+			{Groups: []string{"Belgrade", "2024-02-26T00:00:00Z"}, Metrics: []int{12, 3}},
+			{Groups: []string{"Paris", "2024-02-26T00:00:00Z"}, Metrics: []int{4, 1}},
+		}, res)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCountHeartbeats(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT COUNT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).CountHeartbeats(ctx, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM telemetry\s+WHERE service = \?`).
+			WithArgs("users").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1234))
+		count, err := New(sqlx.NewDb(sqlDB, "sqlmock")).CountHeartbeats(ctx, callhome.TelemetryFilters{Service: "users"})
+		assert.Nil(t, err)
+		assert.Equal(t, 1234, count)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveLastSeen(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("WITH seen AS(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveLastSeen(ctx, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		last := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"ip_address", "country", "city", "mg_version", "first_seen", "last_seen", "heartbeats"}).
+			AddRow("10.0.0.1", "Serbia", "Belgrade", "0.14.0", last.Add(-24*time.Hour), last, 49)
+		mock.ExpectQuery(`(?s)WITH seen AS \(\s+SELECT ip_address, MIN\(time\) AS first_seen, MAX\(time\) AS last_seen, COUNT\(DISTINCT time\) AS heartbeats\s+`+
+			`FROM telemetry\s+WHERE time >= \? AND time <= \?\s+GROUP BY ip_address.*JOIN telemetry t ON t.ip_address = s.ip_address AND t.time = s.last_seen.*ORDER BY s.last_seen DESC, s.ip_address`).
+			WithArgs(last.Add(-time.Hour), last).
+			WillReturnRows(rows)
+
+		seen, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveLastSeen(ctx, callhome.TelemetryFilters{From: last.Add(-time.Hour), To: last})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.DeploymentSeen{{
+			IpAddress:  "10.0.0.1",
+			Country:    "Serbia",
+			City:       "Belgrade",
+			Version:    "0.14.0",
+			FirstSeen:  last.Add(-24 * time.Hour),
+			LastSeen:   last,
+			Heartbeats: 49,
+		}}, seen)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRetrieveClientsSeen(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("error performing query", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectQuery("SELECT(.*)").WillReturnError(fmt.Errorf("any error"))
+		_, err = New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveClientsSeen(ctx, callhome.TelemetryFilters{})
+		assert.NotNil(t, err)
+	})
+	t.Run("successful", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		last := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"deployment_id", "mac_address", "service", "first_seen", "last_seen", "heartbeats"}).
+			AddRow("d1", "00:00:00:00:00:01", "things", last.Add(-time.Hour), last, 3).
+			AddRow("d1", "00:00:00:00:00:01", "users", last.Add(-54*time.Minute), last.Add(-6*time.Minute), 2)
+		mock.ExpectQuery(`(?s)FROM telemetry t\s+INNER JOIN deployments d ON d.ip_address = t.ip_address\s+WHERE time >= \? AND time <= \?\s+GROUP BY 1, 2, 3`).
+			WithArgs(last.Add(-time.Hour), last).
+			WillReturnRows(rows)
+
+		seen, err := New(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveClientsSeen(ctx, callhome.TelemetryFilters{From: last.Add(-time.Hour), To: last})
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.ClientSeen{
+			{DeploymentID: "d1", MacAddress: "00:00:00:00:00:01", Service: "things", FirstSeen: last.Add(-time.Hour), LastSeen: last, Heartbeats: 3},
+			{DeploymentID: "d1", MacAddress: "00:00:00:00:00:01", Service: "users", FirstSeen: last.Add(-54 * time.Minute), LastSeen: last.Add(-6 * time.Minute), Heartbeats: 2},
+		}, seen)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestExportTelemetry(t *testing.T) {
+	ctx := context.TODO()
+	columns := []string{"ip_address", "time", "service_time", "longitude", "latitude", "mg_version", "country", "city", "region", "service", "services"}
+	at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	t.Run("error declaring cursor", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DECLARE export_cursor").WillReturnError(fmt.Errorf("any error"))
+		mock.ExpectRollback()
+		err = New(sqlx.NewDb(sqlDB, "sqlmock")).ExportTelemetry(ctx, callhome.ExportHeartbeats, callhome.TelemetryFilters{}, func(callhome.Telemetry) error { return nil })
+		assert.NotNil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("fetches in batches", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`(?s)DECLARE export_cursor NO SCROLL CURSOR FOR\s+SELECT \(SELECT id FROM deployments.*COALESCE\(service, ''\) AS service.*FROM telemetry\s+WHERE country = \?\s+ORDER BY time, deployment_id, service`).
+			WithArgs("Serbia").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		batch := sqlmock.NewRows(columns)
+		for i := 0; i < exportBatch; i++ {
+			batch.AddRow("10.0.0.1", at, at, 20.4, 44.8, "0.14.0", "Serbia", "Belgrade", "", "users", nil)
 		}
-		assert.True(t, servicesMap["auth"])
-		assert.True(t, servicesMap["users"])
-		assert.True(t, servicesMap["things"])
-
-		// Verify unique versions (should have 2 unique versions)
-		assert.Equal(t, 2, len(summary.Versions))
-		versionsMap := make(map[string]bool)
-		for _, version := range summary.Versions {
-			versionsMap[version] = true
+		mock.ExpectQuery(fmt.Sprintf("FETCH %d FROM export_cursor", exportBatch)).WillReturnRows(batch)
+		mock.ExpectQuery(fmt.Sprintf("FETCH %d FROM export_cursor", exportBatch)).WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("10.0.0.2", at, at, 20.4, 44.8, "0.13.0", "Serbia", "Novi Sad", "", "things", nil))
+		mock.ExpectCommit()
+
+		var export []callhome.Telemetry
+		err = New(sqlx.NewDb(sqlDB, "sqlmock")).ExportTelemetry(ctx, callhome.ExportHeartbeats, callhome.TelemetryFilters{Country: "Serbia"}, func(tel callhome.Telemetry) error {
+			export = append(export, tel)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Len(t, export, exportBatch+1)
+		assert.Equal(t, callhome.Telemetry{
+			IpAddress:   "10.0.0.2",
+			Service:     "things",
+			Version:     "0.13.0",
+			Country:     "Serbia",
+			City:        "Novi Sad",
+			Longitude:   20.4,
+			Latitude:    44.8,
+			LastSeen:    at,
+			ServiceTime: at,
+		}, export[exportBatch])
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("deployments stop at the first error", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`(?s)DECLARE export_cursor NO SCROLL CURSOR FOR\s+WITH latest_per_ip AS.*ARRAY_AGG\(DISTINCT service\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FETCH").WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("10.0.0.1", at, at, 20.4, 44.8, "0.14.0", "Serbia", "Belgrade", "", "", "{things,users}").
+			AddRow("10.0.0.2", at, at, 20.4, 44.8, "0.13.0", "Serbia", "Novi Sad", "", "", "{users}"))
+		mock.ExpectRollback()
+
+		errStop := fmt.Errorf("stop")
+		var export []callhome.Telemetry
+		err = New(sqlx.NewDb(sqlDB, "sqlmock")).ExportTelemetry(ctx, callhome.ExportDeployments, callhome.TelemetryFilters{}, func(tel callhome.Telemetry) error {
+			export = append(export, tel)
+			return errStop
+		})
+		assert.Equal(t, errStop, err)
+		if assert.Len(t, export, 1) {
+			assert.Equal(t, pq.StringArray{"things", "users"}, export[0].Services)
 		}
-		assert.True(t, versionsMap["0.14.0"])
-		assert.True(t, versionsMap["0.13.0"])
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWebhookRepo(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("remove missing webhook", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		mock.ExpectExec(`DELETE FROM webhooks WHERE id = \$1`).WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 0))
+		err = NewWebhookRepo(sqlx.NewDb(sqlDB, "sqlmock")).RemoveWebhook(ctx, "a")
+		assert.ErrorIs(t, err, callhome.ErrWebhookNotFound)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("delivery to removed webhook", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
 
+		at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+		mock.ExpectExec(`(?s)INSERT INTO webhook_deliveries .* WHERE EXISTS \(SELECT 1 FROM webhooks WHERE id = \?\)`).
+			WithArgs("a", "e1", callhome.EventMilestone, 1, at, 200, "", "a").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		err = NewWebhookRepo(sqlx.NewDb(sqlDB, "sqlmock")).SaveDelivery(ctx, callhome.Delivery{
+			WebhookID: "a", EventID: "e1", EventType: callhome.EventMilestone, Attempt: 1, Time: at, StatusCode: 200,
+		})
+		assert.ErrorIs(t, err, callhome.ErrWebhookNotFound)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	t.Run("retrieve webhooks", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		defer sqlDB.Close()
+
+		at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"id", "url", "secret", "events", "created_at"}).
+			AddRow("a", "https://example.com/hooks", "secret", "{new_country,milestone}", at)
+		mock.ExpectQuery(`SELECT id, url, secret, events, created_at FROM webhooks ORDER BY created_at, id`).WillReturnRows(rows)
+		hooks, err := NewWebhookRepo(sqlx.NewDb(sqlDB, "sqlmock")).RetrieveWebhooks(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.Webhook{{
+			ID:        "a",
+			URL:       "https://example.com/hooks",
+			Secret:    "secret",
+			Events:    []string{callhome.EventNewCountry, callhome.EventMilestone},
+			CreatedAt: at,
+		}}, hooks)
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 }
@@ -0,0 +1,85 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// bucketWidths maps time series intervals to time_bucket widths. Week buckets
+// start on Monday and month buckets on the first, both in UTC.
+var bucketWidths = map[string]string{
+	callhome.IntervalHour:  "1 hour",
+	callhome.IntervalDay:   "1 day",
+	callhome.IntervalWeek:  "1 week",
+	callhome.IntervalMonth: "1 month",
+}
+
+// splitColumns maps time series split dimensions to telemetry columns.
+var splitColumns = map[string]string{
+	"":                      "''",
+	callhome.SplitByCountry: "country",
+	callhome.SplitByVersion: "mg_version",
+	callhome.SplitByService: "service",
+}
+
+// RetrieveTimeSeries counts distinct deployments reporting in each time bucket.
+func (r repo) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) ([]callhome.TimeSeriesBucket, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.TimeSeriesBucket, error) {
+		return retrieveTimeSeries(ctx, db, q, filters)
+	})
+}
+
+func retrieveTimeSeries(ctx context.Context, db *sqlx.DB, tq callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) ([]callhome.TimeSeriesBucket, error) {
+	width, ok := bucketWidths[tq.Interval]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	column, ok := splitColumns[tq.SplitBy]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	filterQuery, params := generateQuery(filters)
+
+	// Width and column are taken from the maps above, never from the input.
+	q := fmt.Sprintf(`
+		SELECT
+			time_bucket(INTERVAL '%s', time) AS bucket,
+			COALESCE(%s, '') AS grp,
+			COUNT(DISTINCT ip_address) AS count
+		FROM telemetry
+		%s
+		GROUP BY bucket, grp
+		ORDER BY bucket, grp;
+	`, width, column, filterQuery)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []callhome.TimeSeriesBucket
+	for rows.Next() {
+		var res struct {
+			Bucket time.Time `db:"bucket"`
+			Group  string    `db:"grp"`
+			Count  int       `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, callhome.TimeSeriesBucket{
+			Time:              res.Bucket.UTC(),
+			Group:             res.Group,
+			ActiveDeployments: res.Count,
+		})
+	}
+	return buckets, rows.Err()
+}
@@ -5,15 +5,31 @@ package tracing
 
 import (
 	"context"
+	"time"
 
 	"github.com/absmach/callhome"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	retrieveAllOp     = "retrieve_all_op"
-	retrieveSummaryOp = "retrieve_summary_op"
-	saveOp            = "save_op"
+	retrieveAllOp              = "retrieve_all_op"
+	retrieveSummaryOp          = "retrieve_summary_op"
+	saveOp                     = "save_op"
+	retrievePoliciesOp         = "retrieve_policies_op"
+	retrieveTimeSeriesOp       = "retrieve_time_series_op"
+	retrieveVersionsOp         = "retrieve_versions_op"
+	retrieveTransitionsOp      = "retrieve_transitions_op"
+	retrieveTransitionCountsOp = "retrieve_transition_counts_op"
+	retrieveActivityOp         = "retrieve_activity_op"
+	retrieveAggregateOp        = "retrieve_aggregate_op"
+	countHeartbeatsOp          = "count_heartbeats_op"
+	retrieveServiceSetsOp      = "retrieve_service_sets_op"
+	retrieveDeploymentOp       = "retrieve_deployment_op"
+	retrieveHeartbeatsOp       = "retrieve_heartbeats_op"
+	retrieveLastSeenOp         = "retrieve_last_seen_op"
+	retrieveClientsSeenOp      = "retrieve_clients_seen_op"
+	exportTelemetryOp          = "export_telemetry_op"
 )
 
 var _ callhome.TelemetryRepo = (*repoTracer)(nil)
@@ -51,3 +67,115 @@ func (rt *repoTracer) Save(ctx context.Context, t callhome.Telemetry) error {
 	defer span.End()
 	return rt.repo.Save(ctx, t)
 }
+
+// RetrievePolicies adds tracing middleware to retrieve policies method.
+func (rt *repoTracer) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	ctx, span := rt.tracer.Start(ctx, retrievePoliciesOp)
+	defer span.End()
+	return rt.repo.RetrievePolicies(ctx)
+}
+
+// RetrieveTimeSeries adds tracing middleware to retrieve time series method.
+func (rt *repoTracer) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filter callhome.TelemetryFilters) ([]callhome.TimeSeriesBucket, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveTimeSeriesOp, trace.WithAttributes(
+		attribute.String("interval", q.Interval),
+		attribute.String("split_by", q.SplitBy),
+	))
+	defer span.End()
+	return rt.repo.RetrieveTimeSeries(ctx, q, filter)
+}
+
+// RetrieveVersions adds tracing middleware to retrieve versions method.
+func (rt *repoTracer) RetrieveVersions(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveVersionsOp)
+	defer span.End()
+	return rt.repo.RetrieveVersions(ctx, filter)
+}
+
+// RetrieveTransitions adds tracing middleware to retrieve transitions method.
+func (rt *repoTracer) RetrieveTransitions(ctx context.Context, interval string, filter callhome.TelemetryFilters) ([]callhome.TransitionBucket, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveTransitionsOp, trace.WithAttributes(
+		attribute.String("interval", interval),
+	))
+	defer span.End()
+	return rt.repo.RetrieveTransitions(ctx, interval, filter)
+}
+
+// RetrieveTransitionCounts adds tracing middleware to retrieve transition counts method.
+func (rt *repoTracer) RetrieveTransitionCounts(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.TransitionCount, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveTransitionCountsOp)
+	defer span.End()
+	return rt.repo.RetrieveTransitionCounts(ctx, filter)
+}
+
+// RetrieveActivity adds tracing middleware to retrieve activity method.
+func (rt *repoTracer) RetrieveActivity(ctx context.Context, interval string, filter callhome.TelemetryFilters) ([]callhome.ActivityBucket, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveActivityOp, trace.WithAttributes(
+		attribute.String("interval", interval),
+	))
+	defer span.End()
+	return rt.repo.RetrieveActivity(ctx, interval, filter)
+}
+
+// RetrieveAggregate adds tracing middleware to retrieve aggregate method.
+func (rt *repoTracer) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filter callhome.TelemetryFilters) ([]callhome.AggregateRow, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveAggregateOp, trace.WithAttributes(
+		attribute.StringSlice("group_by", q.GroupBy),
+		attribute.StringSlice("metrics", q.Metrics),
+	))
+	defer span.End()
+	return rt.repo.RetrieveAggregate(ctx, q, filter)
+}
+
+// CountHeartbeats adds tracing middleware to count heartbeats method.
+func (rt *repoTracer) CountHeartbeats(ctx context.Context, filter callhome.TelemetryFilters) (int, error) {
+	ctx, span := rt.tracer.Start(ctx, countHeartbeatsOp)
+	defer span.End()
+	return rt.repo.CountHeartbeats(ctx, filter)
+}
+
+// RetrieveServiceSets adds tracing middleware to retrieve service sets method.
+func (rt *repoTracer) RetrieveServiceSets(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.ServiceSet, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveServiceSetsOp)
+	defer span.End()
+	return rt.repo.RetrieveServiceSets(ctx, filter)
+}
+
+// RetrieveDeployment adds tracing middleware to retrieve deployment method.
+func (rt *repoTracer) RetrieveDeployment(ctx context.Context, id string) (callhome.Deployment, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveDeploymentOp, trace.WithAttributes(
+		attribute.String("deployment_id", id),
+	))
+	defer span.End()
+	return rt.repo.RetrieveDeployment(ctx, id)
+}
+
+// RetrieveHeartbeats adds tracing middleware to retrieve heartbeats method.
+func (rt *repoTracer) RetrieveHeartbeats(ctx context.Context, id string, filter callhome.TelemetryFilters) ([]time.Time, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveHeartbeatsOp, trace.WithAttributes(
+		attribute.String("deployment_id", id),
+	))
+	defer span.End()
+	return rt.repo.RetrieveHeartbeats(ctx, id, filter)
+}
+
+// RetrieveLastSeen adds tracing middleware to retrieve last seen method.
+func (rt *repoTracer) RetrieveLastSeen(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.DeploymentSeen, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveLastSeenOp)
+	defer span.End()
+	return rt.repo.RetrieveLastSeen(ctx, filter)
+}
+
+// RetrieveClientsSeen adds tracing middleware to retrieve clients seen method.
+func (rt *repoTracer) RetrieveClientsSeen(ctx context.Context, filter callhome.TelemetryFilters) ([]callhome.ClientSeen, error) {
+	ctx, span := rt.tracer.Start(ctx, retrieveClientsSeenOp)
+	defer span.End()
+	return rt.repo.RetrieveClientsSeen(ctx, filter)
+}
+
+// ExportTelemetry adds tracing middleware to export telemetry method.
+func (rt *repoTracer) ExportTelemetry(ctx context.Context, rows string, filter callhome.TelemetryFilters, fn func(callhome.Telemetry) error) error {
+	ctx, span := rt.tracer.Start(ctx, exportTelemetryOp)
+	defer span.End()
+	return rt.repo.ExportTelemetry(ctx, rows, filter, fn)
+}
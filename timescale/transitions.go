@@ -0,0 +1,177 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// transitionQueries record the version transitions around a saved heartbeat,
+// compared to the previous and the next heartbeat of the same deployment, MAC
+// address and service that report a version. A heartbeat saved out of order
+// replaces the transition of the next heartbeat. Parameters are cast, since their types
+// cannot be inferred from the select list.
+var transitionQueries = []string{
+	`INSERT INTO version_transitions (time, ip_address, mac_address, service, from_version, to_version, country, city, latitude, longitude)
+	SELECT CAST(:time AS TIMESTAMPTZ), CAST(:ip_address AS TEXT), CAST(:mac_address AS TEXT), CAST(:service AS TEXT),
+		prev.mg_version, CAST(:mg_version AS TEXT), CAST(:country AS TEXT), CAST(:city AS TEXT),
+		CAST(:latitude AS DOUBLE PRECISION), CAST(:longitude AS DOUBLE PRECISION)
+	FROM (
+		SELECT mg_version FROM telemetry
+		WHERE ip_address = :ip_address AND COALESCE(mac_address, '') = :mac_address AND COALESCE(service, '') = :service
+			AND time < :time AND mg_version <> ''
+		ORDER BY time DESC
+		LIMIT 1
+	) prev
+	WHERE prev.mg_version <> :mg_version
+	ON CONFLICT DO NOTHING;`,
+	`DELETE FROM version_transitions
+	WHERE ip_address = :ip_address AND mac_address = :mac_address AND service = :service AND time = (
+		SELECT time FROM telemetry
+		WHERE ip_address = :ip_address AND COALESCE(mac_address, '') = :mac_address AND COALESCE(service, '') = :service
+			AND time > :time AND mg_version <> ''
+		ORDER BY time
+		LIMIT 1
+	);`,
+	`INSERT INTO version_transitions (time, ip_address, mac_address, service, from_version, to_version, country, city, latitude, longitude)
+	SELECT next.time, CAST(:ip_address AS TEXT), CAST(:mac_address AS TEXT), CAST(:service AS TEXT),
+		CAST(:mg_version AS TEXT), next.mg_version, next.country, next.city, next.latitude, next.longitude
+	FROM (
+		SELECT time, mg_version, country, city, latitude, longitude FROM telemetry
+		WHERE ip_address = :ip_address AND COALESCE(mac_address, '') = :mac_address AND COALESCE(service, '') = :service
+			AND time > :time AND mg_version <> ''
+		ORDER BY time
+		LIMIT 1
+	) next
+	WHERE next.mg_version <> :mg_version
+	ON CONFLICT DO NOTHING;`,
+}
+
+// RetrieveTransitions counts deployments moving between versions in each time bucket.
+func (r repo) RetrieveTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) ([]callhome.TransitionBucket, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.TransitionBucket, error) {
+		return retrieveTransitions(ctx, db, interval, filters)
+	})
+}
+
+func retrieveTransitions(ctx context.Context, db *sqlx.DB, interval string, filters callhome.TelemetryFilters) ([]callhome.TransitionBucket, error) {
+	width, ok := bucketWidths[interval]
+	if !ok {
+		return nil, callhome.ErrInvalidTimeSeries
+	}
+	filterQuery, params := generateTransitionQuery(filters)
+
+	q := fmt.Sprintf(`
+		SELECT
+			time_bucket(INTERVAL '%s', time) AS bucket,
+			from_version,
+			to_version,
+			COUNT(DISTINCT ip_address) AS count
+		FROM version_transitions
+		%s
+		GROUP BY bucket, from_version, to_version
+		ORDER BY bucket, from_version, to_version;
+	`, width, filterQuery)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []callhome.TransitionBucket
+	for rows.Next() {
+		var res struct {
+			Bucket time.Time `db:"bucket"`
+			From   string    `db:"from_version"`
+			To     string    `db:"to_version"`
+			Count  int       `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, callhome.TransitionBucket{
+			Time:        res.Bucket.UTC(),
+			From:        res.From,
+			To:          res.To,
+			Deployments: res.Count,
+		})
+	}
+	return buckets, rows.Err()
+}
+
+// RetrieveTransitionCounts counts deployments moving between versions over the
+// whole filtered range.
+func (r repo) RetrieveTransitionCounts(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.TransitionCount, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.TransitionCount, error) {
+		return retrieveTransitionCounts(ctx, db, filters)
+	})
+}
+
+func retrieveTransitionCounts(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) ([]callhome.TransitionCount, error) {
+	filterQuery, params := generateTransitionQuery(filters)
+
+	q := fmt.Sprintf(`
+		SELECT from_version, to_version, COUNT(DISTINCT ip_address) AS count
+		FROM version_transitions
+		%s
+		GROUP BY from_version, to_version
+		ORDER BY from_version, to_version;
+	`, filterQuery)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []callhome.TransitionCount
+	for rows.Next() {
+		var res struct {
+			From  string `db:"from_version"`
+			To    string `db:"to_version"`
+			Count int    `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		counts = append(counts, callhome.TransitionCount{From: res.From, To: res.To, Deployments: res.Count})
+	}
+	return counts, rows.Err()
+}
+
+// generateTransitionQuery applies telemetry filters to version transitions. The
+// version filter matches either side of a transition.
+func generateTransitionQuery(filters callhome.TelemetryFilters) (string, map[string]interface{}) {
+	var queries []string
+	params := make(map[string]interface{})
+
+	if !filters.From.IsZero() {
+		queries = append(queries, "time >= :from")
+		params["from"] = filters.From
+	}
+	if !filters.To.IsZero() {
+		queries = append(queries, "time <= :to")
+		params["to"] = filters.To
+	}
+	// The version filter matches either side of a transition.
+	version := filters.ValueFilters().Version
+	filters.Version = ""
+	queries = dialect.ValueQueries(queries, params, filters)
+	if q := dialect.ValueQuery("from_version", "version", version, params); q != "" {
+		queries = append(queries, fmt.Sprintf("(%s OR %s)", q, dialect.ValueQuery("to_version", "version", version, params)))
+	}
+	queries = geoQueries(queries, params, filters)
+
+	if len(queries) == 0 {
+		return "", params
+	}
+	return fmt.Sprintf("WHERE %s", strings.Join(queries, " AND ")), params
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// RetrieveVersions gets the number of deployments running each version and
+// the time each version was first reported.
+func (r repo) RetrieveVersions(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	return read(ctx, r, func(db *sqlx.DB) ([]callhome.VersionUsage, error) {
+		return retrieveVersions(ctx, db, filters)
+	})
+}
+
+func retrieveVersions(ctx context.Context, db *sqlx.DB, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	filterQuery, params := generateQuery(filters)
+
+	// A deployment runs the version reported by its latest heartbeat.
+	q := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT ip_address, COALESCE(mg_version, '') AS version, time
+			FROM telemetry
+			%s
+		),
+		latest AS (
+			SELECT DISTINCT ON (ip_address) ip_address, version
+			FROM filtered
+			ORDER BY ip_address, time DESC
+		)
+		SELECT f.version, f.first_seen, COALESCE(l.count, 0) AS count
+		FROM (SELECT version, MIN(time) AS first_seen FROM filtered GROUP BY version) f
+		LEFT JOIN (SELECT version, COUNT(*) AS count FROM latest GROUP BY version) l USING (version)
+		ORDER BY f.version;
+	`, filterQuery)
+
+	rows, err := db.NamedQueryContext(ctx, q, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []callhome.VersionUsage
+	for rows.Next() {
+		var res struct {
+			Version   string    `db:"version"`
+			FirstSeen time.Time `db:"first_seen"`
+			Count     int       `db:"count"`
+		}
+		if err := rows.StructScan(&res); err != nil {
+			return nil, err
+		}
+		usage = append(usage, callhome.VersionUsage{
+			Version:     res.Version,
+			Deployments: res.Count,
+			FirstSeen:   res.FirstSeen.UTC(),
+		})
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package timescale
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ callhome.WebhookRepo = (*webhookRepo)(nil)
+
+// webhookRepo always uses the primary db, so webhooks are delivered as soon
+// as they are created.
+type webhookRepo struct {
+	db *sqlx.DB
+}
+
+// NewWebhookRepo returns new TimescaleSQL webhook repository.
+func NewWebhookRepo(db *sqlx.DB) callhome.WebhookRepo {
+	return &webhookRepo{db: db}
+}
+
+type dbWebhook struct {
+	ID        string         `db:"id"`
+	URL       string         `db:"url"`
+	Secret    string         `db:"secret"`
+	Events    pq.StringArray `db:"events"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (dbw dbWebhook) toWebhook() callhome.Webhook {
+	return callhome.Webhook{
+		ID:        dbw.ID,
+		URL:       dbw.URL,
+		Secret:    dbw.Secret,
+		Events:    dbw.Events,
+		CreatedAt: dbw.CreatedAt.UTC(),
+	}
+}
+
+func (r webhookRepo) SaveWebhook(ctx context.Context, w callhome.Webhook) error {
+	q := `INSERT INTO webhooks (id, url, secret, events, created_at)
+		VALUES (:id, :url, :secret, :events, :created_at);`
+	_, err := r.db.NamedExecContext(ctx, q, dbWebhook{
+		ID:        w.ID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+	})
+	return err
+}
+
+func (r webhookRepo) RetrieveWebhook(ctx context.Context, id string) (callhome.Webhook, error) {
+	var dbw dbWebhook
+	err := r.db.GetContext(ctx, &dbw, `SELECT id, url, secret, events, created_at FROM webhooks WHERE id = $1;`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return callhome.Webhook{}, callhome.ErrWebhookNotFound
+	}
+	if err != nil {
+		return callhome.Webhook{}, err
+	}
+	return dbw.toWebhook(), nil
+}
+
+func (r webhookRepo) RetrieveWebhooks(ctx context.Context) ([]callhome.Webhook, error) {
+	var dbws []dbWebhook
+	if err := r.db.SelectContext(ctx, &dbws, `SELECT id, url, secret, events, created_at FROM webhooks ORDER BY created_at, id;`); err != nil {
+		return nil, err
+	}
+	var ret []callhome.Webhook
+	for _, dbw := range dbws {
+		ret = append(ret, dbw.toWebhook())
+	}
+	return ret, nil
+}
+
+// RemoveWebhook removes the webhook, and its deliveries along with it.
+func (r webhookRepo) RemoveWebhook(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return callhome.ErrWebhookNotFound
+	}
+	return nil
+}
+
+type dbDelivery struct {
+	WebhookID  string    `db:"webhook_id"`
+	EventID    string    `db:"event_id"`
+	EventType  string    `db:"event_type"`
+	Attempt    int       `db:"attempt"`
+	Time       time.Time `db:"time"`
+	StatusCode int       `db:"status_code"`
+	Error      string    `db:"error"`
+}
+
+// SaveDelivery logs the delivery, unless the webhook was removed meanwhile.
+func (r webhookRepo) SaveDelivery(ctx context.Context, d callhome.Delivery) error {
+	q := `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, time, status_code, error)
+		SELECT :webhook_id, :event_id, :event_type, :attempt, :time, :status_code, :error
+		WHERE EXISTS (SELECT 1 FROM webhooks WHERE id = :webhook_id);`
+	res, err := r.db.NamedExecContext(ctx, q, dbDelivery(d))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return callhome.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r webhookRepo) RetrieveDeliveries(ctx context.Context, webhookID string, limit int) ([]callhome.Delivery, error) {
+	q := `SELECT webhook_id, event_id, event_type, attempt, time, status_code, error
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY time DESC, attempt DESC
+		LIMIT $2;`
+	var dbds []dbDelivery
+	if err := r.db.SelectContext(ctx, &dbds, q, webhookID, limit); err != nil {
+		return nil, err
+	}
+	var ret []callhome.Delivery
+	for _, dbd := range dbds {
+		dbd.Time = dbd.Time.UTC()
+		ret = append(ret, callhome.Delivery(dbd))
+	}
+	return ret, nil
+}
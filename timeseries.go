@@ -0,0 +1,82 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"errors"
+	"time"
+)
+
+// Time series bucket intervals.
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Dimensions a time series can be split by.
+const (
+	SplitByCountry = "country"
+	SplitByVersion = "version"
+	SplitByService = "service"
+)
+
+// ErrInvalidTimeSeries indicates an unsupported time series interval or split.
+var ErrInvalidTimeSeries = errors.New("invalid time series query")
+
+// TimeSeriesQuery specifies how telemetry is bucketed into a time series.
+type TimeSeriesQuery struct {
+	// Interval is the bucket width, one of the Interval constants.
+	Interval string
+	// SplitBy optionally splits each bucket by one of the SplitBy dimensions.
+	SplitBy string
+}
+
+// Validate checks the interval and the split dimension are supported.
+func (q TimeSeriesQuery) Validate() error {
+	switch q.Interval {
+	case IntervalHour, IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return ErrInvalidTimeSeries
+	}
+	switch q.SplitBy {
+	case "", SplitByCountry, SplitByVersion, SplitByService:
+	default:
+		return ErrInvalidTimeSeries
+	}
+	return nil
+}
+
+// TimeSeriesBucket is the number of deployments active in a single bucket,
+// for a single group if the time series is split.
+type TimeSeriesBucket struct {
+	Time              time.Time `json:"time"`
+	Group             string    `json:"group,omitempty"`
+	ActiveDeployments int       `json:"active_deployments"`
+}
+
+// TimeSeries is the number of active deployments over time, ordered by bucket
+// time and then by group.
+type TimeSeries struct {
+	TimeSeriesQuery
+	Buckets []TimeSeriesBucket
+}
+
+// BucketStart returns the start of the UTC bucket of the given interval that t
+// falls into. Weeks start on Monday.
+func BucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case IntervalHour:
+		return t.Truncate(time.Hour)
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketStart(t *testing.T) {
+	// A Sunday evening, which is Monday morning in UTC+2.
+	at := time.Date(2024, time.March, 3, 23, 30, 15, 0, time.FixedZone("UTC+2", 2*60*60))
+	cases := []struct {
+		interval string
+		start    time.Time
+	}{
+		{callhome.IntervalHour, time.Date(2024, time.March, 3, 21, 0, 0, 0, time.UTC)},
+		{callhome.IntervalDay, time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{callhome.IntervalWeek, time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC)},
+		{callhome.IntervalMonth, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.interval, func(t *testing.T) {
+			assert.Equal(t, tc.start, callhome.BucketStart(at, tc.interval))
+		})
+	}
+}
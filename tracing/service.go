@@ -5,6 +5,7 @@ package tracing
 
 import (
 	"context"
+	"io"
 
 	"github.com/absmach/callhome"
 	"go.opentelemetry.io/otel/attribute"
@@ -12,10 +13,27 @@ import (
 )
 
 const (
-	retrieveOp        = "retrieve_op"
-	retrieveSummaryOp = "retrieve_summary_op"
-	saveOp            = "save_op"
-	serveUIOp         = "serve_UI_op"
+	retrieveOp                  = "retrieve_op"
+	retrieveSummaryOp           = "retrieve_summary_op"
+	saveOp                      = "save_op"
+	serveUIOp                   = "serve_UI_op"
+	retrievePoliciesOp          = "retrieve_policies_op"
+	retrieveTimeSeriesOp        = "retrieve_time_series_op"
+	retrieveVersionsOp          = "retrieve_version_analytics_op"
+	retrieveNewVersionsOp       = "retrieve_new_versions_op"
+	retrieveTransitionsOp       = "retrieve_version_transitions_op"
+	retrieveRetentionOp         = "retrieve_retention_op"
+	retrieveAggregateOp         = "retrieve_aggregate_op"
+	retrieveServicesOp          = "retrieve_service_composition_op"
+	retrieveDeploymentOp        = "retrieve_deployment_op"
+	retrieveSilentDeploymentsOp = "retrieve_silent_deployments_op"
+	createWebhookOp             = "create_webhook_op"
+	retrieveWebhooksOp          = "retrieve_webhooks_op"
+	removeWebhookOp             = "remove_webhook_op"
+	retrieveWebhookDeliveriesOp = "retrieve_webhook_deliveries_op"
+	retrieveFleetMetricsOp      = "retrieve_fleet_metrics_op"
+	exportTelemetryOp           = "export_telemetry_op"
+	retrieveMapPointsOp         = "retrieve_map_points_op"
 )
 
 var _ callhome.Service = (*telemetryServiceTracer)(nil)
@@ -41,10 +59,13 @@ func (tst *telemetryServiceTracer) Retrieve(ctx context.Context, pm callhome.Pag
 }
 
 // RetrieveSummary adds tracing middleware to RetrieveSummary.
-func (tst *telemetryServiceTracer) RetrieveSummary(ctx context.Context, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
-	ctx, span := tst.tracer.Start(ctx, retrieveSummaryOp)
+func (tst *telemetryServiceTracer) RetrieveSummary(ctx context.Context, q callhome.SummaryQuery, filters callhome.TelemetryFilters) (callhome.TelemetrySummary, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveSummaryOp, trace.WithAttributes(
+		attribute.Int("top", q.Top),
+		attribute.String("compare", q.Compare),
+	))
 	defer span.End()
-	return tst.svc.RetrieveSummary(ctx, filters)
+	return tst.svc.RetrieveSummary(ctx, q, filters)
 }
 
 // Save adds tracing middleware to Save.
@@ -64,3 +85,158 @@ func (tst *telemetryServiceTracer) ServeUI(ctx context.Context, filters callhome
 	defer span.End()
 	return tst.svc.ServeUI(ctx, filters)
 }
+
+// RetrievePolicies adds tracing middleware to RetrievePolicies.
+func (tst *telemetryServiceTracer) RetrievePolicies(ctx context.Context) (callhome.StoragePolicies, error) {
+	ctx, span := tst.tracer.Start(ctx, retrievePoliciesOp)
+	defer span.End()
+	return tst.svc.RetrievePolicies(ctx)
+}
+
+// RetrieveTimeSeries adds tracing middleware to RetrieveTimeSeries.
+func (tst *telemetryServiceTracer) RetrieveTimeSeries(ctx context.Context, q callhome.TimeSeriesQuery, filters callhome.TelemetryFilters) (callhome.TimeSeries, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveTimeSeriesOp, trace.WithAttributes(
+		attribute.String("interval", q.Interval),
+		attribute.String("split_by", q.SplitBy),
+	))
+	defer span.End()
+	return tst.svc.RetrieveTimeSeries(ctx, q, filters)
+}
+
+// RetrieveVersionAnalytics adds tracing middleware to RetrieveVersionAnalytics.
+func (tst *telemetryServiceTracer) RetrieveVersionAnalytics(ctx context.Context, filters callhome.TelemetryFilters) (callhome.VersionAnalytics, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveVersionsOp)
+	defer span.End()
+	return tst.svc.RetrieveVersionAnalytics(ctx, filters)
+}
+
+// RetrieveNewVersions adds tracing middleware to RetrieveNewVersions.
+func (tst *telemetryServiceTracer) RetrieveNewVersions(ctx context.Context, filters callhome.TelemetryFilters) ([]callhome.VersionUsage, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveNewVersionsOp)
+	defer span.End()
+	return tst.svc.RetrieveNewVersions(ctx, filters)
+}
+
+// RetrieveVersionTransitions adds tracing middleware to RetrieveVersionTransitions.
+func (tst *telemetryServiceTracer) RetrieveVersionTransitions(ctx context.Context, interval string, filters callhome.TelemetryFilters) (callhome.VersionTransitions, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveTransitionsOp, trace.WithAttributes(
+		attribute.String("interval", interval),
+	))
+	defer span.End()
+	return tst.svc.RetrieveVersionTransitions(ctx, interval, filters)
+}
+
+// RetrieveRetention adds tracing middleware to RetrieveRetention.
+func (tst *telemetryServiceTracer) RetrieveRetention(ctx context.Context, q callhome.RetentionQuery, filters callhome.TelemetryFilters) (callhome.Retention, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveRetentionOp, trace.WithAttributes(
+		attribute.String("interval", q.Interval),
+		attribute.String("inactivity_window", q.InactivityWindow.String()),
+	))
+	defer span.End()
+	return tst.svc.RetrieveRetention(ctx, q, filters)
+}
+
+// RetrieveAggregate adds tracing middleware to RetrieveAggregate.
+func (tst *telemetryServiceTracer) RetrieveAggregate(ctx context.Context, q callhome.AggregateQuery, filters callhome.TelemetryFilters) (callhome.Aggregate, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveAggregateOp, trace.WithAttributes(
+		attribute.StringSlice("group_by", q.GroupBy),
+		attribute.StringSlice("metrics", q.Metrics),
+		attribute.String("order", q.Order),
+		attribute.Int("top", q.Top),
+	))
+	defer span.End()
+	return tst.svc.RetrieveAggregate(ctx, q, filters)
+}
+
+// RetrieveServiceComposition adds tracing middleware to RetrieveServiceComposition.
+func (tst *telemetryServiceTracer) RetrieveServiceComposition(ctx context.Context, profiles int, filters callhome.TelemetryFilters) (callhome.ServiceComposition, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveServicesOp, trace.WithAttributes(
+		attribute.Int("profiles", profiles),
+	))
+	defer span.End()
+	return tst.svc.RetrieveServiceComposition(ctx, profiles, filters)
+}
+
+// RetrieveDeployment adds tracing middleware to RetrieveDeployment.
+func (tst *telemetryServiceTracer) RetrieveDeployment(ctx context.Context, id string, filters callhome.TelemetryFilters) (callhome.DeploymentDetail, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveDeploymentOp, trace.WithAttributes(
+		attribute.String("deployment_id", id),
+	))
+	defer span.End()
+	return tst.svc.RetrieveDeployment(ctx, id, filters)
+}
+
+// RetrieveSilentDeployments adds tracing middleware to RetrieveSilentDeployments.
+func (tst *telemetryServiceTracer) RetrieveSilentDeployments(ctx context.Context, q callhome.SilentQuery, filters callhome.TelemetryFilters) (callhome.SilentDeployments, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveSilentDeploymentsOp, trace.WithAttributes(
+		attribute.String("threshold", q.Threshold.String()),
+		attribute.String("lookback", q.Lookback.String()),
+	))
+	defer span.End()
+	return tst.svc.RetrieveSilentDeployments(ctx, q, filters)
+}
+
+// CreateWebhook adds tracing middleware to CreateWebhook.
+func (tst *telemetryServiceTracer) CreateWebhook(ctx context.Context, w callhome.Webhook) (callhome.Webhook, error) {
+	ctx, span := tst.tracer.Start(ctx, createWebhookOp, trace.WithAttributes(
+		attribute.StringSlice("events", w.Events),
+	))
+	defer span.End()
+	return tst.svc.CreateWebhook(ctx, w)
+}
+
+// RetrieveWebhooks adds tracing middleware to RetrieveWebhooks.
+func (tst *telemetryServiceTracer) RetrieveWebhooks(ctx context.Context) ([]callhome.Webhook, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveWebhooksOp)
+	defer span.End()
+	return tst.svc.RetrieveWebhooks(ctx)
+}
+
+// RemoveWebhook adds tracing middleware to RemoveWebhook.
+func (tst *telemetryServiceTracer) RemoveWebhook(ctx context.Context, id string) error {
+	ctx, span := tst.tracer.Start(ctx, removeWebhookOp, trace.WithAttributes(
+		attribute.String("id", id),
+	))
+	defer span.End()
+	return tst.svc.RemoveWebhook(ctx, id)
+}
+
+// RetrieveWebhookDeliveries adds tracing middleware to RetrieveWebhookDeliveries.
+func (tst *telemetryServiceTracer) RetrieveWebhookDeliveries(ctx context.Context, id string, limit int) ([]callhome.Delivery, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveWebhookDeliveriesOp, trace.WithAttributes(
+		attribute.String("id", id),
+		attribute.Int("limit", limit),
+	))
+	defer span.End()
+	return tst.svc.RetrieveWebhookDeliveries(ctx, id, limit)
+}
+
+// RetrieveFleetMetrics adds tracing middleware to RetrieveFleetMetrics.
+func (tst *telemetryServiceTracer) RetrieveFleetMetrics(ctx context.Context, q callhome.FleetQuery) (callhome.FleetMetrics, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveFleetMetricsOp, trace.WithAttributes(
+		attribute.String("window", q.Window.String()),
+		attribute.Int("top", q.Top),
+	))
+	defer span.End()
+	return tst.svc.RetrieveFleetMetrics(ctx, q)
+}
+
+// ExportTelemetry adds tracing middleware to ExportTelemetry.
+func (tst *telemetryServiceTracer) ExportTelemetry(ctx context.Context, q callhome.ExportQuery, filters callhome.TelemetryFilters, w io.Writer) error {
+	ctx, span := tst.tracer.Start(ctx, exportTelemetryOp, trace.WithAttributes(
+		attribute.String("format", q.Format),
+		attribute.String("rows", q.Rows),
+	))
+	defer span.End()
+	return tst.svc.ExportTelemetry(ctx, q, filters, w)
+}
+
+// RetrieveMapPoints adds tracing middleware to RetrieveMapPoints.
+func (tst *telemetryServiceTracer) RetrieveMapPoints(ctx context.Context, q callhome.MapQuery, filters callhome.TelemetryFilters) (callhome.MapPoints, error) {
+	ctx, span := tst.tracer.Start(ctx, retrieveMapPointsOp, trace.WithAttributes(
+		attribute.Int("zoom", q.Zoom),
+		attribute.Bool("bbox", q.BBox != nil),
+	))
+	defer span.End()
+	return tst.svc.RetrieveMapPoints(ctx, q, filters)
+}
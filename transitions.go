@@ -0,0 +1,84 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"sort"
+	"time"
+
+	"github.com/absmach/callhome/internal/semver"
+)
+
+// TransitionBucket is the number of deployments that moved between two
+// versions of a service within a single time bucket. Repositories detect
+// transitions when a heartbeat reports a different version than the previous
+// heartbeat of the same deployment and service.
+type TransitionBucket struct {
+	Time        time.Time
+	From        string
+	To          string
+	Deployments int
+}
+
+// TransitionCount is the number of deployment transitions between two versions.
+type TransitionCount struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Deployments int    `json:"deployments"`
+}
+
+// UpgradeBucket is the number of upgrades and downgrades in a single time bucket.
+type UpgradeBucket struct {
+	Time       time.Time `json:"time"`
+	Upgrades   int       `json:"upgrades"`
+	Downgrades int       `json:"downgrades"`
+}
+
+// VersionTransitions describes how deployments move between versions.
+type VersionTransitions struct {
+	Interval string
+	// Matrix counts transitions between each pair of versions, ordered by the
+	// source and then the target version, oldest first.
+	Matrix []TransitionCount
+	// Periods are ordered by time.
+	Periods []UpgradeBucket
+}
+
+// summarizeTransitions builds the transition matrix from the counts over the
+// whole range, and the upgrade counts per period from the buckets. A
+// deployment making the same transition in several periods is counted once in
+// the matrix, and once per period.
+func summarizeTransitions(interval string, counts []TransitionCount, buckets []TransitionBucket) VersionTransitions {
+	vt := VersionTransitions{Interval: interval, Matrix: counts}
+
+	periods := make(map[int64]*UpgradeBucket)
+	for _, b := range buckets {
+		p, ok := periods[b.Time.Unix()]
+		if !ok {
+			p = &UpgradeBucket{Time: b.Time}
+			periods[b.Time.Unix()] = p
+		}
+		switch c := semver.Compare(b.To, b.From); {
+		case c > 0:
+			p.Upgrades += b.Deployments
+		case c < 0:
+			p.Downgrades += b.Deployments
+		}
+	}
+
+	sort.Slice(vt.Matrix, func(i, j int) bool {
+		if c := semver.Compare(vt.Matrix[i].From, vt.Matrix[j].From); c != 0 {
+			return c < 0
+		}
+		return semver.Compare(vt.Matrix[i].To, vt.Matrix[j].To) < 0
+	})
+	for _, p := range periods {
+		vt.Periods = append(vt.Periods, *p)
+	}
+	sort.Slice(vt.Periods, func(i, j int) bool {
+		return vt.Periods[i].Time.Before(vt.Periods[j].Time)
+	})
+
+	return vt
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"sort"
+	"time"
+
+	"github.com/absmach/callhome/internal/semver"
+)
+
+// VersionUsage is a version as reported by deployments.
+type VersionUsage struct {
+	Version string
+	// Deployments is the number of deployments whose latest heartbeat reports the version.
+	Deployments int
+	// FirstSeen is the time of the first heartbeat reporting the version.
+	FirstSeen time.Time
+}
+
+// VersionStats describes the adoption of a single version.
+type VersionStats struct {
+	VersionUsage
+	// Share is the fraction of deployments running the version.
+	Share float64
+	// TimeToMajority is the time from the first appearance of a release until
+	// more than half of the deployments ran it or a newer release. It is nil
+	// if that has not happened, or if the release was already present when
+	// the analysed period began.
+	TimeToMajority *time.Duration
+}
+
+// VersionAnalytics describes version adoption across the fleet.
+type VersionAnalytics struct {
+	// Versions are ordered from the newest, with non-semantic versions last.
+	Versions         []VersionStats
+	TotalDeployments int
+	// Latest is the newest release, or the newest version if there are no releases.
+	Latest      string
+	LatestShare float64
+	// MedianTimeToMajority is the median TimeToMajority of the releases that
+	// reached a majority, or zero if none did.
+	MedianTimeToMajority time.Duration
+}
+
+// analyzeVersions builds version analytics from the version usage and from the
+// daily active deployments, both in total and split by version.
+func analyzeVersions(usage []VersionUsage, totals, byVersion []TimeSeriesBucket) VersionAnalytics {
+	var va VersionAnalytics
+	for _, u := range usage {
+		if u.Version == "" {
+			continue
+		}
+		va.Versions = append(va.Versions, VersionStats{VersionUsage: u})
+		va.TotalDeployments += u.Deployments
+	}
+	sort.SliceStable(va.Versions, func(i, j int) bool {
+		return semver.Compare(va.Versions[i].Version, va.Versions[j].Version) > 0
+	})
+
+	for i := range va.Versions {
+		if va.TotalDeployments > 0 {
+			va.Versions[i].Share = float64(va.Versions[i].Deployments) / float64(va.TotalDeployments)
+		}
+	}
+	for _, vs := range va.Versions {
+		if v, err := semver.Parse(vs.Version); err == nil && !v.IsPrerelease() {
+			va.Latest, va.LatestShare = vs.Version, vs.Share
+			break
+		}
+	}
+	if va.Latest == "" && len(va.Versions) > 0 {
+		va.Latest, va.LatestShare = va.Versions[0].Version, va.Versions[0].Share
+	}
+
+	if len(totals) == 0 {
+		return va
+	}
+	var reached []time.Duration
+	for i, vs := range va.Versions {
+		v, err := semver.Parse(vs.Version)
+		if err != nil || v.IsPrerelease() {
+			continue
+		}
+		// Releases first seen on the first day may have appeared earlier.
+		if BucketStart(vs.FirstSeen, IntervalDay).Equal(totals[0].Time) {
+			continue
+		}
+		if d, ok := timeToMajority(vs, totals, byVersion); ok {
+			va.Versions[i].TimeToMajority = &d
+			reached = append(reached, d)
+		}
+	}
+	va.MedianTimeToMajority = median(reached)
+
+	return va
+}
+
+// timeToMajority finds the first day on which more than half of the active
+// deployments ran the release or a newer one, and measures the time from the
+// first appearance of the release until the end of that day.
+func timeToMajority(vs VersionStats, totals, byVersion []TimeSeriesBucket) (time.Duration, bool) {
+	upToDate := make(map[int64]int)
+	for _, b := range byVersion {
+		if b.Group != "" && semver.Compare(b.Group, vs.Version) >= 0 {
+			upToDate[b.Time.Unix()] += b.ActiveDeployments
+		}
+	}
+	for _, b := range totals {
+		if b.Time.Before(BucketStart(vs.FirstSeen, IntervalDay)) {
+			continue
+		}
+		if 2*upToDate[b.Time.Unix()] > b.ActiveDeployments {
+			return b.Time.AddDate(0, 0, 1).Sub(vs.FirstSeen), true
+		}
+	}
+	return 0, false
+}
+
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	m := len(ds) / 2
+	if len(ds)%2 == 1 {
+		return ds[m]
+	}
+	return (ds[m-1] + ds[m]) / 2
+}
@@ -65,14 +65,17 @@ L.control
   })
   .addTo(map);
 
-var allMarkers = [];
 var markerClusterGroup = L.markerClusterGroup({
-  maxClusterRadius: 40,        
-  disableClusteringAtZoom: 10, 
-  spiderfyOnMaxZoom: true,     
-  showCoverageOnHover: false,  
-  zoomToBoundsOnClick: true    
+  maxClusterRadius: 40,
+  disableClusteringAtZoom: 10,
+  spiderfyOnMaxZoom: true,
+  showCoverageOnHover: false,
+  zoomToBoundsOnClick: true
 });
+// Clusters computed by the server at low zoom levels
+var clusterLayer = L.layerGroup();
+map.addLayer(markerClusterGroup);
+map.addLayer(clusterLayer);
 
 // Add all event listeners when DOM is ready
 document.addEventListener('DOMContentLoaded', function() {
@@ -164,81 +167,24 @@ function applyFilter(event) {
   window.location.href = window.location.pathname + '?' + params.toString();
 };
 
-function filterMarkers(filters) {
-  markerClusterGroup.clearLayers();
-
-  var filteredMarkers = allMarkers.filter(function(item) {
-    var passes = true;
-
-    if (filters.fromDate && new Date(item.data.last_seen) < filters.fromDate) {
-      passes = false;
-    }
-    if (filters.toDate && new Date(item.data.last_seen) > filters.toDate) {
-      passes = false;
-    }
-    if (filters.country && item.data.country !== filters.country) {
-      passes = false;
-    }
-    if (filters.city && item.data.city !== filters.city) {
-      passes = false;
-    }
-    if (filters.version && item.data.magistrala_version !== filters.version) {
-      passes = false;
-    }
-    if (filters.service && !item.data.services.includes(filters.service)) {
-      passes = false;
-    }
-
-    return passes;
-  });
-
-  filteredMarkers.forEach(function(item) {
-    markerClusterGroup.addLayer(item.marker);
-  });
-
-  // Fit map bounds to show all filtered markers
-  if (filteredMarkers.length > 0) {
-    const bounds = L.latLngBounds(filteredMarkers.map(item => [item.data.latitude, item.data.longitude]));
-    map.fitBounds(bounds, { padding: [50, 50] });
-  }
-
-  updateCountryTable(filteredMarkers);
-}
-
-function updateCountryTable(markers) {
-  var countryCounts = {};
-  markers.forEach(function(item) {
-    var country = item.data.country;
-    countryCounts[country] = (countryCounts[country] || 0) + 1;
-  });
-
+function updateCountryTable(countries) {
   var tableBody = document.querySelector("#country-table tbody");
   tableBody.innerHTML = "";
 
-  Object.entries(countryCounts).sort((a, b) => b[1] - a[1]).forEach(function([country, count]) {
+  countries.slice().sort((a, b) => b.number_of_deployments - a.number_of_deployments).forEach(function(item) {
     var row = document.createElement("tr");
     row.style.cursor = "pointer";
     row.innerHTML = `
-      <td>${country}</td>
-      <td><span class="badge bg-secondary">${count}</span></td>
+      <td>${item.country}</td>
+      <td><span class="badge bg-secondary">${item.number_of_deployments}</span></td>
     `;
     row.addEventListener("click", function () {
-      getCountryCoordinates(country, function (lat, lng) {
+      getCountryCoordinates(item.country, function (lat, lng) {
         map.setView([lat, lng], 6);
       });
     });
     tableBody.appendChild(row);
   });
-
-  var summaryTextElement = document.getElementById("summary-text");
-  var totalDeployments = markers.length;
-  var totalCountries = Object.keys(countryCounts).length;
-  summaryTextElement.innerHTML = `Magistrala currently has <span class="fw-semibold">${totalDeployments}</span> deployments in <span class="fw-semibold">${totalCountries}</span> countries.`;
-
-  var summaryTop = document.getElementById("summary-top");
-  if (summaryTop.style.display === "block") {
-    summaryTop.innerHTML = summaryTextElement.innerHTML;
-  }
 }
 
 // Function to retrieve coordinates for a given country using Nominatim API
@@ -265,85 +211,134 @@ function getCountryCoordinates(country, callback) {
     });
 }
 
-async function logJSONData() {
-  // Get map data from global variable injected by Go template
-  if (!window.MAP_DATA) {
-    console.error("MAP_DATA not found. Check if the Go template is rendering correctly.");
-    return;
+// Filters of the page that are applied to the map points
+const mapFilters = ["from", "to", "country", "city", "service", "version"];
+var pointsController = null;
+var fitted = false;
+
+// mapBBox gets the visible area as west,south,east,north degrees, wrapping
+// longitudes into [-180, 180], or null if the whole world is visible.
+function mapBBox() {
+  const bounds = map.getBounds();
+  if (bounds.getEast() - bounds.getWest() >= 360) {
+    return null;
   }
+  const wrap = (lng) => ((((lng + 180) % 360) + 360) % 360) - 180;
+  const south = Math.max(bounds.getSouth(), -90);
+  const north = Math.min(bounds.getNorth(), 90);
+  return [wrap(bounds.getWest()), south, wrap(bounds.getEast()), north]
+    .map((v) => v.toFixed(6))
+    .join(",");
+}
 
-  try {
-    const obj = JSON.parse(window.MAP_DATA);
-    const telemetryData = obj.Telemetry || [];
-
-    // Show spinner while loading markers
-    const spinner = document.getElementById("spinner-overlay");
-    if (spinner && telemetryData.length > 0) {
-      spinner.style.display = "flex";
-    }
-
-    // Process markers in batches to avoid blocking the UI
-    const batchSize = 100;
-    for (let i = 0; i < telemetryData.length; i += batchSize) {
-      const batch = telemetryData.slice(i, i + batchSize);
-
-      // Process batch asynchronously
-      await new Promise(resolve => {
-        requestAnimationFrame(() => {
-          batch.forEach((tel) => {
-            const last_seen = new Date(tel.last_seen);
-            const marker = L.circle([tel.latitude, tel.longitude], {
-              radius: 1000,
-            }).bindPopup(
-              `<h3>Deployment details</h3>
-                        <p style="font-size: 12px;">version:\t${
-                          tel.magistrala_version
-                        }</p>
-                        <p style="font-size: 12px;">last seen:\t${last_seen}</p>
-                        <p style="font-size: 12px;">country:\t${
-                          tel.country
-                        }</p>
-                        <p style="font-size: 12px;">city:\t${tel.city}</p>
-                        <p style="font-size: 12px;">Services:\t${tel.services.join(
-                          ", "
-                        )}</p>`
-            );
-
-            allMarkers.push({
-              marker: marker,
-              data: tel
-            });
-          });
-          resolve();
-        });
-      });
+// loadMapPoints gets the deployments in the visible area, clustered by the
+// server at low zoom levels, and replaces the markers with them.
+async function loadMapPoints() {
+  const params = new URLSearchParams();
+  mapFilters.forEach(function(key) {
+    const value = urlParams.get(key);
+    if (value) {
+      params.set(key, value);
     }
+  });
+  const bbox = mapBBox();
+  if (bbox) {
+    params.set("bbox", bbox);
+  }
+  params.set("zoom", Math.min(Math.max(Math.floor(map.getZoom()), 0), 22));
 
-    // Add all markers to the map and apply filters
-    map.addLayer(markerClusterGroup);
-    filterMarkers({});
-
-    // Fit map bounds to show all markers
-    if (allMarkers.length > 0) {
-      const bounds = L.latLngBounds(allMarkers.map(item => [item.data.latitude, item.data.longitude]));
-      map.fitBounds(bounds, { padding: [50, 50] });
-    }
+  // Only the points of the latest view are rendered
+  if (pointsController) {
+    pointsController.abort();
+  }
+  pointsController = new AbortController();
 
-    // Hide spinner
-    if (spinner) {
-      spinner.style.display = "none";
+  const spinner = document.getElementById("spinner-overlay");
+  if (spinner && !fitted) {
+    spinner.style.display = "flex";
+  }
+  try {
+    const response = await fetch("/map/points?" + params.toString(), {
+      signal: pointsController.signal,
+    });
+    if (!response.ok) {
+      throw new Error("unexpected status " + response.status);
     }
+    renderMapPoints(await response.json());
   } catch (error) {
-    console.error("Error loading map data:", error);
-    const spinner = document.getElementById("spinner-overlay");
+    if (error.name !== "AbortError") {
+      console.error("Error loading map points:", error);
+    }
+  } finally {
     if (spinner) {
       spinner.style.display = "none";
     }
   }
 }
 
+function renderMapPoints(collection) {
+  markerClusterGroup.clearLayers();
+  clusterLayer.clearLayers();
+
+  const features = collection.features || [];
+  features.forEach(function(feature) {
+    const [lng, lat] = feature.geometry.coordinates;
+    const props = feature.properties;
+    if (props.cluster) {
+      clusterLayer.addLayer(clusterMarker(lat, lng, props.count));
+    } else {
+      markerClusterGroup.addLayer(deploymentMarker(lat, lng, props));
+    }
+  });
+
+  // Fit the map to the deployments on the first load only, so panning and
+  // zooming are not overridden.
+  if (!fitted) {
+    fitted = true;
+    if (features.length > 0) {
+      const bounds = L.latLngBounds(features.map((f) => [f.geometry.coordinates[1], f.geometry.coordinates[0]]));
+      map.fitBounds(bounds, { padding: [50, 50] });
+    }
+  }
+}
 
+function clusterMarker(lat, lng, count) {
+  var size = "small";
+  if (count >= 100) {
+    size = "large";
+  } else if (count >= 10) {
+    size = "medium";
+  }
+  const marker = L.marker([lat, lng], {
+    icon: L.divIcon({
+      html: `<div><span>${count}</span></div>`,
+      className: `marker-cluster marker-cluster-${size}`,
+      iconSize: L.point(40, 40),
+    }),
+  });
+  marker.on("click", function () {
+    map.setView([lat, lng], Math.min(map.getZoom() + 2, map.getMaxZoom()));
+  });
+  return marker;
+}
 
+function deploymentMarker(lat, lng, tel) {
+  const last_seen = new Date(tel.last_seen);
+  const services = tel.services || [];
+  return L.circle([lat, lng], {
+    radius: 1000,
+  }).bindPopup(
+    `<h3>Deployment details</h3>
+              <p style="font-size: 12px;">version:\t${tel.magistrala_version}</p>
+              <p style="font-size: 12px;">last seen:\t${last_seen}</p>
+              <p style="font-size: 12px;">country:\t${tel.country}</p>
+              <p style="font-size: 12px;">city:\t${tel.city}</p>
+              <p style="font-size: 12px;">Services:\t${services.join(", ")}</p>
+              <a style="font-size: 12px;" href="/deployments/${
+                tel.deployment_id
+              }" target="_blank">Heartbeat history</a>`
+  );
+}
 
 function snapToTime(e) {
   const dt = new Date(e.target.value);
@@ -361,5 +356,8 @@ function snapToTime(e) {
     `T${pad(dt.getHours())}:${pad(dt.getMinutes())}`;
 }
 
-// Initialize map data asynchronously
-logJSONData();
+// Initialize the country table and the map points, reloading them when the
+// map is panned or zoomed
+updateCountryTable(window.COUNTRY_DATA || []);
+map.on("moveend", loadMapPoints);
+loadMapPoints();
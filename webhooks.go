@@ -0,0 +1,446 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types webhooks can subscribe to.
+const (
+	// EventNewCountry is raised when a deployment reports from a country for
+	// the first time.
+	EventNewCountry = "new_country"
+	// EventNewVersion is raised when a version is reported for the first time.
+	EventNewVersion = "new_version"
+	// EventMilestone is raised when the number of deployments passes a
+	// milestone, see Milestone.
+	EventMilestone = "milestone"
+)
+
+// Webhook delivery headers.
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the payload keyed with
+	// the webhook secret, prefixed with "sha256=".
+	SignatureHeader = "X-Callhome-Signature"
+	EventHeader     = "X-Callhome-Event"
+	DeliveryHeader  = "X-Callhome-Delivery"
+)
+
+// MaxDeliveries is the maximum number of deliveries retrieved at once.
+const MaxDeliveries = 1000
+
+var eventTypes = map[string]bool{
+	EventNewCountry: true,
+	EventNewVersion: true,
+	EventMilestone:  true,
+}
+
+var (
+	// ErrInvalidWebhook indicates a webhook without an absolute HTTP URL or
+	// with unknown events.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrWebhookNotFound indicates there is no webhook with the given ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrWebhooksDisabled indicates the service was created without webhooks.
+	ErrWebhooksDisabled = errors.New("webhooks are disabled")
+)
+
+// Webhook is a subscription to telemetry events.
+type Webhook struct {
+	ID  string
+	URL string
+	// Secret keys the payload signatures. It is generated if empty.
+	Secret string
+	// Events are the subscribed event types.
+	Events    []string
+	CreatedAt time.Time
+}
+
+// Validate checks the webhook has an absolute HTTP URL and subscribes to
+// known events.
+func (w Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhook
+	}
+	if len(w.Events) == 0 || !distinctIn(w.Events, eventTypes) {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+func (w Webhook) subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a notable telemetry event, delivered as the webhook payload.
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Country is set for new country events.
+	Country string `json:"country,omitempty"`
+	// Version is set for new version events.
+	Version string `json:"version,omitempty"`
+	// Milestone and Deployments are set for milestone events.
+	Milestone   int `json:"milestone,omitempty"`
+	Deployments int `json:"deployments,omitempty"`
+}
+
+func newEvent(typ string, now time.Time) Event {
+	return Event{ID: uuid.NewString(), Type: typ, Time: now.UTC()}
+}
+
+// Delivery is a single attempt to deliver an event to a webhook.
+type Delivery struct {
+	WebhookID string    `json:"webhook_id"`
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Attempt   int       `json:"attempt"`
+	Time      time.Time `json:"time"`
+	// StatusCode is zero if no response was received.
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Succeeded reports whether the subscriber accepted the event.
+func (d Delivery) Succeeded() bool {
+	return d.StatusCode >= http.StatusOK && d.StatusCode < http.StatusMultipleChoices
+}
+
+// WebhookRepo specifies webhook and delivery log persistence API.
+type WebhookRepo interface {
+	// SaveWebhook persists the webhook.
+	SaveWebhook(ctx context.Context, w Webhook) error
+	// RetrieveWebhook gets the webhook with the given ID, or ErrWebhookNotFound.
+	RetrieveWebhook(ctx context.Context, id string) (Webhook, error)
+	// RetrieveWebhooks gets all webhooks, oldest first.
+	RetrieveWebhooks(ctx context.Context) ([]Webhook, error)
+	// RemoveWebhook removes the webhook with the given ID along with its
+	// deliveries, or returns ErrWebhookNotFound.
+	RemoveWebhook(ctx context.Context, id string) error
+	// SaveDelivery logs the delivery attempt.
+	SaveDelivery(ctx context.Context, d Delivery) error
+	// RetrieveDeliveries gets up to limit deliveries to the webhook, the most
+	// recent first.
+	RetrieveDeliveries(ctx context.Context, webhookID string, limit int) ([]Delivery, error)
+}
+
+// WebhookConfig configures webhook deliveries and events.
+type WebhookConfig struct {
+	// Attempts is the maximum number of attempts to deliver an event.
+	Attempts int `env:"WEBHOOK_ATTEMPTS"           envDefault:"5"`
+	// Backoff is the delay before the first retry, doubled on each retry.
+	Backoff time.Duration `env:"WEBHOOK_BACKOFF"            envDefault:"1s"`
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration `env:"WEBHOOK_TIMEOUT"            envDefault:"10s"`
+	// MilestoneInterval is how often the number of deployments is checked
+	// for milestones.
+	MilestoneInterval time.Duration `env:"WEBHOOK_MILESTONE_INTERVAL" envDefault:"15m"`
+	// ShutdownTimeout bounds how long shutdown waits for pending deliveries.
+	ShutdownTimeout time.Duration `env:"WEBHOOK_SHUTDOWN_TIMEOUT"   envDefault:"10s"`
+}
+
+// Webhooks detects notable telemetry events and delivers them to the
+// subscribed webhooks. The countries and versions already reported are known
+// per process, so each replica of the service raises its own new country and
+// new version events, and subscribers may receive an event once per replica.
+type Webhooks struct {
+	repo      WebhookRepo
+	telemetry TelemetryRepo
+	client    *http.Client
+	cfg       WebhookConfig
+	wg        sync.WaitGroup
+	// ctx is the lifetime of deliveries, canceled on shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.RWMutex
+	// seeded is set once the known countries and versions are loaded.
+	seeded bool
+	// subscribed is set while any webhook exists, as of the latest check.
+	subscribed bool
+	countries  map[string]bool
+	versions   map[string]bool
+	// milestone is the last milestone passed, -1 until it is first checked.
+	milestone int
+}
+
+// NewWebhooks creates webhooks stored in the repository, raising events from
+// the telemetry repository.
+func NewWebhooks(repo WebhookRepo, telemetry TelemetryRepo, client *http.Client, cfg WebhookConfig) *Webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Webhooks{
+		repo:      repo,
+		telemetry: telemetry,
+		client:    client,
+		cfg:       cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		countries: make(map[string]bool),
+		versions:  make(map[string]bool),
+		milestone: -1,
+	}
+}
+
+// MilestoneInterval is how often milestones should be checked.
+func (wh *Webhooks) MilestoneInterval() time.Duration {
+	return wh.cfg.MilestoneInterval
+}
+
+// Wait waits for the pending deliveries.
+func (wh *Webhooks) Wait() {
+	wh.wg.Wait()
+}
+
+// Shutdown waits for the pending deliveries until ctx is done, and then
+// cancels the remaining ones and waits for them to stop. Events published
+// afterwards are not delivered.
+func (wh *Webhooks) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wh.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		wh.cancel()
+		return nil
+	case <-ctx.Done():
+		wh.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Create validates and stores the webhook, generating its ID and, if empty,
+// its secret.
+func (wh *Webhooks) Create(ctx context.Context, w Webhook) (Webhook, error) {
+	if err := w.Validate(); err != nil {
+		return Webhook{}, err
+	}
+	w.ID = uuid.NewString()
+	w.CreatedAt = time.Now().UTC()
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Webhook{}, err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	if err := wh.repo.SaveWebhook(ctx, w); err != nil {
+		return Webhook{}, err
+	}
+	wh.mu.Lock()
+	wh.subscribed = true
+	wh.mu.Unlock()
+	return w, nil
+}
+
+// Detect gets the new country and version events of a heartbeat about to be
+// saved, which are raised once it is saved, see Seen. Nothing is detected
+// before the first milestone check seeds the countries and versions already
+// reported, nor while there are no webhooks.
+func (wh *Webhooks) Detect(t Telemetry) []Event {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	if !wh.seeded || !wh.subscribed {
+		return nil
+	}
+	now := time.Now()
+	var events []Event
+	if t.Country != "" && !wh.countries[t.Country] {
+		e := newEvent(EventNewCountry, now)
+		e.Country = t.Country
+		events = append(events, e)
+	}
+	if t.Version != "" && !wh.versions[t.Version] {
+		e := newEvent(EventNewVersion, now)
+		e.Version = t.Version
+		events = append(events, e)
+	}
+	return events
+}
+
+// Seen marks the countries and versions of the detected events of a saved
+// heartbeat as seen, and returns the events other heartbeats did not raise
+// meanwhile.
+func (wh *Webhooks) Seen(events []Event) []Event {
+	if len(events) == 0 {
+		return nil
+	}
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	var ret []Event
+	for _, e := range events {
+		seen := wh.countries
+		value := e.Country
+		if e.Type == EventNewVersion {
+			seen, value = wh.versions, e.Version
+		}
+		if !seen[value] {
+			seen[value] = true
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// CheckMilestones publishes a milestone event if the number of deployments
+// passed a milestone since the previous check. The first check only records
+// the milestone already passed. Each check also seeds the countries and
+// versions already reported, which keeps restarts from raising events for
+// them, and whether there are webhooks to detect events for.
+func (wh *Webhooks) CheckMilestones(ctx context.Context) error {
+	hooks, err := wh.repo.RetrieveWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	summary, err := wh.telemetry.RetrieveSummary(ctx, TelemetryFilters{})
+	if err != nil {
+		return err
+	}
+	wh.mu.Lock()
+	for _, c := range summary.Countries {
+		wh.countries[c.Country] = true
+	}
+	for _, v := range summary.VersionCounts {
+		wh.versions[v.Value] = true
+	}
+	wh.seeded, wh.subscribed = true, len(hooks) > 0
+	prev, reached := wh.milestone, Milestone(summary.TotalDeployments)
+	if reached > prev {
+		wh.milestone = reached
+	}
+	wh.mu.Unlock()
+
+	if prev < 0 || reached <= prev {
+		return nil
+	}
+	e := newEvent(EventMilestone, time.Now())
+	e.Milestone, e.Deployments = reached, summary.TotalDeployments
+	return wh.Publish(ctx, e)
+}
+
+// Milestone gets the largest milestone of 10, 25, 50, 100, 250 and so on
+// not above the number of deployments, or zero.
+func Milestone(deployments int) int {
+	reached := 0
+	for m := 10; m <= deployments; m *= 10 {
+		for _, step := range []int{m, m * 5 / 2, m * 5} {
+			if step <= deployments {
+				reached = step
+			}
+		}
+	}
+	return reached
+}
+
+// Publish delivers the events to the subscribed webhooks in the background.
+func (wh *Webhooks) Publish(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	hooks, err := wh.repo.RetrieveWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		for _, w := range hooks {
+			if !w.subscribes(e.Type) {
+				continue
+			}
+			wh.wg.Add(1)
+			go func(w Webhook, e Event) {
+				defer wh.wg.Done()
+				// Deliveries outlive the request the event was raised by,
+				// until shutdown.
+				wh.deliver(wh.ctx, w, e, payload)
+			}(w, e)
+		}
+	}
+	return nil
+}
+
+// deliver posts the payload until the subscriber accepts it or the attempts
+// run out, logging each attempt.
+func (wh *Webhooks) deliver(ctx context.Context, w Webhook, e Event, payload []byte) {
+	backoff := wh.cfg.Backoff
+	for attempt := 1; attempt <= wh.cfg.Attempts; attempt++ {
+		d := wh.post(ctx, w, e, payload)
+		d.Attempt = attempt
+		// A failure to log a delivery must not stop the delivery itself, and
+		// attempts canceled on shutdown are logged too.
+		_ = wh.repo.SaveDelivery(context.WithoutCancel(ctx), d)
+		if d.Succeeded() || attempt == wh.cfg.Attempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (wh *Webhooks) post(ctx context.Context, w Webhook, e Event, payload []byte) Delivery {
+	d := Delivery{WebhookID: w.ID, EventID: e.ID, EventType: e.Type, Time: time.Now().UTC()}
+	ctx, cancel := context.WithTimeout(ctx, wh.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(DeliveryHeader, e.ID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, payload))
+	res, err := wh.client.Do(req)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	defer res.Body.Close()
+	d.StatusCode = res.StatusCode
+	if !d.Succeeded() {
+		d.Error = fmt.Sprintf("unexpected status %s", res.Status)
+	}
+	return d
+}
+
+// Sign gets the hex HMAC-SHA256 of the payload keyed with the secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,263 @@
+// Copyright (c) Abstract Machines
+// SPDX-License-Identifier: Apache-2.0
+
+package callhome_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/absmach/callhome"
+	"github.com/absmach/callhome/memory"
+	"github.com/absmach/callhome/mocks"
+	"github.com/ip2location/ip2location-go/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var webhookCfg = callhome.WebhookConfig{
+	Attempts:          3,
+	Backoff:           time.Millisecond,
+	Timeout:           time.Second,
+	MilestoneInterval: time.Minute,
+}
+
+// subscriber records the events it receives, after failing the given
+// number of deliveries.
+type subscriber struct {
+	mu       sync.Mutex
+	secret   string
+	failures int
+	events   []callhome.Event
+}
+
+func (s *subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get(callhome.SignatureHeader) != "sha256="+callhome.Sign(s.secret, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var e callhome.Event
+	if err := json.Unmarshal(body, &e); err != nil || r.Header.Get(callhome.EventHeader) != e.Type {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.events = append(s.events, e)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestWebhookValidate(t *testing.T) {
+	cases := []struct {
+		desc string
+		w    callhome.Webhook
+		err  error
+	}{
+		{"valid", callhome.Webhook{URL: "https://example.com/hooks", Events: []string{callhome.EventNewCountry, callhome.EventMilestone}}, nil},
+		{"relative url", callhome.Webhook{URL: "/hooks", Events: []string{callhome.EventNewCountry}}, callhome.ErrInvalidWebhook},
+		{"unsupported scheme", callhome.Webhook{URL: "ftp://example.com", Events: []string{callhome.EventNewCountry}}, callhome.ErrInvalidWebhook},
+		{"no events", callhome.Webhook{URL: "https://example.com/hooks"}, callhome.ErrInvalidWebhook},
+		{"unknown event", callhome.Webhook{URL: "https://example.com/hooks", Events: []string{"deleted"}}, callhome.ErrInvalidWebhook},
+		{"duplicate event", callhome.Webhook{URL: "https://example.com/hooks", Events: []string{callhome.EventMilestone, callhome.EventMilestone}}, callhome.ErrInvalidWebhook},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.err, c.w.Validate())
+		})
+	}
+}
+
+func TestMilestone(t *testing.T) {
+	cases := map[int]int{0: 0, 9: 0, 10: 10, 24: 10, 25: 25, 99: 50, 100: 100, 2499: 1000, 2500: 2500, 12000: 10000}
+	for deployments, milestone := range cases {
+		assert.Equal(t, milestone, callhome.Milestone(deployments), fmt.Sprintf("%d deployments", deployments))
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	ctx := context.TODO()
+	sub := &subscriber{secret: "secret", failures: 1}
+	server := httptest.NewServer(sub)
+	defer server.Close()
+
+	repo := memory.NewWebhookRepo()
+	hooks := callhome.NewWebhooks(repo, memory.New(), server.Client(), webhookCfg)
+	svc := callhome.New(memory.New(), nil, hooks)
+
+	_, err := svc.CreateWebhook(ctx, callhome.Webhook{URL: "not a url", Events: []string{callhome.EventMilestone}})
+	assert.ErrorIs(t, err, callhome.ErrInvalidWebhook)
+	w, err := svc.CreateWebhook(ctx, callhome.Webhook{URL: server.URL, Secret: "secret", Events: []string{callhome.EventMilestone}})
+	require.Nil(t, err)
+	assert.NotEmpty(t, w.ID)
+	generated, err := svc.CreateWebhook(ctx, callhome.Webhook{URL: server.URL, Events: []string{callhome.EventNewCountry}})
+	require.Nil(t, err)
+	assert.Len(t, generated.Secret, 64, "secrets are generated if empty")
+
+	e := callhome.Event{ID: "e1", Type: callhome.EventMilestone, Milestone: 100, Deployments: 104}
+	require.Nil(t, hooks.Publish(ctx, e))
+	hooks.Wait()
+	assert.Equal(t, []callhome.Event{e}, sub.events, "events are only delivered to subscribed webhooks")
+
+	ds, err := svc.RetrieveWebhookDeliveries(ctx, w.ID, 10)
+	require.Nil(t, err)
+	if assert.Len(t, ds, 2) {
+		assert.Equal(t, 2, ds[0].Attempt)
+		assert.True(t, ds[0].Succeeded())
+		assert.Equal(t, 1, ds[1].Attempt)
+		assert.Equal(t, http.StatusServiceUnavailable, ds[1].StatusCode)
+		assert.NotEmpty(t, ds[1].Error)
+	}
+
+	t.Run("attempts run out", func(t *testing.T) {
+		sub.failures = 5
+		require.Nil(t, hooks.Publish(ctx, callhome.Event{ID: "e2", Type: callhome.EventMilestone}))
+		hooks.Wait()
+		ds, err := svc.RetrieveWebhookDeliveries(ctx, w.ID, 10)
+		require.Nil(t, err)
+		assert.Len(t, ds, 2+webhookCfg.Attempts)
+	})
+	t.Run("remove", func(t *testing.T) {
+		assert.Nil(t, svc.RemoveWebhook(ctx, w.ID))
+		_, err := svc.RetrieveWebhookDeliveries(ctx, w.ID, 10)
+		assert.ErrorIs(t, err, callhome.ErrWebhookNotFound)
+		hooks, err := svc.RetrieveWebhooks(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []callhome.Webhook{generated}, hooks)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		_, err := callhome.New(memory.New(), nil, nil).RetrieveWebhooks(ctx)
+		assert.ErrorIs(t, err, callhome.ErrWebhooksDisabled)
+	})
+}
+
+func TestWebhooksShutdown(t *testing.T) {
+	ctx := context.TODO()
+	// The subscriber does not respond until the test ends.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	repo := memory.NewWebhookRepo()
+	cfg := webhookCfg
+	cfg.Timeout = time.Minute
+	hooks := callhome.NewWebhooks(repo, memory.New(), server.Client(), cfg)
+	w, err := hooks.Create(ctx, callhome.Webhook{URL: server.URL, Events: []string{callhome.EventMilestone}})
+	require.Nil(t, err)
+	require.Nil(t, hooks.Publish(ctx, callhome.Event{ID: "e1", Type: callhome.EventMilestone}))
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, hooks.Shutdown(shutdownCtx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), cfg.Timeout)
+
+	ds, err := repo.RetrieveDeliveries(ctx, w.ID, 10)
+	require.Nil(t, err)
+	if assert.Len(t, ds, 1, "canceled deliveries are not retried") {
+		assert.False(t, ds[0].Succeeded())
+		assert.NotEmpty(t, ds[0].Error)
+	}
+}
+
+func TestSaveRaisesEvents(t *testing.T) {
+	ctx := context.TODO()
+	sub := &subscriber{secret: "secret"}
+	server := httptest.NewServer(sub)
+	defer server.Close()
+
+	locMock := mocks.NewLocationService(t)
+	locMock.On("GetLocation", mock.Anything, "10.0.0.1").Return(ip2location.IP2Locationrecord{Country_long: "Serbia"}, nil)
+	locMock.On("GetLocation", mock.Anything, "10.0.0.2").Return(ip2location.IP2Locationrecord{Country_long: "France"}, nil)
+	repo := memory.New()
+	require.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: "10.0.0.1", Service: "users", Version: "0.13.0", Country: "Serbia", ServiceTime: time.Now().Add(-time.Hour)}))
+	hooks := callhome.NewWebhooks(memory.NewWebhookRepo(), repo, server.Client(), webhookCfg)
+	svc := callhome.New(repo, locMock, hooks)
+
+	// Nothing is detected before the seeding check, nor without webhooks.
+	france := callhome.Telemetry{IpAddress: "10.0.0.2", Service: "users", Country: "France"}
+	assert.Empty(t, hooks.Detect(france))
+	require.Nil(t, hooks.CheckMilestones(ctx))
+	assert.Empty(t, hooks.Detect(france))
+
+	_, err := svc.CreateWebhook(ctx, callhome.Webhook{URL: server.URL, Secret: "secret", Events: []string{callhome.EventNewCountry, callhome.EventNewVersion}})
+	require.Nil(t, err)
+	// Countries are only seen once their heartbeat is saved.
+	assert.Len(t, hooks.Detect(france), 1)
+	assert.Len(t, hooks.Detect(france), 1)
+
+	heartbeats := []callhome.Telemetry{
+		// Seen before the service started.
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.13.0", ServiceTime: time.Now()},
+		{IpAddress: "10.0.0.1", Service: "users", Version: "0.14.0", ServiceTime: time.Now()},
+		{IpAddress: "10.0.0.2", Service: "users", Version: "0.14.0", ServiceTime: time.Now()},
+		{IpAddress: "10.0.0.2", Service: "things", Version: "0.14.0", ServiceTime: time.Now()},
+	}
+	for _, hb := range heartbeats {
+		require.Nil(t, svc.Save(ctx, hb))
+	}
+	hooks.Wait()
+
+	var got []string
+	for _, e := range sub.events {
+		got = append(got, e.Type+":"+e.Country+e.Version)
+	}
+	assert.ElementsMatch(t, []string{"new_version:0.14.0", "new_country:France"}, got)
+
+	t.Run("concurrent heartbeats", func(t *testing.T) {
+		spain := callhome.Telemetry{IpAddress: "10.0.0.3", Service: "users", Country: "Spain"}
+		first, second := hooks.Detect(spain), hooks.Detect(spain)
+		assert.Len(t, hooks.Seen(first), 1)
+		assert.Empty(t, hooks.Seen(second), "events are raised once")
+	})
+}
+
+func TestCheckMilestones(t *testing.T) {
+	ctx := context.TODO()
+	sub := &subscriber{secret: "secret"}
+	server := httptest.NewServer(sub)
+	defer server.Close()
+
+	repo := memory.New()
+	deploy := func(from, to int) {
+		for i := from; i < to; i++ {
+			require.Nil(t, repo.Save(ctx, callhome.Telemetry{IpAddress: fmt.Sprintf("10.0.0.%d", i), Service: "users", Country: "Serbia", ServiceTime: time.Now()}))
+		}
+	}
+	hooks := callhome.NewWebhooks(memory.NewWebhookRepo(), repo, server.Client(), webhookCfg)
+	svc := callhome.New(repo, nil, hooks)
+	_, err := svc.CreateWebhook(ctx, callhome.Webhook{URL: server.URL, Secret: "secret", Events: []string{callhome.EventMilestone}})
+	require.Nil(t, err)
+
+	deploy(0, 12)
+	// The milestones passed before the first check are not raised.
+	require.Nil(t, hooks.CheckMilestones(ctx))
+	deploy(12, 24)
+	require.Nil(t, hooks.CheckMilestones(ctx))
+	deploy(24, 26)
+	require.Nil(t, hooks.CheckMilestones(ctx))
+	require.Nil(t, hooks.CheckMilestones(ctx))
+	hooks.Wait()
+
+	if assert.Len(t, sub.events, 1) {
+		assert.Equal(t, callhome.EventMilestone, sub.events[0].Type)
+		assert.Equal(t, 25, sub.events[0].Milestone)
+		assert.Equal(t, 26, sub.events[0].Deployments)
+	}
+}